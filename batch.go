@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// messageSender is implemented by sinks that deliver encoded messages, so
+// that batchSink can hand them whole batches. r is the reading the message
+// is routed by.
+type messageSender interface {
+	Sink
+	send(ctx context.Context, r Reading, msg Message) error
+}
+
+// headerSinks are the batchable sinks whose transport carries message
+// headers.
+var headerSinks = map[string]bool{"stomp": true}
+
+// batchSink collects readings per sensor, or per DIU with
+// batch.group-by: diu, and sends each group as a single message in the batch
+// form of the payload format once it holds batch.size readings or its first
+// reading is batch.window old. A batch is routed by its first reading, so
+// destination templates using {sensor_id} or {channel} resolve to that
+// reading when batching by DIU.
+type batchSink struct {
+	sink    messageSender
+	encoder BatchEncoder
+	size    int
+	window  time.Duration
+	byDIU   bool
+
+	mu      sync.Mutex
+	batches map[string]*pendingBatch
+}
+
+type pendingBatch struct {
+	readings []Reading
+	timer    *time.Timer
+}
+
+// withBatching wraps the named sink in a batchSink if batching is
+// configured for it.
+func withBatching(name string, sink Sink) (Sink, error) {
+	size := viper.GetInt(sinkKey(name, "batch.size"))
+	window := viper.GetDuration(sinkKey(name, "batch.window"))
+	if size <= 1 && window <= 0 {
+		return sink, nil
+	}
+
+	sender, ok := sink.(messageSender)
+	if !ok {
+		sink.Close()
+		return nil, fmt.Errorf("the %s sink does not support batching", name)
+	}
+
+	s := &batchSink{
+		sink:    sender,
+		size:    size,
+		window:  window,
+		batches: make(map[string]*pendingBatch),
+	}
+	switch groupBy := sinkSetting(name, "batch.group-by"); groupBy {
+	case "", "sensor":
+	case "diu":
+		s.byDIU = true
+	default:
+		sink.Close()
+		return nil, fmt.Errorf("unknown batch grouping %q", groupBy)
+	}
+
+	var err error
+	if s.encoder, err = newEncoder(name, headerSinks[name]); err != nil {
+		sink.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *batchSink) Publish(ctx context.Context, r Reading) error {
+	key := r.SensorID
+	if s.byDIU {
+		key = r.DIU
+	}
+
+	s.mu.Lock()
+	batch, ok := s.batches[key]
+	if !ok {
+		batch = &pendingBatch{}
+		s.batches[key] = batch
+		if s.window > 0 {
+			batch.timer = time.AfterFunc(s.window, func() { s.flushExpired(key, batch) })
+		}
+	}
+	batch.readings = append(batch.readings, r)
+	if s.size <= 0 || len(batch.readings) < s.size {
+		s.mu.Unlock()
+		return nil
+	}
+	delete(s.batches, key)
+	s.mu.Unlock()
+
+	if batch.timer != nil {
+		batch.timer.Stop()
+	}
+	return s.flush(ctx, batch.readings)
+}
+
+// flushExpired sends a batch whose window has elapsed, unless it has been
+// sent already because it filled up.
+func (s *batchSink) flushExpired(key string, batch *pendingBatch) {
+	s.mu.Lock()
+	if s.batches[key] != batch {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.batches, key)
+	s.mu.Unlock()
+
+	if err := s.flush(context.Background(), batch.readings); err != nil {
+		log.Printf("Error sending batch of %d readings: %v", len(batch.readings), err)
+	}
+}
+
+func (s *batchSink) flush(ctx context.Context, readings []Reading) error {
+	msg, err := s.encoder.EncodeBatch(readings)
+	if err != nil {
+		return err
+	}
+	return s.sink.send(ctx, readings[0], msg)
+}
+
+// Close sends the partial batches and closes the underlying sink.
+func (s *batchSink) Close() error {
+	s.mu.Lock()
+	batches := s.batches
+	s.batches = make(map[string]*pendingBatch)
+	s.mu.Unlock()
+
+	var errs []error
+	for _, batch := range batches {
+		if batch.timer != nil {
+			batch.timer.Stop()
+		}
+		if err := s.flush(context.Background(), batch.readings); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := s.sink.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// sendingSink is a messageSender that records the messages it is given.
+type sendingSink struct {
+	recordingSink
+
+	mu       sync.Mutex
+	messages []Message
+	routes   []Reading
+}
+
+func (s *sendingSink) send(ctx context.Context, r Reading, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	s.routes = append(s.routes, r)
+	return nil
+}
+
+func (s *sendingSink) sent() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func batchReading(sensor, diu string, value float64) Reading {
+	r := testReading
+	r.SensorID = sensor
+	r.Name = "pressure:" + sensor
+	r.DIU = diu
+	r.Value = value
+	return r
+}
+
+func TestBatchSinkSize(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("batch.size", 3)
+	viper.Set("payload-format", "kv")
+
+	inner := &sendingSink{}
+	sink, err := withBatching("redis", inner)
+	if err != nil {
+		t.Fatalf("Error setting up batching: %v", err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		sink.Publish(ctx, batchReading("sensor_001", "diu_000", float64(i)))
+		sink.Publish(ctx, batchReading("sensor_002", "diu_000", float64(i)))
+	}
+	sink.Publish(ctx, batchReading("sensor_001", "diu_000", 3))
+
+	sent := inner.sent()
+	if len(sent) != 2 {
+		t.Fatalf("Expected 2 full batches, got %d", len(sent))
+	}
+	want := "pressure:sensor_001=0.000000\npressure:sensor_001=1.000000\npressure:sensor_001=2.000000"
+	if string(sent[0].Body) != want {
+		t.Errorf("Expected batch %q, got %q", want, sent[0].Body)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing batch sink: %v", err)
+	}
+	if sent := inner.sent(); len(sent) != 3 || string(sent[2].Body) != "pressure:sensor_001=3.000000" {
+		t.Errorf("Expected Close to send the partial batch, got %d messages", len(sent))
+	}
+	if !inner.closed {
+		t.Errorf("Expected the underlying sink to be closed")
+	}
+}
+
+func TestBatchSinkWindowByDIU(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("redis.batch.window", 50*time.Millisecond)
+	viper.Set("batch.group-by", "diu")
+	viper.Set("payload-format", "senml-json")
+
+	inner := &sendingSink{}
+	sink, err := withBatching("redis", inner)
+	if err != nil {
+		t.Fatalf("Error setting up batching: %v", err)
+	}
+	defer sink.Close()
+
+	sink.Publish(context.Background(), batchReading("sensor_001", "diu_000", 1))
+	sink.Publish(context.Background(), batchReading("sensor_002", "diu_000", 2))
+
+	deadline := time.Now().Add(time.Second)
+	for len(inner.sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sent := inner.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected one batch after the window, got %d", len(sent))
+	}
+	if sent[0].ContentType != "application/senml+json" {
+		t.Errorf("Expected a SenML pack, got %s", sent[0].ContentType)
+	}
+	if body := string(sent[0].Body); !strings.Contains(body, "sensor_001:pressure") || !strings.Contains(body, "sensor_002:pressure") {
+		t.Errorf("Expected both sensors in the batch, got %s", body)
+	}
+}
+
+func TestBatchingDisabled(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	inner := &sendingSink{}
+	sink, err := withBatching("redis", inner)
+	if err != nil {
+		t.Fatalf("Error setting up batching: %v", err)
+	}
+	if sink != Sink(inner) {
+		t.Errorf("Expected the sink to be returned unwrapped")
+	}
+}
+
+func TestBatchingUnsupportedSink(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("batch.size", 10)
+
+	if _, err := withBatching("redis-kv", &recordingSink{}); err == nil {
+		t.Errorf("Expected an error for a sink that cannot send batches")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// batteryStep is the longest time step batteries are integrated with.
+const batteryStep = time.Second
+
+// batteryCurve is the open-circuit voltage of a lithium-ion cell against
+// its state of charge, as a fraction of the way from its empty to its full
+// voltage.
+var batteryCurve = []profilePoint{
+	{0, 0}, {0.05, 0.3}, {0.1, 0.45}, {0.2, 0.58}, {0.5, 0.7}, {0.8, 0.85}, {1, 1},
+}
+
+// battery powers the sensors of one DIU. It drains at its idle current and
+// by a fixed charge for every message the DIU's sensors publish, and is
+// recharged in the charging windows of its schedule and, when its state
+// of charge falls to recharge-at, until it is full. While it is empty the
+// DIU is off and its sensors' samples are dropped.
+type battery struct {
+	mu            sync.Mutex
+	capacity      float64 // mAh
+	charge        float64 // mAh
+	idle          float64 // mA
+	perMessage    float64 // mAh
+	chargeCurrent float64 // mA
+	rechargeAt    float64 // state of charge in %
+	emptyVoltage  float64
+	fullVoltage   float64
+	windows       []*scheduleWindow
+	start         time.Time // start of the simulation, for the schedule
+	recharging    bool
+	last          time.Time
+}
+
+var (
+	batteriesMu sync.Mutex
+	batteries   = make(map[string]*battery)
+)
+
+// batterySpecFor returns the battery configuration of a DIU:
+// dius.<diu>.battery if set, otherwise battery. It is empty when the DIU
+// is not battery powered.
+func batterySpecFor(diu string) generatorSpec {
+	if spec := viper.GetStringMap("dius." + diu + ".battery"); len(spec) > 0 {
+		return spec
+	}
+	return viper.GetStringMap("battery")
+}
+
+// batteryFor returns the battery of a DIU, creating it on first use, or nil
+// if the DIU has none. Batteries are configured with, e.g.
+//
+//	battery:
+//	  capacity: 2000          # mAh
+//	  initial: 80             # state of charge in %
+//	  idle-current: 0.2       # mA
+//	  message-charge: 0.005   # mAh per published message
+//	  charge-current: 500     # mA
+//	  recharge-at: 10         # %
+//	  schedule:               # charging windows
+//	    - {at: 12h, duration: 2h}
+//	  empty-voltage: 3.0
+//	  full-voltage: 4.2
+func batteryFor(diu string, start time.Time) (*battery, error) {
+	batteriesMu.Lock()
+	defer batteriesMu.Unlock()
+
+	if b, ok := batteries[diu]; ok {
+		return b, nil
+	}
+	spec := batterySpecFor(diu)
+	if len(spec) == 0 {
+		return nil, nil
+	}
+	b := &battery{
+		capacity:      spec.float("capacity", 2000),
+		idle:          spec.float("idle-current", 0.2),
+		perMessage:    spec.float("message-charge", 0.005),
+		chargeCurrent: spec.float("charge-current", 500),
+		rechargeAt:    spec.float("recharge-at", 0),
+		emptyVoltage:  spec.float("empty-voltage", 3.0),
+		fullVoltage:   spec.float("full-voltage", 4.2),
+		windows:       parseSchedule(spec, time.Hour),
+		start:         start,
+	}
+	initial := spec.float("initial", 100)
+	switch {
+	case b.capacity <= 0:
+		return nil, fmt.Errorf("battery of %s: capacity must be positive", diu)
+	case initial < 0 || initial > 100 || b.rechargeAt < 0 || b.rechargeAt >= 100:
+		return nil, fmt.Errorf("battery of %s: initial and recharge-at must be between 0 and 100", diu)
+	case b.idle < 0 || b.perMessage < 0 || b.chargeCurrent < 0:
+		return nil, fmt.Errorf("battery of %s: currents and charges must not be negative", diu)
+	}
+	b.charge = b.capacity * initial / 100
+	batteries[diu] = b
+	return b, nil
+}
+
+// advance brings the battery's charge up to t. The caller holds b.mu.
+func (b *battery) advance(t time.Time) {
+	if b.last.IsZero() {
+		b.last = t
+	}
+	for b.last.Before(t) {
+		dt := min(t.Sub(b.last), batteryStep)
+		charging := b.recharging
+		for _, window := range b.windows {
+			charging = charging || window.contains(b.last.Sub(b.start))
+		}
+		current := -b.idle
+		if charging {
+			current += b.chargeCurrent
+		}
+		b.charge = max(0, min(b.capacity, b.charge+current*dt.Hours()))
+		b.last = b.last.Add(dt)
+
+		if b.charge >= b.capacity {
+			b.recharging = false
+		} else if b.rechargeAt > 0 && b.soc() <= b.rechargeAt {
+			b.recharging = true
+		}
+	}
+}
+
+// soc returns the state of charge in %. The caller holds b.mu.
+func (b *battery) soc() float64 {
+	return 100 * b.charge / b.capacity
+}
+
+// transmit drains the charge of sending a message.
+func (b *battery) transmit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.charge = max(0, b.charge-b.perMessage)
+}
+
+// read returns the battery's state of charge in % and its voltage at t.
+func (b *battery) read(t time.Time) (soc, voltage float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(t)
+	soc = b.soc()
+	return soc, b.emptyVoltage + (b.fullVoltage-b.emptyVoltage)*interpolateCurve(batteryCurve, soc/100)
+}
+
+// interpolateCurve interpolates linearly between points sorted by pos,
+// holding the values of the first and last points beyond them.
+func interpolateCurve(points []profilePoint, pos float64) float64 {
+	if pos <= points[0].pos {
+		return points[0].value
+	}
+	for i := 1; i < len(points); i++ {
+		if pos <= points[i].pos {
+			prev, next := points[i-1], points[i]
+			return prev.value + (next.value-prev.value)*(pos-prev.pos)/(next.pos-prev.pos)
+		}
+	}
+	return points[len(points)-1].value
+}
+
+// newBatteryGenerator reads the battery of the sensor's DIU: its state of
+// charge in %, or with output voltage its voltage.
+func newBatteryGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	b, err := batteryFor(sensor.DIU, sensor.Start)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, fmt.Errorf("battery generator for %s: %s has no battery", sensor.ID, sensor.DIU)
+	}
+	output := spec.str("output", "soc")
+	if output != "soc" && output != "voltage" {
+		return nil, fmt.Errorf("battery generator for %s: unknown output %q", sensor.ID, output)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		soc, voltage := b.read(t)
+		if output == "voltage" {
+			return voltage
+		}
+		return soc
+	}), nil
+}
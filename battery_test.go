@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func resetBatteries(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := batteries
+	batteries = make(map[string]*battery)
+	t.Cleanup(func() { batteries = saved })
+}
+
+func TestBatteryDrainAndRecharge(t *testing.T) {
+	resetBatteries(t)
+	viper.Set("battery", map[string]any{
+		"capacity":       100,
+		"idle-current":   50,
+		"message-charge": 0.1,
+		"charge-current": 150,
+		"recharge-at":    20,
+	})
+	viper.Set("dius.diu_001.battery", map[string]any{
+		"capacity":       100,
+		"initial":        50,
+		"idle-current":   50,
+		"charge-current": 150,
+		"schedule":       []any{map[string]any{"at": "1h", "duration": "30m"}},
+	})
+	viper.Set("channels.battery.generator", map[string]any{"type": "battery"})
+	viper.Set("channels.voltage.generator", map[string]any{"type": "battery", "output": "voltage"})
+
+	soc, err := newValueGenerator(testSensor(1, "battery"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	voltage, err := newValueGenerator(testSensor(2, "voltage"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	b := batteries["diu_000"]
+
+	if got := soc.Next(testStart); got != 100 {
+		t.Errorf("Expected a full battery, got %f%%", got)
+	}
+	if got := voltage.Next(testStart); got != 4.2 {
+		t.Errorf("Expected the full voltage, got %fV", got)
+	}
+	for i := 0; i < 100; i++ {
+		b.transmit()
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{time.Hour, 40}, // 10 mAh of messages and 50 mAh idle
+		// Recharging from 20% at 1h24m, at 100 mA net, until full.
+		{90 * time.Minute, 30},
+		{2*time.Hour + 12*time.Minute, 100},
+		{2*time.Hour + 36*time.Minute, 80},
+	} {
+		// Charging starts and stops on the integration steps.
+		if got := soc.Next(testStart.Add(tt.at)); math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("At %v: expected %f%%, got %f%%", tt.at, tt.want, got)
+		}
+	}
+
+	// Charging in the window of the schedule.
+	sensor := testSensor(3, "voltage")
+	sensor.DIU = "diu_001"
+	if voltage, err = newValueGenerator(sensor); err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{0, 3.84}, // 50% is 70% of the way from the empty to the full voltage
+		{time.Hour, 3},
+		{90 * time.Minute, 3.84},
+	} {
+		if got := voltage.Next(testStart.Add(tt.at)); math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("At %v: expected %fV, got %fV", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestEmptyBatteryDropsSamples(t *testing.T) {
+	resetBatteries(t)
+	viper.Set("battery", map[string]any{"initial": 0.01, "capacity": 1, "message-charge": 0.001})
+	viper.Set("sensors-per-diu", 2)
+
+	s, err := newSimulatedSensor(0)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if s.sample(testStart, 1); s.info.Notes.Drop {
+		t.Errorf("Expected a sample while the battery has charge")
+	}
+	if s.sample(testStart.Add(time.Minute), 2); !s.info.Notes.Drop {
+		t.Errorf("Expected samples to be dropped once the battery is empty")
+	}
+	other, err := newSimulatedSensor(2)
+	if err != nil || other.battery == s.battery {
+		t.Errorf("Expected each DIU to have its own battery")
+	}
+
+	for _, spec := range []map[string]any{
+		{"capacity": 0},
+		{"initial": 120},
+		{"recharge-at": 100},
+		{"idle-current": -1},
+	} {
+		batteries = make(map[string]*battery)
+		viper.Set("battery", spec)
+		if _, err := newSimulatedSensor(0); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// discardSink encodes readings with the configured payload format and
+// discards them, so benchmarks measure the simulator rather than a
+// server.
+type discardSink struct {
+	encoder payloadCodec
+	bytes   atomic.Int64
+}
+
+func newDiscardSink() (*discardSink, error) {
+	encoder, err := newEncoder("", false)
+	if err != nil {
+		return nil, err
+	}
+	return &discardSink{encoder: encoder}, nil
+}
+
+func (d *discardSink) Publish(ctx context.Context, r Reading) error {
+	msg, err := d.encoder.Encode(r)
+	if err != nil {
+		return err
+	}
+	d.bytes.Add(int64(len(msg.Body)))
+	return nil
+}
+
+func (d *discardSink) Close() error { return nil }
+
+// report writes the size of the encoded readings over elapsed.
+func (d *discardSink) report(w io.Writer, readings int64, elapsed time.Duration) {
+	bytes := d.bytes.Load()
+	fmt.Fprintf(w, "Encoded %d bytes as %s: %.1f bytes/reading, %.3f MB/s\n",
+		bytes, payloadFormat(""), float64(bytes)/float64(max(readings, 1)), float64(bytes)/elapsed.Seconds()/1e6)
+}
+
+// errLimitReached is returned for the readings published to a countingSink
+// after its limit.
+var errLimitReached = errors.New("message limit reached")
+
+// countingSink counts the readings published to a sink, in total and by
+// channel, and the sensors they came from. With a limit, it publishes only
+// that many readings, refusing the rest with errLimitReached, and closes
+// full once they are published. Registry announcements and anomaly label
+// copies are passed on without being counted.
+type countingSink struct {
+	Sink
+	limit    int64
+	full     chan struct{}
+	sent     atomic.Int64 // readings offered, including those over the limit
+	readings atomic.Int64
+	errors   atomic.Int64
+	sensors  sync.Map // sensor ID -> struct{}
+	channels sync.Map // channel -> *channelTally
+}
+
+// channelTally counts the readings published to a channel and those that
+// failed to publish.
+type channelTally struct {
+	readings, errors atomic.Int64
+}
+
+// channelCount is a snapshot of a channelTally.
+type channelCount struct {
+	readings, errors int64
+}
+
+func newCountingSink(sink Sink, limit int64) *countingSink {
+	return &countingSink{Sink: sink, limit: limit, full: make(chan struct{})}
+}
+
+func (c *countingSink) Publish(ctx context.Context, r Reading) error {
+	if r.auxiliary {
+		return c.Sink.Publish(ctx, r)
+	}
+	n := c.sent.Add(1)
+	if c.limit > 0 && n > c.limit {
+		return errLimitReached
+	}
+	if _, ok := c.sensors.Load(r.SensorID); !ok {
+		c.sensors.Store(r.SensorID, struct{}{})
+	}
+	tally, ok := c.channels.Load(r.Channel)
+	if !ok {
+		tally, _ = c.channels.LoadOrStore(r.Channel, &channelTally{})
+	}
+	err := c.Sink.Publish(ctx, r)
+	if err != nil {
+		c.errors.Add(1)
+		tally.(*channelTally).errors.Add(1)
+	} else {
+		c.readings.Add(1)
+		tally.(*channelTally).readings.Add(1)
+	}
+	if n == c.limit {
+		close(c.full)
+	}
+	return err
+}
+
+// byChannel returns the counts of the readings published to each channel.
+func (c *countingSink) byChannel() map[string]channelCount {
+	counts := make(map[string]channelCount)
+	c.channels.Range(func(channel, tally any) bool {
+		t := tally.(*channelTally)
+		counts[channel.(string)] = channelCount{readings: t.readings.Load(), errors: t.errors.Load()}
+		return true
+	})
+	return counts
+}
+
+// report writes the throughput over elapsed.
+func (c *countingSink) report(w io.Writer, elapsed time.Duration) {
+	sensors := 0
+	c.sensors.Range(func(any, any) bool {
+		sensors++
+		return true
+	})
+	readings := c.readings.Load()
+	fmt.Fprintf(w, "Published %d readings from %d sensors in %s: %.1f readings/s\n",
+		readings, sensors, elapsed.Round(time.Millisecond), float64(readings)/elapsed.Seconds())
+	if failed := c.errors.Load(); failed > 0 {
+		fmt.Fprintf(w, "%d readings failed to publish\n", failed)
+	}
+}
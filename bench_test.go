@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestCountingSink(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	discard, err := newDiscardSink()
+	if err != nil {
+		t.Fatalf("Error creating sink: %v", err)
+	}
+	counter := newCountingSink(discard, 0)
+	for _, id := range []string{"sensor_000", "sensor_001", "sensor_000"} {
+		if err := counter.Publish(context.Background(), Reading{SensorData: SensorData{SensorID: id, Channel: "temperature", Value: 20}}); err != nil {
+			t.Fatalf("Error publishing: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	counter.report(&out, 2*time.Second)
+	discard.report(&out, counter.readings.Load(), 2*time.Second)
+	for _, want := range []string{"Published 3 readings from 2 sensors in 2s: 1.5 readings/s", "as json"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the report, got:\n%s", want, out.String())
+		}
+	}
+	if discard.bytes.Load() == 0 {
+		t.Errorf("Expected the readings encoded")
+	}
+}
+
+func TestCountingSinkLimit(t *testing.T) {
+	sink := &recordingSink{}
+	counter := newCountingSink(sink, 3)
+	for i := 0; i < 5; i++ {
+		err := counter.Publish(context.Background(), Reading{SensorData: SensorData{SensorID: "sensor_000"}})
+		if want := i >= 3; errors.Is(err, errLimitReached) != want {
+			t.Errorf("Reading %d: expected the limit reached %v, got %v", i, want, err)
+		}
+	}
+	// Announcements pass the limit without counting as readings.
+	if err := counter.Publish(context.Background(), Reading{SensorData: SensorData{SensorID: "sensor_000"}, auxiliary: true}); err != nil {
+		t.Errorf("Error publishing an announcement: %v", err)
+	}
+	if n := sink.count(); n != 4 || counter.readings.Load() != 3 {
+		t.Errorf("Expected 3 readings and an announcement published, got %d messages and %d readings", n, counter.readings.Load())
+	}
+	select {
+	case <-counter.full:
+	default:
+		t.Errorf("Expected the counter full")
+	}
+}
+
+func TestSimulateMaxMessages(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	viper.Set("max-messages", 10)
+	viper.Set("duration", time.Minute)
+
+	sink := &recordingSink{}
+	start := time.Now()
+	counter := simulate(sink, 5, 100, 100, false, false)
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("Expected the simulation stopped at max-messages, ran for %s", elapsed)
+	}
+	if n := sink.count(); n != 10 || counter.readings.Load() != 10 {
+		t.Errorf("Expected 10 readings published, got %d", n)
+	}
+	if !sink.closed {
+		t.Errorf("Expected the sink closed")
+	}
+}
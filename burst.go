@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// burstComponent is a sine wave in the signal of a burst generator.
+type burstComponent struct {
+	frequency, amplitude, phase float64
+}
+
+// newBurstGenerator takes snapshots of a vibration-like waveform: every
+// sample carries length points of the signal sampled at sample-rate Hz,
+// e.g.
+//
+//	type: burst
+//	length: 1024
+//	sample-rate: 10240
+//	components:
+//	  - {frequency: 50, amplitude: 1}
+//	  - {frequency: 120, amplitude: 0.3, phase: 90}
+//	noise: 0.05
+//	output: fft
+//
+// The signal is the sum of the components plus gaussian noise with a
+// standard deviation of noise. With output samples (the default) the
+// points are published as they are; with output fft they are replaced by
+// the amplitudes of the length/2 frequency bins, which needs a length
+// that is a power of two. The sensor's value is the RMS of the signal.
+// Bursts are taken at the sensor's publish rate.
+func newBurstGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	length := int(spec.float("length", 1024))
+	sampleRate := spec.float("sample-rate", 10240)
+	noise := spec.float("noise", 0)
+	if length < 1 || sampleRate <= 0 || noise < 0 {
+		return nil, fmt.Errorf("burst generator for %s: length and sample-rate must be positive and noise must not be negative", sensor.ID)
+	}
+	output := spec.str("output", "samples")
+	switch output {
+	case "samples":
+	case "fft":
+		if length&(length-1) != 0 {
+			return nil, fmt.Errorf("burst generator for %s: fft output needs a length that is a power of two", sensor.ID)
+		}
+	default:
+		return nil, fmt.Errorf("burst generator for %s: unknown output %q", sensor.ID, output)
+	}
+
+	var components []burstComponent
+	for _, item := range cast.ToSlice(spec["components"]) {
+		c := generatorSpec(cast.ToStringMap(item))
+		components = append(components, burstComponent{
+			frequency: c.float("frequency", 0),
+			amplitude: c.float("amplitude", 1),
+			phase:     c.float("phase", 0) * math.Pi / 180,
+		})
+	}
+	if len(components) == 0 && noise == 0 {
+		return nil, fmt.Errorf("burst generator for %s: components or noise must be set", sensor.ID)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		start := t.Sub(sensor.Start).Seconds()
+		samples := make([]float64, length)
+		var sum float64
+		for i := range samples {
+			at := start + float64(i)/sampleRate
+			var v float64
+			for _, c := range components {
+				v += c.amplitude * math.Sin(2*math.Pi*c.frequency*at+c.phase)
+			}
+			v += sensor.Rand.NormFloat64() * noise
+			samples[i] = v
+			sum += v * v
+		}
+		if output == "fft" {
+			samples = spectrum(samples)
+		}
+		sensor.Notes.Samples = samples
+		return math.Sqrt(sum / float64(length))
+	}), nil
+}
+
+// spectrum returns the amplitudes of the first len(samples)/2 frequency
+// bins of samples, whose length must be a power of two. Bin k is at
+// k*sample-rate/len(samples) Hz.
+func spectrum(samples []float64) []float64 {
+	n := len(samples)
+	x := make([]complex128, n)
+	// Load the samples in bit-reversed order for an in-place radix-2 FFT.
+	bits := 0
+	for 1<<bits < n {
+		bits++
+	}
+	for i, v := range samples {
+		j := 0
+		for b := 0; b < bits; b++ {
+			j |= (i >> b & 1) << (bits - 1 - b)
+		}
+		x[j] = complex(v, 0)
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], wk*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				wk *= w
+			}
+		}
+	}
+
+	bins := make([]float64, max(n/2, 1))
+	for k := range bins {
+		scale := 2.0
+		if k == 0 {
+			scale = 1
+		}
+		bins[k] = scale * cmplx.Abs(x[k]) / float64(n)
+	}
+	return bins
+}
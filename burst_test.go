@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestBurstGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.vibration.generator", map[string]any{
+		"type":        "burst",
+		"length":      256,
+		"sample-rate": 1024,
+		"components":  []any{map[string]any{"frequency": 64, "amplitude": 2}},
+	})
+
+	sensor := testSensor(1, "vibration")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	if rms := generator.Next(testStart); !approxEqual(rms, 2/math.Sqrt2) {
+		t.Errorf("Expected an RMS of %g, got %g", 2/math.Sqrt2, rms)
+	}
+	if samples := sensor.Notes.Samples; len(samples) != 256 || !approxEqual(samples[4], 2) {
+		t.Errorf("Expected 256 samples peaking at 2 after a quarter period, got %d: %v", len(samples), samples[:8])
+	}
+}
+
+func TestBurstSpectrum(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.vibration.generator", map[string]any{
+		"type":        "burst",
+		"length":      512,
+		"sample-rate": 1024,
+		"output":      "fft",
+		"components": []any{
+			map[string]any{"frequency": 50, "amplitude": 1},
+			map[string]any{"frequency": 120, "amplitude": 0.25, "phase": 90},
+		},
+	})
+
+	sensor := testSensor(1, "vibration")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	generator.Next(testStart)
+	bins := sensor.Notes.Samples
+	if len(bins) != 256 {
+		t.Fatalf("Expected 256 bins, got %d", len(bins))
+	}
+	// Bins are 2 Hz wide.
+	for k, bin := range bins {
+		want := 0.0
+		switch k {
+		case 25:
+			want = 1
+		case 60:
+			want = 0.25
+		}
+		if math.Abs(bin-want) > 1e-9 {
+			t.Errorf("Expected bin %d to be %g, got %g", k, want, bin)
+		}
+	}
+}
+
+func TestBurstGeneratorErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	specs := []map[string]any{
+		{"type": "burst"},
+		{"type": "burst", "noise": 1, "length": 0},
+		{"type": "burst", "noise": 1, "output": "fft", "length": 1000},
+		{"type": "burst", "noise": 1, "output": "wavelet"},
+	}
+	for _, spec := range specs {
+		viper.Set("channels.vibration.generator", spec)
+		if _, err := newValueGenerator(testSensor(1, "vibration")); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+}
+
+func TestBurstSamplesInReadings(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channel-names", []string{"vibration"})
+	viper.Set("channels.vibration.generator", map[string]any{"type": "burst", "length": 4, "noise": 1})
+	viper.Set("channels.vibration.unit", "m/s2")
+
+	s, err := newSimulatedSensor(0)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	r := s.sample(testStart, 1)
+	if len(r.Samples) != 4 {
+		t.Fatalf("Expected 4 samples in the reading, got %v", r.Samples)
+	}
+	body, _ := json.Marshal(r.SensorData)
+	if !strings.Contains(string(body), `"samples":[`) {
+		t.Errorf("Expected the samples in the JSON payload, got %s", body)
+	}
+	if msg := toSensorReading(r); len(msg.Samples) != 4 || msg.Samples[0] != r.Samples[0] {
+		t.Errorf("Expected the samples in the protobuf payload, got %v", msg.Samples)
+	}
+}
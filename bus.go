@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// timedValue is a sample of a sensor.
+type timedValue struct {
+	t time.Time
+	v float64
+}
+
+// signalBus lets sensors follow each other's values. Every sensor registers
+// itself; sensors that another sensor watches also record their samples,
+// keeping as much history as the longest lag they are watched with.
+type signalBus struct {
+	mu      sync.RWMutex
+	sensors map[string]sensorInfo
+	watched map[string]time.Duration
+	history map[string][]timedValue
+}
+
+// signals is the bus shared by all simulated sensors.
+var signals = newSignalBus()
+
+func newSignalBus() *signalBus {
+	return &signalBus{
+		sensors: make(map[string]sensorInfo),
+		watched: make(map[string]time.Duration),
+		history: make(map[string][]timedValue),
+	}
+}
+
+func (b *signalBus) register(sensor sensorInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sensors[sensor.ID] = sensor
+}
+
+// resolve finds the sensor a source parameter refers to: a sensor ID, or a
+// channel name meaning the first sensor of that channel on the DIU of the
+// sensor asking.
+func (b *signalBus) resolve(source string, from sensorInfo) (string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, ok := b.sensors[source]; ok {
+		return source, true
+	}
+	var candidates []sensorInfo
+	for _, sensor := range b.sensors {
+		if sensor.Channel == source && sensor.DIU == from.DIU && sensor.ID != from.ID {
+			candidates = append(candidates, sensor)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Index < candidates[j].Index })
+	return candidates[0].ID, true
+}
+
+// watch starts recording the samples of a sensor, keeping at least
+// retention of history.
+func (b *signalBus) watch(id string, retention time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if retention >= b.watched[id] {
+		b.watched[id] = retention
+	}
+}
+
+// record stores a sample of a sensor if the sensor is watched.
+func (b *signalBus) record(id string, t time.Time, v float64) {
+	b.mu.RLock()
+	retention, ok := b.watched[id]
+	b.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	history := append(b.history[id], timedValue{t, v})
+	// Keep one sample older than the retention so that lookups at the
+	// oldest lag still find the value in effect.
+	cutoff := t.Add(-retention)
+	drop := sort.Search(len(history), func(i int) bool { return !history[i].t.Before(cutoff) }) - 1
+	if drop > 0 {
+		history = append(history[:0], history[drop:]...)
+	}
+	b.history[id] = history
+}
+
+// valueAt returns the value a sensor had at time t: its latest sample at or
+// before t.
+func (b *signalBus) valueAt(id string, t time.Time) (float64, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	history := b.history[id]
+	i := sort.Search(len(history), func(i int) bool { return history[i].t.After(t) })
+	if i == 0 {
+		return 0, false
+	}
+	return history[i-1].v, true
+}
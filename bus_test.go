@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestSignalBusHistory(t *testing.T) {
+	bus := newSignalBus()
+	bus.record("sensor_000", testStart, 1) // not watched yet
+	if _, ok := bus.valueAt("sensor_000", testStart); ok {
+		t.Errorf("Expected unwatched sensors not to be recorded")
+	}
+
+	bus.watch("sensor_000", 10*time.Second)
+	for i := 0; i < 60; i++ {
+		bus.record("sensor_000", testStart.Add(time.Duration(i)*time.Second), float64(i))
+	}
+	if v, ok := bus.valueAt("sensor_000", testStart.Add(50500*time.Millisecond)); !ok || v != 50 {
+		t.Errorf("Expected the value in effect at 50.5s to be 50, got %f (%v)", v, ok)
+	}
+	if n := len(bus.history["sensor_000"]); n > 12 {
+		t.Errorf("Expected history to be trimmed to the retention, got %d samples", n)
+	}
+}
+
+func TestFollowGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+
+	source := testSensor(0, "temperature")
+	source.ID = "sensor_000"
+	signals.register(source)
+
+	viper.Set("channels.pressure.generator", map[string]any{
+		"type":   "follow",
+		"source": "temperature",
+		"gain":   0.01,
+		"offset": 0.8,
+		"lag":    "5s",
+	})
+	follower := testSensor(1, "pressure")
+	signals.register(follower)
+	generator, err := newValueGenerator(follower)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+
+	// The first call resolves the source, which has no history yet.
+	if got := generator.Next(testStart); !approxEqual(got, 0.8) {
+		t.Errorf("Expected the offset before the source has values, got %f", got)
+	}
+	for i := 0; i <= 15; i++ {
+		signals.record("sensor_000", testStart.Add(time.Duration(i)*time.Second), 20+float64(i))
+	}
+	// At 15s the follower sees the temperature of 10s: 30.
+	if got := generator.Next(testStart.Add(15 * time.Second)); !approxEqual(got, 1.1) {
+		t.Errorf("Expected 0.8 + 0.01 * 30, got %f", got)
+	}
+}
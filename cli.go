@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// newRootCommand returns the command line of the simulator: a subcommand
+// per mode, all sharing the flags that select the config file. The
+// commands that simulate or publish readings add the flags of the
+// simulation settings. Without a subcommand it runs the simulation, as run
+// does.
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:          "diu_sim",
+		Short:        "Simulate the sensors of data interface units (DIUs) publishing readings",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	addConfigFlags(root.PersistentFlags())
+
+	run := newRunCommand()
+	root.PreRun = run.PreRun
+	root.Run = run.Run
+	root.Flags().AddFlagSet(run.Flags())
+	root.AddCommand(run, newValidateCommand(), newRecordCommand(), newReplayCommand(), newBenchCommand(), newInitCommand(), newSchemaCommand(), newFaultCommand())
+	return root
+}
+
+// loadCommandConfig loads the config of a command, after making the values
+// of its flags the defaults of their settings.
+func loadCommandConfig(cmd *cobra.Command, args []string) {
+	setFlagDefaults(cmd.Flags())
+	loadConfig()
+}
+
+func newRunCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "run",
+		PreRun: loadCommandConfig,
+		Short:  "Run the simulation, publishing readings to the sinks until interrupted or a limit is reached",
+		Args:   cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			numSensors, minRate, maxRate := setupSimulation()
+			sink, err := setupSinks()
+			if err != nil {
+				log.Fatalf("Error setting up sinks: %v", err)
+			}
+			simulate(sink, numSensors, minRate, maxRate, viper.GetBool("watch-config"), viper.GetBool("tui"))
+		},
+	}
+	addSettingFlags(cmd.Flags())
+	cmd.Flags().Bool("watch-config", false, "Watch the config file and apply changes to sensors, rates and sinks while running")
+	cmd.Flags().Bool("tui", false, "Show the simulation in an interactive terminal UI, with keys to pause it, trigger faults and change rates")
+	addLimitFlags(cmd.Flags(), 0)
+	return cmd
+}
+
+// addLimitFlags adds the flags of the duration and max-messages settings,
+// which stop a simulation, with the default duration of the command.
+func addLimitFlags(fs *pflag.FlagSet, duration time.Duration) {
+	fs.Duration("duration", duration, "How long to run, e.g. 30m, after which the simulator drains and exits (0: until interrupted)")
+	fs.Int64("max-messages", 0, "Number of readings to publish, after which the simulator drains and exits (0: no limit)")
+}
+
+func newValidateCommand() *cobra.Command {
+	var ping, strict bool
+	var format string
+	cmd := &cobra.Command{
+		Use:    "validate",
+		PreRun: loadCommandConfig,
+		Short:  "Check the config, scenario and sinks and report problems, exiting non-zero on errors",
+		Args:   cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if format != "text" && format != "json" {
+				log.Fatalf("Error: unknown format %q (want text or json)", format)
+			}
+			os.Exit(runValidate(os.Stdout, bulkSensorCount(), viper.GetFloat64("min-rate"), viper.GetFloat64("max-rate"), ping, strict, format == "json"))
+		},
+	}
+	addSettingFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&ping, "ping", false, "Also connect to the sinks and ping Redis")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Treat warnings, such as unknown keys, as errors")
+	cmd.Flags().StringVar(&format, "format", "text", "Report format: text, or json for tools")
+	return cmd
+}
+
+func newSchemaCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Write the JSON Schema of the config file, for editors and other tools",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := writeConfigSchema(os.Stdout); err != nil {
+				log.Fatalf("Error writing schema: %v", err)
+			}
+		},
+	}
+}
+
+func newRecordCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:    "record",
+		PreRun: loadCommandConfig,
+		Short:  "Run the simulation, writing the readings to a CSV recording instead of the sinks",
+		Args:   cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			numSensors, minRate, maxRate := setupSimulation()
+			recorder, err := newCSVRecorder(output)
+			if err != nil {
+				log.Fatalf("Error creating recording: %v", err)
+			}
+			simulate(recorder, numSensors, minRate, maxRate, false, false)
+		},
+	}
+	addSettingFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&output, "output", "o", "recording.csv", "File to write the recording to")
+	addLimitFlags(cmd.Flags(), 0)
+	return cmd
+}
+
+func newReplayCommand() *cobra.Command {
+	var speed float64
+	var loop, originalTimestamps bool
+	cmd := &cobra.Command{
+		Use:    "replay <recording.csv>",
+		PreRun: loadCommandConfig,
+		Short:  "Publish the readings of a recording to the sinks at their recorded times",
+		Args:   cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if speed <= 0 {
+				log.Fatalf("Error: speed must be greater than 0")
+			}
+			sink, err := setupSinks()
+			if err != nil {
+				log.Fatalf("Error setting up sinks: %v", err)
+			}
+			defer sink.Close()
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+			if err := replayRecording(ctx, sink, args[0], speed, loop, originalTimestamps); err != nil {
+				log.Fatalf("Error replaying %s: %v", args[0], err)
+			}
+		},
+	}
+	addSettingFlags(cmd.Flags())
+	cmd.Flags().Float64Var(&speed, "speed", 1, "Replay speed, e.g. 10 to replay ten times faster than recorded")
+	cmd.Flags().BoolVar(&loop, "loop", false, "Start over at the end of the recording")
+	cmd.Flags().BoolVar(&originalTimestamps, "original-timestamps", false, "Publish the recorded timestamps rather than the times of replay")
+	return cmd
+}
+
+func newBenchCommand() *cobra.Command {
+	var publish bool
+	cmd := &cobra.Command{
+		Use:    "bench",
+		PreRun: loadCommandConfig,
+		Short:  "Run the simulation for a while and report its throughput",
+		Long: "Run the simulation for a while and report its throughput. The readings are encoded\n" +
+			"with the configured payload format and discarded, unless --publish is given.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			numSensors, minRate, maxRate := setupSimulation()
+			if publish {
+				sink, err := setupSinks()
+				if err != nil {
+					log.Fatalf("Error setting up sinks: %v", err)
+				}
+				simulate(sink, numSensors, minRate, maxRate, false, false)
+				return
+			}
+			discard, err := newDiscardSink()
+			if err != nil {
+				log.Fatalf("Error setting up sinks: %v", err)
+			}
+			start := time.Now()
+			counter := simulate(discard, numSensors, minRate, maxRate, false, false)
+			discard.report(os.Stdout, counter.readings.Load(), time.Since(start))
+		},
+	}
+	addSettingFlags(cmd.Flags())
+	addLimitFlags(cmd.Flags(), 10*time.Second)
+	cmd.Flags().BoolVar(&publish, "publish", false, "Publish to the configured sinks rather than discarding the readings")
+	return cmd
+}
+
+func newInitCommand() *cobra.Command {
+	var dir string
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Write a commented example config.yaml and scenario.yaml to start from",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runInit(dir, force); err != nil {
+				log.Fatalf("Error writing example config: %v", err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&dir, "dir", ".", "Directory to write config.yaml and scenario.yaml to")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing files")
+	return cmd
+}
+
+func newFaultCommand() *cobra.Command {
+	var duration time.Duration
+	cmd := &cobra.Command{
+		Use:    "fault <kind> <sensor>...",
+		PreRun: loadCommandConfig,
+		Short:  "Trigger a fault on sensors of a running simulation through its control API",
+		Long: "Trigger a fault on sensors of a running simulation through its control API, which\n" +
+			"--control-addr (or control.addr in the config) gives. The kinds of faults are\n" +
+			strings.Join(runtimeFaults, ", ") + ".",
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			addr := viper.GetString("control.addr")
+			if addr == "" {
+				log.Fatalf("Error: no control API to connect to (set --control-addr)")
+			}
+			baseURL, err := controlURL(addr)
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			client := &http.Client{Timeout: 10 * time.Second}
+			failed := false
+			for _, id := range args[1:] {
+				status, err := requestFault(client, baseURL, id, args[0], duration)
+				if err != nil {
+					log.Printf("Error triggering a %s fault on sensor %s: %v", args[0], id, err)
+					failed = true
+					continue
+				}
+				fmt.Printf("%s: %s fault for %s (active faults: %s)\n", status.ID, args[0], duration, strings.Join(status.Faults, ", "))
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().String("control-addr", "", "Address of the simulator's control API, e.g. :8090 (default: control.addr of the config)")
+	cmd.Flags().DurationVar(&duration, "for", 30*time.Second, "How long the fault lasts")
+	return cmd
+}
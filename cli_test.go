@@ -0,0 +1,43 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRootCommand(t *testing.T) {
+	root := newRootCommand()
+	var names []string
+	for _, cmd := range root.Commands() {
+		names = append(names, cmd.Name())
+	}
+	for _, want := range []string{"bench", "fault", "init", "record", "replay", "run", "validate"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("Expected a %s subcommand, got %v", want, names)
+		}
+	}
+
+	// The commands that simulate or publish take the settings flags, the
+	// others only their own flags and those selecting the config.
+	for _, args := range [][]string{{"validate", "--num-sensors", "5", "--strict"}, {"record", "--sinks", "sse", "-o", "out.csv"}} {
+		cmd, rest, err := root.Find(args)
+		if err != nil {
+			t.Fatalf("Error finding %s: %v", args[0], err)
+		}
+		if err := cmd.ParseFlags(rest); err != nil {
+			t.Errorf("Error parsing %v: %v", args, err)
+		}
+	}
+	for _, args := range [][]string{{"init", "--strict"}, {"init", "--redis-addr", "localhost:6380"}, {"schema", "--sinks", "sse"}, {"fault", "--num-sensors", "5"}} {
+		cmd, rest, _ := root.Find(args)
+		if err := cmd.ParseFlags(rest); err == nil {
+			t.Errorf("Expected %s rejected by %s", args[1], args[0])
+		}
+	}
+	for _, args := range [][]string{{"init", "--config", "sim.yaml"}, {"fault", "--control-addr", ":8090", "--for", "1m"}} {
+		cmd, rest, _ := root.Find(args)
+		if err := cmd.ParseFlags(rest); err != nil {
+			t.Errorf("Error parsing %v: %v", args, err)
+		}
+	}
+}
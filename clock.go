@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// diuClock is the clock of a DIU, which stamps its sensors' readings. It
+// is off from true time by an offset and gains drift seconds per second
+// on it. With an NTP-style sync interval it is corrected every interval,
+// back to true time up to a random residual error, and drifts off again.
+type diuClock struct {
+	mu        sync.Mutex
+	offset    time.Duration // offset at start and after each sync
+	drift     float64       // seconds gained per second
+	interval  time.Duration // between syncs, 0 for none
+	syncError time.Duration // largest residual offset after a sync
+	start     time.Time
+	rand      *rand.Rand
+	epoch     int64 // syncs done so far
+}
+
+var (
+	diuClocksMu sync.Mutex
+	diuClocks   = make(map[string]*diuClock)
+)
+
+// clockFor returns the clock of a DIU, creating it on first use, or nil if
+// it keeps true time. Clocks are configured with dius.<diu>.clock or
+// clock, e.g.
+//
+//	clock:
+//	  offset: [-2s, 2s]       # at start
+//	  drift: [-50, 50]        # ppm
+//	  sync-interval: 10m
+//	  sync-error: 20ms
+//
+// where [min, max] pairs give each DIU its own offset or drift within
+// the range.
+func clockFor(diu string, start time.Time) (*diuClock, error) {
+	diuClocksMu.Lock()
+	defer diuClocksMu.Unlock()
+
+	if c, ok := diuClocks[diu]; ok {
+		return c, nil
+	}
+	spec := generatorSpec(viper.GetStringMap("dius." + diu + ".clock"))
+	if len(spec) == 0 {
+		spec = viper.GetStringMap("clock")
+	}
+	if len(spec) == 0 {
+		return nil, nil
+	}
+
+	r := sensorRand(0, "clock/"+diu)
+	c := &diuClock{
+		interval:  spec.duration("sync-interval", 0),
+		syncError: spec.duration("sync-error", 0),
+		start:     start,
+		rand:      r,
+	}
+	var err error
+	if c.offset, err = durationParam(spec, "offset", r); err != nil {
+		return nil, fmt.Errorf("clock of %s: %w", diu, err)
+	}
+	ppm, err := calibrationParam(spec, "drift", 0, r)
+	if err != nil {
+		return nil, fmt.Errorf("clock of %s: %w", diu, err)
+	}
+	c.drift = ppm / 1e6
+	if c.interval < 0 || c.syncError < 0 {
+		return nil, fmt.Errorf("clock of %s: sync-interval and sync-error must not be negative", diu)
+	}
+	diuClocks[diu] = c
+	return c, nil
+}
+
+// durationParam returns a duration parameter: the duration it is set to,
+// or one drawn from r within the [min, max] pair it is set to.
+func durationParam(spec generatorSpec, key string, r *rand.Rand) (time.Duration, error) {
+	if !isRange(spec[key]) {
+		return spec.duration(key, 0), nil
+	}
+	bounds := cast.ToSlice(spec[key])
+	if len(bounds) != 2 {
+		return 0, fmt.Errorf("%s must be a duration or a [min, max] pair", key)
+	}
+	min, max := cast.ToDuration(bounds[0]), cast.ToDuration(bounds[1])
+	if min > max {
+		return 0, fmt.Errorf("%s min %v is greater than max %v", key, min, max)
+	}
+	return min + time.Duration(r.Float64()*float64(max-min)), nil
+}
+
+// at returns the time the clock shows at true time t.
+func (c *diuClock) at(t time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	since := t.Sub(c.start)
+	if c.interval > 0 && since > 0 {
+		// Sync to true time at the start of each interval, leaving a
+		// residual error.
+		if epoch := int64(since / c.interval); epoch > c.epoch {
+			c.epoch = epoch
+			c.offset = time.Duration((2*c.rand.Float64() - 1) * float64(c.syncError))
+		}
+		since -= time.Duration(c.epoch) * c.interval
+	}
+	return t.Add(c.offset + time.Duration(c.drift*float64(since)))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func resetClocks(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := diuClocks
+	diuClocks = make(map[string]*diuClock)
+	t.Cleanup(func() { diuClocks = saved })
+}
+
+func TestDIUClockDrift(t *testing.T) {
+	resetClocks(t)
+	viper.Set("clock", map[string]any{"offset": "2s", "drift": 100})
+	viper.Set("dius.diu_001.clock", map[string]any{"offset": "-1s", "drift": -50, "sync-interval": "10m"})
+
+	c, err := clockFor("diu_000", testStart)
+	if err != nil {
+		t.Fatalf("Error creating clock: %v", err)
+	}
+	for _, tt := range []struct {
+		at, want time.Duration
+	}{
+		{0, 2 * time.Second},
+		{time.Hour, 2*time.Second + 360*time.Millisecond},
+		{24 * time.Hour, 2*time.Second + 8640*time.Millisecond},
+	} {
+		if got := c.at(testStart.Add(tt.at)).Sub(testStart.Add(tt.at)); got != tt.want {
+			t.Errorf("After %v: expected the clock %v off, got %v", tt.at, tt.want, got)
+		}
+	}
+	if other, _ := clockFor("diu_000", testStart); other != c {
+		t.Errorf("Expected sensors of a DIU to share its clock")
+	}
+
+	// Synced to true time every 10 minutes, without residual error.
+	c, err = clockFor("diu_001", testStart)
+	if err != nil {
+		t.Fatalf("Error creating clock: %v", err)
+	}
+	for _, tt := range []struct {
+		at, want time.Duration
+	}{
+		{5 * time.Minute, -time.Second - 15*time.Millisecond},
+		{10 * time.Minute, 0},
+		{15 * time.Minute, -15 * time.Millisecond},
+		{25 * time.Minute, -15 * time.Millisecond},
+	} {
+		if got := c.at(testStart.Add(tt.at)).Sub(testStart.Add(tt.at)); got != tt.want {
+			t.Errorf("After %v: expected the clock %v off, got %v", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestDIUClockRanges(t *testing.T) {
+	resetClocks(t)
+	viper.Set("seed", 1)
+	viper.Set("clock", map[string]any{
+		"offset":        []any{"-2s", "2s"},
+		"drift":         []any{-50, 50},
+		"sync-interval": "1m",
+		"sync-error":    "20ms",
+	})
+
+	c, err := clockFor("diu_000", testStart)
+	if err != nil {
+		t.Fatalf("Error creating clock: %v", err)
+	}
+	if c.offset < -2*time.Second || c.offset > 2*time.Second || c.drift < -50e-6 || c.drift > 50e-6 {
+		t.Errorf("Expected an offset within 2s and a drift within 50ppm, got %v and %g", c.offset, c.drift)
+	}
+	for at := time.Minute; at < time.Hour; at += time.Minute {
+		// Just after a sync, only the residual error is left.
+		if got := c.at(testStart.Add(at)).Sub(testStart.Add(at)); got < -20*time.Millisecond || got > 20*time.Millisecond {
+			t.Fatalf("After %v: expected the clock within 20ms after a sync, got %v", at, got)
+		}
+	}
+
+	for _, spec := range []map[string]any{
+		{"offset": []any{"2s", "-2s"}},
+		{"drift": []any{1, 2, 3}},
+		{"sync-interval": "-1m"},
+	} {
+		resetClocks(t)
+		viper.Set("clock", spec)
+		if _, err := clockFor("diu_000", testStart); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+}
+
+func TestSkewedTimestamps(t *testing.T) {
+	resetClocks(t)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	constantGenerator("temperature", 20)
+	viper.Set("dius.diu_000.clock", map[string]any{"offset": "1s"})
+	viper.Set("jitter", map[string]any{"offset": "250ms"})
+
+	info := testSensor(1, "temperature")
+	generator, err := newValueGenerator(info)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	s, err := newSensor(info, generator)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	want := testStart.Add(1250 * time.Millisecond).Format(time.RFC3339Nano)
+	if r := s.sample(testStart, 1); r.Timestamp != want {
+		t.Errorf("Expected timestamp %s, got %s", want, r.Timestamp)
+	}
+}
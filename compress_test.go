@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/viper"
+)
+
+func TestCompressionCodecs(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("payload-format", "kv")
+	want := "pressure:sensor_001=1.050000"
+
+	decompress := map[string]func([]byte) ([]byte, error){
+		"gzip": func(b []byte) ([]byte, error) {
+			r, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(r)
+		},
+		"zstd": func(b []byte) ([]byte, error) {
+			d, _ := zstd.NewReader(nil)
+			defer d.Close()
+			return d.DecodeAll(b, nil)
+		},
+		"snappy": func(b []byte) ([]byte, error) {
+			return snappy.Decode(nil, b)
+		},
+	}
+
+	for name, decode := range decompress {
+		viper.Set("compression", name)
+		encoder, err := newEncoder("redis", false)
+		if err != nil {
+			t.Fatalf("Error creating %s encoder: %v", name, err)
+		}
+		msg, err := encoder.Encode(testReading)
+		if err != nil {
+			t.Fatalf("Error encoding with %s: %v", name, err)
+		}
+		body, err := decode(msg.Body)
+		if err != nil || string(body) != want {
+			t.Errorf("%s: expected %q after decompression, got %q (%v)", name, want, body, err)
+		}
+	}
+}
+
+func TestCompressionMarkers(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("payload-format", "kv")
+	viper.Set("compression", "snappy")
+
+	viper.Set("compression-marker", "header")
+	encoder, _ := newEncoder("stomp", true)
+	msg, _ := encoder.Encode(testReading)
+	if msg.Headers["content-encoding"] != "snappy" {
+		t.Errorf("Expected a content-encoding header, got %v", msg.Headers)
+	}
+
+	viper.Set("compression-marker", "flag")
+	encoder, _ = newEncoder("redis", false)
+	msg, _ = encoder.Encode(testReading)
+	if msg.Body[0] != codecSnappy {
+		t.Errorf("Expected the snappy flag byte, got %d", msg.Body[0])
+	}
+
+	// Uncompressed payloads are flagged too when a sink opts out.
+	viper.Set("redis.compression", "none")
+	encoder, _ = newEncoder("redis", false)
+	msg, _ = encoder.Encode(testReading)
+	if msg.Body[0] != codecNone || string(msg.Body[1:]) != "pressure:sensor_001=1.050000" {
+		t.Errorf("Expected a flagged uncompressed payload, got %q", msg.Body)
+	}
+}
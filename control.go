@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// controlServer serves the HTTP API that controls a running simulation,
+// under /api/v1:
+//
+//	GET    /stats                list the simulation's state and throughput
+//	POST   /pause                pause all sensors
+//	POST   /resume               resume them
+//	PUT    /rates                set the global rates, e.g. {"min-rate": 1, "max-rate": 4}
+//	GET    /sensors              list the running sensors
+//	POST   /sensors              add a sensor, e.g. {"id": "pump_temp", "channel": "temperature", "rate": 2}
+//	DELETE /sensors/{id}         remove a sensor
+//	PUT    /sensors/{id}/rates   set a sensor's rates, e.g. {"rate": 2}
+//	POST   /sensors/{id}/faults  trigger a fault, e.g. {"fault": "stuck", "duration": "30s"}
+//	POST   /sensors/pause        pause sensors, e.g. {"id": "plant_a/pump/*"} or {"channel": "pressure"}
+//	POST   /sensors/resume       resume them
+//	GET    /faults               list the kinds of faults that can be triggered
+//
+// Sensors are added with the settings of a sensors.<id> entry, and rates
+// are set with its rate, or min-rate and max-rate, settings. The API is
+// also served without the /api/v1 prefix, as it was before it was
+// versioned. The web dashboard (see dashboardHandler) is served on
+// /dashboard/, which / redirects to.
+type controlServer struct {
+	sim    *simulation
+	server *http.Server
+	addr   net.Addr
+}
+
+func startControlServer(addr string, sim *simulation) (*controlServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("starting control server: %w", err)
+	}
+	c := &controlServer{sim: sim, addr: listener.Addr()}
+	c.server = &http.Server{Handler: c.handler()}
+	go func() {
+		if err := c.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Control server error: %v", err)
+		}
+	}()
+	log.Printf("Serving the control API on http://%s/api/v1 and the dashboard on http://%s/dashboard/", listener.Addr(), listener.Addr())
+	return c, nil
+}
+
+func (c *controlServer) Close() error {
+	return c.server.Close()
+}
+
+func (c *controlServer) handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /stats", c.handleStats)
+	api.HandleFunc("POST /pause", c.handlePause(true))
+	api.HandleFunc("POST /resume", c.handlePause(false))
+	api.HandleFunc("PUT /rates", c.handleSetRates)
+	api.HandleFunc("GET /sensors", c.handleListSensors)
+	api.HandleFunc("POST /sensors", c.handleAddSensor)
+	api.HandleFunc("DELETE /sensors/{id}", c.handleRemoveSensor)
+	api.HandleFunc("PUT /sensors/{id}/rates", c.handleSetSensorRates)
+	api.HandleFunc("POST /sensors/{id}/faults", c.handleTriggerFault)
+	api.HandleFunc("POST /sensors/pause", c.handlePauseSensors(true))
+	api.HandleFunc("POST /sensors/resume", c.handlePauseSensors(false))
+	api.HandleFunc("GET /faults", c.handleListFaults)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/", http.StripPrefix("/api/v1", api))
+	mux.Handle("/", api)
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", dashboardHandler()))
+	mux.Handle("GET /{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+	return mux
+}
+
+// sensorStatus describes a running sensor in API responses.
+type sensorStatus struct {
+	ID      string   `json:"id"`
+	Channel string   `json:"channel"`
+	DIU     string   `json:"diu"`
+	Site    string   `json:"site,omitempty"`
+	MinRate float64  `json:"min_rate"`
+	MaxRate float64  `json:"max_rate"`
+	Paused  bool     `json:"paused"`
+	Faults  []string `json:"faults,omitempty"` // active faults
+
+	Last *SensorData `json:"last,omitempty"` // last reading published
+}
+
+func newSensorStatus(s *simulatedSensor) sensorStatus {
+	minRate, maxRate := s.currentRates()
+	return sensorStatus{
+		ID:      s.info.ID,
+		Channel: s.info.Channel,
+		DIU:     s.info.DIU,
+		Site:    s.info.Site,
+		MinRate: minRate,
+		MaxRate: maxRate,
+		Paused:  s.paused.Load(),
+		Faults:  s.info.Faults.activeKinds(time.Now()),
+		Last:    s.last.Load(),
+	}
+}
+
+// rateRequest sets publish rates in API requests: a fixed rate, or a range
+// from min-rate to max-rate, which is a fixed rate if only one is set.
+type rateRequest struct {
+	Rate    float64 `json:"rate"`
+	MinRate float64 `json:"min-rate"`
+	MaxRate float64 `json:"max-rate"`
+}
+
+// bounds returns the rate range the request sets.
+func (r rateRequest) bounds() (float64, float64, error) {
+	minRate, maxRate := r.MinRate, r.MaxRate
+	switch {
+	case r.Rate != 0:
+		minRate, maxRate = r.Rate, r.Rate
+	case minRate == 0:
+		minRate = maxRate
+	case maxRate == 0:
+		maxRate = minRate
+	}
+	if minRate <= 0 || maxRate <= 0 {
+		return 0, 0, errors.New("rates must be greater than 0")
+	}
+	if minRate > maxRate {
+		return 0, 0, errors.New("min-rate cannot be greater than max-rate")
+	}
+	return minRate, maxRate, nil
+}
+
+// decodeRates reads the rate range a request sets, answering it with an
+// error if it is invalid.
+func decodeRates(w http.ResponseWriter, r *http.Request) (float64, float64, bool) {
+	var req rateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid rates: %v", err), http.StatusBadRequest)
+		return 0, 0, false
+	}
+	minRate, maxRate, err := req.bounds()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return minRate, maxRate, true
+}
+
+func (c *controlServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.sim.stats())
+}
+
+func (c *controlServer) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.sim.setPaused(paused)
+		writeJSON(w, http.StatusOK, c.sim.stats())
+	}
+}
+
+func (c *controlServer) handleSetRates(w http.ResponseWriter, r *http.Request) {
+	minRate, maxRate, ok := decodeRates(w, r)
+	if !ok {
+		return
+	}
+	c.sim.setRates(minRate, maxRate)
+	writeJSON(w, http.StatusOK, c.sim.stats())
+}
+
+func (c *controlServer) handleListSensors(w http.ResponseWriter, r *http.Request) {
+	sensors := c.sim.runningSensors()
+	statuses := make([]sensorStatus, len(sensors))
+	for i, s := range sensors {
+		statuses[i] = newSensorStatus(s)
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (c *controlServer) handleAddSensor(w http.ResponseWriter, r *http.Request) {
+	var spec map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		http.Error(w, fmt.Sprintf("invalid sensor: %v", err), http.StatusBadRequest)
+		return
+	}
+	id := cast.ToString(spec["id"])
+	delete(spec, "id")
+	sensor, err := c.sim.addSensor(id, spec)
+	switch {
+	case errors.Is(err, errSensorExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeJSON(w, http.StatusCreated, newSensorStatus(sensor))
+	}
+}
+
+func (c *controlServer) handleRemoveSensor(w http.ResponseWriter, r *http.Request) {
+	err := c.sim.removeSensor(r.PathValue("id"))
+	switch {
+	case errors.Is(err, errSensorNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (c *controlServer) handleSetSensorRates(w http.ResponseWriter, r *http.Request) {
+	minRate, maxRate, ok := decodeRates(w, r)
+	if !ok {
+		return
+	}
+	sensor, err := c.sim.setSensorRates(r.PathValue("id"), minRate, maxRate)
+	writeSensorResult(w, sensor, err)
+}
+
+func (c *controlServer) handleTriggerFault(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Fault    string `json:"fault"`
+		Duration string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid fault: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Fault == "" {
+		req.Fault = "stuck"
+	}
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid fault duration: %v", err), http.StatusBadRequest)
+		return
+	}
+	sensor, err := c.sim.triggerFault(r.PathValue("id"), req.Fault, d)
+	writeSensorResult(w, sensor, err)
+}
+
+func (c *controlServer) handlePauseSensors(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sel sensorSelector
+		if err := json.NewDecoder(r.Body).Decode(&sel); err != nil {
+			http.Error(w, fmt.Sprintf("invalid selection: %v", err), http.StatusBadRequest)
+			return
+		}
+		sensors, err := c.sim.pauseSensors(sel, paused)
+		switch {
+		case errors.Is(err, errSensorNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			statuses := make([]sensorStatus, len(sensors))
+			for i, s := range sensors {
+				statuses[i] = newSensorStatus(s)
+			}
+			writeJSON(w, http.StatusOK, statuses)
+		}
+	}
+}
+
+func (c *controlServer) handleListFaults(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, runtimeFaults)
+}
+
+// writeSensorResult answers a request that changed a sensor with its
+// status, or with the error that kept it from changing.
+func writeSensorResult(w http.ResponseWriter, sensor *simulatedSensor, err error) {
+	switch {
+	case errors.Is(err, errSensorNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeJSON(w, http.StatusOK, newSensorStatus(sensor))
+	}
+}
+
+// controlURL returns the base URL of the control API served on addr, as
+// the control.addr setting gives it, reaching a server listening on all
+// interfaces on localhost.
+func controlURL(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid control address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/api/v1", nil
+}
+
+// requestFault triggers a fault on a sensor of the simulation whose control
+// API is at baseURL, returning the sensor's status.
+func requestFault(client *http.Client, baseURL, id, kind string, d time.Duration) (sensorStatus, error) {
+	body, err := json.Marshal(map[string]string{"fault": kind, "duration": d.String()})
+	if err != nil {
+		return sensorStatus{}, err
+	}
+	resp, err := client.Post(baseURL+"/sensors/"+url.PathEscape(id)+"/faults", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return sensorStatus{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return sensorStatus{}, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var status sensorStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return sensorStatus{}, fmt.Errorf("invalid response: %w", err)
+	}
+	return status, nil
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
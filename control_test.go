@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestControlSensors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("sinks: recording\nsensors:\n  inlet_temp: {channel: temperature}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Error reading config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sim, err := startSensorSimulations(ctx, &recordingSink{}, 2, 1, 1)
+	if err != nil {
+		cancel()
+		t.Fatalf("Error starting simulation: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.wg.Wait()
+	})
+	server := httptest.NewServer((&controlServer{sim: sim}).handler())
+	t.Cleanup(server.Close)
+
+	request := func(method, path, body string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error calling %s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := request("POST", "/sensors", `{"id": "Pump_Temp", "channel": "temperature", "rate": 2, "metadata": {"room": "basement"}}`); code != http.StatusCreated {
+		t.Errorf("Expected the sensor added, got status %d", code)
+	}
+	if code := request("POST", "/sensors", `{"id": "pump_temp", "channel": "temperature"}`); code != http.StatusConflict {
+		t.Errorf("Expected a sensor added twice to conflict, got status %d", code)
+	}
+	if code := request("POST", "/sensors", `{"id": "no_channel"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected a sensor without a channel rejected, got status %d", code)
+	}
+	if code := request("POST", "/sensors", `{"id": "bad_generator", "channel": "temperature", "generator": {"type": "nope"}}`); code != http.StatusBadRequest {
+		t.Errorf("Expected a misconfigured sensor rejected, got status %d", code)
+	}
+	if viper.IsSet("sensors.bad_generator") {
+		t.Errorf("Expected the config of a rejected sensor removed")
+	}
+	if code := request("DELETE", "/sensors/sensor_001", ""); code != http.StatusNoContent {
+		t.Errorf("Expected the sensor removed, got status %d", code)
+	}
+	if code := request("DELETE", "/sensors/sensor_001", ""); code != http.StatusNotFound {
+		t.Errorf("Expected removing a stopped sensor to fail, got status %d", code)
+	}
+
+	resp, err := http.Get(server.URL + "/sensors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []sensorStatus
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Error decoding sensors: %v", err)
+	}
+	resp.Body.Close()
+	var ids []string
+	for _, s := range statuses {
+		ids = append(ids, s.ID)
+	}
+	if want := []string{"inlet_temp", "pump_temp", "sensor_000"}; !slices.Equal(ids, want) {
+		t.Errorf("Expected sensors %v, got %v", want, ids)
+	}
+	if sim.sensors["pump_temp"].metadata["room"] != "basement" {
+		t.Errorf("Expected the added sensor configured from the request")
+	}
+
+	// A reload keeps the added sensor and the removed one stopped.
+	sim.reload()
+	if ids := runningSensorIDs(sim); !slices.Equal(ids, []string{"inlet_temp", "pump_temp", "sensor_000"}) {
+		t.Errorf("Expected the runtime changes kept on reload, got %v", ids)
+	}
+	if low, high := sim.sensors["pump_temp"].rateRange(testStart, 1, 1); low != 2 || high != 2 {
+		t.Errorf("Expected the added sensor's rate kept on reload, got %g to %g Hz", low, high)
+	}
+}
+
+func TestControlAPI(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("sinks: recording\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Error reading config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := &recordingSink{}
+	sim, err := startSensorSimulations(ctx, sink, 2, 50, 50)
+	if err != nil {
+		cancel()
+		t.Fatalf("Error starting simulation: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.wg.Wait()
+	})
+	server := httptest.NewServer((&controlServer{sim: sim}).handler())
+	t.Cleanup(server.Close)
+
+	request := func(method, path, body string, v any) int {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+"/api/v1"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error calling %s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if v != nil && resp.StatusCode < 300 {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("Error decoding %s %s: %v", method, path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var stats simulationStats
+	if code := request("POST", "/pause", "", &stats); code != http.StatusOK || !stats.Paused {
+		t.Errorf("Expected the simulation paused, got status %d and %+v", code, stats)
+	}
+	time.Sleep(50 * time.Millisecond)
+	paused := sink.count()
+	time.Sleep(150 * time.Millisecond)
+	if n := sink.count(); n != paused {
+		t.Errorf("Expected no readings while paused, got %d", n-paused)
+	}
+	if code := request("POST", "/resume", "", &stats); code != http.StatusOK || stats.Paused {
+		t.Errorf("Expected the simulation resumed, got status %d and %+v", code, stats)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if sink.count() == paused {
+		t.Errorf("Expected readings once resumed")
+	}
+
+	if code := request("PUT", "/rates", `{"min-rate": 2, "max-rate": 3}`, &stats); code != http.StatusOK || stats.MinRate != 2 || stats.MaxRate != 3 {
+		t.Errorf("Expected the global rates set, got status %d and %+v", code, stats)
+	}
+	if code := request("PUT", "/rates", `{"min-rate": 3, "max-rate": 1}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected inverted rates rejected, got status %d", code)
+	}
+	var status sensorStatus
+	if code := request("PUT", "/sensors/sensor_001/rates", `{"rate": 5}`, &status); code != http.StatusOK || status.MinRate != 5 || status.MaxRate != 5 {
+		t.Errorf("Expected the sensor's rate set, got status %d and %+v", code, status)
+	}
+	if code := request("PUT", "/sensors/nope/rates", `{"rate": 5}`, nil); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown sensor not found, got status %d", code)
+	}
+	if low, high := sim.sensors["sensor_000"].currentRates(); low != 2 || high != 3 {
+		t.Errorf("Expected the global rates on sensor_000, got %g to %g Hz", low, high)
+	}
+
+	if code := request("POST", "/sensors/sensor_000/faults", `{"fault": "stuck", "duration": "1m"}`, &status); code != http.StatusOK || !slices.Equal(status.Faults, []string{"stuck"}) {
+		t.Errorf("Expected a stuck fault triggered, got status %d and %+v", code, status)
+	}
+	if code := request("POST", "/sensors/sensor_000/faults", `{"fault": "melted", "duration": "1m"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown fault rejected, got status %d", code)
+	}
+	if code := request("POST", "/sensors/sensor_000/faults", `{"fault": "stuck"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected a fault without a duration rejected, got status %d", code)
+	}
+
+	// The fault command triggers faults through the API.
+	status, err = requestFault(http.DefaultClient, server.URL+"/api/v1", "sensor_000", "spike", time.Minute)
+	if err != nil || !slices.Equal(status.Faults, []string{"spike", "stuck"}) {
+		t.Errorf("Expected a spike fault triggered, got %+v, %v", status, err)
+	}
+	if _, err := requestFault(http.DefaultClient, server.URL+"/api/v1", "nope", "spike", time.Minute); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected an unknown sensor not found, got %v", err)
+	}
+
+	var statuses []sensorStatus
+	if code := request("POST", "/sensors/pause", `{"id": "sensor_00*"}`, &statuses); code != http.StatusOK || len(statuses) != 2 || !statuses[1].Paused {
+		t.Errorf("Expected the sensors matching the pattern paused, got status %d and %+v", code, statuses)
+	}
+	channel := sim.sensors["sensor_001"].info.Channel
+	if code := request("POST", "/sensors/resume", `{"channel": "`+channel+`"}`, &statuses); code != http.StatusOK || len(statuses) != 1 || statuses[0].ID != "sensor_001" || statuses[0].Paused {
+		t.Errorf("Expected the sensor of channel %s resumed, got status %d and %+v", channel, code, statuses)
+	}
+	if !sim.sensors["sensor_000"].isPaused() || sim.sensors["sensor_001"].isPaused() {
+		t.Errorf("Expected only sensor_000 paused")
+	}
+	for body, want := range map[string]int{
+		`{}`:                  http.StatusBadRequest,
+		`{"id": "["}`:         http.StatusBadRequest,
+		`{"channel": "flow"}`: http.StatusNotFound,
+	} {
+		if code := request("POST", "/sensors/pause", body, nil); code != want {
+			t.Errorf("Pausing %s: expected status %d, got %d", body, want, code)
+		}
+	}
+
+	// A reload keeps the rates set at runtime.
+	sim.reload()
+	if low, high := sim.sensors["sensor_001"].currentRates(); low != 5 || high != 5 {
+		t.Errorf("Expected the sensor's rate kept on reload, got %g to %g Hz", low, high)
+	}
+	if code := request("GET", "/stats", "", &stats); code != http.StatusOK || stats.Sensors != 2 || stats.Readings == 0 {
+		t.Errorf("Expected the stats of 2 sensors, got status %d and %+v", code, stats)
+	}
+	if code := request("GET", "/sensors", "", &statuses); code != http.StatusOK || len(statuses) != 2 || statuses[0].Last == nil {
+		t.Errorf("Expected the sensors with their last readings, got status %d and %+v", code, statuses)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	server := httptest.NewServer((&controlServer{}).handler())
+	t.Cleanup(server.Close)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if location := resp.Header.Get("Location"); resp.StatusCode != http.StatusFound || location != "/dashboard/" {
+		t.Errorf("Expected / redirected to the dashboard, got status %d to %q", resp.StatusCode, location)
+	}
+
+	for path, want := range map[string]string{
+		"/dashboard/":              `<script src="dashboard.js">`,
+		"/dashboard/dashboard.js":  `call("GET", "/faults")`,
+		"/dashboard/dashboard.css": "table {",
+		"/api/v1/faults":           `["stuck","dropout","spike","nan"]`,
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("%s: expected %q, got status %d and\n%s", path, want, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestControlURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		":8090":          "http://localhost:8090/api/v1",
+		"0.0.0.0:8090":   "http://localhost:8090/api/v1",
+		"[::]:8090":      "http://localhost:8090/api/v1",
+		"10.0.0.5:8090":  "http://10.0.0.5:8090/api/v1",
+		"sim.example:80": "http://sim.example:80/api/v1",
+	} {
+		if got, err := controlURL(addr); err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s, %v", addr, want, got, err)
+		}
+	}
+	if _, err := controlURL("8090"); err == nil {
+		t.Errorf("Expected an address without a port rejected")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"rgehrsitz/diu_sim/diusimpb"
+)
+
+// grpcControlServer serves the Control service of control.proto, the same
+// control surface as the HTTP API (see controlServer), with WatchStats
+// streaming the simulation's stats.
+type grpcControlServer struct {
+	diusimpb.UnimplementedControlServer
+	sim    *simulation
+	server *grpc.Server
+	addr   net.Addr
+}
+
+func startGRPCControlServer(addr string, sim *simulation) (*grpcControlServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("starting gRPC control server: %w", err)
+	}
+	c := &grpcControlServer{sim: sim, server: grpc.NewServer(), addr: listener.Addr()}
+	diusimpb.RegisterControlServer(c.server, c)
+	go func() {
+		if err := c.server.Serve(listener); err != nil {
+			log.Printf("gRPC control server error: %v", err)
+		}
+	}()
+	log.Printf("Serving the gRPC control API on %s", listener.Addr())
+	return c, nil
+}
+
+func (c *grpcControlServer) Close() error {
+	c.server.Stop()
+	return nil
+}
+
+// grpcControlError converts an error of the simulation into a gRPC status.
+func grpcControlError(err error) error {
+	switch {
+	case errors.Is(err, errSensorNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errSensorExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+func statsProto(s simulationStats) *diusimpb.Stats {
+	return &diusimpb.Stats{
+		Paused:            s.Paused,
+		Uptime:            durationpb.New(time.Duration(s.UptimeSeconds * float64(time.Second))),
+		Sensors:           uint32(s.Sensors),
+		Readings:          uint64(s.Readings),
+		Errors:            uint64(s.Errors),
+		ReadingsPerSecond: s.ReadingsPerSecond,
+		MinRate:           s.MinRate,
+		MaxRate:           s.MaxRate,
+	}
+}
+
+func sensorProto(sensor *simulatedSensor) *diusimpb.Sensor {
+	s := newSensorStatus(sensor)
+	return &diusimpb.Sensor{
+		Id:      s.ID,
+		Channel: s.Channel,
+		Diu:     s.DIU,
+		Site:    s.Site,
+		MinRate: s.MinRate,
+		MaxRate: s.MaxRate,
+		Faults:  s.Faults,
+		Paused:  s.Paused,
+	}
+}
+
+func (c *grpcControlServer) GetStats(ctx context.Context, req *diusimpb.GetStatsRequest) (*diusimpb.Stats, error) {
+	return statsProto(c.sim.stats()), nil
+}
+
+func (c *grpcControlServer) WatchStats(req *diusimpb.WatchStatsRequest, stream diusimpb.Control_WatchStatsServer) error {
+	interval := req.GetInterval().AsDuration()
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := stream.Send(statsProto(c.sim.stats())); err != nil {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return nil
+		case <-c.sim.ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *grpcControlServer) Pause(ctx context.Context, req *diusimpb.PauseRequest) (*diusimpb.Stats, error) {
+	c.sim.setPaused(true)
+	return statsProto(c.sim.stats()), nil
+}
+
+func (c *grpcControlServer) Resume(ctx context.Context, req *diusimpb.ResumeRequest) (*diusimpb.Stats, error) {
+	c.sim.setPaused(false)
+	return statsProto(c.sim.stats()), nil
+}
+
+func (c *grpcControlServer) SetRates(ctx context.Context, req *diusimpb.SetRatesRequest) (*diusimpb.Stats, error) {
+	minRate, maxRate, err := rateRequest{Rate: req.Rate, MinRate: req.MinRate, MaxRate: req.MaxRate}.bounds()
+	if err != nil {
+		return nil, grpcControlError(err)
+	}
+	c.sim.setRates(minRate, maxRate)
+	return statsProto(c.sim.stats()), nil
+}
+
+func (c *grpcControlServer) ListSensors(ctx context.Context, req *diusimpb.ListSensorsRequest) (*diusimpb.ListSensorsResponse, error) {
+	resp := &diusimpb.ListSensorsResponse{}
+	for _, sensor := range c.sim.runningSensors() {
+		resp.Sensors = append(resp.Sensors, sensorProto(sensor))
+	}
+	return resp, nil
+}
+
+func (c *grpcControlServer) AddSensor(ctx context.Context, req *diusimpb.AddSensorRequest) (*diusimpb.Sensor, error) {
+	sensor, err := c.sim.addSensor(req.Id, req.GetSettings().AsMap())
+	if err != nil {
+		return nil, grpcControlError(err)
+	}
+	return sensorProto(sensor), nil
+}
+
+func (c *grpcControlServer) RemoveSensor(ctx context.Context, req *diusimpb.RemoveSensorRequest) (*diusimpb.RemoveSensorResponse, error) {
+	if err := c.sim.removeSensor(req.Id); err != nil {
+		return nil, grpcControlError(err)
+	}
+	return &diusimpb.RemoveSensorResponse{}, nil
+}
+
+func (c *grpcControlServer) SetSensorRates(ctx context.Context, req *diusimpb.SetSensorRatesRequest) (*diusimpb.Sensor, error) {
+	minRate, maxRate, err := rateRequest{Rate: req.Rate, MinRate: req.MinRate, MaxRate: req.MaxRate}.bounds()
+	if err != nil {
+		return nil, grpcControlError(err)
+	}
+	sensor, err := c.sim.setSensorRates(req.Id, minRate, maxRate)
+	if err != nil {
+		return nil, grpcControlError(err)
+	}
+	return sensorProto(sensor), nil
+}
+
+func (c *grpcControlServer) TriggerFault(ctx context.Context, req *diusimpb.TriggerFaultRequest) (*diusimpb.Sensor, error) {
+	fault := req.Fault
+	if fault == "" {
+		fault = "stuck"
+	}
+	sensor, err := c.sim.triggerFault(req.Id, fault, req.GetDuration().AsDuration())
+	if err != nil {
+		return nil, grpcControlError(err)
+	}
+	return sensorProto(sensor), nil
+}
+
+func (c *grpcControlServer) PauseSensors(ctx context.Context, req *diusimpb.SensorSelector) (*diusimpb.ListSensorsResponse, error) {
+	return c.pauseSensors(req, true)
+}
+
+func (c *grpcControlServer) ResumeSensors(ctx context.Context, req *diusimpb.SensorSelector) (*diusimpb.ListSensorsResponse, error) {
+	return c.pauseSensors(req, false)
+}
+
+func (c *grpcControlServer) pauseSensors(req *diusimpb.SensorSelector, paused bool) (*diusimpb.ListSensorsResponse, error) {
+	sensors, err := c.sim.pauseSensors(sensorSelector{ID: req.Id, Channel: req.Channel}, paused)
+	if err != nil {
+		return nil, grpcControlError(err)
+	}
+	resp := &diusimpb.ListSensorsResponse{}
+	for _, sensor := range sensors {
+		resp.Sensors = append(resp.Sensors, sensorProto(sensor))
+	}
+	return resp, nil
+}
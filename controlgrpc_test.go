@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"rgehrsitz/diu_sim/diusimpb"
+)
+
+func TestGRPCControl(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("sinks: recording\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Error reading config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sim, err := startSensorSimulations(ctx, &recordingSink{}, 2, 1, 1)
+	if err != nil {
+		cancel()
+		t.Fatalf("Error starting simulation: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.wg.Wait()
+	})
+	server, err := startGRPCControlServer("127.0.0.1:0", sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	conn, err := grpc.NewClient(server.addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := diusimpb.NewControlClient(conn)
+
+	settings, err := structpb.NewStruct(map[string]any{"channel": "temperature", "rate": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := client.AddSensor(ctx, &diusimpb.AddSensorRequest{Id: "pump_temp", Settings: settings})
+	if err != nil || sensor.Channel != "temperature" || sensor.MinRate != 2 {
+		t.Errorf("Expected the sensor added, got %v, %v", sensor, err)
+	}
+	if _, err := client.AddSensor(ctx, &diusimpb.AddSensorRequest{Id: "pump_temp", Settings: settings}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("Expected a sensor added twice to conflict, got %v", err)
+	}
+	if _, err := client.RemoveSensor(ctx, &diusimpb.RemoveSensorRequest{Id: "sensor_001"}); err != nil {
+		t.Errorf("Error removing sensor: %v", err)
+	}
+	if _, err := client.RemoveSensor(ctx, &diusimpb.RemoveSensorRequest{Id: "sensor_001"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected removing a stopped sensor to fail, got %v", err)
+	}
+
+	sensor, err = client.SetSensorRates(ctx, &diusimpb.SetSensorRatesRequest{Id: "sensor_000", MinRate: 3, MaxRate: 4})
+	if err != nil || sensor.MinRate != 3 || sensor.MaxRate != 4 {
+		t.Errorf("Expected the sensor's rates set, got %v, %v", sensor, err)
+	}
+	if _, err := client.SetRates(ctx, &diusimpb.SetRatesRequest{MinRate: 3, MaxRate: 1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected inverted rates rejected, got %v", err)
+	}
+	sensor, err = client.TriggerFault(ctx, &diusimpb.TriggerFaultRequest{Id: "sensor_000", Duration: durationpb.New(time.Minute)})
+	if err != nil || !slices.Equal(sensor.Faults, []string{"stuck"}) {
+		t.Errorf("Expected a stuck fault triggered, got %v, %v", sensor, err)
+	}
+
+	list, err := client.ListSensors(ctx, &diusimpb.ListSensorsRequest{})
+	if err != nil {
+		t.Fatalf("Error listing sensors: %v", err)
+	}
+	var ids []string
+	for _, s := range list.Sensors {
+		ids = append(ids, s.Id)
+	}
+	if want := []string{"pump_temp", "sensor_000"}; !slices.Equal(ids, want) {
+		t.Errorf("Expected sensors %v, got %v", want, ids)
+	}
+
+	paused, err := client.PauseSensors(ctx, &diusimpb.SensorSelector{Channel: "temperature"})
+	if err != nil || len(paused.Sensors) == 0 || !paused.Sensors[0].Paused {
+		t.Errorf("Expected the temperature sensors paused, got %v, %v", paused, err)
+	}
+	if _, err := client.ResumeSensors(ctx, &diusimpb.SensorSelector{Id: "nope*"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected resuming no sensors to fail, got %v", err)
+	}
+
+	if stats, err := client.Pause(ctx, &diusimpb.PauseRequest{}); err != nil || !stats.Paused {
+		t.Errorf("Expected the simulation paused, got %v, %v", stats, err)
+	}
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	stream, err := client.WatchStats(watchCtx, &diusimpb.WatchStatsRequest{Interval: durationpb.New(10 * time.Millisecond)})
+	if err != nil {
+		t.Fatalf("Error watching stats: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		stats, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Error receiving stats: %v", err)
+		}
+		if !stats.Paused || stats.Sensors != 2 {
+			t.Errorf("Expected the stats of 2 paused sensors, got %v", stats)
+		}
+	}
+}
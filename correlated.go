@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// noiseGroup draws jointly distributed noise for a group of sensors. Time
+// is divided into slots of step, and every slot gets one draw of a noise
+// vector with one component per member, which the members add to the
+// samples they take in that slot.
+type noiseGroup struct {
+	mu      sync.Mutex
+	members []string
+	chol    [][]float64 // lower Cholesky factor of the covariance matrix
+	step    time.Duration
+	rand    *rand.Rand
+	draws   map[int64][]float64 // noise vectors by slot
+}
+
+// noiseGroupHistory is how many slots of draws a noise group keeps, so
+// that members sampling a little late still find theirs.
+const noiseGroupHistory = 16
+
+var (
+	noiseGroupsMu sync.Mutex
+	noiseGroups   = make(map[int]*noiseGroup)
+)
+
+// noiseGroupFor returns the correlated noise group a sensor is a member
+// of, creating it on first use, and the sensor's component in it, or nil
+// if the sensor is in none. Groups are listed under correlated-noise, e.g.
+//
+//	correlated-noise:
+//	  - sensors: [sensor_000, sensor_001, sensor_002]
+//	    stddev: [0.5, 0.02, 1]
+//	    correlation:
+//	      - [1, 0.8, -0.3]
+//	      - [0.8, 1, 0]
+//	      - [-0.3, 0, 1]
+//	    step: 1s
+//
+// with either a correlation matrix and the members' stddevs, or a
+// covariance matrix. The step defaults to 1s.
+func noiseGroupFor(sensor sensorInfo) (*noiseGroup, int, error) {
+	noiseGroupsMu.Lock()
+	defer noiseGroupsMu.Unlock()
+
+	for i, item := range cast.ToSlice(viper.Get("correlated-noise")) {
+		spec := generatorSpec(cast.ToStringMap(item))
+		members := cast.ToStringSlice(spec["sensors"])
+		member := slices.Index(members, sensor.ID)
+		if member < 0 {
+			continue
+		}
+		if group, ok := noiseGroups[i]; ok {
+			return group, member, nil
+		}
+		group, err := newNoiseGroup(spec, members, sensorRand(0, fmt.Sprintf("correlated-noise/%d", i)))
+		if err != nil {
+			return nil, 0, fmt.Errorf("correlated noise group %d: %w", i+1, err)
+		}
+		noiseGroups[i] = group
+		return group, member, nil
+	}
+	return nil, 0, nil
+}
+
+func newNoiseGroup(spec generatorSpec, members []string, r *rand.Rand) (*noiseGroup, error) {
+	n := len(members)
+	var covariance [][]float64
+	switch {
+	case spec["covariance"] != nil:
+		var err error
+		if covariance, err = squareMatrix(spec["covariance"], n); err != nil {
+			return nil, fmt.Errorf("covariance: %w", err)
+		}
+	case spec["correlation"] != nil:
+		correlation, err := squareMatrix(spec["correlation"], n)
+		if err != nil {
+			return nil, fmt.Errorf("correlation: %w", err)
+		}
+		stddevs := cast.ToSlice(spec["stddev"])
+		if len(stddevs) != n {
+			return nil, fmt.Errorf("stddev must list one value per sensor")
+		}
+		covariance = make([][]float64, n)
+		for i := range correlation {
+			if correlation[i][i] != 1 {
+				return nil, fmt.Errorf("correlation: the diagonal must be 1")
+			}
+			covariance[i] = make([]float64, n)
+			for j, r := range correlation[i] {
+				if r < -1 || r > 1 {
+					return nil, fmt.Errorf("correlation: %g is not between -1 and 1", r)
+				}
+				covariance[i][j] = r * cast.ToFloat64(stddevs[i]) * cast.ToFloat64(stddevs[j])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("correlation or covariance must be set")
+	}
+
+	chol, err := cholesky(covariance)
+	if err != nil {
+		return nil, err
+	}
+	step := spec.duration("step", time.Second)
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	return &noiseGroup{
+		members: members,
+		chol:    chol,
+		step:    step,
+		rand:    r,
+		draws:   make(map[int64][]float64),
+	}, nil
+}
+
+// squareMatrix reads an n×n matrix given as a list of rows.
+func squareMatrix(v any, n int) ([][]float64, error) {
+	rows := cast.ToSlice(v)
+	if len(rows) != n {
+		return nil, fmt.Errorf("expected %d rows, one per sensor, got %d", n, len(rows))
+	}
+	matrix := make([][]float64, n)
+	for i, row := range rows {
+		values := cast.ToSlice(row)
+		if len(values) != n {
+			return nil, fmt.Errorf("expected %d values in row %d, got %d", n, i+1, len(values))
+		}
+		matrix[i] = make([]float64, n)
+		for j, value := range values {
+			matrix[i][j] = cast.ToFloat64(value)
+		}
+	}
+	return matrix, nil
+}
+
+// cholesky returns the lower triangular L with L·Lᵀ = m, for a symmetric,
+// positive semi-definite m.
+func cholesky(m [][]float64) ([][]float64, error) {
+	n := len(m)
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			if m[i][j] != m[j][i] {
+				return nil, fmt.Errorf("the matrix is not symmetric")
+			}
+			sum := m[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			switch {
+			case i == j && sum < -1e-12:
+				return nil, fmt.Errorf("the matrix is not positive semi-definite")
+			case i == j:
+				l[i][i] = math.Sqrt(math.Max(sum, 0))
+			case l[j][j] > 0:
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+	return l, nil
+}
+
+// noise returns the member's component of the noise vector of the slot
+// elapsed time into the simulation falls into.
+func (g *noiseGroup) noise(member int, elapsed time.Duration) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	slot := int64(elapsed / g.step)
+	draw, ok := g.draws[slot]
+	if !ok {
+		z := make([]float64, len(g.members))
+		for i := range z {
+			z[i] = g.rand.NormFloat64()
+		}
+		draw = make([]float64, len(g.members))
+		for i, row := range g.chol {
+			for k, c := range row[:i+1] {
+				draw[i] += c * z[k]
+			}
+		}
+		g.draws[slot] = draw
+		if len(g.draws) > noiseGroupHistory {
+			for s := range g.draws {
+				if s <= slot-noiseGroupHistory {
+					delete(g.draws, s)
+				}
+			}
+		}
+	}
+	return draw[member]
+}
+
+// applyCorrelatedNoise adds the sensor's component of the noise of its
+// correlated noise group, if it is in one, to its generator.
+func applyCorrelatedNoise(sensor sensorInfo, generator ValueGenerator) (ValueGenerator, error) {
+	group, member, err := noiseGroupFor(sensor)
+	if err != nil || group == nil {
+		return generator, err
+	}
+	return generatorFunc(func(t time.Time) float64 {
+		return generator.Next(t) + group.noise(member, t.Sub(sensor.Start))
+	}), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func resetNoiseGroups(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := noiseGroups
+	noiseGroups = make(map[int]*noiseGroup)
+	t.Cleanup(func() { noiseGroups = saved })
+}
+
+func TestCorrelatedNoise(t *testing.T) {
+	resetNoiseGroups(t)
+	constantGenerator("temperature", 0)
+	viper.Set("correlated-noise", []any{map[string]any{
+		"sensors": []any{"sensor_000", "sensor_001", "sensor_002"},
+		"stddev":  []any{1, 2, 0.5},
+		"correlation": []any{
+			[]any{1, 0.8, -0.5},
+			[]any{0.8, 1, 0},
+			[]any{-0.5, 0, 1},
+		},
+	}})
+
+	generators := make([]ValueGenerator, 3)
+	for i := range generators {
+		sensor := testSensor(i, "temperature")
+		sensor.ID = []string{"sensor_000", "sensor_001", "sensor_002"}[i]
+		var err error
+		if generators[i], err = newValueGenerator(sensor); err != nil {
+			t.Fatalf("Error creating generator: %v", err)
+		}
+	}
+
+	const n = 20000
+	samples := make([][]float64, 3)
+	for k := 0; k < n; k++ {
+		// Samples taken in the same slot get the same noise.
+		at := testStart.Add(time.Duration(k)*time.Second + 300*time.Millisecond)
+		for i, generator := range generators {
+			v := generator.Next(at)
+			if again := generator.Next(at.Add(500 * time.Millisecond)); again != v {
+				t.Fatalf("Expected the same noise within a slot, got %f and %f", v, again)
+			}
+			samples[i] = append(samples[i], v)
+		}
+	}
+	stddev := func(x []float64) float64 {
+		var sum float64
+		for _, v := range x {
+			sum += v * v
+		}
+		return math.Sqrt(sum / n)
+	}
+	corr := func(x, y []float64) float64 {
+		var sum float64
+		for k := range x {
+			sum += x[k] * y[k]
+		}
+		return sum / n / stddev(x) / stddev(y)
+	}
+	for i, want := range []float64{1, 2, 0.5} {
+		if got := stddev(samples[i]); math.Abs(got-want) > 0.05*want {
+			t.Errorf("Expected a stddev of %g for sensor %d, got %f", want, i, got)
+		}
+	}
+	for _, tt := range []struct {
+		i, j int
+		want float64
+	}{{0, 1, 0.8}, {0, 2, -0.5}, {1, 2, 0}} {
+		if got := corr(samples[tt.i], samples[tt.j]); math.Abs(got-tt.want) > 0.03 {
+			t.Errorf("Expected a correlation of %g between sensors %d and %d, got %f", tt.want, tt.i, tt.j, got)
+		}
+	}
+
+	// Sensors outside the group are left alone.
+	outsider := testSensor(5, "temperature")
+	outsider.ID = "sensor_005"
+	generator, err := newValueGenerator(outsider)
+	if err != nil || generator.Next(testStart) != 0 {
+		t.Errorf("Expected sensors outside the group to have no noise")
+	}
+}
+
+func TestCorrelatedNoiseErrors(t *testing.T) {
+	resetNoiseGroups(t)
+	tests := []struct {
+		group map[string]any
+		want  string
+	}{
+		{map[string]any{}, "correlation or covariance must be set"},
+		{map[string]any{"covariance": []any{[]any{1, 0}}}, "expected 2 rows"},
+		{map[string]any{"covariance": []any{[]any{1, 0.5}, []any{0.4, 1}}}, "not symmetric"},
+		{map[string]any{"covariance": []any{[]any{1, 2}, []any{2, 1}}}, "not positive semi-definite"},
+		{map[string]any{"correlation": []any{[]any{1, 0.5}, []any{0.5, 1}}}, "stddev must list"},
+		{map[string]any{"correlation": []any{[]any{2, 0.5}, []any{0.5, 1}}, "stddev": []any{1, 1}}, "diagonal must be 1"},
+	}
+	for _, tt := range tests {
+		noiseGroups = make(map[int]*noiseGroup)
+		tt.group["sensors"] = []any{"sensor_001", "sensor_002"}
+		viper.Set("correlated-noise", []any{tt.group})
+		if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: expected an error containing %q, got %v", tt.group, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// The counter generator builds its increment generator from generatorTypes,
+// so it is registered at init to avoid an initialization cycle.
+func init() {
+	generatorTypes["counter"] = newCounterGenerator
+}
+
+// newCounterGenerator accumulates increments into a monotonically
+// increasing count, such as an energy meter or a pulse counter, e.g.
+//
+//	type: counter
+//	start: 1200
+//	increment: {type: gaussian, base: 0.012, stddev: 0.002}
+//	per: second
+//	max: 100000
+//	rollover: wrap
+//
+// The increment is a number or a generator drawing them, and is added per
+// sample, or per second between samples when per is second. Negative
+// increments count as zero. With integer set the count is reported
+// rounded down, as pulse counters do, while fractions keep accumulating.
+// When the count reaches max it wraps around to zero and keeps the
+// remainder, resets to start, or saturates at max.
+func newCounterGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	var increment ValueGenerator
+	switch inc := spec["increment"]; inc.(type) {
+	case nil:
+		increment = generatorFunc(func(time.Time) float64 { return 1 })
+	case map[string]any:
+		incSpec := generatorSpec(cast.ToStringMap(inc))
+		typ := incSpec.str("type", "uniform")
+		factory, ok := generatorTypes[typ]
+		if !ok {
+			return nil, fmt.Errorf("counter generator for %s: unknown increment generator type %q", sensor.ID, typ)
+		}
+		var err error
+		if increment, err = factory(incSpec, sensor); err != nil {
+			return nil, err
+		}
+	default:
+		value, err := cast.ToFloat64E(inc)
+		if err != nil {
+			return nil, fmt.Errorf("counter generator for %s: increment must be a number or a generator", sensor.ID)
+		}
+		increment = generatorFunc(func(time.Time) float64 { return value })
+	}
+
+	perSecond := false
+	switch per := spec.str("per", "sample"); per {
+	case "sample":
+	case "second":
+		perSecond = true
+	default:
+		return nil, fmt.Errorf("counter generator for %s: unknown increment period %q", sensor.ID, per)
+	}
+
+	start := spec.float("start", 0)
+	limit := spec.float("max", 0)
+	if limit < 0 || limit > 0 && start >= limit {
+		return nil, fmt.Errorf("counter generator for %s: max must be greater than start", sensor.ID)
+	}
+	rollover := spec.str("rollover", "wrap")
+	switch rollover {
+	case "wrap", "reset", "saturate":
+	default:
+		return nil, fmt.Errorf("counter generator for %s: unknown rollover %q", sensor.ID, rollover)
+	}
+	integer := cast.ToBool(spec["integer"])
+
+	count := start
+	var last time.Time
+	return generatorFunc(func(t time.Time) float64 {
+		step := math.Max(increment.Next(t), 0)
+		if perSecond {
+			if last.IsZero() {
+				step = 0
+			} else {
+				step *= math.Max(t.Sub(last).Seconds(), 0)
+			}
+			last = t
+		}
+		count += step
+		if limit > 0 && count >= limit {
+			switch rollover {
+			case "wrap":
+				count = math.Mod(count, limit)
+			case "reset":
+				count = start
+			case "saturate":
+				count = limit
+			}
+		}
+		if integer {
+			return math.Floor(count)
+		}
+		return count
+	}), nil
+}
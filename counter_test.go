@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestCounterGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	tests := []struct {
+		spec map[string]any
+		want []float64 // at 0s, 1s, 2s, ...
+	}{
+		{map[string]any{}, []float64{1, 2, 3, 4}},
+		{map[string]any{"start": 10, "increment": 2.5}, []float64{12.5, 15, 17.5}},
+		{map[string]any{"increment": 0.5, "per": "second"}, []float64{0, 0.5, 1, 1.5}},
+		{map[string]any{"increment": 0.4, "integer": true}, []float64{0, 0, 1, 1, 2}},
+		{map[string]any{"increment": -1}, []float64{0, 0}},
+		{map[string]any{"increment": 3, "max": 10}, []float64{3, 6, 9, 2, 5}},
+		{map[string]any{"start": 1, "increment": 3, "max": 10, "rollover": "reset"}, []float64{4, 7, 1, 4}},
+		{map[string]any{"increment": 3, "max": 10, "rollover": "saturate"}, []float64{3, 6, 9, 10, 10}},
+		{map[string]any{"increment": map[string]any{"type": "square", "amplitude": 0, "offset": 2}}, []float64{2, 4, 6}},
+	}
+	for _, tt := range tests {
+		tt.spec["type"] = "counter"
+		viper.Set("channels.energy.generator", tt.spec)
+		generator, err := newValueGenerator(testSensor(1, "energy"))
+		if err != nil {
+			t.Fatalf("Error creating generator for %v: %v", tt.spec, err)
+		}
+		for i, want := range tt.want {
+			if got := generator.Next(testStart.Add(time.Duration(i) * time.Second)); !approxEqual(got, want) {
+				t.Errorf("%v: expected %g at %ds, got %g", tt.spec, want, i, got)
+			}
+		}
+	}
+}
+
+func TestCounterGeneratorErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	specs := []map[string]any{
+		{"type": "counter", "increment": "lots"},
+		{"type": "counter", "increment": map[string]any{"type": "nope"}},
+		{"type": "counter", "per": "minute"},
+		{"type": "counter", "start": 10, "max": 5},
+		{"type": "counter", "max": 5, "rollover": "explode"},
+	}
+	for _, spec := range specs {
+		viper.Set("channels.energy.generator", spec)
+		if _, err := newValueGenerator(testSensor(1, "energy")); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+}
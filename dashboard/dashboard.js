@@ -0,0 +1,167 @@
+// The dashboard polls the control API every second and draws the
+// simulation's throughput, its sensors and their last values, with buttons
+// for the common actions.
+"use strict";
+
+const api = "api/v1";
+const maxRows = 200; // sensors listed at most, after filtering
+const history = []; // readings/s of the last polls, for the chart
+let faultKinds = [];
+let paused = false;
+let last = null; // readings and time of the previous poll
+
+const $ = (id) => document.getElementById(id);
+
+async function call(method, path, body) {
+  const resp = await fetch(`../${api}${path}`, {
+    method,
+    headers: body ? { "Content-Type": "application/json" } : {},
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  if (!resp.ok) {
+    throw new Error(`${method} ${path}: ${(await resp.text()).trim()}`);
+  }
+  return resp.status === 204 ? null : resp.json();
+}
+
+// act runs an action, showing its error if it fails, and then polls.
+async function act(action) {
+  try {
+    await action();
+    $("error").textContent = "";
+  } catch (err) {
+    $("error").textContent = err.message;
+  }
+  poll();
+}
+
+function formatDuration(seconds) {
+  const s = Math.floor(seconds);
+  const h = Math.floor(s / 3600);
+  const m = Math.floor((s % 3600) / 60);
+  return h > 0 ? `${h}h${m}m` : `${m}m${s % 60}s`;
+}
+
+function showStats(stats) {
+  paused = stats.paused;
+  $("state").textContent = paused ? "paused" : "running";
+  $("state").classList.toggle("paused", paused);
+  $("pause").textContent = paused ? "Resume" : "Pause";
+  $("uptime").textContent = formatDuration(stats.uptime_seconds);
+  $("sensors").textContent = stats.sensors;
+  $("readings").textContent = stats.readings;
+  $("errors").textContent = stats.errors;
+  $("rates").textContent = stats.min_rate === stats.max_rate
+    ? `${stats.min_rate}` : `${stats.min_rate}–${stats.max_rate}`;
+
+  const now = performance.now();
+  if (last) {
+    const throughput = (stats.readings - last.readings) / ((now - last.time) / 1000);
+    $("throughput").textContent = throughput.toFixed(1);
+    history.push(throughput);
+    if (history.length > 120) {
+      history.shift();
+    }
+    drawChart();
+  }
+  last = { readings: stats.readings, time: now };
+}
+
+function drawChart() {
+  const canvas = $("chart");
+  canvas.width = canvas.clientWidth;
+  const ctx = canvas.getContext("2d");
+  const top = Math.max(...history, 1);
+  const step = canvas.width / 119;
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+  ctx.strokeStyle = "#2a6fb0";
+  ctx.lineWidth = 2;
+  ctx.beginPath();
+  history.forEach((value, i) => {
+    const x = canvas.width - (history.length - 1 - i) * step;
+    const y = canvas.height - 4 - (value / top) * (canvas.height - 8);
+    i === 0 ? ctx.moveTo(x, y) : ctx.lineTo(x, y);
+  });
+  ctx.stroke();
+  ctx.fillStyle = "#666";
+  ctx.fillText(`${top.toFixed(0)}/s`, 4, 12);
+}
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function formatValue(last) {
+  if (!last) {
+    return "";
+  }
+  const value = last.label || String(Math.round(last.value * 1000) / 1000);
+  return last.unit ? `${value} ${last.unit}` : value;
+}
+
+function showSensors(sensors) {
+  const filter = $("filter").value.toLowerCase();
+  const shown = sensors.filter((s) =>
+    !filter || s.id.includes(filter) || s.channel.includes(filter) || s.diu.toLowerCase().includes(filter));
+  const rows = document.createElement("tbody");
+  rows.id = "sensor-rows";
+  for (const s of shown.slice(0, maxRows)) {
+    const row = rows.insertRow();
+    cell(row, s.id);
+    cell(row, s.channel);
+    cell(row, s.diu);
+    cell(row, s.min_rate === s.max_rate ? `${s.min_rate}` : `${s.min_rate}–${s.max_rate}`);
+    cell(row, formatValue(s.last));
+    cell(row, s.last ? new Date(s.last.timestamp).toLocaleTimeString() : "");
+    cell(row, [s.paused ? "paused" : "", ...(s.faults || [])].filter(Boolean).join(", "), "faults");
+    const actions = cell(row, "");
+    const pause = document.createElement("button");
+    pause.textContent = s.paused ? "resume" : "pause";
+    pause.onclick = () => act(() => call("POST", s.paused ? "/sensors/resume" : "/sensors/pause", { id: s.id }));
+    actions.appendChild(pause);
+    for (const kind of faultKinds) {
+      const button = document.createElement("button");
+      button.textContent = kind;
+      button.title = `Trigger a ${kind} fault`;
+      button.onclick = () => act(() => call("POST", `/sensors/${encodeURIComponent(s.id)}/faults`,
+        { fault: kind, duration: $("fault-duration").value }));
+      actions.appendChild(button);
+    }
+  }
+  if (shown.length > maxRows) {
+    cell(rows.insertRow(), `… and ${shown.length - maxRows} more`).colSpan = 8;
+  }
+  $("sensor-rows").replaceWith(rows);
+}
+
+async function poll() {
+  try {
+    const [stats, sensors] = await Promise.all([call("GET", "/stats"), call("GET", "/sensors")]);
+    showStats(stats);
+    showSensors(sensors);
+  } catch (err) {
+    $("state").textContent = "disconnected";
+    $("error").textContent = err.message;
+  }
+}
+
+$("pause").onclick = () => act(() => call("POST", paused ? "/resume" : "/pause"));
+$("rates-form").onsubmit = (event) => {
+  event.preventDefault();
+  act(() => call("PUT", "/rates", {
+    "min-rate": Number($("min-rate").value),
+    "max-rate": Number($("max-rate").value),
+  }));
+};
+$("filter").oninput = poll;
+
+call("GET", "/faults").then((kinds) => {
+  faultKinds = kinds;
+  poll();
+  setInterval(poll, 1000);
+});
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// newDerivedSensors sets up the sensors computed from other sensors, listed
+// under derived, e.g.
+//
+//	derived:
+//	  - id: delta_p
+//	    channel: pressure
+//	    expression: sensor("sensor_001") - sensor("sensor_004") + noise(0.01)
+//	  - id: delta_p_alarm
+//	    expression: sensor("delta_p") > 0.5 ? 1 : 0
+//
+// Expressions are those of the expr generator, and sensor() can refer to
+// simulated and derived sensors alike. The channel defaults to the ID and
+// the DIU to the one the sensor's index falls into; indexes are counted on
+// from first. Derived sensors may depend on each other as long as they do
+// not form a cycle, and are returned in the order they must be evaluated.
+// Dependencies are only seen where sensor() is called with a literal
+// source.
+func newDerivedSensors(first int) ([]*simulatedSensor, error) {
+	items := cast.ToSlice(viper.Get("derived"))
+	specs := make([]generatorSpec, len(items))
+	infos := make([]sensorInfo, len(items))
+	byID := make(map[string]int, len(items))
+	for i, item := range items {
+		spec := generatorSpec(cast.ToStringMap(item))
+		id := spec.str("id", "")
+		if id == "" {
+			return nil, fmt.Errorf("derived sensor %d: id must be set", i+1)
+		}
+		if _, ok := byID[id]; ok {
+			return nil, fmt.Errorf("derived sensor %s is defined more than once", id)
+		}
+		if spec.str("expression", "") == "" {
+			return nil, fmt.Errorf("derived sensor %s: expression must be set", id)
+		}
+		index := first + i
+		specs[i] = spec
+		infos[i] = sensorInfo{
+			Index:   index,
+			ID:      id,
+			Channel: spec.str("channel", id),
+			DIU:     spec.str("diu", diuID(index)),
+			Start:   simulationStart,
+			Rand:    sensorRand(index, "values"),
+			Notes:   &sampleNotes{},
+			Faults:  &faultTriggers{},
+		}
+		byID[id] = i
+		// Register all derived sensors up front so that they can refer to
+		// each other.
+		signals.register(infos[i])
+	}
+
+	deps := make([][]int, len(items))
+	for i, info := range infos {
+		sources, err := expressionSources(specs[i].str("expression", ""))
+		if err != nil {
+			return nil, fmt.Errorf("derived sensor %s: %w", info.ID, err)
+		}
+		for _, source := range sources {
+			id, ok := signals.resolve(source, info)
+			if !ok {
+				return nil, fmt.Errorf("derived sensor %s: unknown sensor %q", info.ID, source)
+			}
+			signals.watch(id, 0)
+			if j, ok := byID[id]; ok {
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+	order, err := derivedOrder(infos, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	sensors := make([]*simulatedSensor, 0, len(order))
+	for _, i := range order {
+		generator, err := newExpressionGenerator(specs[i], infos[i])
+		if err != nil {
+			return nil, err
+		}
+		if generator, err = layerGenerator(infos[i], generator); err != nil {
+			return nil, err
+		}
+		sensor, err := newSensor(infos[i], generator)
+		if err != nil {
+			return nil, err
+		}
+		sensors = append(sensors, sensor)
+	}
+	return sensors, nil
+}
+
+// derivedOrder sorts derived sensors so that each comes after the sensors
+// it depends on, keeping the configured order otherwise.
+func derivedOrder(infos []sensorInfo, deps [][]int) ([]int, error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(infos))
+	order := make([]int, 0, len(infos))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			cycle := path[slices.Index(path, infos[i].ID):]
+			return fmt.Errorf("derived sensors depend on each other in a cycle: %s -> %s", strings.Join(cycle, " -> "), infos[i].ID)
+		}
+		state[i] = visiting
+		path = append(path, infos[i].ID)
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		order = append(order, i)
+		return nil
+	}
+	for i := range infos {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// runDerivedSensors evaluates the derived sensors every derived-interval
+// (default 1s) until ctx is cancelled. All of them take their samples at
+// the same time, each after the sensors it depends on, so that the
+// relationships between the published values hold. Paused sensors skip
+// their samples.
+func runDerivedSensors(ctx context.Context, sink Sink, sensors []*simulatedSensor) {
+	interval := viper.GetDuration("derived-interval")
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var sequence uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			sequence++
+			for _, s := range sensors {
+				if s.isPaused() {
+					continue
+				}
+				s.emit(ctx, sink, s.sample(t, sequence))
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestDerivedSensors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+
+	viper.Set("channel-names", []string{"pressure"})
+	constantGenerator("pressure", 5)
+	viper.Set("sensors.sensor_001.generator", map[string]any{"type": "square", "amplitude": 0, "offset": 3})
+	// Listed before the sensor it depends on.
+	viper.Set("derived", []any{
+		map[string]any{"id": "delta_p_alarm", "expression": `sensor("delta_p") > 1.5 ? 1 : 0`},
+		map[string]any{"id": "delta_p", "channel": "pressure", "expression": `sensor("sensor_000") - sensor("sensor_001")`},
+	})
+
+	var sensors []*simulatedSensor
+	for i := 0; i < 2; i++ {
+		s, err := newSimulatedSensor(i)
+		if err != nil {
+			t.Fatalf("Error creating sensor %d: %v", i, err)
+		}
+		sensors = append(sensors, s)
+	}
+	derived, err := newDerivedSensors(2)
+	if err != nil {
+		t.Fatalf("Error creating derived sensors: %v", err)
+	}
+	if len(derived) != 2 || derived[0].info.ID != "delta_p" || derived[1].info.ID != "delta_p_alarm" {
+		t.Fatalf("Expected delta_p to be evaluated before delta_p_alarm, got %v", derived)
+	}
+	if derived[0].info.Channel != "pressure" || derived[1].info.Channel != "delta_p_alarm" || derived[0].info.Index != 3 {
+		t.Errorf("Unexpected derived sensor info: %+v, %+v", derived[0].info, derived[1].info)
+	}
+
+	for _, s := range sensors {
+		s.sample(testStart, 1)
+	}
+	at := testStart.Add(time.Second)
+	if r := derived[0].sample(at, 1); r.Value != 2 || r.SensorID != "delta_p" {
+		t.Errorf("Expected delta_p to be 5 - 3, got %+v", r)
+	}
+	if r := derived[1].sample(at, 1); r.Value != 1 {
+		t.Errorf("Expected delta_p_alarm to be raised, got %v", r.Value)
+	}
+}
+
+func TestDerivedSensorErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	t.Cleanup(func() { signals = saved })
+
+	tests := []struct {
+		derived []any
+		want    string
+	}{
+		{[]any{map[string]any{"expression": "1"}}, "id must be set"},
+		{[]any{map[string]any{"id": "a"}}, "expression must be set"},
+		{[]any{map[string]any{"id": "a", "expression": "1"}, map[string]any{"id": "a", "expression": "2"}}, "more than once"},
+		{[]any{map[string]any{"id": "a", "expression": `sensor("nope")`}}, `unknown sensor "nope"`},
+		{[]any{
+			map[string]any{"id": "a", "expression": "1"},
+			map[string]any{"id": "b", "expression": `sensor("c")`},
+			map[string]any{"id": "c", "expression": `sensor("a") + sensor("b")`},
+		}, "cycle: b -> c -> b"},
+	}
+	for _, tt := range tests {
+		signals = newSignalBus()
+		viper.Set("derived", tt.derived)
+		if _, err := newDerivedSensors(0); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+		}
+	}
+}
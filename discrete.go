@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// newBooleanGenerator produces the 0/1 states of a digital input such as a
+// door switch or relay contact. With a period the input toggles
+// periodically, on for the duty fraction of each period and shifted by
+// phase and phase-step degrees like the waveforms; otherwise it toggles at
+// random, staying on for mean-on and off for mean-off on average. After
+// each change of state the contact chatters for the chatter duration,
+// reading the opposite state with chatter-probability.
+func newBooleanGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	chatter := spec.duration("chatter", 0)
+	chatterProbability := spec.float("chatter-probability", 0.5)
+
+	var state func(t time.Time) bool
+	if _, periodic := spec["period"]; periodic {
+		period := spec.duration("period", time.Minute)
+		duty := spec.float("duty", 0.5)
+		if period <= 0 || duty < 0 || duty > 1 {
+			return nil, fmt.Errorf("boolean generator for %s: period must be positive and duty between 0 and 1", sensor.ID)
+		}
+		phase := (spec.float("phase", 0) + spec.float("phase-step", 0)*float64(sensor.Index)) / 360
+		state = func(t time.Time) bool {
+			cycles := float64(t.Sub(sensor.Start))/float64(period) + phase
+			return cycles-math.Floor(cycles) < duty
+		}
+	} else {
+		meanOn, meanOff := spec.duration("mean-on", time.Minute), spec.duration("mean-off", time.Minute)
+		if meanOn <= 0 || meanOff <= 0 {
+			return nil, fmt.Errorf("boolean generator for %s: mean-on and mean-off must be positive", sensor.ID)
+		}
+		on := spec.float("initial", 0) != 0
+		var next time.Time // of the next random change
+		hold := func(from time.Time) time.Time {
+			mean := meanOff
+			if on {
+				mean = meanOn
+			}
+			return from.Add(time.Duration(sensor.Rand.ExpFloat64() * float64(mean)))
+		}
+		state = func(t time.Time) bool {
+			if next.IsZero() {
+				next = hold(t)
+			}
+			for !t.Before(next) {
+				on = !on
+				next = hold(next)
+			}
+			return on
+		}
+	}
+
+	var (
+		last    bool
+		changed time.Time
+		started bool
+	)
+	return generatorFunc(func(t time.Time) float64 {
+		on := state(t)
+		if started && on != last {
+			changed = t
+		}
+		last, started = on, true
+		if chatter > 0 && !changed.IsZero() && t.Sub(changed) < chatter && sensor.Rand.Float64() < chatterProbability {
+			on = !on
+		}
+		if on {
+			return 1
+		}
+		return 0
+	}), nil
+}
+
+// channelKinds are the kinds of values a channel can hold, selected with
+// channels.<channel>.kind:
+//
+//	number:  plain numeric values (the default)
+//	boolean: 0/1 states, written as false/true when
+//	         channels.<channel>.boolean-format is bool
+//	enum:    codes of the states in channels.<channel>.enum, published
+//	         with their labels
+//	text:    codes of the status messages in channels.<channel>.messages,
+//	         published as the message text
+var channelKinds = map[string]bool{
+	"number":  true,
+	"boolean": true,
+	"enum":    true,
+	"text":    true,
+}
+
+// channelKind returns the kind of values a channel holds.
+func channelKind(channel string) (string, error) {
+	kind := viper.GetString("channels." + channel + ".kind")
+	if kind == "" {
+		return "number", nil
+	}
+	if !channelKinds[kind] {
+		return "", fmt.Errorf("channel %s: unknown kind %q", channel, kind)
+	}
+	return kind, nil
+}
+
+// enumValue is an entry of an enum channel's catalog.
+type enumValue struct {
+	label string
+	code  int
+}
+
+// enumCatalog returns the catalog of an enum channel,
+// channels.<channel>.enum: a list of labels, coded 0, 1, ... in order, or of
+// {label, code} entries.
+func enumCatalog(channel string) ([]enumValue, error) {
+	items := cast.ToSlice(viper.Get("channels." + channel + ".enum"))
+	catalog := make([]enumValue, len(items))
+	for i, item := range items {
+		if entry, ok := item.(map[string]any); ok {
+			spec := generatorSpec(entry)
+			catalog[i] = enumValue{label: spec.str("label", ""), code: int(spec.float("code", float64(i)))}
+		} else {
+			catalog[i] = enumValue{label: cast.ToString(item), code: i}
+		}
+		if catalog[i].label == "" {
+			return nil, fmt.Errorf("channel %s: enum entry %d has no label", channel, i+1)
+		}
+	}
+	return catalog, nil
+}
+
+// enumCode returns the code of a label in a catalog. Labels are matched
+// without regard to case, since config keys such as markov state names
+// are lowercased.
+func enumCode(catalog []enumValue, label string) (int, bool) {
+	for _, value := range catalog {
+		if strings.EqualFold(value.label, label) {
+			return value.code, true
+		}
+	}
+	return 0, false
+}
+
+// defaultEnumSpec returns the generator of enum channels that have none: a
+// markov generator over the catalog that starts in its first state and
+// leaves a state about once every ten minutes, for one picked at random.
+func defaultEnumSpec(catalog []enumValue) generatorSpec {
+	states := make(map[string]any, len(catalog))
+	for _, from := range catalog {
+		transitions := make(map[string]any)
+		for _, to := range catalog {
+			if to.label != from.label {
+				transitions[to.label] = 0.1 / float64(len(catalog)-1)
+			}
+		}
+		states[from.label] = map[string]any{"transitions": transitions}
+	}
+	return generatorSpec{"type": "markov", "step": "1m", "initial": catalog[0].label, "states": states}
+}
+
+// newScheduleGenerator steps through a list of values, each held for its
+// duration, e.g.
+//
+//	type: schedule
+//	steps:
+//	  - {state: STANDBY, duration: 5m}
+//	  - {state: RUN, duration: 1h}
+//	  - {value: 0, duration: 10m}
+//
+// Steps give either a value or, on enum channels, a state label. The
+// schedule repeats unless loop is false, in which case the last value is
+// held.
+func newScheduleGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	items := cast.ToSlice(spec["steps"])
+	if len(items) == 0 {
+		return nil, fmt.Errorf("schedule generator for %s: steps must be set", sensor.ID)
+	}
+	catalog, err := enumCatalog(sensor.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]float64, len(items))
+	ends := make([]time.Duration, len(items)) // of each step, from the start of the schedule
+	var total time.Duration
+	for i, item := range items {
+		step := generatorSpec(cast.ToStringMap(item))
+		if state := step.str("state", ""); state != "" {
+			code, ok := enumCode(catalog, state)
+			if !ok {
+				return nil, fmt.Errorf("schedule generator for %s: %s is not in the enum of channel %s", sensor.ID, state, sensor.Channel)
+			}
+			values[i] = float64(code)
+		} else {
+			values[i] = step.float("value", 0)
+		}
+		duration := step.duration("duration", 0)
+		if duration <= 0 {
+			return nil, fmt.Errorf("schedule generator for %s: step %d needs a positive duration", sensor.ID, i+1)
+		}
+		total += duration
+		ends[i] = total
+	}
+	loop := cast.ToBool(spec.str("loop", "true"))
+
+	return generatorFunc(func(t time.Time) float64 {
+		elapsed := t.Sub(sensor.Start)
+		if loop {
+			elapsed %= total
+		}
+		i := sort.Search(len(ends), func(i int) bool { return ends[i] > elapsed })
+		return values[min(i, len(values)-1)]
+	}), nil
+}
+
+// statusMessage is an entry of a text channel's message catalog.
+type statusMessage struct {
+	code   int
+	text   string
+	weight float64
+}
+
+// messageCatalog returns the catalog of a text channel,
+// channels.<channel>.messages: a list of texts, coded 0, 1, ... in order, or
+// of {text, code, weight} entries. Weights default to 1.
+func messageCatalog(channel string) ([]statusMessage, error) {
+	items := cast.ToSlice(viper.Get("channels." + channel + ".messages"))
+	catalog := make([]statusMessage, len(items))
+	for i, item := range items {
+		catalog[i] = statusMessage{code: i, text: cast.ToString(item), weight: 1}
+		if entry, ok := item.(map[string]any); ok {
+			spec := generatorSpec(entry)
+			catalog[i] = statusMessage{
+				code:   int(spec.float("code", float64(i))),
+				text:   spec.str("text", ""),
+				weight: spec.float("weight", 1),
+			}
+		}
+		if catalog[i].text == "" {
+			return nil, fmt.Errorf("channel %s: message %d has no text", channel, i+1)
+		}
+		if catalog[i].weight < 0 {
+			return nil, fmt.Errorf("channel %s: message %d has a negative weight", channel, i+1)
+		}
+	}
+	return catalog, nil
+}
+
+// newChoiceGenerator picks each value at random from values, in proportion
+// to weights if given.
+func newChoiceGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	values := cast.ToSlice(spec["values"])
+	if len(values) == 0 {
+		return nil, fmt.Errorf("choice generator for %s: values must be set", sensor.ID)
+	}
+	weights := cast.ToSlice(spec["weights"])
+	if len(weights) != 0 && len(weights) != len(values) {
+		return nil, fmt.Errorf("choice generator for %s: there must be as many weights as values", sensor.ID)
+	}
+
+	choices := make([]float64, len(values))
+	cumulative := make([]float64, len(values))
+	var total float64
+	for i, v := range values {
+		choices[i] = cast.ToFloat64(v)
+		weight := 1.0
+		if len(weights) > 0 {
+			weight = cast.ToFloat64(weights[i])
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("choice generator for %s: weights must not be negative", sensor.ID)
+		}
+		total += weight
+		cumulative[i] = total
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("choice generator for %s: weights add up to 0", sensor.ID)
+	}
+
+	return generatorFunc(func(time.Time) float64 {
+		r := sensor.Rand.Float64() * total
+		return choices[sort.Search(len(cumulative), func(i int) bool { return cumulative[i] > r })]
+	}), nil
+}
+
+// defaultTextSpec returns the generator of text channels that have none:
+// a choice of the catalog's messages by their weights.
+func defaultTextSpec(catalog []statusMessage) generatorSpec {
+	values := make([]any, len(catalog))
+	weights := make([]any, len(catalog))
+	for i, message := range catalog {
+		values[i], weights[i] = message.code, message.weight
+	}
+	return generatorSpec{"type": "choice", "values": values, "weights": weights}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestPeriodicBooleanGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.door.generator", map[string]any{"type": "boolean", "period": "10s", "duty": 0.3})
+
+	generator, err := newValueGenerator(testSensor(1, "door"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{0, 1},
+		{2 * time.Second, 1},
+		{3 * time.Second, 0},
+		{9 * time.Second, 0},
+		{10 * time.Second, 1},
+	} {
+		if got := generator.Next(testStart.Add(tt.at)); got != tt.want {
+			t.Errorf("At %v: expected %g, got %g", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestRandomBooleanGeneratorWithChatter(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.relay.generator", map[string]any{
+		"type":     "boolean",
+		"mean-on":  "1m",
+		"mean-off": "3m",
+		"chatter":  "2s",
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "relay"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	// Sampled every 100ms for a day, the relay should be on about a
+	// quarter of the time, and chatter make for many short pulses.
+	var on, changes int
+	last := 0.0
+	for i := 0; i < 864000; i++ {
+		v := generator.Next(testStart.Add(time.Duration(i) * 100 * time.Millisecond))
+		if v != 0 && v != 1 {
+			t.Fatalf("Expected 0 or 1, got %g", v)
+		}
+		on += int(v)
+		if v != last {
+			changes++
+			last = v
+		}
+	}
+	if fraction := float64(on) / 864000; fraction < 0.15 || fraction > 0.35 {
+		t.Errorf("Expected the relay on about 25%% of the time, got %.0f%%", fraction*100)
+	}
+	if changes < 4*720 {
+		t.Errorf("Expected chatter around the ~720 toggles, got %d changes", changes)
+	}
+}
+
+func TestBooleanSensor(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channel-names", "door")
+	viper.Set("channels.door", map[string]any{"kind": "boolean", "boolean-format": "bool"})
+
+	sensor, err := newSimulatedSensor(0)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	reading := sensor.sample(time.Now(), 1)
+	body, err := json.Marshal(reading.SensorData)
+	if err != nil {
+		t.Fatalf("Error marshaling reading: %v", err)
+	}
+	if !strings.Contains(string(body), `"value":true`) && !strings.Contains(string(body), `"value":false`) {
+		t.Errorf("Expected a boolean value, got %s", body)
+	}
+
+	viper.Set("channels.door.boolean-format", "yes-no")
+	if _, err := newSimulatedSensor(0); err == nil {
+		t.Errorf("Expected an error for an unknown boolean format")
+	}
+	viper.Set("channels.door.kind", "tristate")
+	if _, err := newSimulatedSensor(0); err == nil {
+		t.Errorf("Expected an error for an unknown channel kind")
+	}
+}
+
+func TestScheduleGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.mode.enum", []any{"OFF", "STANDBY", "RUN", map[string]any{"label": "FAULT", "code": 99}})
+	viper.Set("channels.mode.generator", map[string]any{
+		"type": "schedule",
+		"steps": []any{
+			map[string]any{"state": "STANDBY", "duration": "5m"},
+			map[string]any{"state": "run", "duration": "1h"},
+			map[string]any{"state": "FAULT", "duration": "1m"},
+		},
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "mode"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{0, 1},
+		{5 * time.Minute, 2},
+		{65*time.Minute + 30*time.Second, 99},
+		{66 * time.Minute, 1}, // the schedule repeats
+	} {
+		if got := generator.Next(testStart.Add(tt.at)); got != tt.want {
+			t.Errorf("At %v: expected %g, got %g", tt.at, tt.want, got)
+		}
+	}
+
+	viper.Set("channels.mode.generator.steps", []any{map[string]any{"state": "PURGE", "duration": "1m"}})
+	if _, err := newValueGenerator(testSensor(1, "mode")); err == nil {
+		t.Errorf("Expected an error for a state missing from the enum")
+	}
+}
+
+func TestEnumSensor(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channel-names", "mode")
+	viper.Set("channels.mode", map[string]any{
+		"kind": "enum",
+		"enum": []any{"OFF", "STANDBY", "RUN", "FAULT"},
+		"generator": map[string]any{
+			"type":    "markov",
+			"initial": "RUN",
+			"states": map[string]any{
+				"RUN":   map[string]any{"transitions": map[string]any{"FAULT": 1}},
+				"FAULT": map[string]any{},
+			},
+		},
+	})
+
+	sensor, err := newSimulatedSensor(0)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	now := time.Now()
+	for _, want := range []struct {
+		value float64
+		label string
+	}{{2, "RUN"}, {3, "FAULT"}} {
+		reading := sensor.sample(now, 1)
+		if reading.Value != want.value || reading.Label != want.label {
+			t.Errorf("Expected %s (%g), got %s (%g)", want.label, want.value, reading.Label, reading.Value)
+		}
+	}
+
+	// Without a generator, enum sensors wander between their states.
+	viper.Set("channels.mode.generator", nil)
+	sensor, err = newSimulatedSensor(0)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if label := sensor.sample(now, 1).Label; label != "OFF" {
+		t.Errorf("Expected the first state, got %q", label)
+	}
+
+	viper.Set("channels.mode.enum", nil)
+	if _, err := newSimulatedSensor(0); err == nil {
+		t.Errorf("Expected an error for an enum channel without an enum")
+	}
+}
+
+func TestChoiceGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{
+		"type":    "choice",
+		"values":  []any{1, 2, 3},
+		"weights": []any{0, 3, 1},
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	counts := make(map[float64]int)
+	for i := 0; i < 4000; i++ {
+		counts[generator.Next(testStart)]++
+	}
+	if counts[1] != 0 || counts[2] < 2700 || counts[2] > 3300 || counts[3] == 0 {
+		t.Errorf("Expected values in proportion to their weights, got %v", counts)
+	}
+
+	viper.Set("channels.temperature.generator.weights", []any{1})
+	if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+		t.Errorf("Expected an error for mismatched weights")
+	}
+}
+
+func TestTextSensor(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channel-names", "status")
+	viper.Set("channels.status", map[string]any{
+		"kind": "text",
+		"messages": []any{
+			map[string]any{"code": 0, "text": "OK", "weight": 0},
+			map[string]any{"code": 17, "text": "E17: filter clogged"},
+		},
+	})
+
+	sensor, err := newSimulatedSensor(0)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	reading := sensor.sample(time.Now(), 1)
+	if reading.Value != 17 || reading.Text != "E17: filter clogged" {
+		t.Fatalf("Expected the only weighted message, got %g %q", reading.Value, reading.Text)
+	}
+
+	body, _ := json.Marshal(reading.SensorData)
+	if !strings.Contains(string(body), `"value":"E17: filter clogged"`) {
+		t.Errorf("Expected the message as the JSON value, got %s", body)
+	}
+	if got := formatMessage(reading); got != "status:sensor_000=E17: filter clogged" {
+		t.Errorf("Expected the message in the kv payload, got %s", got)
+	}
+	msg, _ := encodeCSV(reading)
+	if !strings.HasSuffix(string(msg.Body), ",E17: filter clogged") {
+		t.Errorf("Expected the message in the CSV payload, got %s", msg.Body)
+	}
+
+	viper.Set("channels.status.messages", nil)
+	if _, err := newSimulatedSensor(0); err == nil {
+		t.Errorf("Expected an error for a text channel without messages")
+	}
+}
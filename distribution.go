@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// newLognormalGenerator draws offset plus log-normally distributed values,
+// whose logarithm is normally distributed with mean mu and standard
+// deviation sigma (default 0.25). By default mu centres the values on the
+// middle of the channel's range, or 1 if that is not positive.
+func newLognormalGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	min, max, err := specRange(spec, sensor)
+	if err != nil {
+		return nil, err
+	}
+	offset := spec.float("offset", 0)
+	mu := 0.0
+	if middle := (min+max)/2 - offset; middle > 0 {
+		mu = math.Log(middle)
+	}
+	mu = spec.float("mu", mu)
+	sigma := spec.float("sigma", 0.25)
+	if sigma < 0 {
+		return nil, fmt.Errorf("lognormal generator for %s: sigma must not be negative", sensor.ID)
+	}
+
+	return generatorFunc(func(time.Time) float64 {
+		return offset + math.Exp(mu+sensor.Rand.NormFloat64()*sigma)
+	}), nil
+}
+
+// newExponentialGenerator draws exponentially distributed values above
+// offset, such as the times between random events, with the given mean
+// or rate (1/mean). By default the offset is the bottom of the channel's
+// range and the mean a fifth of the range.
+func newExponentialGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	min, max, err := specRange(spec, sensor)
+	if err != nil {
+		return nil, err
+	}
+	offset := spec.float("offset", min)
+	mean := spec.float("mean", (max-min)/5)
+	if _, ok := spec["rate"]; ok {
+		mean = 1 / spec.float("rate", 0)
+	}
+	if !(mean > 0) || math.IsInf(mean, 0) {
+		return nil, fmt.Errorf("exponential generator for %s: mean and rate must be positive", sensor.ID)
+	}
+
+	return generatorFunc(func(time.Time) float64 {
+		return offset + sensor.Rand.ExpFloat64()*mean
+	}), nil
+}
+
+// poissonChunk is the largest mean drawn from at once by poisson. Larger
+// means are split, since the sum of Poisson variables is one too.
+const poissonChunk = 30
+
+// newPoissonGenerator draws Poisson distributed counts of events per
+// sample, with the mean lambda (default 1).
+func newPoissonGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	lambda := spec.float("lambda", 1)
+	if lambda < 0 {
+		return nil, fmt.Errorf("poisson generator for %s: lambda must not be negative", sensor.ID)
+	}
+
+	return generatorFunc(func(time.Time) float64 {
+		var count int
+		for remaining := lambda; remaining > 0; remaining -= poissonChunk {
+			// Knuth's method: count uniform draws until their product
+			// falls below e^-mean.
+			limit := math.Exp(-math.Min(remaining, poissonChunk))
+			for p := sensor.Rand.Float64(); p > limit; p *= sensor.Rand.Float64() {
+				count++
+			}
+		}
+		return float64(count)
+	}), nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestDistributions(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	tests := []struct {
+		channel             map[string]any
+		mean, variance, tol float64
+		integer             bool
+	}{
+		{map[string]any{"distribution": "normal", "base": 10, "stddev": 2}, 10, 4, 0.05, false},
+		// The mean of a log-normal is e^(mu + sigma²/2).
+		{map[string]any{"distribution": "lognormal", "mu": 0, "sigma": 0.5, "offset": 2}, 2 + math.Exp(0.125), (math.Exp(0.25) - 1) * math.Exp(0.25), 0.05, false},
+		{map[string]any{"distribution": "exponential", "rate": 0.5, "offset": 1}, 3, 4, 0.05, false},
+		{map[string]any{"distribution": "exponential", "min": 0, "max": 10}, 2, 4, 0.05, false},
+		{map[string]any{"distribution": "poisson", "lambda": 4}, 4, 4, 0.05, true},
+		{map[string]any{"distribution": "poisson", "lambda": 100}, 100, 100, 0.05, true},
+	}
+	for _, tt := range tests {
+		viper.Set("channels.events", tt.channel)
+		generator, err := newValueGenerator(testSensor(1, "events"))
+		if err != nil {
+			t.Fatalf("%v: error creating generator: %v", tt.channel, err)
+		}
+		const n = 50000
+		var sum, squares float64
+		for i := 0; i < n; i++ {
+			v := generator.Next(testStart)
+			if tt.integer && v != math.Round(v) {
+				t.Fatalf("%v: expected whole numbers, got %f", tt.channel, v)
+			}
+			sum += v
+			squares += v * v
+		}
+		mean := sum / n
+		variance := squares/n - mean*mean
+		if math.Abs(mean-tt.mean) > tt.tol*tt.mean || math.Abs(variance-tt.variance) > 2*tt.tol*tt.variance {
+			t.Errorf("%v: expected mean %g and variance %g, got %g and %g", tt.channel, tt.mean, tt.variance, mean, variance)
+		}
+	}
+}
+
+func TestDistributionErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	for _, channel := range []map[string]any{
+		{"distribution": "lognormal", "sigma": -1},
+		{"distribution": "exponential", "rate": 0},
+		{"distribution": "exponential", "mean": -2},
+		{"distribution": "poisson", "lambda": -1},
+	} {
+		viper.Set("channels.events", channel)
+		if _, err := newValueGenerator(testSensor(1, "events")); err == nil {
+			t.Errorf("Expected an error for %v", channel)
+		}
+	}
+}
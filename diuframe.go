@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// diuFrameSync is the default sync word that starts every DIU frame.
+const diuFrameSync = 0xAA55
+
+// diuFrameScales are the default value resolutions (engineering units per
+// count) of the built-in channels in DIU frames.
+var diuFrameScales = map[string]float64{
+	"temperature": 0.01,
+	"pressure":    0.0001,
+	"humidity":    0.01,
+}
+
+// diuFrameEncoder encodes readings in the fixed 8-byte frame emitted by
+// the DIU hardware. All fields are big-endian:
+//
+//	offset 0: uint16 sync word (diu-frame.sync-word, default 0xAA55)
+//	offset 2: uint16 sensor index
+//	offset 4: int16  value / scale, rounded and saturated
+//	offset 6: uint16 CRC-16/CCITT-FALSE of bytes 0-5
+//
+// The scale for a channel is diu-frame.scale.<channel>, defaulting to
+// diuFrameScales and then to 0.01. The settings are read when the encoder
+// is built, as sensors encode their readings concurrently.
+type diuFrameEncoder struct {
+	sync   uint16
+	scales map[string]float64
+}
+
+func newDIUFrameEncoder() *diuFrameEncoder {
+	e := &diuFrameEncoder{sync: diuFrameSync, scales: make(map[string]float64)}
+	if viper.IsSet("diu-frame.sync-word") {
+		e.sync = uint16(viper.GetUint("diu-frame.sync-word"))
+	}
+	for channel, scale := range diuFrameScales {
+		e.scales[channel] = scale
+	}
+	for channel, scale := range viper.GetStringMap("diu-frame.scale") {
+		e.scales[channel] = cast.ToFloat64(scale)
+	}
+	return e
+}
+
+func (e *diuFrameEncoder) Encode(r Reading) (Message, error) {
+	return Message{Body: e.appendFrame(make([]byte, 0, 8), r), ContentType: "application/octet-stream"}, nil
+}
+
+// EncodeBatch concatenates the frames of several readings, as the hardware
+// does when it dumps its buffer.
+func (e *diuFrameEncoder) EncodeBatch(rs []Reading) (Message, error) {
+	body := make([]byte, 0, 8*len(rs))
+	for _, r := range rs {
+		body = e.appendFrame(body, r)
+	}
+	return Message{Body: body, ContentType: "application/octet-stream"}, nil
+}
+
+// appendFrame appends the frame of r to body.
+func (e *diuFrameEncoder) appendFrame(body []byte, r Reading) []byte {
+	scale, ok := e.scales[r.Channel]
+	if !ok {
+		scale = 0.01
+	}
+	frame := binary.BigEndian.AppendUint16(body, e.sync)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(r.Index))
+	frame = binary.BigEndian.AppendUint16(frame, uint16(scaleToInt16(r.Value, scale)))
+	return binary.BigEndian.AppendUint16(frame, crc16CCITT(frame[len(body):]))
+}
+
+// scaleToInt16 converts a value to counts of the given scale, saturating at
+// the int16 limits like an ADC would.
+func scaleToInt16(value, scale float64) int16 {
+	counts := math.Round(value / scale)
+	switch {
+	case math.IsNaN(counts):
+		return 0
+	case counts > math.MaxInt16:
+		return math.MaxInt16
+	case counts < math.MinInt16:
+		return math.MinInt16
+	default:
+		return int16(counts)
+	}
+}
+
+// crc16CCITT computes CRC-16/CCITT-FALSE (polynomial 0x1021, initial value
+// 0xFFFF, no reflection, no final XOR).
+func crc16CCITT(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCRC16CCITT(t *testing.T) {
+	// Standard check value for CRC-16/CCITT-FALSE.
+	if got := crc16CCITT([]byte("123456789")); got != 0x29B1 {
+		t.Errorf("crc16CCITT check value = %#04x, want 0x29b1", got)
+	}
+}
+
+func TestEncodeDIUFrame(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	reading := Reading{SensorData: SensorData{Channel: "temperature", Value: 27.35}, Index: 258}
+	msg, err := newDIUFrameEncoder().Encode(reading)
+	if err != nil {
+		t.Fatalf("Error encoding frame: %v", err)
+	}
+
+	// 27.35 / 0.01 = 2735 = 0x0AAF
+	want := []byte{0xAA, 0x55, 0x01, 0x02, 0x0A, 0xAF}
+	want = append(want, byte(crc16CCITT(want)>>8), byte(crc16CCITT(want)))
+	if !bytes.Equal(msg.Body, want) {
+		t.Errorf("Encode = % x, want % x", msg.Body, want)
+	}
+
+	encoder := newDIUFrameEncoder()
+	viper.Set("diu-frame.sync-word", 0x7E7E)
+	viper.Set("diu-frame.scale.temperature", 0.1)
+	if msg, _ := encoder.Encode(reading); !bytes.Equal(msg.Body, want) {
+		t.Errorf("Expected the settings read when the encoder was built, got % x", msg.Body)
+	}
+	// 27.35 / 0.1 rounds to 274 = 0x0112
+	msg, _ = newDIUFrameEncoder().EncodeBatch([]Reading{reading, reading})
+	if len(msg.Body) != 16 || msg.Body[8] != 0x7E || msg.Body[9] != 0x7E || msg.Body[12] != 0x01 || msg.Body[13] != 0x12 {
+		t.Errorf("Expected two frames with the configured sync word and scale, got % x", msg.Body)
+	}
+}
+
+func TestScaleToInt16Saturates(t *testing.T) {
+	if got := scaleToInt16(1000, 0.01); got != 32767 {
+		t.Errorf("Expected positive saturation, got %d", got)
+	}
+	if got := scaleToInt16(-1000, 0.01); got != -32768 {
+		t.Errorf("Expected negative saturation, got %d", got)
+	}
+}
@@ -0,0 +1,6 @@
+// Package diusimfb contains the FlatBuffers tables used for flatbuffers
+// payloads. Consumers can generate code for other languages from
+// reading.fbs.
+package diusimfb
+
+//go:generate flatc --go -o .. reading.fbs
@@ -0,0 +1,90 @@
+// Package diusimgen is the interface for custom value generators, such as
+// models of proprietary devices, that the simulator uses without being
+// forked. A generator type is registered under a name, usually from the
+// init function of a Go plugin:
+//
+//	package main
+//
+//	import "rgehrsitz/diu_sim/diusimgen"
+//
+//	func init() {
+//		diusimgen.Register("valve", newValve)
+//	}
+//
+// built with go build -buildmode=plugin against the same version of the
+// simulator and listed under plugins in its config. Sensors then use it
+// like a built-in type, e.g. with generator: {type: valve, stroke: 5s}.
+package diusimgen
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ValueGenerator produces the successive values of a simulated sensor. Next
+// is called with the time of each sample.
+type ValueGenerator interface {
+	Next(t time.Time) float64
+}
+
+// Sensor describes the sensor a generator is built for.
+type Sensor struct {
+	Index   int
+	ID      string
+	Channel string
+	DIU     string
+	Start   time.Time  // start of the simulation
+	Rand    *rand.Rand // the sensor's own random source
+}
+
+// Spec is the configuration of a generator: its type and parameters, as
+// read from the config file.
+type Spec map[string]any
+
+// Factory builds a generator for a sensor from its configuration.
+type Factory func(spec Spec, sensor Sensor) (ValueGenerator, error)
+
+var (
+	mu        sync.Mutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a generator type available under name. It panics if
+// factory is nil or a type is already registered under name.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if factory == nil {
+		panic("diusimgen: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic(fmt.Sprintf("diusimgen: Register called twice for generator type %q", name))
+	}
+	factories[name] = factory
+}
+
+// Lookup returns the factory of the generator type registered under name.
+func Lookup(name string) (Factory, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	factory, ok := factories[name]
+	return factory, ok
+}
+
+// Types returns the names of the registered generator types, sorted.
+func Types() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
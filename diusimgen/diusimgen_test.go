@@ -0,0 +1,44 @@
+package diusimgen
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+type constant float64
+
+func (c constant) Next(time.Time) float64 { return float64(c) }
+
+func TestRegister(t *testing.T) {
+	Register("test-constant", func(spec Spec, sensor Sensor) (ValueGenerator, error) {
+		return constant(3), nil
+	})
+	factory, ok := Lookup("test-constant")
+	if !ok {
+		t.Fatalf("Expected the registered type to be found")
+	}
+	if g, err := factory(nil, Sensor{}); err != nil || g.Next(time.Time{}) != 3 {
+		t.Errorf("Expected the registered factory, got %v, %v", g, err)
+	}
+	if _, ok := Lookup("missing"); ok {
+		t.Errorf("Expected no factory for an unregistered type")
+	}
+	if !slices.Contains(Types(), "test-constant") {
+		t.Errorf("Expected test-constant among %v", Types())
+	}
+
+	for name, factory := range map[string]Factory{
+		"test-constant": factory,
+		"test-nil":      nil,
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected registering %s to panic", name)
+				}
+			}()
+			Register(name, factory)
+		}()
+	}
+}
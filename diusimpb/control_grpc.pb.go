@@ -0,0 +1,575 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.27.1
+// source: control.proto
+
+package diusimpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Control_GetStats_FullMethodName       = "/diusim.v1.Control/GetStats"
+	Control_WatchStats_FullMethodName     = "/diusim.v1.Control/WatchStats"
+	Control_Pause_FullMethodName          = "/diusim.v1.Control/Pause"
+	Control_Resume_FullMethodName         = "/diusim.v1.Control/Resume"
+	Control_SetRates_FullMethodName       = "/diusim.v1.Control/SetRates"
+	Control_ListSensors_FullMethodName    = "/diusim.v1.Control/ListSensors"
+	Control_AddSensor_FullMethodName      = "/diusim.v1.Control/AddSensor"
+	Control_RemoveSensor_FullMethodName   = "/diusim.v1.Control/RemoveSensor"
+	Control_SetSensorRates_FullMethodName = "/diusim.v1.Control/SetSensorRates"
+	Control_TriggerFault_FullMethodName   = "/diusim.v1.Control/TriggerFault"
+	Control_PauseSensors_FullMethodName   = "/diusim.v1.Control/PauseSensors"
+	Control_ResumeSensors_FullMethodName  = "/diusim.v1.Control/ResumeSensors"
+)
+
+// ControlClient is the client API for Control service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Control drives a running simulation, as the HTTP control API does.
+type ControlClient interface {
+	// GetStats returns the simulation's state and throughput.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error)
+	// WatchStats streams the simulation's stats every interval until the
+	// call is cancelled or the simulation stops.
+	WatchStats(ctx context.Context, in *WatchStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Stats], error)
+	// Pause pauses all sensors.
+	Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*Stats, error)
+	// Resume resumes them.
+	Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*Stats, error)
+	// SetRates sets the global publish rates, which apply to the sensors that
+	// have no rates of their own.
+	SetRates(ctx context.Context, in *SetRatesRequest, opts ...grpc.CallOption) (*Stats, error)
+	// ListSensors lists the running sensors, sorted by ID.
+	ListSensors(ctx context.Context, in *ListSensorsRequest, opts ...grpc.CallOption) (*ListSensorsResponse, error)
+	// AddSensor adds and starts a sensor.
+	AddSensor(ctx context.Context, in *AddSensorRequest, opts ...grpc.CallOption) (*Sensor, error)
+	// RemoveSensor stops a sensor.
+	RemoveSensor(ctx context.Context, in *RemoveSensorRequest, opts ...grpc.CallOption) (*RemoveSensorResponse, error)
+	// SetSensorRates sets the publish rates of a sensor.
+	SetSensorRates(ctx context.Context, in *SetSensorRatesRequest, opts ...grpc.CallOption) (*Sensor, error)
+	// TriggerFault puts a sensor into a fault for a while.
+	TriggerFault(ctx context.Context, in *TriggerFaultRequest, opts ...grpc.CallOption) (*Sensor, error)
+	// PauseSensors pauses the selected sensors, returning them.
+	PauseSensors(ctx context.Context, in *SensorSelector, opts ...grpc.CallOption) (*ListSensorsResponse, error)
+	// ResumeSensors resumes the selected sensors, returning them.
+	ResumeSensors(ctx context.Context, in *SensorSelector, opts ...grpc.CallOption) (*ListSensorsResponse, error)
+}
+
+type controlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewControlClient(cc grpc.ClientConnInterface) ControlClient {
+	return &controlClient{cc}
+}
+
+func (c *controlClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, Control_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) WatchStats(ctx context.Context, in *WatchStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Stats], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Control_ServiceDesc.Streams[0], Control_WatchStats_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchStatsRequest, Stats]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Control_WatchStatsClient = grpc.ServerStreamingClient[Stats]
+
+func (c *controlClient) Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*Stats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, Control_Pause_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*Stats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, Control_Resume_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) SetRates(ctx context.Context, in *SetRatesRequest, opts ...grpc.CallOption) (*Stats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, Control_SetRates_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) ListSensors(ctx context.Context, in *ListSensorsRequest, opts ...grpc.CallOption) (*ListSensorsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSensorsResponse)
+	err := c.cc.Invoke(ctx, Control_ListSensors_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) AddSensor(ctx context.Context, in *AddSensorRequest, opts ...grpc.CallOption) (*Sensor, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Sensor)
+	err := c.cc.Invoke(ctx, Control_AddSensor_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) RemoveSensor(ctx context.Context, in *RemoveSensorRequest, opts ...grpc.CallOption) (*RemoveSensorResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemoveSensorResponse)
+	err := c.cc.Invoke(ctx, Control_RemoveSensor_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) SetSensorRates(ctx context.Context, in *SetSensorRatesRequest, opts ...grpc.CallOption) (*Sensor, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Sensor)
+	err := c.cc.Invoke(ctx, Control_SetSensorRates_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) TriggerFault(ctx context.Context, in *TriggerFaultRequest, opts ...grpc.CallOption) (*Sensor, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Sensor)
+	err := c.cc.Invoke(ctx, Control_TriggerFault_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) PauseSensors(ctx context.Context, in *SensorSelector, opts ...grpc.CallOption) (*ListSensorsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSensorsResponse)
+	err := c.cc.Invoke(ctx, Control_PauseSensors_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) ResumeSensors(ctx context.Context, in *SensorSelector, opts ...grpc.CallOption) (*ListSensorsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSensorsResponse)
+	err := c.cc.Invoke(ctx, Control_ResumeSensors_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ControlServer is the server API for Control service.
+// All implementations must embed UnimplementedControlServer
+// for forward compatibility.
+//
+// Control drives a running simulation, as the HTTP control API does.
+type ControlServer interface {
+	// GetStats returns the simulation's state and throughput.
+	GetStats(context.Context, *GetStatsRequest) (*Stats, error)
+	// WatchStats streams the simulation's stats every interval until the
+	// call is cancelled or the simulation stops.
+	WatchStats(*WatchStatsRequest, grpc.ServerStreamingServer[Stats]) error
+	// Pause pauses all sensors.
+	Pause(context.Context, *PauseRequest) (*Stats, error)
+	// Resume resumes them.
+	Resume(context.Context, *ResumeRequest) (*Stats, error)
+	// SetRates sets the global publish rates, which apply to the sensors that
+	// have no rates of their own.
+	SetRates(context.Context, *SetRatesRequest) (*Stats, error)
+	// ListSensors lists the running sensors, sorted by ID.
+	ListSensors(context.Context, *ListSensorsRequest) (*ListSensorsResponse, error)
+	// AddSensor adds and starts a sensor.
+	AddSensor(context.Context, *AddSensorRequest) (*Sensor, error)
+	// RemoveSensor stops a sensor.
+	RemoveSensor(context.Context, *RemoveSensorRequest) (*RemoveSensorResponse, error)
+	// SetSensorRates sets the publish rates of a sensor.
+	SetSensorRates(context.Context, *SetSensorRatesRequest) (*Sensor, error)
+	// TriggerFault puts a sensor into a fault for a while.
+	TriggerFault(context.Context, *TriggerFaultRequest) (*Sensor, error)
+	// PauseSensors pauses the selected sensors, returning them.
+	PauseSensors(context.Context, *SensorSelector) (*ListSensorsResponse, error)
+	// ResumeSensors resumes the selected sensors, returning them.
+	ResumeSensors(context.Context, *SensorSelector) (*ListSensorsResponse, error)
+	mustEmbedUnimplementedControlServer()
+}
+
+// UnimplementedControlServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedControlServer struct{}
+
+func (UnimplementedControlServer) GetStats(context.Context, *GetStatsRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedControlServer) WatchStats(*WatchStatsRequest, grpc.ServerStreamingServer[Stats]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchStats not implemented")
+}
+func (UnimplementedControlServer) Pause(context.Context, *PauseRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pause not implemented")
+}
+func (UnimplementedControlServer) Resume(context.Context, *ResumeRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resume not implemented")
+}
+func (UnimplementedControlServer) SetRates(context.Context, *SetRatesRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRates not implemented")
+}
+func (UnimplementedControlServer) ListSensors(context.Context, *ListSensorsRequest) (*ListSensorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSensors not implemented")
+}
+func (UnimplementedControlServer) AddSensor(context.Context, *AddSensorRequest) (*Sensor, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddSensor not implemented")
+}
+func (UnimplementedControlServer) RemoveSensor(context.Context, *RemoveSensorRequest) (*RemoveSensorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveSensor not implemented")
+}
+func (UnimplementedControlServer) SetSensorRates(context.Context, *SetSensorRatesRequest) (*Sensor, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetSensorRates not implemented")
+}
+func (UnimplementedControlServer) TriggerFault(context.Context, *TriggerFaultRequest) (*Sensor, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerFault not implemented")
+}
+func (UnimplementedControlServer) PauseSensors(context.Context, *SensorSelector) (*ListSensorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseSensors not implemented")
+}
+func (UnimplementedControlServer) ResumeSensors(context.Context, *SensorSelector) (*ListSensorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeSensors not implemented")
+}
+func (UnimplementedControlServer) mustEmbedUnimplementedControlServer() {}
+func (UnimplementedControlServer) testEmbeddedByValue()                 {}
+
+// UnsafeControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ControlServer will
+// result in compilation errors.
+type UnsafeControlServer interface {
+	mustEmbedUnimplementedControlServer()
+}
+
+func RegisterControlServer(s grpc.ServiceRegistrar, srv ControlServer) {
+	// If the following call pancis, it indicates UnimplementedControlServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Control_ServiceDesc, srv)
+}
+
+func _Control_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_WatchStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlServer).WatchStats(m, &grpc.GenericServerStream[WatchStatsRequest, Stats]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Control_WatchStatsServer = grpc.ServerStreamingServer[Stats]
+
+func _Control_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_Pause_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Pause(ctx, req.(*PauseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_Resume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Resume(ctx, req.(*ResumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_SetRates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).SetRates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_SetRates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).SetRates(ctx, req.(*SetRatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_ListSensors_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSensorsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).ListSensors(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_ListSensors_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).ListSensors(ctx, req.(*ListSensorsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_AddSensor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddSensorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).AddSensor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_AddSensor_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).AddSensor(ctx, req.(*AddSensorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_RemoveSensor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveSensorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).RemoveSensor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_RemoveSensor_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).RemoveSensor(ctx, req.(*RemoveSensorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_SetSensorRates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetSensorRatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).SetSensorRates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_SetSensorRates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).SetSensorRates(ctx, req.(*SetSensorRatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_TriggerFault_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerFaultRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).TriggerFault(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_TriggerFault_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).TriggerFault(ctx, req.(*TriggerFaultRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_PauseSensors_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SensorSelector)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).PauseSensors(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_PauseSensors_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).PauseSensors(ctx, req.(*SensorSelector))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_ResumeSensors_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SensorSelector)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).ResumeSensors(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_ResumeSensors_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).ResumeSensors(ctx, req.(*SensorSelector))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Control_ServiceDesc is the grpc.ServiceDesc for Control service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Control_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "diusim.v1.Control",
+	HandlerType: (*ControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStats",
+			Handler:    _Control_GetStats_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Control_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Control_Resume_Handler,
+		},
+		{
+			MethodName: "SetRates",
+			Handler:    _Control_SetRates_Handler,
+		},
+		{
+			MethodName: "ListSensors",
+			Handler:    _Control_ListSensors_Handler,
+		},
+		{
+			MethodName: "AddSensor",
+			Handler:    _Control_AddSensor_Handler,
+		},
+		{
+			MethodName: "RemoveSensor",
+			Handler:    _Control_RemoveSensor_Handler,
+		},
+		{
+			MethodName: "SetSensorRates",
+			Handler:    _Control_SetSensorRates_Handler,
+		},
+		{
+			MethodName: "TriggerFault",
+			Handler:    _Control_TriggerFault_Handler,
+		},
+		{
+			MethodName: "PauseSensors",
+			Handler:    _Control_PauseSensors_Handler,
+		},
+		{
+			MethodName: "ResumeSensors",
+			Handler:    _Control_ResumeSensors_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchStats",
+			Handler:       _Control_WatchStats_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "control.proto",
+}
@@ -0,0 +1,8 @@
+// Package diusimpb contains the protobuf messages used for protobuf
+// payloads, the gRPC collector service used by the simulator's gRPC
+// output and the gRPC control service the simulator serves. Consumers can
+// generate code for other languages from reading.proto, collector.proto
+// and control.proto.
+package diusimpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative reading.proto collector.proto control.proto
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// instanceID identifies this run of the simulator in reading envelopes. It
+// is the instance-id setting, or a random UUID chosen at startup.
+var instanceID = sync.OnceValue(func() string {
+	if id := viper.GetString("instance-id"); id != "" {
+		return id
+	}
+	id, _ := newEventID()
+	return id
+})
+
+// envelopeEncoder wraps the payload of each reading in a JSON envelope
+// carrying the fields consumers need for compatibility checks and
+// de-duplication. The payload is embedded like CloudEvents data: JSON as-is,
+// text as a string and binary payloads base64-encoded. A batch envelope
+// carries the DIU and sequence number of its first reading and the number
+// of readings it holds.
+type envelopeEncoder struct {
+	data          payloadCodec
+	schemaVersion string
+}
+
+type readingEnvelope struct {
+	SchemaVersion string          `json:"schema_version"`
+	InstanceID    string          `json:"instance_id"`
+	DIU           string          `json:"diu_id"`
+	Sequence      uint64          `json:"sequence"`
+	Count         int             `json:"count,omitempty"`
+	ContentType   string          `json:"content_type"`
+	Reading       json.RawMessage `json:"reading,omitempty"`
+	ReadingBase64 []byte          `json:"reading_base64,omitempty"`
+}
+
+// newEnvelopeEncoder returns the envelope configured for the named sink, or
+// nil if envelopes are off.
+func newEnvelopeEncoder(sink string) (*envelopeEncoder, error) {
+	if !viper.GetBool(sinkKey(sink, "envelope.enabled")) {
+		return nil, nil
+	}
+	version := sinkSetting(sink, "envelope.schema-version")
+	if version == "" {
+		version = "1"
+	}
+	return &envelopeEncoder{schemaVersion: version}, nil
+}
+
+func (e *envelopeEncoder) Encode(r Reading) (Message, error) {
+	payload, err := e.data.Encode(r)
+	if err != nil {
+		return Message{}, err
+	}
+	return e.wrap(r, 0, payload)
+}
+
+func (e *envelopeEncoder) EncodeBatch(rs []Reading) (Message, error) {
+	payload, err := e.data.EncodeBatch(rs)
+	if err != nil {
+		return Message{}, err
+	}
+	return e.wrap(rs[0], len(rs), payload)
+}
+
+func (e *envelopeEncoder) wrap(r Reading, count int, payload Message) (Message, error) {
+	envelope := readingEnvelope{
+		SchemaVersion: e.schemaVersion,
+		InstanceID:    instanceID(),
+		DIU:           r.DIU,
+		Sequence:      r.Sequence,
+		Count:         count,
+		ContentType:   payload.ContentType,
+	}
+	envelope.Reading, envelope.ReadingBase64 = embedPayload(payload)
+
+	body, err := json.Marshal(envelope)
+	return Message{Body: body, ContentType: "application/json", Headers: payload.Headers}, err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEnvelope(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("envelope.enabled", true)
+	viper.Set("envelope.schema-version", "2.1")
+
+	reading := testReading
+	reading.Sequence = 42
+
+	encoder, err := newEncoder("redis", false)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+	msg, err := encoder.Encode(reading)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+
+	var envelope readingEnvelope
+	if err := json.Unmarshal(msg.Body, &envelope); err != nil {
+		t.Fatalf("Error decoding envelope: %v", err)
+	}
+	if envelope.SchemaVersion != "2.1" || envelope.InstanceID == "" || envelope.DIU != "diu_000" || envelope.Sequence != 42 {
+		t.Errorf("Unexpected envelope fields: %+v", envelope)
+	}
+	var data SensorData
+	if err := json.Unmarshal(envelope.Reading, &data); err != nil || !reflect.DeepEqual(data, testReading.SensorData) {
+		t.Errorf("Expected the JSON reading to be embedded, got %s", envelope.Reading)
+	}
+
+	batch, _ := encoder.EncodeBatch([]Reading{reading, reading})
+	envelope = readingEnvelope{}
+	json.Unmarshal(batch.Body, &envelope)
+	if envelope.Count != 2 || envelope.InstanceID != instanceID() {
+		t.Errorf("Unexpected batch envelope: %+v", envelope)
+	}
+
+	// Envelopes can be turned off per sink.
+	viper.Set("redis.envelope.enabled", false)
+	encoder, _ = newEncoder("redis", false)
+	msg, _ = encoder.Encode(reading)
+	if err := json.Unmarshal(msg.Body, &data); err != nil || !reflect.DeepEqual(data, testReading.SensorData) {
+		t.Errorf("Expected a bare reading, got %s", msg.Body)
+	}
+}
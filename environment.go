@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// weatherComponents is the number of slow sinusoids an ambient variable's
+// weather is made of.
+const weatherComponents = 4
+
+// ambientVariable is one variable of the environment, such as the outdoor
+// temperature: a daily cycle plus weather, slow random variations with a
+// given standard deviation and time scale. The weather is the sum of
+// sinusoids with random periods and phases, so the variable's value at any
+// time can be computed directly and all sensors see the same trajectory.
+type ambientVariable struct {
+	mean, amplitude float64
+	peak            float64 // position of the daily peak in the day
+	loc             *time.Location
+	weather         [weatherComponents]struct{ amplitude, period, phase float64 }
+}
+
+// ambientDefaults are the built-in variables of the environment, in the
+// units of the built-in channels.
+var ambientDefaults = map[string]generatorSpec{
+	"temperature": {"mean": 15, "amplitude": 5, "peak": "15:00", "stddev": 3, "time-scale": "12h"},
+	"humidity":    {"mean": 65, "amplitude": 15, "peak": "05:00", "stddev": 8, "time-scale": "12h"},
+	"pressure":    {"mean": 1.01325, "amplitude": 0, "stddev": 0.01, "time-scale": "48h"},
+}
+
+var (
+	ambientMu sync.Mutex
+	ambient   map[string]*ambientVariable
+)
+
+// environmentSpec returns the configuration of the environment's
+// variables: the built-in ones, with their settings overridden by
+// environment.<variable>, and any other variables defined there.
+func environmentSpec() map[string]generatorSpec {
+	specs := make(map[string]generatorSpec)
+	for name, defaults := range ambientDefaults {
+		specs[name] = generatorSpec{}
+		for key, value := range defaults {
+			specs[name][key] = value
+		}
+	}
+	for name, item := range viper.GetStringMap("environment") {
+		if name == "timezone" {
+			continue
+		}
+		if specs[name] == nil {
+			specs[name] = generatorSpec{}
+		}
+		for key, value := range cast.ToStringMap(item) {
+			specs[name][key] = value
+		}
+	}
+	return specs
+}
+
+// ambientFor returns a variable of the shared environment, building the
+// environment on first use. The environment is configured with, e.g.
+//
+//	environment:
+//	  timezone: Europe/Berlin
+//	  temperature: {mean: 8, amplitude: 4, peak: "14:00", stddev: 3, time-scale: 12h}
+//	  pressure: {mean: 1.013, stddev: 0.012}
+//	  wind: {mean: 4, stddev: 2, time-scale: 2h}
+//
+// Each variable follows a daily cosine of amplitude around mean that peaks
+// at peak in the given timezone (default local), plus weather with a
+// standard deviation of stddev that changes over about time-scale.
+// Temperature, humidity and pressure are built in.
+func ambientFor(name string) (*ambientVariable, error) {
+	ambientMu.Lock()
+	defer ambientMu.Unlock()
+
+	if ambient == nil {
+		timezone := viper.GetString("environment.timezone")
+		if timezone == "" {
+			timezone = "Local"
+		}
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("environment: %w", err)
+		}
+		variables := make(map[string]*ambientVariable)
+		for variable, spec := range environmentSpec() {
+			v, err := newAmbientVariable(spec, loc, sensorRand(0, "environment/"+variable))
+			if err != nil {
+				return nil, fmt.Errorf("environment %s: %w", variable, err)
+			}
+			variables[variable] = v
+		}
+		ambient = variables
+	}
+	return ambient[name], nil
+}
+
+func newAmbientVariable(spec generatorSpec, loc *time.Location, r *rand.Rand) (*ambientVariable, error) {
+	v := &ambientVariable{mean: spec.float("mean", 0), amplitude: spec.float("amplitude", 0), loc: loc}
+	var err error
+	if v.peak, err = parseCycleTime("daily", spec.str("peak", "15:00")); err != nil {
+		return nil, err
+	}
+	stddev := spec.float("stddev", 0)
+	scale := spec.duration("time-scale", 12*time.Hour)
+	if stddev < 0 || scale <= 0 {
+		return nil, fmt.Errorf("stddev must not be negative and time-scale must be positive")
+	}
+	// Sinusoids of amplitude a have a variance of a²/2.
+	amplitude := stddev * math.Sqrt(2.0/weatherComponents)
+	for i := range v.weather {
+		v.weather[i].amplitude = amplitude
+		v.weather[i].period = scale.Seconds() * (1 + 3*r.Float64())
+		v.weather[i].phase = 2 * math.Pi * r.Float64()
+	}
+	return v, nil
+}
+
+// at returns the value of the variable at t.
+func (v *ambientVariable) at(t time.Time) float64 {
+	value := v.mean + v.amplitude*math.Cos(2*math.Pi*(cyclePosition("daily", t.In(v.loc))-v.peak))
+	s := float64(t.UnixNano()) / 1e9
+	for _, w := range v.weather {
+		value += w.amplitude * math.Sin(2*math.Pi*s/w.period+w.phase)
+	}
+	return value
+}
+
+// newEnvironmentGenerator reads a variable of the shared environment (see
+// ambientFor), by default the one named after the sensor's channel, as
+// seen by the sensor: delayed by lag, multiplied by gain and shifted by
+// offset, with gaussian noise of the given stddev added. Gain and offset
+// can be [min, max] pairs to give each sensor its own, as for the
+// calibration modifier.
+func newEnvironmentGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	name := spec.str("variable", sensor.Channel)
+	variable, err := ambientFor(name)
+	if err != nil {
+		return nil, err
+	}
+	if variable == nil {
+		return nil, fmt.Errorf("environment generator for %s: the environment has no variable %q", sensor.ID, name)
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%s", spec.str("seed", ""), sensor.ID)
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+	gain, err := calibrationParam(spec, "gain", 1, r)
+	if err != nil {
+		return nil, fmt.Errorf("environment generator for %s: %w", sensor.ID, err)
+	}
+	offset, err := calibrationParam(spec, "offset", 0, r)
+	if err != nil {
+		return nil, fmt.Errorf("environment generator for %s: %w", sensor.ID, err)
+	}
+	lag := spec.duration("lag", 0)
+	stddev := spec.float("stddev", 0)
+	if lag < 0 || stddev < 0 {
+		return nil, fmt.Errorf("environment generator for %s: lag and stddev must not be negative", sensor.ID)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		return variable.at(t.Add(-lag))*gain + offset + sensor.Rand.NormFloat64()*stddev
+	}), nil
+}
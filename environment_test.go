@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func resetEnvironment(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := ambient
+	ambient = nil
+	t.Cleanup(func() { ambient = saved })
+}
+
+func TestEnvironmentDailyCycle(t *testing.T) {
+	resetEnvironment(t)
+	viper.Set("environment", map[string]any{
+		"timezone":    "UTC",
+		"temperature": map[string]any{"mean": 15, "amplitude": 5, "peak": "15:00", "stddev": 0},
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{15 * time.Hour, 20},
+		{3 * time.Hour, 10},
+		{9 * time.Hour, 15},
+	} {
+		if got := generator.Next(day.Add(tt.at)); !approxEqual(got, tt.want) {
+			t.Errorf("At %v: expected %f, got %f", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestEnvironmentSharedAcrossSensors(t *testing.T) {
+	resetEnvironment(t)
+	viper.Set("environment.wind", map[string]any{"mean": 4, "stddev": 2, "time-scale": "2h"})
+	viper.Set("sensors.sensor_001.generator", map[string]any{"type": "environment", "variable": "wind"})
+	viper.Set("sensors.sensor_002.generator", map[string]any{"type": "environment", "variable": "wind", "offset": 0.5, "gain": 2, "lag": "10m"})
+
+	sensors := make([]ValueGenerator, 2)
+	for i := range sensors {
+		sensor := testSensor(i+1, "wind")
+		sensor.ID = []string{"sensor_001", "sensor_002"}[i]
+		var err error
+		if sensors[i], err = newValueGenerator(sensor); err != nil {
+			t.Fatalf("Error creating generator: %v", err)
+		}
+	}
+
+	var sum, squares float64
+	const n = 5000
+	for i := 0; i < n; i++ {
+		at := testStart.Add(time.Duration(i) * 5 * time.Minute)
+		a, b := sensors[0].Next(at), sensors[1].Next(at.Add(10*time.Minute))
+		if !approxEqual(b, 2*a+0.5) {
+			t.Fatalf("Expected the second sensor to see the wind 10m later, doubled and offset: %f and %f", a, b)
+		}
+		sum += a
+		squares += a * a
+	}
+	mean := sum / n
+	if stddev := math.Sqrt(squares/n - mean*mean); math.Abs(mean-4) > 0.5 || math.Abs(stddev-2) > 0.5 {
+		t.Errorf("Expected the wind to vary around 4 with a stddev of about 2, got %f and %f", mean, stddev)
+	}
+}
+
+func TestEnvironmentDefaultsAndErrors(t *testing.T) {
+	resetEnvironment(t)
+	viper.Set("environment.timezone", "UTC")
+	viper.Set("channels.humidity", map[string]any{"distribution": "environment", "offset": []any{-5, 5}})
+
+	// Channels named after a variable read it by default.
+	generator, err := newValueGenerator(testSensor(1, "pressure"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	if got, want := generator.Next(testStart), ambient["pressure"].at(testStart); got != want {
+		t.Errorf("Expected the ambient pressure %f, got %f", want, got)
+	}
+	// Offsets given as ranges are drawn per sensor.
+	if generator, err = newValueGenerator(testSensor(1, "humidity")); err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	offset := generator.Next(testStart) - ambient["humidity"].at(testStart)
+	if offset < -5 || offset > 5 || offset == 0 {
+		t.Errorf("Expected an offset between -5 and 5, got %f", offset)
+	}
+
+	viper.Set("sensors.sensor_001.generator", map[string]any{"type": "environment", "variable": "snow"})
+	if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+		t.Errorf("Expected an error for an unknown variable")
+	}
+	ambient = nil
+	viper.Set("environment.timezone", "Mars/Olympus_Mons")
+	if _, err := ambientFor("temperature"); err == nil {
+		t.Errorf("Expected an error for an unknown timezone")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+	"github.com/spf13/cast"
+)
+
+// newExpressionGenerator computes each value from an expression in the
+// expr language (https://expr-lang.org), such as
+//
+//	25 + 5*sin(t/60) + noise(0.2)
+//
+// Besides the language's built-ins, expressions can use:
+//
+//	t                          seconds since the simulation started
+//	prev                       the sensor's previous value, initially start
+//	index, id, channel, diu    the sensor's index, ID, channel and DIU
+//	pi                         π
+//	sin, cos, tan, sqrt, exp, log
+//	noise(stddev)              normally distributed noise
+//	uniform(min, max)          a uniformly distributed value
+//	sensor(source[, lag])      another sensor's value, lag seconds ago; the
+//	                           source is a sensor ID or a channel on the
+//	                           same DIU, as for the follow generator
+func newExpressionGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	source := spec.str("expression", "")
+	if source == "" {
+		return nil, fmt.Errorf("expr generator for %s: expression must be set", sensor.ID)
+	}
+
+	var now time.Time
+	sources := make(map[string]string) // source parameters resolved to sensor IDs
+	env := map[string]any{
+		"t":       0.0,
+		"prev":    spec.float("start", 0),
+		"index":   sensor.Index,
+		"id":      sensor.ID,
+		"channel": sensor.Channel,
+		"diu":     sensor.DIU,
+		"pi":      math.Pi,
+	}
+	options := []expr.Option{
+		expr.Env(env),
+		expr.AsFloat64(),
+		expr.Function("noise", func(params ...any) (any, error) {
+			return sensor.Rand.NormFloat64() * cast.ToFloat64(params[0]), nil
+		}, new(func(float64) float64)),
+		expr.Function("uniform", func(params ...any) (any, error) {
+			min, max := cast.ToFloat64(params[0]), cast.ToFloat64(params[1])
+			return min + sensor.Rand.Float64()*(max-min), nil
+		}, new(func(float64, float64) float64)),
+		expr.Function("sensor", func(params ...any) (any, error) {
+			var lag time.Duration
+			if len(params) > 1 {
+				lag = time.Duration(cast.ToFloat64(params[1]) * float64(time.Second))
+			}
+			source := params[0].(string)
+			id, ok := sources[source]
+			if !ok {
+				// Sources are resolved on first use, once all sensors
+				// are registered.
+				if id, ok = signals.resolve(source, sensor); !ok {
+					return 0.0, nil
+				}
+				sources[source] = id
+			}
+			signals.watch(id, lag)
+			value, _ := signals.valueAt(id, now.Add(-lag))
+			return value, nil
+		}, new(func(string) float64), new(func(string, float64) float64)),
+	}
+	for name, f := range map[string]func(float64) float64{
+		"sin":  math.Sin,
+		"cos":  math.Cos,
+		"tan":  math.Tan,
+		"sqrt": math.Sqrt,
+		"exp":  math.Exp,
+		"log":  math.Log,
+	} {
+		options = append(options, expr.Function(name, func(params ...any) (any, error) {
+			return f(cast.ToFloat64(params[0])), nil
+		}, new(func(float64) float64)))
+	}
+
+	program, err := expr.Compile(source, options...)
+	if err != nil {
+		return nil, fmt.Errorf("expr generator for %s: %w", sensor.ID, err)
+	}
+
+	var (
+		machine vm.VM
+		failed  bool
+	)
+	return generatorFunc(func(t time.Time) float64 {
+		now = t
+		env["t"] = t.Sub(sensor.Start).Seconds()
+		out, err := machine.Run(program, env)
+		if err != nil {
+			// Keep the previous value, reporting the error only once
+			// rather than on every sample.
+			if !failed {
+				log.Printf("Error evaluating expression for %s: %v", sensor.ID, err)
+				failed = true
+			}
+			return env["prev"].(float64)
+		}
+		value := out.(float64)
+		env["prev"] = value
+		return value
+	}), nil
+}
+
+// sourceVisitor collects the literal sources of sensor() calls.
+type sourceVisitor []string
+
+func (v *sourceVisitor) Visit(node *ast.Node) {
+	call, ok := (*node).(*ast.CallNode)
+	if !ok || len(call.Arguments) == 0 {
+		return
+	}
+	if callee, ok := call.Callee.(*ast.IdentifierNode); !ok || callee.Value != "sensor" {
+		return
+	}
+	if source, ok := call.Arguments[0].(*ast.StringNode); ok {
+		*v = append(*v, source.Value)
+	}
+}
+
+// expressionSources returns the sources an expression reads with sensor()
+// calls, where they are given as string literals.
+func expressionSources(source string) ([]string, error) {
+	tree, err := parser.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	var sources sourceVisitor
+	ast.Walk(&tree.Node, &sources)
+	return sources, nil
+}
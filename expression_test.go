@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestExpressionGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	tests := []struct {
+		expression string
+		at         time.Duration
+		want       float64
+	}{
+		{"25 + 5*sin(t/60)", 15 * time.Second, 25 + 5*math.Sin(0.25)},
+		{"sqrt(index) * 2", 0, 2},
+		{"channel == 'temperature' ? 1 : 0", 0, 1},
+		{"prev + 1", 0, 11},
+		{"25 + noise(0)", 0, 25},
+		{"uniform(3, 3)", 0, 3},
+	}
+	for _, tt := range tests {
+		viper.Set("channels.temperature.generator", map[string]any{
+			"type":       "expr",
+			"expression": tt.expression,
+			"start":      10,
+		})
+		generator, err := newValueGenerator(testSensor(1, "temperature"))
+		if err != nil {
+			t.Fatalf("%s: error creating generator: %v", tt.expression, err)
+		}
+		if got := generator.Next(testStart.Add(tt.at)); !approxEqual(got, tt.want) {
+			t.Errorf("%s: expected %f, got %f", tt.expression, tt.want, got)
+		}
+	}
+}
+
+func TestExpressionReferencesSensors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+
+	source := testSensor(0, "temperature")
+	source.ID = "sensor_000"
+	signals.register(source)
+
+	viper.Set("channels.pressure.generator", map[string]any{
+		"type":       "expr",
+		"expression": "sensor('temperature') - sensor('sensor_000', 5)",
+	})
+	sensor := testSensor(1, "pressure")
+	signals.register(sensor)
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+
+	if got := generator.Next(testStart); got != 0 {
+		t.Errorf("Expected 0 before the source has values, got %f", got)
+	}
+	for i := 0; i <= 10; i++ {
+		signals.record("sensor_000", testStart.Add(time.Duration(i)*time.Second), float64(i))
+	}
+	if got := generator.Next(testStart.Add(10 * time.Second)); got != 5 {
+		t.Errorf("Expected the change over 5s to be 5, got %f", got)
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	for _, expression := range []string{"", "25 +", "unknown(1)", "'text'"} {
+		viper.Set("channels.temperature.generator", map[string]any{"type": "expr", "expression": expression})
+		if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+			t.Errorf("Expected an error for expression %q", expression)
+		}
+	}
+}
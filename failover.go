@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// failoverSink writes to a primary sink and switches to a secondary after
+// failover.error-threshold consecutive primary errors. While failed over,
+// one reading every failover.probe-interval is sent to the primary instead;
+// after failover.recovery-threshold consecutive successful probes it fails
+// back. Every switch is logged so outage rehearsals can be correlated with
+// downstream behaviour.
+type failoverSink struct {
+	primary, secondary         Sink
+	primaryName, secondaryName string
+
+	errorThreshold    int
+	recoveryThreshold int
+	probeInterval     time.Duration
+
+	mu         sync.Mutex
+	failedOver bool
+	errors     int
+	recoveries int
+	lastProbe  time.Time
+}
+
+func newFailoverSink() (*failoverSink, error) {
+	s := &failoverSink{
+		primaryName:       viper.GetString("failover.primary"),
+		secondaryName:     viper.GetString("failover.secondary"),
+		errorThreshold:    viper.GetInt("failover.error-threshold"),
+		recoveryThreshold: viper.GetInt("failover.recovery-threshold"),
+		probeInterval:     viper.GetDuration("failover.probe-interval"),
+	}
+	if s.primaryName == "" || s.secondaryName == "" {
+		return nil, fmt.Errorf("failover.primary and failover.secondary must both be set")
+	}
+	if s.primaryName == "failover" || s.secondaryName == "failover" {
+		return nil, fmt.Errorf("failover sinks cannot be nested")
+	}
+	if s.errorThreshold <= 0 {
+		s.errorThreshold = 5
+	}
+	if s.recoveryThreshold <= 0 {
+		s.recoveryThreshold = 3
+	}
+	if s.probeInterval <= 0 {
+		s.probeInterval = 10 * time.Second
+	}
+
+	var err error
+	if s.primary, err = newSink(s.primaryName); err != nil {
+		return nil, fmt.Errorf("primary sink: %w", err)
+	}
+	if s.secondary, err = newSink(s.secondaryName); err != nil {
+		s.primary.Close()
+		return nil, fmt.Errorf("secondary sink: %w", err)
+	}
+	return s, nil
+}
+
+func (s *failoverSink) Publish(ctx context.Context, r Reading) error {
+	s.mu.Lock()
+	failedOver := s.failedOver
+	probe := failedOver && time.Since(s.lastProbe) >= s.probeInterval
+	if probe {
+		s.lastProbe = time.Now()
+	}
+	s.mu.Unlock()
+
+	if !failedOver {
+		err := s.primary.Publish(ctx, r)
+		if err != nil && s.recordPrimaryError(err) {
+			// Don't lose the reading that tipped us over.
+			return s.secondary.Publish(ctx, r)
+		}
+		if err == nil {
+			s.mu.Lock()
+			s.errors = 0
+			s.mu.Unlock()
+		}
+		return err
+	}
+
+	if probe {
+		err := s.primary.Publish(ctx, r)
+		s.recordProbe(err)
+		if err == nil {
+			return nil
+		}
+	}
+	return s.secondary.Publish(ctx, r)
+}
+
+// recordPrimaryError counts a primary failure and reports whether it caused
+// a switch to the secondary.
+func (s *failoverSink) recordPrimaryError(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failedOver {
+		return true
+	}
+	s.errors++
+	if s.errors < s.errorThreshold {
+		return false
+	}
+
+	s.failedOver = true
+	s.recoveries = 0
+	s.lastProbe = time.Now()
+	log.Printf("Failover: switching from %s to %s after %d consecutive errors: %v",
+		s.primaryName, s.secondaryName, s.errors, err)
+	return true
+}
+
+func (s *failoverSink) recordProbe(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.recoveries = 0
+		return
+	}
+	s.recoveries++
+	if s.recoveries >= s.recoveryThreshold && s.failedOver {
+		s.failedOver = false
+		s.errors = 0
+		log.Printf("Failover: %s recovered after %d successful probes, switching back from %s",
+			s.primaryName, s.recoveries, s.secondaryName)
+	}
+}
+
+func (s *failoverSink) Close() error {
+	return errors.Join(s.primary.Close(), s.secondary.Close())
+}
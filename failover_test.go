@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFailoverSink(t *testing.T) {
+	primary, secondary := &recordingSink{}, &recordingSink{}
+	sink := &failoverSink{
+		primary:           primary,
+		secondary:         secondary,
+		primaryName:       "primary",
+		secondaryName:     "secondary",
+		errorThreshold:    2,
+		recoveryThreshold: 2,
+		probeInterval:     time.Millisecond,
+	}
+	ctx := context.Background()
+
+	sink.Publish(ctx, Reading{})
+	if primary.count() != 1 || secondary.count() != 0 {
+		t.Fatalf("Expected healthy primary to receive the reading")
+	}
+
+	// The first error is tolerated; the second fails over and the reading
+	// is delivered to the secondary.
+	primary.setFail(true)
+	if err := sink.Publish(ctx, Reading{}); err == nil {
+		t.Errorf("Expected an error below the error threshold")
+	}
+	if err := sink.Publish(ctx, Reading{}); err != nil {
+		t.Errorf("Expected the failover reading to reach the secondary: %v", err)
+	}
+	if !sink.failedOver || secondary.count() != 1 {
+		t.Fatalf("Expected to be failed over with one secondary reading")
+	}
+
+	// Failed probes keep writing to the secondary.
+	time.Sleep(2 * time.Millisecond)
+	sink.Publish(ctx, Reading{})
+	if secondary.count() != 2 {
+		t.Errorf("Expected a failed probe to fall back to the secondary")
+	}
+
+	// Two successful probes fail back.
+	primary.setFail(false)
+	for i := 0; i < 2; i++ {
+		time.Sleep(2 * time.Millisecond)
+		sink.Publish(ctx, Reading{})
+	}
+	if sink.failedOver {
+		t.Fatalf("Expected to fail back after successful probes")
+	}
+	if primary.count() != 3 {
+		t.Errorf("Expected probes to be delivered to the primary, got %d", primary.count())
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// faultTriggers holds the faults triggered on a sensor at runtime, by kind,
+// with the time each of them ends.
+type faultTriggers struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func (f *faultTriggers) trigger(kind string, until time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.until == nil {
+		f.until = make(map[string]time.Time)
+	}
+	f.until[kind] = until
+}
+
+// activeKinds returns the kinds of the faults in effect at t, sorted.
+func (f *faultTriggers) activeKinds(t time.Time) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var kinds []string
+	for kind, until := range f.until {
+		if t.Before(until) {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// active reports whether a fault of the given kind is in effect at t.
+func (f *faultTriggers) active(kind string, t time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return t.Before(f.until[kind])
+}
+
+// runtimeFaults are the kinds of faults that can be triggered at runtime.
+var runtimeFaults = []string{"stuck", "dropout", "spike", "nan"}
+
+// applyFaults layers the faults that can be triggered at runtime over a
+// sensor's generator:
+//
+//	stuck:   the sensor repeats the value it had when the fault began
+//	dropout: the sensor's samples are dropped
+//	spike:   the samples are offset by half the sensor's range, up or down
+//	         at random, and labelled as spike anomalies
+//	nan:     the sensor reads NaN
+func applyFaults(sensor sensorInfo, generator ValueGenerator) ValueGenerator {
+	min, max := sensorRange(sensor)
+	magnitude := (max - min) / 2
+	var held float64
+	var holding bool
+	return generatorFunc(func(t time.Time) float64 {
+		value := generator.Next(t)
+		if sensor.Faults.active("dropout", t) {
+			sensor.Notes.Drop = true
+		}
+		if sensor.Faults.active("spike", t) {
+			if sensor.Rand.Intn(2) == 0 {
+				value -= magnitude
+			} else {
+				value += magnitude
+			}
+			sensor.Notes.Anomaly = "spike"
+		}
+		if sensor.Faults.active("nan", t) {
+			sensor.Notes.Fault = "nan"
+			return math.NaN()
+		}
+		if !sensor.Faults.active("stuck", t) {
+			holding = false
+			return value
+		}
+		if !holding {
+			held, holding = value, true
+		}
+		sensor.Notes.Fault = "stuck"
+		return held
+	})
+}
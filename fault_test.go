@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestTriggeredStuckFault(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{"type": "sawtooth", "period": "10s", "amplitude": 5, "offset": 25})
+
+	sensor := testSensor(0, "temperature")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+
+	sensor.Faults.trigger("stuck", testStart.Add(5*time.Second))
+	for i, want := range []float64{20, 20, 20, 20, 20, 25} {
+		*sensor.Notes = sampleNotes{}
+		got := generator.Next(testStart.Add(time.Duration(i) * time.Second))
+		if !approxEqual(got, want) {
+			t.Errorf("At %ds: expected %f, got %f", i, want, got)
+		}
+		if stuck := sensor.Notes.Fault == "stuck"; stuck != (i < 5) {
+			t.Errorf("At %ds: unexpected fault note %q", i, sensor.Notes.Fault)
+		}
+	}
+}
+
+func TestTriggeredRuntimeFaults(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{"type": "sawtooth", "period": "10s", "amplitude": 5, "offset": 25})
+
+	sensor := testSensor(0, "temperature")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	min, max := sensorRange(sensor)
+
+	sensor.Faults.trigger("dropout", testStart.Add(2*time.Second))
+	sensor.Faults.trigger("spike", testStart.Add(4*time.Second))
+	sensor.Faults.trigger("nan", testStart.Add(6*time.Second))
+	for i := 0; i < 8; i++ {
+		*sensor.Notes = sampleNotes{}
+		got := generator.Next(testStart.Add(time.Duration(i) * time.Second))
+		if sensor.Notes.Drop != (i < 2) {
+			t.Errorf("At %ds: expected dropped %v, got %v", i, i < 2, sensor.Notes.Drop)
+		}
+		if spiked := sensor.Notes.Anomaly == "spike"; spiked != (i < 4) {
+			t.Errorf("At %ds: unexpected anomaly note %q", i, sensor.Notes.Anomaly)
+		}
+		if math.IsNaN(got) != (i < 6) || (sensor.Notes.Fault == "nan") != (i < 6) {
+			t.Errorf("At %ds: unexpected value %f with fault note %q", i, got, sensor.Notes.Fault)
+		}
+	}
+
+	// Spikes offset the readings by half the sensor's range.
+	sensor.Faults.trigger("spike", testStart.Add(20*time.Second))
+	at := testStart.Add(11 * time.Second)
+	if got := generator.Next(at); !approxEqual(math.Abs(got-21), (max-min)/2) {
+		t.Errorf("Expected a spike of %f off 21, got %f", (max-min)/2, got)
+	}
+}
+
+func TestTriggerFaultAtRuntime(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{"type": "sawtooth", "period": "10s", "amplitude": 5, "offset": 25})
+	viper.Set("sensors.sensor_000.channel", "temperature")
+
+	sensor, err := newSimulatedSensor(0)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	sim := &simulation{sensors: map[string]*simulatedSensor{"sensor_000": sensor}}
+	if _, err := sim.triggerFault("sensor_000", "frozen", time.Minute); err == nil {
+		t.Error("Expected an error for an unknown fault")
+	}
+	if _, err := sim.triggerFault("sensor_999", "stuck", time.Minute); err == nil {
+		t.Error("Expected an error for an unknown sensor")
+	}
+	if _, err := sim.triggerFault("SENSOR_000", "stuck", time.Minute); err != nil {
+		t.Fatalf("Error triggering fault: %v", err)
+	}
+
+	// The sensor holds its last value until the fault ends.
+	now := time.Now()
+	first := sensor.sample(now, 1)
+	for i := 1; i < 4; i++ {
+		got := sensor.sample(now.Add(time.Duration(i)*time.Second), uint64(i+1))
+		if got.Value != first.Value || sensor.info.Notes.Fault != "stuck" {
+			t.Errorf("At %ds: expected %f stuck, got %f with fault note %q", i, first.Value, got.Value, sensor.info.Notes.Fault)
+		}
+	}
+	if got := sensor.sample(now.Add(2*time.Minute+5*time.Second), 5); got.Value == first.Value || sensor.info.Notes.Fault != "" {
+		t.Errorf("Expected the fault over after its duration, got %f with fault note %q", got.Value, sensor.info.Notes.Fault)
+	}
+}
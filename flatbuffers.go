@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+
+	"rgehrsitz/diu_sim/diusimfb"
+)
+
+// flatBuilders recycles FlatBuffers builders between messages.
+var flatBuilders = sync.Pool{
+	New: func() any { return flatbuffers.NewBuilder(256) },
+}
+
+// buildSensorReading adds a diusimfb.SensorReading table for r to builder.
+func buildSensorReading(builder *flatbuffers.Builder, r Reading) flatbuffers.UOffsetT {
+	sensorID := builder.CreateString(r.SensorID)
+	channel := builder.CreateString(r.Channel)
+	diu := builder.CreateString(r.DIU)
+	name := builder.CreateString(r.Name)
+	var anomalyType flatbuffers.UOffsetT
+	if r.AnomalyType != "" {
+		anomalyType = builder.CreateString(r.AnomalyType)
+	}
+
+	diusimfb.SensorReadingStart(builder)
+	diusimfb.SensorReadingAddSensorId(builder, sensorID)
+	diusimfb.SensorReadingAddChannel(builder, channel)
+	if t, err := time.Parse(time.RFC3339Nano, r.Timestamp); err == nil {
+		diusimfb.SensorReadingAddTimestampNs(builder, t.UnixNano())
+	}
+	diusimfb.SensorReadingAddValue(builder, r.Value)
+	diusimfb.SensorReadingAddDiu(builder, diu)
+	diusimfb.SensorReadingAddName(builder, name)
+	if r.Anomaly {
+		diusimfb.SensorReadingAddAnomaly(builder, true)
+		diusimfb.SensorReadingAddAnomalyType(builder, anomalyType)
+	}
+	return diusimfb.SensorReadingEnd(builder)
+}
+
+// encodeFlatBuffers encodes a reading as a diusimfb.SensorReading table (see
+// diusimfb/reading.fbs).
+func encodeFlatBuffers(r Reading) (Message, error) {
+	builder := flatBuilders.Get().(*flatbuffers.Builder)
+	defer flatBuilders.Put(builder)
+	builder.Reset()
+
+	builder.Finish(buildSensorReading(builder, r))
+	body := append([]byte(nil), builder.FinishedBytes()...)
+	return Message{Body: body, ContentType: "application/x-flatbuffers"}, nil
+}
+
+// encodeFlatBuffersBatch encodes readings as a diusimfb.SensorReadingBatch
+// table.
+func encodeFlatBuffersBatch(rs []Reading) (Message, error) {
+	builder := flatBuilders.Get().(*flatbuffers.Builder)
+	defer flatBuilders.Put(builder)
+	builder.Reset()
+
+	offsets := make([]flatbuffers.UOffsetT, len(rs))
+	for i, r := range rs {
+		offsets[i] = buildSensorReading(builder, r)
+	}
+	diusimfb.SensorReadingBatchStartReadingsVector(builder, len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		builder.PrependUOffsetT(offsets[i])
+	}
+	readings := builder.EndVector(len(offsets))
+
+	diusimfb.SensorReadingBatchStart(builder)
+	diusimfb.SensorReadingBatchAddReadings(builder, readings)
+	builder.Finish(diusimfb.SensorReadingBatchEnd(builder))
+
+	body := append([]byte(nil), builder.FinishedBytes()...)
+	return Message{Body: body, ContentType: "application/x-flatbuffers"}, nil
+}
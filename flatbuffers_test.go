@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"rgehrsitz/diu_sim/diusimfb"
+)
+
+func TestEncodeFlatBuffers(t *testing.T) {
+	msg, err := encodeFlatBuffers(testReading)
+	if err != nil {
+		t.Fatalf("Error encoding FlatBuffers: %v", err)
+	}
+
+	decoded := diusimfb.GetRootAsSensorReading(msg.Body, 0)
+	if string(decoded.SensorId()) != "sensor_001" || string(decoded.Channel()) != "pressure" || decoded.Value() != 1.05 || string(decoded.Diu()) != "diu_000" {
+		t.Errorf("Unexpected decoded reading %s %s %v %s", decoded.SensorId(), decoded.Channel(), decoded.Value(), decoded.Diu())
+	}
+	if got := decoded.TimestampNs(); got != 1719835200e9 {
+		t.Errorf("Expected timestamp 1719835200e9, got %d", got)
+	}
+	if decoded.Anomaly() || decoded.AnomalyType() != nil {
+		t.Errorf("Expected no anomaly labels, got %v %q", decoded.Anomaly(), decoded.AnomalyType())
+	}
+
+	labelled := testReading
+	labelled.Anomaly, labelled.AnomalyType = true, "spike"
+	msg, _ = encodeFlatBuffers(labelled)
+	decoded = diusimfb.GetRootAsSensorReading(msg.Body, 0)
+	if !decoded.Anomaly() || string(decoded.AnomalyType()) != "spike" || string(decoded.Name()) != "pressure:sensor_001" {
+		t.Errorf("Expected the anomaly labels decoded, got %v %q", decoded.Anomaly(), decoded.AnomalyType())
+	}
+}
+
+func TestEncodeFlatBuffersBatch(t *testing.T) {
+	second := testReading
+	second.Value = 1.07
+
+	msg, err := encodeFlatBuffersBatch([]Reading{testReading, second})
+	if err != nil {
+		t.Fatalf("Error encoding FlatBuffers batch: %v", err)
+	}
+
+	batch := diusimfb.GetRootAsSensorReadingBatch(msg.Body, 0)
+	var reading diusimfb.SensorReading
+	if batch.ReadingsLength() != 2 || !batch.Readings(&reading, 1) || reading.Value() != 1.07 {
+		t.Errorf("Unexpected decoded batch of %d readings", batch.ReadingsLength())
+	}
+}
+
+// BenchmarkPublishPayloadFormats measures the encoding cost of the structured
+// payload formats in the publish path.
+func BenchmarkPublishPayloadFormats(b *testing.B) {
+	for _, format := range []string{"json", "protobuf", "flatbuffers"} {
+		b.Run(format, func(b *testing.B) {
+			b.Cleanup(viper.Reset)
+			viper.Set("payload-format", format)
+			encoder, err := newEncoder("bench", false)
+			if err != nil {
+				b.Fatalf("Error creating encoder: %v", err)
+			}
+			sink := &sendingSink{}
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				msg, err := encoder.Encode(testReading)
+				if err != nil {
+					b.Fatal(err)
+				}
+				sink.send(context.Background(), testReading, msg)
+				sink.messages = sink.messages[:0]
+				sink.routes = sink.routes[:0]
+			}
+		})
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// ValueGenerator produces the successive values of a simulated sensor. Next
+// is called with the time of each sample.
+type ValueGenerator interface {
+	Next(t time.Time) float64
+}
+
+// generatorFunc adapts a function to the ValueGenerator interface.
+type generatorFunc func(t time.Time) float64
+
+func (f generatorFunc) Next(t time.Time) float64 {
+	return f(t)
+}
+
+// sensorInfo describes the sensor a generator is built for.
+type sensorInfo struct {
+	Index   int
+	ID      string
+	Channel string
+	DIU     string
+	Site    string         // site the sensor's DIU is at, if any
+	Start   time.Time      // start of the simulation
+	Rand    *rand.Rand     // the sensor's own random source
+	Notes   *sampleNotes   // annotations of the sample being generated
+	Faults  *faultTriggers // faults triggered on the sensor at runtime
+}
+
+// sampleNotes are annotations that generators and modifiers attach to the
+// sample they are generating. They are cleared before every sample.
+type sampleNotes struct {
+	Anomaly string // type of anomaly injected into the sample, if any
+	Fault   string // sensor fault affecting the sample, if any
+	Drop    bool   // the sample is not published
+
+	Position *Position // location of position sensors
+	Samples  []float64 // waveform points or spectrum of burst sensors
+
+	Quality  string  // quality code forced by the scenario, if any
+	LinkLoss float64 // dB the scenario degrades the sensor's link by
+}
+
+// generatorSpec is the configuration of a generator: its type and
+// parameters, as read from the config file.
+type generatorSpec map[string]any
+
+func (s generatorSpec) float(key string, def float64) float64 {
+	if v, ok := s[key]; ok {
+		return cast.ToFloat64(v)
+	}
+	return def
+}
+
+func (s generatorSpec) duration(key string, def time.Duration) time.Duration {
+	if v, ok := s[key]; ok {
+		return cast.ToDuration(v)
+	}
+	return def
+}
+
+func (s generatorSpec) str(key, def string) string {
+	if v, ok := s[key]; ok {
+		return cast.ToString(v)
+	}
+	return def
+}
+
+// generatorFactory builds a generator of one type for a sensor.
+type generatorFactory func(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error)
+
+// generatorTypes are the generators selectable with the type parameter.
+var generatorTypes = map[string]generatorFactory{
+	"uniform":     newUniformGenerator,
+	"sine":        newWaveformGenerator,
+	"square":      newWaveformGenerator,
+	"sawtooth":    newWaveformGenerator,
+	"triangle":    newWaveformGenerator,
+	"walk":        newRandomWalkGenerator,
+	"gaussian":    newGaussianGenerator,
+	"normal":      newGaussianGenerator,
+	"lognormal":   newLognormalGenerator,
+	"exponential": newExponentialGenerator,
+	"poisson":     newPoissonGenerator,
+	"follow":      newFollowGenerator,
+	"plant":       newPlantGenerator,
+	"expr":        newExpressionGenerator,
+	"script":      newScriptGenerator,
+	"replay":      newReplayGenerator,
+	"boolean":     newBooleanGenerator,
+	"schedule":    newScheduleGenerator,
+	"choice":      newChoiceGenerator,
+	"route":       newRouteGenerator,
+	"wander":      newWanderGenerator,
+	"burst":       newBurstGenerator,
+	"environment": newEnvironmentGenerator,
+	"battery":     newBatteryGenerator,
+}
+
+// generatorSpecFor returns the generator configuration of a sensor:
+// sensors.<sensor_id>.generator if set, otherwise
+// channels.<channel>.generator. It is empty when neither is set.
+func generatorSpecFor(sensor sensorInfo) generatorSpec {
+	if spec := viper.GetStringMap("sensors." + sensor.ID + ".generator"); len(spec) > 0 {
+		return spec
+	}
+	return viper.GetStringMap("channels." + sensor.Channel + ".generator")
+}
+
+// newValueGenerator builds the configured generator for a sensor, with its
+// modifiers, scenario events and runtime faults applied. Sensors without a
+// generator fall back to defaultGeneratorSpec.
+func newValueGenerator(sensor sensorInfo) (ValueGenerator, error) {
+	spec := generatorSpecFor(sensor)
+	var err error
+	if len(spec) == 0 {
+		if spec, err = defaultGeneratorSpec(sensor); err != nil {
+			return nil, err
+		}
+	}
+	typ := spec.str("type", "uniform")
+	var generator ValueGenerator
+	if factory, ok := generatorTypes[typ]; ok {
+		generator, err = factory(spec, sensor)
+	} else if generator, ok, err = pluginGenerator(typ, spec, sensor); !ok {
+		return nil, fmt.Errorf("unknown generator type %q for %s", typ, sensor.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return layerGenerator(sensor, generator)
+}
+
+// layerGenerator applies a sensor's modifiers, correlated noise, scenario
+// events and runtime faults to its generator.
+func layerGenerator(sensor sensorInfo, generator ValueGenerator) (ValueGenerator, error) {
+	generator, err := applyModifiers(sensor, generator)
+	if err != nil {
+		return nil, err
+	}
+	if generator, err = applyCorrelatedNoise(sensor, generator); err != nil {
+		return nil, err
+	}
+	return applyFaults(sensor, applyScenario(sensor, generator)), nil
+}
+
+// defaultGeneratorSpec returns the generator of a sensor that has none
+// configured. If its channel names a distribution, that generator type is
+// used with the channel's settings as parameters, e.g.
+//
+//	channels:
+//	  vibration: {min: 0, max: 5, distribution: gaussian, stddev: 0.4}
+//	  arrivals: {distribution: poisson, lambda: 3}
+//
+// Distributions are uniform, normal (or gaussian), lognormal, exponential
+// and poisson, though any generator type can be named. Otherwise boolean
+// channels toggle at random, enum channels move between their states at
+// random, text channels pick messages at random, and other sensors read
+// their DIU's plant if that has an output named after the channel, or the
+// shared environment if it is configured and has a variable named after
+// the channel, or draw uniform random values from the channel's range if
+// not.
+func defaultGeneratorSpec(sensor sensorInfo) (generatorSpec, error) {
+	key := "channels." + sensor.Channel
+	if distribution := viper.GetString(key + ".distribution"); distribution != "" {
+		spec := generatorSpec(viper.GetStringMap(key))
+		spec["type"] = distribution
+		return spec, nil
+	}
+	switch viper.GetString(key + ".kind") {
+	case "boolean":
+		return generatorSpec{"type": "boolean"}, nil
+	case "enum":
+		catalog, err := enumCatalog(sensor.Channel)
+		if err != nil {
+			return nil, err
+		}
+		if len(catalog) == 0 {
+			return nil, fmt.Errorf("channel %s: enum must be set for enum channels", sensor.Channel)
+		}
+		return defaultEnumSpec(catalog), nil
+	case "text":
+		catalog, err := messageCatalog(sensor.Channel)
+		if err != nil {
+			return nil, err
+		}
+		if len(catalog) == 0 {
+			return nil, fmt.Errorf("channel %s: messages must be set for text channels", sensor.Channel)
+		}
+		return defaultTextSpec(catalog), nil
+	}
+
+	p, err := plantFor(sensor.DIU)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		if _, ok := p.model.output(sensor.Channel); ok {
+			return generatorSpec{"type": "plant"}, nil
+		}
+	}
+	if viper.IsSet("environment") {
+		variable, err := ambientFor(sensor.Channel)
+		if err != nil {
+			return nil, err
+		}
+		if variable != nil {
+			return generatorSpec{"type": "environment"}, nil
+		}
+	}
+	return generatorSpec{}, nil
+}
+
+// defaultChannelRanges are the value ranges of the built-in channels.
+var defaultChannelRanges = map[string][2]float64{
+	"temperature": {25.0, 35.0},
+	"pressure":    {0.8, 1.2},
+	"humidity":    {70.0, 90.0},
+}
+
+// channelRange returns the value range of a channel: channels.<channel>.min
+// and max where set, otherwise the built-in range, or 0 to 100.
+func channelRange(channel string) (min, max float64) {
+	bounds, ok := defaultChannelRanges[channel]
+	if !ok {
+		bounds = [2]float64{0, 100}
+	}
+	min, max = bounds[0], bounds[1]
+	if key := "channels." + channel + ".min"; viper.IsSet(key) {
+		min = viper.GetFloat64(key)
+	}
+	if key := "channels." + channel + ".max"; viper.IsSet(key) {
+		max = viper.GetFloat64(key)
+	}
+	return min, max
+}
+
+// sensorRange returns the range of a sensor's values: sensors.<id>.min and
+// max, which default to the channel's range.
+func sensorRange(sensor sensorInfo) (min, max float64) {
+	min, max = channelRange(sensor.Channel)
+	if key := "sensors." + sensor.ID + ".min"; viper.IsSet(key) {
+		min = viper.GetFloat64(key)
+	}
+	if key := "sensors." + sensor.ID + ".max"; viper.IsSet(key) {
+		max = viper.GetFloat64(key)
+	}
+	return min, max
+}
+
+// specRange returns the min and max parameters of a generator, which
+// default to the sensor's range.
+func specRange(spec generatorSpec, sensor sensorInfo) (min, max float64, err error) {
+	min, max = sensorRange(sensor)
+	min, max = spec.float("min", min), spec.float("max", max)
+	if min > max {
+		return 0, 0, fmt.Errorf("%s generator for %s: min %g is greater than max %g", spec.str("type", "uniform"), sensor.ID, min, max)
+	}
+	return min, max, nil
+}
+
+// newUniformGenerator draws independent values uniformly between min and
+// max.
+func newUniformGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	min, max, err := specRange(spec, sensor)
+	if err != nil {
+		return nil, err
+	}
+	return generatorFunc(func(time.Time) float64 {
+		return min + sensor.Rand.Float64()*(max-min)
+	}), nil
+}
+
+// newGaussianGenerator draws values of base plus normally distributed noise
+// with the given mean and stddev. By default the base is the middle of the
+// channel's range and the stddev a sixth of the range, so that nearly all
+// values fall within the range. The noise is white, with independent
+// values, unless color is pink or brown (see newNoiseSource).
+func newGaussianGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	min, max, err := specRange(spec, sensor)
+	if err != nil {
+		return nil, err
+	}
+	base := spec.float("base", (min+max)/2)
+	mean := spec.float("mean", 0)
+	stddev := spec.float("stddev", (max-min)/6)
+	if stddev < 0 {
+		return nil, fmt.Errorf("gaussian generator for %s: stddev must not be negative", sensor.ID)
+	}
+	noise, err := newNoiseSource(spec.str("color", "white"), stddev, spec.float("leak", 0.01), sensor.Rand)
+	if err != nil {
+		return nil, fmt.Errorf("gaussian generator for %s: %w", sensor.ID, err)
+	}
+
+	return generatorFunc(func(time.Time) float64 {
+		return base + mean + noise()
+	}), nil
+}
+
+// waveformShapes map the position within a period, in [0, 1), to a value
+// in [-1, 1]. All shapes start at 0 or their low point and rise.
+var waveformShapes = map[string]func(frac float64) float64{
+	"sine": func(frac float64) float64 {
+		return math.Sin(2 * math.Pi * frac)
+	},
+	"square": func(frac float64) float64 {
+		if frac < 0.5 {
+			return 1
+		}
+		return -1
+	},
+	"sawtooth": func(frac float64) float64 {
+		return 2*frac - 1
+	},
+	"triangle": func(frac float64) float64 {
+		return 2 / math.Pi * math.Asin(math.Sin(2*math.Pi*frac))
+	},
+}
+
+// newWaveformGenerator produces offset + amplitude * shape over a period
+// measured from the start of the simulation. The phase is given in degrees;
+// phase-step adds that many degrees per sensor index, so the sensors of a
+// channel can be spread out.
+func newWaveformGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	shape := waveformShapes[spec.str("type", "sine")]
+	amplitude := spec.float("amplitude", 1)
+	offset := spec.float("offset", 0)
+	period := spec.duration("period", time.Minute)
+	if period <= 0 {
+		return nil, fmt.Errorf("waveform generator for %s: period must be positive", sensor.ID)
+	}
+	phase := (spec.float("phase", 0) + spec.float("phase-step", 0)*float64(sensor.Index)) / 360
+
+	return generatorFunc(func(t time.Time) float64 {
+		cycles := float64(t.Sub(sensor.Start))/float64(period) + phase
+		return offset + amplitude*shape(cycles-math.Floor(cycles))
+	}), nil
+}
+
+// newRandomWalkGenerator moves each value from the previous one by a
+// normally distributed step with standard deviation step (default 1% of the
+// range), reflecting off min and max. The walk begins at start, which
+// defaults to the middle of the range.
+func newRandomWalkGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	min, max, err := specRange(spec, sensor)
+	if err != nil {
+		return nil, err
+	}
+	step := spec.float("step", (max-min)/100)
+	if math.IsNaN(step) || math.IsInf(step, 0) || step < 0 {
+		return nil, fmt.Errorf("walk generator for %s: step must be a finite, non-negative number", sensor.ID)
+	}
+	value := spec.float("start", (min+max)/2)
+	if value < min || value > max {
+		return nil, fmt.Errorf("walk generator for %s: start %g is outside %g to %g", sensor.ID, value, min, max)
+	}
+
+	return generatorFunc(func(time.Time) float64 {
+		value = reflectBounds(value+sensor.Rand.NormFloat64()*step, min, max)
+		return value
+	}), nil
+}
+
+// reflectBounds folds v back into [min, max] as if it bounced off the limits.
+// Infinite values are clamped to the limit they lie beyond.
+func reflectBounds(v, min, max float64) float64 {
+	switch {
+	case min == max || math.IsInf(v, -1):
+		return min
+	case math.IsInf(v, 1):
+		return max
+	}
+	// The bounces repeat every two widths of the range; in the second
+	// width the value runs back down from max.
+	width := max - min
+	offset := math.Mod(v-min, 2*width)
+	if offset < 0 {
+		offset += 2 * width
+	}
+	if offset > width {
+		offset = 2*width - offset
+	}
+	return min + offset
+}
+
+// newFollowGenerator couples a sensor to another one: its value is offset +
+// gain * the source's value lag ago, plus normal noise of stddev noise. The
+// source is a sensor ID, or a channel name for the first sensor of that
+// channel on the same DIU. Until the source has a value the sensor reads
+// offset plus noise.
+func newFollowGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	source := spec.str("source", "")
+	if source == "" {
+		return nil, fmt.Errorf("follow generator for %s: source must be set", sensor.ID)
+	}
+	gain := spec.float("gain", 1)
+	offset := spec.float("offset", 0)
+	lag := spec.duration("lag", 0)
+	noise := spec.float("noise", 0)
+
+	// The source is resolved on first use, once all sensors are registered.
+	var sourceID string
+	return generatorFunc(func(t time.Time) float64 {
+		if sourceID == "" {
+			id, ok := signals.resolve(source, sensor)
+			if !ok {
+				return offset + sensor.Rand.NormFloat64()*noise
+			}
+			sourceID = id
+			signals.watch(sourceID, lag)
+		}
+
+		value := offset + sensor.Rand.NormFloat64()*noise
+		if v, ok := signals.valueAt(sourceID, t.Add(-lag)); ok {
+			value += gain * v
+		}
+		return value
+	}), nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var testStart = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+func testSensor(index int, channel string) sensorInfo {
+	return sensorInfo{
+		Index:   index,
+		ID:      "sensor_001",
+		Channel: channel,
+		DIU:     "diu_000",
+		Start:   testStart,
+		Rand:    rand.New(rand.NewSource(1)),
+		Notes:   &sampleNotes{},
+		Faults:  &faultTriggers{},
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestUniformGeneratorDefaultRange(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	generator, err := newValueGenerator(testSensor(1, "pressure"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if v := generator.Next(testStart); v < 0.8 || v > 1.2 {
+			t.Fatalf("Expected pressure between 0.8 and 1.2, got %f", v)
+		}
+	}
+}
+
+func TestChannelRangesFromConfig(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.pressure.max", 2.5)
+	viper.Set("channels.vibration", map[string]any{"min": -1, "max": 1})
+
+	tests := []struct {
+		channel  string
+		min, max float64
+	}{
+		{"pressure", 0.8, 2.5},
+		{"vibration", -1, 1},
+		{"flow", 0, 100},
+	}
+	for _, tt := range tests {
+		sensor := testSensor(1, tt.channel)
+		if min, max, err := specRange(generatorSpec{}, sensor); err != nil || min != tt.min || max != tt.max {
+			t.Errorf("%s: expected range %g to %g, got %g to %g (%v)", tt.channel, tt.min, tt.max, min, max, err)
+		}
+	}
+}
+
+func TestChannelDistribution(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.vibration", map[string]any{
+		"min":          0,
+		"max":          10,
+		"distribution": "gaussian",
+		"stddev":       0,
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "vibration"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	if got := generator.Next(testStart); got != 5 {
+		t.Errorf("Expected the middle of the channel range with no noise, got %f", got)
+	}
+
+	viper.Set("channels.vibration.distribution", "cauchy")
+	if _, err := newValueGenerator(testSensor(1, "vibration")); err == nil {
+		t.Errorf("Expected an error for an unknown distribution")
+	}
+}
+
+func TestWaveformGenerators(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	tests := []struct {
+		typ  string
+		want []float64 // at 0, 1/4, 1/2 and 3/4 of the period
+	}{
+		{"sine", []float64{10, 12, 10, 8}},
+		{"square", []float64{12, 12, 8, 8}},
+		{"sawtooth", []float64{8, 9, 10, 11}},
+		{"triangle", []float64{10, 12, 10, 8}},
+	}
+	for _, tt := range tests {
+		viper.Set("channels.temperature.generator", map[string]any{
+			"type":      tt.typ,
+			"amplitude": 2,
+			"offset":    10,
+			"period":    "4s",
+		})
+		generator, err := newValueGenerator(testSensor(0, "temperature"))
+		if err != nil {
+			t.Fatalf("Error creating %s generator: %v", tt.typ, err)
+		}
+		for i, want := range tt.want {
+			if got := generator.Next(testStart.Add(time.Duration(i) * time.Second)); !approxEqual(got, want) {
+				t.Errorf("%s at %ds: expected %f, got %f", tt.typ, i, want, got)
+			}
+		}
+	}
+}
+
+func TestWaveformPhase(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{
+		"type":       "sine",
+		"phase":      45,
+		"phase-step": 45,
+	})
+
+	// Sensor 1 is shifted by 90 degrees in total, so it starts at the peak.
+	generator, _ := newValueGenerator(testSensor(1, "temperature"))
+	if got := generator.Next(testStart); !approxEqual(got, 1) {
+		t.Errorf("Expected 1 at the start, got %f", got)
+	}
+
+	// Per-sensor settings replace the channel's.
+	viper.Set("sensors.sensor_001.generator", map[string]any{"type": "square", "amplitude": 3})
+	generator, _ = newValueGenerator(testSensor(1, "temperature"))
+	if got := generator.Next(testStart); got != 3 {
+		t.Errorf("Expected the sensor's square wave, got %f", got)
+	}
+}
+
+func TestUnknownGeneratorType(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.humidity.generator", map[string]any{"type": "chaos"})
+
+	if _, err := newValueGenerator(testSensor(2, "humidity")); err == nil {
+		t.Errorf("Expected an error for an unknown generator type")
+	}
+}
+
+func TestRandomWalkGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{
+		"type":  "walk",
+		"min":   20,
+		"max":   30,
+		"start": 25,
+		"step":  0.5,
+	})
+
+	generator, err := newValueGenerator(testSensor(0, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	previous := 25.0
+	for i := 0; i < 1000; i++ {
+		v := generator.Next(testStart)
+		if v < 20 || v > 30 {
+			t.Fatalf("Value %f escaped the bounds", v)
+		}
+		if math.Abs(v-previous) > 5 {
+			t.Fatalf("Step from %f to %f is implausibly large", previous, v)
+		}
+		previous = v
+	}
+
+	viper.Set("channels.temperature.generator", map[string]any{"type": "walk", "min": 20, "max": 30, "step": math.Inf(1)})
+	if _, err := newValueGenerator(testSensor(0, "temperature")); err == nil {
+		t.Errorf("Expected an error for an infinite step")
+	}
+}
+
+func TestReflectBounds(t *testing.T) {
+	tests := []struct{ v, want float64 }{
+		{5, 5},
+		{-1, 1},
+		{11, 9},
+		{25, 5},
+		{-25, 5},
+		{2e15 + 1, 1},
+		{math.Inf(1), 10},
+		{math.Inf(-1), 0},
+	}
+	for _, tt := range tests {
+		if got := reflectBounds(tt.v, 0, 10); got != tt.want {
+			t.Errorf("reflectBounds(%g, 0, 10) = %g, want %g", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestGaussianGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.pressure.generator", map[string]any{
+		"type":   "gaussian",
+		"base":   1.0,
+		"mean":   0.05,
+		"stddev": 0.01,
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "pressure"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+
+	const n = 10000
+	var sum, sumSquares float64
+	for i := 0; i < n; i++ {
+		v := generator.Next(testStart)
+		sum += v
+		sumSquares += v * v
+	}
+	mean := sum / n
+	stddev := math.Sqrt(sumSquares/n - mean*mean)
+	if math.Abs(mean-1.05) > 0.001 {
+		t.Errorf("Expected mean 1.05, got %f", mean)
+	}
+	if math.Abs(stddev-0.01) > 0.001 {
+		t.Errorf("Expected stddev 0.01, got %f", stddev)
+	}
+}
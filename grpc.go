@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"rgehrsitz/diu_sim/diusimpb"
+)
+
+// grpcReconnectDelay is how long the gRPC sink waits before reopening a
+// failed upload stream.
+const grpcReconnectDelay = time.Second
+
+// grpcSink pushes readings to a remote collector over a client-streaming
+// Upload RPC, the way field DIUs upload to the central service.
+//
+// Readings are queued in a bounded buffer that a single goroutine drains
+// into the stream. When the collector applies backpressure the buffer
+// fills up, and Publish then either blocks the sensor (grpc.backpressure:
+// block) or drops the reading (grpc.backpressure: drop).
+type grpcSink struct {
+	conn   *grpc.ClientConn
+	client diusimpb.CollectorClient
+	queue  chan *diusimpb.SensorReading
+	drop   bool
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newGRPCSink() (*grpcSink, error) {
+	target := viper.GetString("grpc.target")
+	if target == "" {
+		return nil, fmt.Errorf("grpc.target must be set")
+	}
+
+	creds := insecure.NewCredentials()
+	if viper.GetBool("grpc.tls.enabled") {
+		config, err := tlsConfig("grpc.tls")
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(config)
+	}
+
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("creating gRPC client for %s: %w", target, err)
+	}
+
+	bufferSize := viper.GetInt("grpc.buffer-size")
+	if bufferSize <= 0 {
+		bufferSize = 1024
+	}
+
+	s := &grpcSink{
+		conn:    conn,
+		client:  diusimpb.NewCollectorClient(conn),
+		queue:   make(chan *diusimpb.SensorReading, bufferSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	switch mode := viper.GetString("grpc.backpressure"); mode {
+	case "", "block":
+	case "drop":
+		s.drop = true
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("unknown grpc backpressure mode %q", mode)
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go s.run()
+
+	return s, nil
+}
+
+func (s *grpcSink) Publish(ctx context.Context, r Reading) error {
+	msg := toSensorReading(r)
+
+	if s.drop {
+		select {
+		case s.queue <- msg:
+			return nil
+		default:
+			return fmt.Errorf("gRPC upload buffer full, dropping reading")
+		}
+	}
+
+	select {
+	case s.queue <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.done:
+		return fmt.Errorf("gRPC sink closed")
+	}
+}
+
+// run keeps an upload stream open and feeds it from the queue, reopening
+// the stream after errors. A reading whose send failed is retried on the
+// next stream.
+func (s *grpcSink) run() {
+	defer close(s.stopped)
+
+	var pending *diusimpb.SensorReading
+	for {
+		stream, err := s.client.Upload(s.ctx)
+		if err != nil {
+			log.Printf("Error opening gRPC upload stream: %v", err)
+			if !s.sleep(grpcReconnectDelay) {
+				return
+			}
+			continue
+		}
+
+		pending, err = s.feed(stream, pending)
+		if err == nil {
+			// Closing: the queue has been drained into the stream.
+			summary, err := stream.CloseAndRecv()
+			if err != nil {
+				log.Printf("Error closing gRPC upload stream: %v", err)
+			} else {
+				log.Printf("gRPC collector acknowledged %d readings", summary.GetReceived())
+			}
+			return
+		}
+
+		log.Printf("gRPC upload stream failed: %v", err)
+		if !s.sleep(grpcReconnectDelay) {
+			return
+		}
+	}
+}
+
+// feed sends queued readings on the stream until the sink is closed, in
+// which case it drains what is left and returns a nil error, or until a send
+// fails, in which case it returns the reading that could not be sent.
+func (s *grpcSink) feed(stream diusimpb.Collector_UploadClient, pending *diusimpb.SensorReading) (*diusimpb.SensorReading, error) {
+	for {
+		if pending != nil {
+			if err := stream.Send(pending); err != nil {
+				return pending, err
+			}
+			pending = nil
+		}
+
+		select {
+		case pending = <-s.queue:
+		case <-s.done:
+			for {
+				select {
+				case msg := <-s.queue:
+					if err := stream.Send(msg); err != nil {
+						return msg, err
+					}
+				default:
+					return nil, nil
+				}
+			}
+		}
+	}
+}
+
+// sleep waits for d, returning false if the sink is closed in the meantime.
+func (s *grpcSink) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *grpcSink) Close() error {
+	close(s.done)
+
+	select {
+	case <-s.stopped:
+	case <-time.After(5 * time.Second):
+		log.Printf("Timed out flushing gRPC upload stream")
+	}
+	s.cancel()
+	return s.conn.Close()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+
+	"rgehrsitz/diu_sim/diusimpb"
+)
+
+type testCollector struct {
+	diusimpb.UnimplementedCollectorServer
+
+	mu       sync.Mutex
+	readings []*diusimpb.SensorReading
+}
+
+func (c *testCollector) Upload(stream diusimpb.Collector_UploadServer) error {
+	var received uint64
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&diusimpb.UploadSummary{Received: received})
+		}
+		if err != nil {
+			return err
+		}
+		received++
+		c.mu.Lock()
+		c.readings = append(c.readings, msg)
+		c.mu.Unlock()
+	}
+}
+
+func TestGRPCSinkUploadsReadings(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	collector := &testCollector{}
+	server := grpc.NewServer()
+	diusimpb.RegisterCollectorServer(server, collector)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	viper.Set("grpc.target", listener.Addr().String())
+	sink, err := newGRPCSink()
+	if err != nil {
+		t.Fatalf("Error creating gRPC sink: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		reading := Reading{SensorData: SensorData{
+			SensorID:  "sensor_001",
+			Channel:   "pressure",
+			Timestamp: "2024-07-01T12:00:00Z",
+			Value:     float64(i),
+		}}
+		if err := sink.Publish(context.Background(), reading); err != nil {
+			t.Fatalf("Error publishing: %v", err)
+		}
+	}
+
+	// Closing drains the buffer and ends the upload stream.
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %v", err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if len(collector.readings) != 10 {
+		t.Fatalf("Expected 10 readings, collector received %d", len(collector.readings))
+	}
+	if got := collector.readings[9]; got.GetValue() != 9 || got.GetSensorId() != "sensor_001" || got.GetTimestamp().AsTime().Hour() != 12 {
+		t.Errorf("Unexpected reading %v", got)
+	}
+}
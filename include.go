@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// configType returns the format of a config file, as its extension says:
+// YAML, JSON or TOML, or YAML if the extension is not one of these.
+func configType(path string) string {
+	switch ext := strings.TrimPrefix(filepath.Ext(path), "."); ext {
+	case "yml":
+		return "yaml"
+	case "yaml", "json", "toml":
+		return ext
+	}
+	return "yaml"
+}
+
+// applyIncludes composes the config from several files: the files the
+// config file lists under include are read first, each with its own
+// includes, and the config file is merged over them; then the overlays,
+// the files given after the first with --config a.yaml,b.yaml, are merged
+// over that in order, e.g.
+//
+//	# site-a.yaml
+//	include: [base.yaml, topology.yaml]
+//	num-sensors: 500
+//	channels:
+//	  temperature: {max: 45}
+//
+// Maps are merged key by key, so a later file only needs to set what it
+// changes; lists and other values replace earlier ones. Relative include
+// paths are relative to the file that includes them.
+func applyIncludes() error {
+	main := viper.ConfigFileUsed()
+	overlays := configOverlays()
+	if main == "" || !viper.InConfig("include") && len(overlays) == 0 {
+		return nil
+	}
+	settings := make(map[string]any)
+	if err := mergeConfigFile(settings, main, make(map[string]bool)); err != nil {
+		return err
+	}
+	for _, overlay := range overlays {
+		if err := mergeConfigFile(settings, overlay, make(map[string]bool)); err != nil {
+			return err
+		}
+	}
+	delete(settings, "include")
+	return viper.MergeConfigMap(settings)
+}
+
+// configOverlays returns the config files merged over the config file:
+// those given after the first with --config.
+func configOverlays() []string {
+	if files := configList("config"); len(files) > 1 {
+		return files[1:]
+	}
+	return nil
+}
+
+// configFiles returns the files the config is composed of: the config
+// file, the files it includes, recursively, and the overlays.
+func configFiles() []string {
+	var files []string
+	seen := make(map[string]bool)
+	var add func(path string)
+	add = func(path string) {
+		path = filepath.Clean(path)
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		files = append(files, path)
+		v := viper.New()
+		v.SetConfigFile(path)
+		v.SetConfigType(configType(path))
+		if err := v.ReadInConfig(); err != nil {
+			return
+		}
+		for _, include := range cast.ToStringSlice(v.Get("include")) {
+			add(resolveInclude(path, include))
+		}
+	}
+	if main := viper.ConfigFileUsed(); main != "" {
+		add(main)
+		for _, overlay := range configOverlays() {
+			add(overlay)
+		}
+	}
+	return files
+}
+
+// mergeConfigFile merges the settings of a config file, and before them
+// those of the files it includes, into settings. including holds the files
+// whose includes are being read, to catch files including themselves.
+func mergeConfigFile(settings map[string]any, path string, including map[string]bool) error {
+	path = filepath.Clean(path)
+	if including[path] {
+		return fmt.Errorf("config file %s includes itself", path)
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType(configType(path))
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("reading config file %s: %w", path, err)
+	}
+	including[path] = true
+	defer delete(including, path)
+	for _, include := range cast.ToStringSlice(v.Get("include")) {
+		if err := mergeConfigFile(settings, resolveInclude(path, include), including); err != nil {
+			return err
+		}
+	}
+	mergeSettings(settings, v.AllSettings())
+	return nil
+}
+
+// resolveInclude returns the path of a file included by the config file
+// from, relative to the directory of from unless it is absolute.
+func resolveInclude(from, include string) string {
+	if filepath.IsAbs(include) {
+		return include
+	}
+	return filepath.Join(filepath.Dir(from), include)
+}
+
+// mergeSettings merges src into dst: maps key by key, recursively, and
+// other values replacing those in dst.
+func mergeSettings(dst, src map[string]any) {
+	for key, value := range src {
+		if srcMap, ok := value.(map[string]any); ok {
+			if dstMap, ok := dst[key].(map[string]any); ok {
+				mergeSettings(dstMap, srcMap)
+				continue
+			}
+			copied := make(map[string]any)
+			mergeSettings(copied, srcMap)
+			value = copied
+		}
+		dst[key] = value
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestApplyIncludes(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.yaml": `
+num-sensors: 100
+min-rate: 2
+channel-names: [temperature, pressure]
+channels:
+  temperature: {min: 10, max: 30, unit: °C}
+`,
+		"topology/sites.json": `{"sites": {"plant_a": {"dius": 2}}, "channels": {"temperature": {"max": 35}}}`,
+		"site.yaml": `
+include: [base.yaml, topology/sites.json]
+num-sensors: 500
+channels:
+  temperature: {max: 40}
+`,
+		"overlay.toml": "channel-names = [\"humidity\"]\n[channels.temperature]\nmin = 12\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viper.SetDefault("num-sensors", 1000)
+	viper.Set("config", filepath.Join(dir, "site.yaml")+","+filepath.Join(dir, "overlay.toml"))
+	viper.SetConfigFile(filepath.Join(dir, "site.yaml"))
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Error reading config: %v", err)
+	}
+
+	if err := applyIncludes(); err != nil {
+		t.Fatalf("Error including config files: %v", err)
+	}
+	if n := viper.GetInt("num-sensors"); n != 500 {
+		t.Errorf("Expected num-sensors 500 from the including file, got %d", n)
+	}
+	if rate := viper.GetFloat64("min-rate"); rate != 2 {
+		t.Errorf("Expected min-rate 2 from the base file, got %g", rate)
+	}
+	if min, max := channelRange("temperature"); min != 12 || max != 40 {
+		t.Errorf("Expected the channel settings merged to 12 to 40, got %g to %g", min, max)
+	}
+	if unit := viper.GetString("channels.temperature.unit"); unit != "°C" {
+		t.Errorf("Expected the unit kept from the base file, got %q", unit)
+	}
+	if names := channelNames(); !slices.Equal(names, []string{"humidity"}) {
+		t.Errorf("Expected the channel list replaced by the overlay, got %v", names)
+	}
+	if !viper.IsSet("sites.plant_a.dius") {
+		t.Errorf("Expected the sites from the included JSON file")
+	}
+}
+
+func TestApplyIncludesCycle(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.yaml": "include: b.yaml\n",
+		"b.yaml": "include: [a.yaml]\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viper.SetConfigFile(filepath.Join(dir, "a.yaml"))
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Error reading config: %v", err)
+	}
+	if err := applyIncludes(); err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("Expected an include cycle error, got %v", err)
+	}
+}
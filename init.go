@@ -0,0 +1,48 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// examples holds the commented example config and scenario that init
+// writes.
+//
+//go:embed examples/config.yaml examples/scenario.yaml
+var examples embed.FS
+
+// runInit writes the example config.yaml and scenario.yaml into dir. Files
+// that already exist are only overwritten with force.
+func runInit(dir string, force bool) error {
+	names, err := fs.Glob(examples, "examples/*")
+	if err != nil {
+		return err
+	}
+	if !force {
+		for _, name := range names {
+			path := filepath.Join(dir, filepath.Base(name))
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists (use --force to overwrite it)", path)
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, name := range names {
+		content, err := examples.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.Base(name))
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			return err
+		}
+		log.Printf("Wrote %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRunInit(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	resetBatteries(t)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	savedScenario := scenario
+	t.Cleanup(func() { scenario = savedScenario })
+
+	dir := filepath.Join(t.TempDir(), "sim")
+	if err := runInit(dir, false); err != nil {
+		t.Fatalf("Error writing example config: %v", err)
+	}
+	if err := runInit(dir, false); err == nil {
+		t.Errorf("Expected existing files not to be overwritten")
+	}
+	if err := runInit(dir, true); err != nil {
+		t.Errorf("Expected existing files overwritten with force, got %v", err)
+	}
+
+	// The example config is valid, without unknown keys.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	viper.Set("config", "config.yaml")
+	loadConfig()
+	var out bytes.Buffer
+	if code := runValidate(&out, viper.GetInt("num-sensors"), viper.GetFloat64("min-rate"), viper.GetFloat64("max-rate"), false, true, false); code != 0 {
+		t.Errorf("Expected the example config to be valid, got:\n%s", out.String())
+	}
+	if len(scenario) == 0 {
+		t.Errorf("Expected the example scenario loaded")
+	}
+}
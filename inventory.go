@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// inventoryFields are the sensor settings read from inventory columns;
+// the numeric ones are parsed as numbers.
+var inventoryFields = map[string]bool{
+	"channel":  false,
+	"diu":      false,
+	"site":     false,
+	"min":      true,
+	"max":      true,
+	"rate":     true,
+	"min-rate": true,
+	"max-rate": true,
+}
+
+// loadInventory adds the sensors listed in the CSV file inventory.file,
+// such as an export of an asset database, to the sensors entries (see
+// definedSensorIDs). Its header row names the columns: id and channel,
+// and optionally diu, site, min, max, rate, min-rate and max-rate, which
+// set the sensor settings of the same names; the other columns become
+// metadata of the sensors. Empty cells are left unset. When the export
+// names the columns differently, inventory.columns maps the settings to
+// the column names, e.g.
+//
+//	inventory:
+//	  file: assets.csv
+//	  delimiter: ";"
+//	  columns: {id: asset_tag, channel: measurand, diu: controller}
+//
+// Settings of sensors.<id> in the config go over those of the inventory.
+func loadInventory() error {
+	file := viper.GetString("inventory.file")
+	if file == "" {
+		return nil
+	}
+	blocks, err := readInventory(file)
+	if err != nil {
+		return fmt.Errorf("inventory %s: %w", file, err)
+	}
+	sensors := viper.GetStringMap("sensors")
+	for id, block := range blocks {
+		maps.Copy(block, cast.ToStringMap(sensors[id]))
+		sensors[id] = block
+	}
+	viper.Set("sensors", sensors)
+	return nil
+}
+
+// readInventory reads the sensors of an inventory file, by ID.
+func readInventory(file string) (map[string]map[string]any, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	if delimiter := viper.GetString("inventory.delimiter"); delimiter != "" {
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) {
+			return nil, fmt.Errorf("delimiter %q must be a single character", delimiter)
+		}
+		reader.Comma = r
+	}
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header row: %w", err)
+	}
+
+	// Each column sets the setting it is mapped to, or else the setting of
+	// its name, or else the metadata of its name.
+	renamed := make(map[string]string)
+	for setting, column := range viper.GetStringMapString("inventory.columns") {
+		renamed[strings.ToLower(strings.TrimSpace(column))] = setting
+	}
+	settings := make([]string, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if setting, ok := renamed[column]; ok {
+			column = setting
+		}
+		settings[i] = column
+	}
+	for _, required := range []string{"id", "channel"} {
+		found := false
+		for _, setting := range settings {
+			found = found || setting == required
+		}
+		if !found {
+			return nil, fmt.Errorf("missing %s column", required)
+		}
+	}
+
+	blocks := make(map[string]map[string]any)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var id string
+		block := make(map[string]any)
+		metadata := make(map[string]any)
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			numeric, ok := inventoryFields[settings[i]]
+			switch {
+			case settings[i] == "id":
+				id = strings.ToLower(value)
+			case numeric:
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s %q is not a number", line, header[i], value)
+				}
+				block[settings[i]] = n
+			case ok:
+				block[settings[i]] = value
+			default:
+				metadata[settings[i]] = value
+			}
+		}
+		if id == "" {
+			return nil, fmt.Errorf("line %d: id must be set", line)
+		}
+		if _, ok := blocks[id]; ok {
+			return nil, fmt.Errorf("line %d: sensor %s is listed more than once", line, id)
+		}
+		if block["channel"] == nil {
+			return nil, fmt.Errorf("line %d: sensor %s: channel must be set", line, id)
+		}
+		if len(metadata) > 0 {
+			block["metadata"] = metadata
+		}
+		blocks[id] = block
+	}
+	return blocks, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func writeInventory(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "assets.csv")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadInventory(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("inventory.file", writeInventory(t, `Asset_Tag;Measurand;DIU;Min;Max;Rate;Location;Vendor
+PT-101;temperature;diu_pump;-20;60;2;pump room;acme
+PT-102;pressure;diu_pump;0;10;;pump room;
+FT-201;flow;diu_line;;;0.5;;
+`))
+	viper.Set("inventory.delimiter", ";")
+	viper.Set("inventory.columns", map[string]any{"id": "asset_tag", "channel": "Measurand"})
+	viper.Set("sensors.pt-102", map[string]any{"max": 16, "metadata": map[string]any{"vendor": "other"}})
+	if err := loadTopology(); err != nil {
+		t.Fatalf("Error loading inventory: %v", err)
+	}
+
+	want := []string{"ft-201", "pt-101", "pt-102"}
+	if ids := definedSensorIDs(0); !slices.Equal(ids, want) {
+		t.Fatalf("Expected sensors %v, got %v", want, ids)
+	}
+
+	pt101, err := newConfiguredSensor(0, "pt-101", "")
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	reading := pt101.sample(testStart, 1)
+	if reading.Channel != "temperature" || reading.DIU != "diu_pump" {
+		t.Errorf("Expected a temperature reading of diu_pump, got %+v", reading)
+	}
+	if reading.Value < -20 || reading.Value > 60 {
+		t.Errorf("Expected a value between -20 and 60, got %v", reading.Value)
+	}
+	if m := reading.Metadata; m["location"] != "pump room" || m["vendor"] != "acme" {
+		t.Errorf("Expected the other columns as metadata, got %v", m)
+	}
+	if min, max := pt101.rateRange(testStart, 1, 4); min != 2 || max != 2 {
+		t.Errorf("Expected a rate of 2, got %v to %v", min, max)
+	}
+
+	pt102 := viper.GetStringMap("sensors.pt-102")
+	if pt102["min"] != 0.0 || pt102["max"] != 16 || pt102["channel"] != "pressure" {
+		t.Errorf("Expected the config to override the inventory, got %v", pt102)
+	}
+	if _, ok := pt102["rate"]; ok {
+		t.Errorf("Expected empty cells to be left unset, got %v", pt102)
+	}
+}
+
+func TestLoadInventoryErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	for name, content := range map[string]string{
+		"no channel column": "id,min\npt-101,0\n",
+		"no ID":             "id,channel\n,temperature\n",
+		"no channel":        "id,channel\npt-101,\n",
+		"duplicate":         "id,channel\npt-101,temperature\nPT-101,pressure\n",
+		"bad number":        "id,channel,max\npt-101,temperature,hot\n",
+	} {
+		viper.Set("inventory.file", writeInventory(t, content))
+		err := loadInventory()
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		if name == "bad number" && !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%s: expected the line in the error, got %v", name, err)
+		}
+	}
+}
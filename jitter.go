@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// timingJitter makes a sensor's timing imperfect, like that of devices in
+// the field: the timestamps it publishes are off from the times its
+// samples were taken, and it sends its readings some time after taking
+// them.
+type timingJitter struct {
+	offset    time.Duration // constant error of the timestamps
+	timestamp time.Duration // random error of the timestamps
+	send      time.Duration // random delay before sending
+	normal    bool          // the random parts are normally distributed
+	rand      *rand.Rand
+}
+
+// jitterFor returns a sensor's timing jitter, configured with
+// sensors.<id>.jitter, channels.<channel>.jitter or jitter, or nil if it
+// has none. For example
+//
+//	jitter:
+//	  timestamp: 20ms     # timestamps are up to 20ms off
+//	  offset: -5ms        # and 5ms early on average
+//	  send: 100ms         # readings are sent up to 100ms after sampling
+//	  distribution: normal
+//
+// With the uniform distribution (default) timestamp and send are the
+// largest errors and delays; with normal they are standard deviations.
+func jitterFor(sensor sensorInfo) (*timingJitter, error) {
+	spec := generatorSpec(viper.GetStringMap("sensors." + sensor.ID + ".jitter"))
+	if len(spec) == 0 {
+		spec = viper.GetStringMap("channels." + sensor.Channel + ".jitter")
+	}
+	if len(spec) == 0 {
+		spec = viper.GetStringMap("jitter")
+	}
+	if len(spec) == 0 {
+		return nil, nil
+	}
+
+	j := &timingJitter{
+		offset:    spec.duration("offset", 0),
+		timestamp: spec.duration("timestamp", 0),
+		send:      spec.duration("send", 0),
+		rand:      sensorRand(sensor.Index, "jitter"),
+	}
+	switch distribution := spec.str("distribution", "uniform"); distribution {
+	case "uniform":
+	case "normal":
+		j.normal = true
+	default:
+		return nil, fmt.Errorf("jitter for %s: unknown distribution %q", sensor.ID, distribution)
+	}
+	if j.timestamp < 0 || j.send < 0 {
+		return nil, fmt.Errorf("jitter for %s: timestamp and send must not be negative", sensor.ID)
+	}
+	return j, nil
+}
+
+// stamp returns the timestamp published for a sample taken at t.
+func (j *timingJitter) stamp(t time.Time) time.Time {
+	e := 2*j.rand.Float64() - 1
+	if j.normal {
+		e = j.rand.NormFloat64()
+	}
+	return t.Add(j.offset + time.Duration(e*float64(j.timestamp)))
+}
+
+// delay returns how long after taking a sample its reading is sent.
+func (j *timingJitter) delay() time.Duration {
+	f := j.rand.Float64()
+	if j.normal {
+		f = math.Abs(j.rand.NormFloat64())
+	}
+	return time.Duration(f * float64(j.send))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestTimingJitter(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("seed", 1)
+	viper.Set("jitter", map[string]any{"timestamp": "20ms", "offset": "-5ms", "send": "100ms"})
+	viper.Set("channels.pressure.jitter", map[string]any{"timestamp": "1s", "distribution": "normal"})
+
+	j, err := jitterFor(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating jitter: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if e := j.stamp(testStart).Sub(testStart); e < -25*time.Millisecond || e > 15*time.Millisecond {
+			t.Fatalf("Expected timestamps within 20ms of 5ms early, got %v", e)
+		}
+		if d := j.delay(); d < 0 || d > 100*time.Millisecond {
+			t.Fatalf("Expected send delays of up to 100ms, got %v", d)
+		}
+	}
+
+	j, err = jitterFor(testSensor(1, "pressure"))
+	if err != nil {
+		t.Fatalf("Error creating jitter: %v", err)
+	}
+	var sum, squares float64
+	for i := 0; i < 10000; i++ {
+		e := j.stamp(testStart).Sub(testStart).Seconds()
+		sum += e
+		squares += e * e
+	}
+	if mean, variance := sum/10000, squares/10000; mean < -0.05 || mean > 0.05 || variance < 0.9 || variance > 1.1 {
+		t.Errorf("Expected timestamp errors with mean 0 and stddev 1s, got mean %g and variance %g", mean, variance)
+	}
+	if j.delay() != 0 {
+		t.Errorf("Expected no send delay when send is not set")
+	}
+
+	for _, spec := range []map[string]any{
+		{"distribution": "cauchy"},
+		{"send": "-1s"},
+	} {
+		viper.Set("jitter", spec)
+		if _, err := jitterFor(testSensor(1, "temperature")); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+	viper.Set("jitter", nil)
+	if j, err := jitterFor(testSensor(1, "temperature")); j != nil || err != nil {
+		t.Errorf("Expected no jitter when none is configured, got %v, %v", j, err)
+	}
+}
+
+func TestJitteredTimestamps(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	constantGenerator("temperature", 20)
+	viper.Set("sensors.sensor_001.jitter", map[string]any{"offset": "250ms"})
+
+	info := testSensor(1, "temperature")
+	generator, err := newValueGenerator(info)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	s, err := newSensor(info, generator)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	want := testStart.Add(250 * time.Millisecond).Format(time.RFC3339Nano)
+	if r := s.sample(testStart, 1); r.Timestamp != want {
+		t.Errorf("Expected timestamp %s, got %s", want, r.Timestamp)
+	}
+}
@@ -4,16 +4,20 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"log"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -22,91 +26,464 @@ type SensorData struct {
 	Channel   string  `json:"channel"`
 	Timestamp string  `json:"timestamp"`
 	Value     float64 `json:"value"`
+	Unit      string  `json:"unit,omitempty"`
+	Label     string  `json:"label,omitempty"` // state of enum sensors
+
+	// Position is the location of position sensors, whose value is their
+	// speed.
+	Position *Position `json:"position,omitempty"`
+
+	// Samples is the waveform snapshot or spectrum of burst sensors, whose
+	// value is its RMS.
+	Samples []float64 `json:"samples,omitempty"`
+
+	// Quality is the OPC-style quality code of the reading, GOOD, UNCERTAIN
+	// or BAD, with the RSSI (dBm) and SNR (dB) of the sensor's link, set
+	// when quality fields are enabled.
+	Quality string   `json:"quality,omitempty"`
+	RSSI    *float64 `json:"rssi,omitempty"`
+	SNR     *float64 `json:"snr,omitempty"`
+
+	// Text is the message of text sensors, written in place of the
+	// numeric message code.
+	Text string `json:"-"`
+
+	// Boolean marks readings of boolean sensors whose 0/1 value is written
+	// as false/true.
+	Boolean bool `json:"-"`
+
+	// Metadata is the static metadata of explicitly defined sensors, such
+	// as their location or model.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Ground-truth labels of injected anomalies, set when anomaly labels
+	// are embedded in readings.
+	Anomaly     bool   `json:"anomaly,omitempty"`
+	AnomalyType string `json:"anomaly_type,omitempty"`
 }
 
+// channels are the built-in channels, simulated unless channel-names
+// declares others.
 var channels = []string{"temperature", "pressure", "humidity"}
 
-func parseArguments() (int, float64, float64) {
-	numSensors := flag.Int("num-sensors", 1000, "Number of sensors to simulate")
-	minRate := flag.Float64("min-rate", 4.0, "Minimum publish rate in Hz")
-	maxRate := flag.Float64("max-rate", 4.0, "Maximum publish rate in Hz")
+// defaultSensorsPerDIU is how many consecutive sensors are grouped into one
+// simulated data interface unit when sensors-per-diu is not set.
+const defaultSensorsPerDIU = 16
+
+// flagConfigKeys maps command-line flags to the config keys they provide
+// defaults for. Values from the config file still take precedence.
+var flagConfigKeys = map[string]string{
+	"num-sensors":            "num-sensors",
+	"min-rate":               "min-rate",
+	"max-rate":               "max-rate",
+	"config":                 "config",
+	"watch-config":           "watch-config",
+	"tui":                    "tui",
+	"profile":                "profile",
+	"scenario":               "scenario",
+	"seed":                   "seed",
+	"plugins":                "plugins",
+	"sensors-per-diu":        "sensors-per-diu",
+	"channel-assignment":     "channel-assignment",
+	"sensor-id-template":     "naming.sensor-id",
+	"name-template":          "naming.name",
+	"channels":               "channel-names",
+	"anomaly-labels":         "anomalies.labels",
+	"anomaly-labels-channel": "anomalies.labels-channel",
+	"sinks":                  "sinks",
+	"sse-addr":               "sse.addr",
+	"payload-format":         "payload-format",
+	"payload-template":       "payload-template",
+	"payload-template-file":  "payload-template-file",
+	"envelope":               "envelope.enabled",
+	"envelope-schema":        "envelope.schema-version",
+	"instance-id":            "instance-id",
+	"topic-prefix":           "topic-prefix",
+	"inventory":              "inventory.file",
+	"control-addr":           "control.addr",
+	"control-grpc-addr":      "control.grpc-addr",
+	"registry":               "registry.enabled",
+	"registry-channel":       "registry.channel",
+	"compression":            "compression",
+	"compression-marker":     "compression-marker",
+	"cloudevents":            "cloudevents.mode",
+	"cloudevents-source":     "cloudevents.source",
+	"cloudevents-type":       "cloudevents.type",
+	"batch-size":             "batch.size",
+	"batch-window":           "batch.window",
+	"batch-group-by":         "batch.group-by",
+	"serial-device":          "serial.device",
+	"serial-baud":            "serial.baud",
+	"serial-framing":         "serial.framing",
+	"syslog-addr":            "syslog.addr",
+	"syslog-network":         "syslog.network",
+	"syslog-facility":        "syslog.facility",
+	"stomp-addr":             "stomp.addr",
+	"stomp-destination":      "stomp.destination",
+	"grpc-target":            "grpc.target",
+	"pulsar-url":             "pulsar.url",
+	"pulsar-topic":           "pulsar.topic",
+	"pulsar-key":             "pulsar.key",
+	"pulsar-schema":          "pulsar.schema",
+	"redis-addr":             "redis.addr",
+	"redis-username":         "redis.username",
+	"redis-password":         "redis.password",
+	"redis-db":               "redis.db",
+	"redis-pool-size":        "redis.pool-size",
+	"redis-dial-timeout":     "redis.dial-timeout",
+	"redis-read-timeout":     "redis.read-timeout",
+	"redis-write-timeout":    "redis.write-timeout",
+	"redis-prefix":           "redis.prefix",
+	"redis-tls":              "redis.tls.enabled",
+	"redis-tls-ca":           "redis.tls.ca-file",
+	"redis-tls-cert":         "redis.tls.cert-file",
+	"redis-tls-key":          "redis.tls.key-file",
+	"redis-tls-skip-verify":  "redis.tls.insecure-skip-verify",
+	"ramp-up-rate":           "ramp-up.rate",
+	"duration":               "duration",
+	"max-messages":           "max-messages",
+}
 
-	flag.Parse()
+// addConfigFlags adds the flags that select the config file and its
+// profile, which all commands share.
+func addConfigFlags(fs *pflag.FlagSet) {
+	fs.String("config", "", "Path to the YAML, JSON or TOML config file (default: ./config.yaml); further comma-separated files are merged over it in order")
+	fs.String("profile", "", "Name of the config file profile whose settings override the base settings")
+}
 
-	return *numSensors, *minRate, *maxRate
+// addSettingFlags adds the flags of the simulation settings, which provide
+// defaults for the config keys in flagConfigKeys.
+func addSettingFlags(fs *pflag.FlagSet) {
+	fs.Int("num-sensors", 1000, "Number of sensors to simulate")
+	fs.Float64("min-rate", 4.0, "Minimum publish rate in Hz")
+	fs.Float64("max-rate", 4.0, "Maximum publish rate in Hz")
+
+	fs.String("scenario", "", "Path to a scenario file of timed events")
+	fs.Int64("seed", 0, "Seed for all random numbers of the simulation, making runs reproducible (default: random, logged at startup)")
+	fs.String("plugins", "", "Comma-separated list of Go plugins (.so) registering custom generator types")
+	fs.Float64("ramp-up-rate", 0, "Start this many sensors per second rather than all at once (0: all at once)")
+	fs.Int("sensors-per-diu", defaultSensorsPerDIU, "Number of sensors grouped into each simulated DIU")
+	fs.String("sensor-id-template", defaultSensorIDTemplate, "Template of the IDs of sensors generated in bulk ({index}, {channel}, {diu}, {site}; {index:03} pads to three digits)")
+	fs.String("name-template", defaultNameTemplate, "Template of the names readings are published under ({channel}, {sensor_id}, {index}, {diu}, {site})")
+	fs.String("inventory", "", "CSV export of an asset database listing sensors to simulate (id, channel, diu, site, min, max, rate, ... columns)")
+	fs.String("channel-assignment", "spread", "How sensors are assigned to channels by weight: spread evenly, or random, drawn per sensor and stable for a seed")
+	fs.String("channels", "", "Comma-separated list of channels to simulate (default: temperature,pressure,humidity)")
+	fs.String("anomaly-labels", "embed", "How injected anomalies are labelled: embed, stream, both or none")
+	fs.String("anomaly-labels-channel", "labels", "Channel that labelled readings are streamed to")
+	fs.String("sinks", "redis", "Comma-separated list of outputs to publish to (redis, redis-kv, redis-hash, sse, serial, syslog, stomp, grpc, pulsar, failover)")
+	fs.String("topic-prefix", "", "Prefix of every channel, topic and key published to, e.g. sim.lab3., to namespace an instance")
+	fs.String("sse-addr", ":8081", "Listen address for the Server-Sent Events endpoint")
+	fs.String("payload-format", "json", "Message payload format: json, kv, csv, senml-json, senml-cbor, protobuf, flatbuffers, diu-frame or template")
+	fs.String("payload-template", "", "Go text/template for the template payload format, e.g. '{{.Sensor}};{{.Value}}'")
+	fs.String("payload-template-file", "", "File holding the Go text/template for the template payload format")
+	fs.Bool("envelope", false, "Wrap readings in an envelope with schema version, instance ID, DIU ID and sequence number")
+	fs.String("envelope-schema", "1", "Schema version written to reading envelopes")
+	fs.String("control-addr", "", "Listen address of the HTTP control API, e.g. :8090 (default: disabled)")
+	fs.String("control-grpc-addr", "", "Listen address of the gRPC control API (diusimpb/control.proto), e.g. :8091 (default: disabled)")
+	fs.Bool("registry", false, "Announce each sensor with its metadata on the registry channel when it starts")
+	fs.String("registry-channel", "registry", "Channel sensors are announced on")
+	fs.String("instance-id", "", "Simulator instance ID written to reading envelopes (default: random per run)")
+	fs.String("compression", "none", "Payload compression: none, gzip, zstd or snappy")
+	fs.String("compression-marker", "none", "How compression is signalled: none, header (content-encoding) or flag (leading codec byte)")
+	fs.String("cloudevents", "off", "Wrap readings in CloudEvents 1.0 envelopes: off, structured or binary")
+	fs.String("cloudevents-source", "/diu_sim/{diu}/{sensor_id}", "CloudEvents source attribute template")
+	fs.String("cloudevents-type", "diusim.sensor.reading", "CloudEvents type attribute template")
+	fs.Int("batch-size", 0, "Send readings in batches of this many per message (0 or 1 disables batching)")
+	fs.Duration("batch-window", 0, "Send a batch once its first reading is this old, e.g. 1s (0 disables)")
+	fs.String("batch-group-by", "sensor", "Group batches by sensor or diu")
+	fs.String("serial-device", "", "Serial port device for the serial sink, e.g. /dev/ttyUSB0")
+	fs.Int("serial-baud", 115200, "Serial port baud rate")
+	fs.String("serial-framing", "line", "Serial framing: line, stx-etx, length or raw")
+	fs.String("syslog-addr", "localhost:514", "Syslog collector address")
+	fs.String("syslog-network", "udp", "Syslog transport: udp, tcp or tls")
+	fs.Int("syslog-facility", 16, "Syslog facility code (16 = local0)")
+	fs.String("stomp-addr", "localhost:61613", "STOMP broker address")
+	fs.String("stomp-destination", "/topic/{channel}", "STOMP destination template ({channel}, {sensor_id}, {diu}, {site}, {name})")
+	fs.String("grpc-target", "", "Address of the gRPC collector to push readings to")
+	fs.String("pulsar-url", "pulsar://localhost:6650", "Pulsar service URL")
+	fs.String("pulsar-topic", "persistent://public/default/{channel}", "Pulsar topic template ({channel}, {sensor_id}, {diu}, {site}, {name})")
+	fs.String("pulsar-key", "{sensor_id}", "Pulsar message key template; empty for round-robin partitioning")
+	fs.String("pulsar-schema", "none", "Pulsar schema: none, json or avro")
+	fs.String("redis-addr", "localhost:6379", "Redis server address (host:port or unix socket path)")
+	fs.String("redis-username", "", "Redis ACL username")
+	fs.String("redis-password", "", "Redis password")
+	fs.Int("redis-db", 0, "Redis logical database index")
+	fs.Int("redis-pool-size", 0, "Maximum number of Redis connections (default: 10 per CPU)")
+	fs.Duration("redis-dial-timeout", 0, "Timeout for connecting to Redis (default: 5s)")
+	fs.Duration("redis-read-timeout", 0, "Timeout for Redis replies (default: 3s)")
+	fs.Duration("redis-write-timeout", 0, "Timeout for Redis writes (default: the read timeout)")
+	fs.String("redis-prefix", "", "Prefix applied to every Redis channel and key, e.g. sim1:")
+	fs.Bool("redis-tls", false, "Connect to Redis over TLS")
+	fs.String("redis-tls-ca", "", "CA certificate file used to verify the Redis server")
+	fs.String("redis-tls-cert", "", "Client certificate file for Redis TLS")
+	fs.String("redis-tls-key", "", "Client key file for Redis TLS")
+	fs.Bool("redis-tls-skip-verify", false, "Skip verification of the Redis server certificate")
 }
 
-func setupRedisClient() *redis.Client {
-	client := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
+// setFlagDefaults makes the values of the flags of a command the defaults
+// of their config keys, so the config file and the environment still take
+// precedence. The values are set as given, as strings, and converted as
+// the settings are read.
+func setFlagDefaults(fs *pflag.FlagSet) {
+	fs.VisitAll(func(f *pflag.Flag) {
+		if key, ok := flagConfigKeys[f.Name]; ok {
+			viper.SetDefault(key, f.Value.String())
+		}
 	})
+}
 
-	return client
+// diuID returns the ID of the DIU a sensor belongs to.
+func diuID(sensorID int) string {
+	sensorsPerDIU := viper.GetInt("sensors-per-diu")
+	if sensorsPerDIU <= 0 {
+		sensorsPerDIU = defaultSensorsPerDIU
+	}
+	return fmt.Sprintf("diu_%03d", sensorID/sensorsPerDIU)
 }
 
-func generateSensorValue(sensorID int, channel string) float64 {
-	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(sensorID)))
-	switch channel {
-	case "temperature":
-		return 25.0 + r.Float64()*10.0 // Range: 25.0 to 35.0
-	case "pressure":
-		return 0.8 + r.Float64()*0.4 // Range: 0.8 to 1.2
-	case "humidity":
-		return 70.0 + r.Float64()*20.0 // Range: 70.0 to 90.0
-	default:
-		return r.Float64() * 100.0 // Default range: 0 to 100
+// channelNames returns the simulated channels: those declared by
+// channel-names, or the built-in channels. Sensors are assigned to them
+// by weightedChannel.
+func channelNames() []string {
+	if names := configList("channel-names"); len(names) > 0 {
+		return names
 	}
+	return channels
 }
 
-func publishSensorData(ctx context.Context, client *redis.Client, sensorID int, minRate, maxRate float64) {
-	channel := channels[sensorID%len(channels)]
-	sensorName := fmt.Sprintf("%s:sensor_%03d", channel, sensorID)
+// channelAssignment is the sequence of channels sensors are assigned to
+// for one list of channels and their weights, extended as needed.
+type channelAssignment struct {
+	weights  []float64
+	total    float64
+	current  []float64 // smooth weighted round-robin state
+	sequence []int     // channel of each sensor, by index
+}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(sensorID)))
+var (
+	assignmentsMu sync.Mutex
+	assignments   = make(map[string]*channelAssignment)
+)
 
-	// Start with an initial rate
-	rate := minRate + r.Float64()*(maxRate-minRate)
-	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
-	defer ticker.Stop()
+// channelCounts returns the numbers of sensors set for the channels of
+// names with channels.<channel>.count, and their total, which is 0 if no
+// channel sets one.
+func channelCounts(names []string) (counts []int, total int) {
+	counts = make([]int, len(names))
+	for i, name := range names {
+		counts[i] = max(viper.GetInt("channels."+name+".count"), 0)
+		total += counts[i]
+	}
+	return counts, total
+}
 
-	for range ticker.C {
-		value := generateSensorValue(sensorID, channel)
-		message := fmt.Sprintf("%s=%f", sensorName, value)
+// bulkSensorCount returns the number of sensors generated in bulk: the
+// total of the channel counts if any channel sets one, else num-sensors.
+func bulkSensorCount() int {
+	if _, total := channelCounts(channelNames()); total > 0 {
+		return total
+	}
+	return viper.GetInt("num-sensors")
+}
 
-		err := client.Publish(ctx, channel, message).Err()
-		if err != nil {
-			log.Printf("Error publishing data for %s: %v\n", sensorName, err)
-		} else {
-			log.Printf("Published data for %s to channel %s: %s\n", sensorName, channel, message)
+// channelAssignments are the ways sensors are assigned to channels, as
+// selected with channel-assignment.
+var channelAssignments = []string{"spread", "random"}
+
+// checkChannelAssignment checks that channel-assignment, if set, is known.
+func checkChannelAssignment() error {
+	if mode := viper.GetString("channel-assignment"); mode != "" && !slices.Contains(channelAssignments, mode) {
+		return fmt.Errorf("unknown channel-assignment %q (want %s)", mode, strings.Join(channelAssignments, " or "))
+	}
+	return nil
+}
+
+// draw returns a channel drawn at random in proportion to the weights.
+func (a *channelAssignment) draw(r *rand.Rand) int {
+	x := r.Float64() * a.total
+	for i, w := range a.weights {
+		if x < w {
+			return i
 		}
+		x -= w
+	}
+	return len(a.weights) - 1
+}
 
-		// Calculate and set the next tick duration
-		rate = minRate + r.Float64()*(maxRate-minRate)
-		nextTickDuration := time.Duration(float64(time.Second) / rate)
-		ticker.Reset(nextTickDuration)
+// weightedChannel returns the channel, of names, that the index-th sensor
+// is assigned to. Each channel gets a share of the sensors in proportion
+// to its weight, channels.<channel>.weight (default 1), e.g. weights 60,
+// 30 and 10 assign 60% of the sensors to the first channel. If channels
+// set counts instead, channels.<channel>.count, those are the weights, so
+// the first sensors up to their total are of each channel exactly as many
+// as its count, and channels without a count get none. The sensors of
+// each channel are spread evenly over the indexes by smooth weighted
+// round-robin, which with equal weights is plain round-robin. Channels
+// with a weight of 0 get no sensors, unless all do.
+//
+// With channel-assignment random, each sensor's channel is drawn at random
+// in proportion to the weights instead, from its own random stream (see
+// sensorRand), so with the same seed every sensor keeps its channel across
+// runs, even if the number of sensors changes.
+func weightedChannel(names []string, index int) string {
+	weights := make([]float64, len(names))
+	total := 0.0
+	counts, totalCount := channelCounts(names)
+	for i, name := range names {
+		weights[i] = 1
+		if totalCount > 0 {
+			weights[i] = float64(counts[i])
+		} else if key := "channels." + name + ".weight"; viper.IsSet(key) {
+			weights[i] = math.Max(viper.GetFloat64(key), 0)
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		return names[index%len(names)]
+	}
 
-		// Check if the context has been cancelled
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			// Continue to the next iteration
+	random := viper.GetString("channel-assignment") == "random"
+	key := fmt.Sprint(names, weights)
+	if random {
+		key = fmt.Sprint("random ", viper.GetInt64("seed"), " ", key)
+	}
+	assignmentsMu.Lock()
+	defer assignmentsMu.Unlock()
+	a, ok := assignments[key]
+	if !ok {
+		a = &channelAssignment{weights: weights, total: total, current: make([]float64, len(names))}
+		assignments[key] = a
+	}
+	for len(a.sequence) <= index {
+		if random {
+			a.sequence = append(a.sequence, a.draw(sensorRand(len(a.sequence), "channel")))
+			continue
+		}
+		next := 0
+		for i, w := range a.weights {
+			a.current[i] += w
+			if a.current[i] > a.current[next] {
+				next = i
+			}
 		}
+		a.current[next] -= a.total
+		a.sequence = append(a.sequence, next)
+	}
+	return names[a.sequence[index]]
+}
+
+// publishSensorData simulates a single sensor until ctx is cancelled.
+func publishSensorData(ctx context.Context, sink Sink, sensorID int, minRate, maxRate float64) {
+	sensor, err := newSimulatedSensor(sensorID)
+	if err != nil {
+		log.Printf("Error setting up sensor %d: %v", sensorID, err)
+		return
 	}
+	sensor.run(ctx, sink, minRate, maxRate)
 }
 
-func startSensorSimulations(ctx context.Context, numSensors int, minRate, maxRate float64) {
-	client := setupRedisClient()
+// startSensorSimulations sets up all sensors, failing if any of them is
+// misconfigured, and then starts simulating them.
+func startSensorSimulations(ctx context.Context, sink Sink, numSensors int, minRate, maxRate float64) (*simulation, error) {
+	defined := definedSensorIDs(numSensors)
+	sensors := make([]*simulatedSensor, numSensors, numSensors+len(defined))
+	for i := range sensors {
+		sensor, err := newSimulatedSensor(i)
+		if err != nil {
+			return nil, err
+		}
+		sensors[i] = sensor
+	}
+	for _, id := range defined {
+		sensor, err := newConfiguredSensor(len(sensors), id, "")
+		if err != nil {
+			return nil, err
+		}
+		sensors = append(sensors, sensor)
+	}
+	derived, err := newDerivedSensors(len(sensors))
+	if err != nil {
+		return nil, err
+	}
+
+	swappable := &swappableSink{sink: sink}
+	sim := &simulation{
+		ctx:          ctx,
+		sink:         swappable,
+		counter:      newCountingSink(swappable, viper.GetInt64("max-messages")),
+		running:      make(map[string]sensorRun),
+		sensors:      make(map[string]*simulatedSensor),
+		added:        make(map[string]map[string]any),
+		removed:      make(map[string]bool),
+		rates:        make(map[string][2]float64),
+		started:      time.Now(),
+		nextIndex:    len(sensors) + len(derived),
+		numSensors:   numSensors,
+		minRate:      minRate,
+		maxRate:      maxRate,
+		sinkSettings: sinkSettings(),
+	}
+	// With a ramp-up rate, the sensors start that many per second rather
+	// than all at once.
+	rampUp := viper.GetFloat64("ramp-up.rate")
+	if rampUp > 0 && len(sensors) > 1 {
+		log.Printf("Ramping up %d sensors at %g sensors/s over %s", len(sensors), rampUp, rampUpDelay(len(sensors)-1, rampUp).Round(time.Millisecond))
+	}
+	for i, sensor := range sensors {
+		sim.startAfter(sensor, rampUpDelay(i, rampUp))
+	}
+	if len(derived) > 0 {
+		for _, sensor := range derived {
+			sensor.simPaused = &sim.paused
+		}
+		announce := viper.GetBool("registry.enabled")
+		sim.wg.Add(1)
+		go func() {
+			defer sim.wg.Done()
+			if announce {
+				for _, sensor := range derived {
+					sensor.announce(ctx, sim.counter)
+				}
+			}
+			runDerivedSensors(ctx, sim.counter, derived)
+		}()
+	}
+	return sim, nil
+}
 
-	for i := 0; i < numSensors; i++ {
-		go publishSensorData(ctx, client, i, minRate, maxRate)
+// rampUpDelay returns when the i-th sensor starts, ramping up at rate
+// sensors per second; with no rate, all start at once.
+func rampUpDelay(i int, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
 	}
+	return time.Duration(float64(i) / rate * float64(time.Second))
 }
 
+// envPrefix prefixes the environment variables settings are read from.
+const envPrefix = "DIUSIM"
+
+// bindEnv lets every setting be set from the environment, as DIUSIM_ and
+// its key in upper case with dots and dashes replaced by underscores, e.g.
+// DIUSIM_NUM_SENSORS for num-sensors or DIUSIM_REDIS_ADDR for redis.addr.
+// The environment takes precedence over the config file and the flags.
+func bindEnv() {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
+}
+
+// loadConfig reads the config file, which can be YAML, JSON or TOML as its
+// extension says; files without a known extension are read as YAML.
 func loadConfig() {
-	viper.SetConfigName("config") // name of config file (without extension)
-	viper.SetConfigType("yaml")   // YAML format
-	viper.AddConfigPath(".")      // look for config in the working directory
+	bindEnv()
+	if files := configList("config"); len(files) > 0 {
+		viper.SetConfigFile(files[0])
+		viper.SetConfigType(configType(files[0]))
+	} else {
+		viper.SetConfigName("config") // config.json, config.toml, config.yaml, ...
+		viper.AddConfigPath(".")      // look for config in the working directory
+	}
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -119,56 +496,158 @@ func loadConfig() {
 	} else {
 		log.Println("Using config file:", viper.ConfigFileUsed())
 	}
+	if err := applyIncludes(); err != nil {
+		log.Fatalf("Error including config files: %v", err)
+	}
+	// Settings of the wrong type would otherwise be read as zero values.
+	for _, file := range configFiles() {
+		issues, _ := checkConfigFile(file)
+		for _, issue := range issues {
+			log.Printf("Config error: %s", issue)
+		}
+	}
+	if err := applyProfile(); err != nil {
+		log.Fatalf("Error applying profile: %v", err)
+	}
 
-	log.Printf("Loaded configuration: %+v", viper.AllSettings())
+	settings := viper.AllSettings()
+	maskSecrets(settings)
+	log.Printf("Loaded configuration: %+v", settings)
+}
+
+// secretSettings are the settings masked when the configuration is logged.
+var secretSettings = []string{"redis.password", "stomp.passcode", "pulsar.token"}
+
+// maskSecrets replaces the secretSettings that are set in settings, as
+// viper.AllSettings returns them, with asterisks.
+func maskSecrets(settings map[string]any) {
+	for _, key := range secretSettings {
+		section, name, _ := strings.Cut(key, ".")
+		if values, ok := settings[section].(map[string]any); ok {
+			if secret, _ := values[name].(string); secret != "" {
+				values[name] = "********"
+			}
+		}
+	}
 }
 
 func setupLogging() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 }
 
-func main() {
-	setupLogging()
-
-	numSensors, minRate, maxRate := parseArguments()
-
-	// Load config (will use config.yaml if it exists)
-	loadConfig()
-
-	// Override with config file values if they exist
-	if viper.IsSet("num-sensors") {
-		numSensors = viper.GetInt("num-sensors")
+// setupSimulation loads the plugins, topology and scenario and checks the
+// publish rates, exiting on errors, and returns the number of sensors
+// generated in bulk and the rates.
+func setupSimulation() (numSensors int, minRate, maxRate float64) {
+	if err := loadPlugins(); err != nil {
+		log.Fatalf("Error loading plugins: %v", err)
 	}
-	if viper.IsSet("min-rate") {
-		minRate = viper.GetFloat64("min-rate")
+	if err := checkNaming(); err != nil {
+		log.Fatalf("Error: %v", err)
 	}
-	if viper.IsSet("max-rate") {
-		maxRate = viper.GetFloat64("max-rate")
+	if err := checkChannelAssignment(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := loadTopology(); err != nil {
+		log.Fatalf("Error loading topology: %v", err)
 	}
 
-	// Validate rate values
+	if file := viper.GetString("scenario"); file != "" {
+		events, err := loadScenario(file)
+		if err != nil {
+			log.Fatalf("Error loading scenario: %v", err)
+		}
+		scenario = events
+		log.Printf("Loaded %d scenario events from %s", len(events), file)
+	}
+
+	if viper.GetInt64("seed") == 0 {
+		viper.Set("seed", time.Now().UnixNano())
+	}
+	log.Printf("Simulation seed: %d (rerun with --seed %[1]d to reproduce)", viper.GetInt64("seed"))
+
+	numSensors = bulkSensorCount()
+	minRate, maxRate = viper.GetFloat64("min-rate"), viper.GetFloat64("max-rate")
 	if minRate <= 0 || maxRate <= 0 {
 		log.Fatalf("Error: min-rate and max-rate must be greater than 0")
 	}
 	if minRate > maxRate {
 		log.Fatalf("Error: min-rate cannot be greater than max-rate")
 	}
+	return numSensors, minRate, maxRate
+}
 
+// simulate runs the simulation, publishing to sink, until it is
+// interrupted, the duration setting has passed or max-messages readings
+// are published, and then lets the sensors finish, closes the sink and
+// writes a summary to stdout. With watch, changes to the config file are
+// applied while it runs, and with tui it is shown in the terminal UI (see
+// terminalUI). It returns the counts of the readings published.
+func simulate(sink Sink, numSensors int, minRate, maxRate float64, watch, tui bool) *countingSink {
 	log.Printf("Starting simulation with %d sensors, publishing at rates between %.6f and %.6f Hz\n", numSensors, minRate, maxRate)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	startSensorSimulations(ctx, numSensors, minRate, maxRate)
-
-	// Wait for interrupt signal to gracefully shutdown the simulator
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	duration := viper.GetDuration("duration")
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	start := time.Now()
+	sim, err := startSensorSimulations(ctx, sink, numSensors, minRate, maxRate)
+	if err != nil {
+		log.Fatalf("Error setting up sensors: %v", err)
+	}
+	if watch {
+		sim.watchConfig()
+	}
+	if addr := viper.GetString("control.addr"); addr != "" {
+		control, err := startControlServer(addr, sim)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer control.Close()
+	}
+	if addr := viper.GetString("control.grpc-addr"); addr != "" {
+		control, err := startGRPCControlServer(addr, sim)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer control.Close()
+	}
+	var ui *terminalUI
+	if tui {
+		if ui, err = startTerminalUI(sim, stop); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
 
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("Ran for %s", duration)
+		}
+	case <-sim.counter.full:
+		log.Printf("Published %d readings", sim.counter.limit)
+	}
+	if ui != nil {
+		ui.Close()
+	}
 	log.Println("Shutting down simulator...")
-	cancel()
-	// Wait a bit for goroutines to finish
-	time.Sleep(time.Second)
+	stop()
+	sim.wg.Wait()
+	if err := sim.sink.Close(); err != nil {
+		log.Printf("Error closing sinks: %v", err)
+	}
+	sim.counter.report(os.Stdout, time.Since(start))
 	log.Println("Simulator stopped")
+	return sim.counter
+}
+
+func main() {
+	setupLogging()
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
 }
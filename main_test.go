@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 )
 
 func TestSetupRedisClient(t *testing.T) {
+	useTestRedis(t)
 	client := setupRedisClient()
 
 	if client == nil {
@@ -44,26 +47,44 @@ func TestMarshalSensorData(t *testing.T) {
 	}
 }
 
-func TestParseArguments(t *testing.T) {
-	os.Args = []string{"cmd", "--num-sensors=10", "--min-rate=5.0", "--max-rate=10.0", "--config=config.yaml"}
-
-	numSensors, minRate, maxRate := parseArguments()
+func TestSettingFlags(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	cmd := newRootCommand()
+	if err := cmd.ParseFlags([]string{"--num-sensors=10", "--min-rate=5.0", "--max-rate=10.0", "--sinks=sse,stomp", "--watch-config"}); err != nil {
+		t.Fatalf("Error parsing flags: %v", err)
+	}
+	setFlagDefaults(cmd.Flags())
 
-	if numSensors != 10 {
+	if numSensors := viper.GetInt("num-sensors"); numSensors != 10 {
 		t.Errorf("Expected numSensors to be 10, got %d", numSensors)
 	}
-
-	if minRate != 5.0 {
+	if minRate := viper.GetFloat64("min-rate"); minRate != 5.0 {
 		t.Errorf("Expected minRate to be 5.0, got %f", minRate)
 	}
-
-	if maxRate != 10.0 {
+	if maxRate := viper.GetFloat64("max-rate"); maxRate != 10.0 {
 		t.Errorf("Expected maxRate to be 10.0, got %f", maxRate)
 	}
+	if sinks := configList("sinks"); len(sinks) != 2 || sinks[1] != "stomp" {
+		t.Errorf("Expected sinks sse and stomp, got %v", sinks)
+	}
+	if !viper.GetBool("watch-config") {
+		t.Errorf("Expected watch-config set by the run flag")
+	}
+	if window := viper.GetDuration("batch.window"); window != 0 {
+		t.Errorf("Expected the default batch window 0, got %s", window)
+	}
 
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader("num-sensors: 20\n")); err != nil {
+		t.Fatal(err)
+	}
+	if numSensors := viper.GetInt("num-sensors"); numSensors != 20 {
+		t.Errorf("Expected the config file to override the flag, got %d", numSensors)
+	}
 }
 
 func TestPublishSensorData(t *testing.T) {
+	useTestRedis(t)
 	ctx := context.Background()
 	client := setupRedisClient()
 
@@ -71,7 +92,12 @@ func TestPublishSensorData(t *testing.T) {
 	minRate := 4.0
 	maxRate := 5.0
 
-	go publishSensorData(ctx, client, sensorID, minRate, maxRate)
+	sink, err := newRedisSink(client)
+	if err != nil {
+		t.Fatalf("Error creating Redis sink: %v", err)
+	}
+
+	go publishSensorData(ctx, sink, sensorID, minRate, maxRate)
 
 	channel := channels[sensorID%len(channels)]
 	pubsub := client.Subscribe(ctx, channel)
@@ -139,3 +165,238 @@ max-rate: 12.0
 		t.Errorf("Expected max-rate to be 12.0, got %f", viper.GetFloat64("max-rate"))
 	}
 }
+
+func TestMaskSecrets(t *testing.T) {
+	settings := map[string]any{
+		"redis":  map[string]any{"addr": "localhost:6379", "password": ""},
+		"stomp":  map[string]any{"login": "sim", "passcode": "hunter2"},
+		"pulsar": map[string]any{"token": "eyJhbGciOi"},
+	}
+	maskSecrets(settings)
+	if got := fmt.Sprint(settings); got != "map[pulsar:map[token:********] redis:map[addr:localhost:6379 password:] stomp:map[login:sim passcode:********]]" {
+		t.Errorf("Expected only the set secrets masked, got %s", got)
+	}
+}
+
+func TestDIUID(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("sensors-per-diu", 4)
+	if got := diuID(3); got != "diu_000" {
+		t.Errorf("Expected sensor 3 to belong to diu_000, got %s", got)
+	}
+	if got := diuID(4); got != "diu_001" {
+		t.Errorf("Expected sensor 4 to belong to diu_001, got %s", got)
+	}
+}
+
+func TestBindEnv(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Setenv("DIUSIM_NUM_SENSORS", "7")
+	t.Setenv("DIUSIM_REDIS_ADDR", "redis.test:6380")
+	t.Setenv("DIUSIM_CHANNELS_PRESSURE_MAX", "2.5")
+	viper.SetDefault("redis.addr", "localhost:6379")
+	viper.Set("channels.pressure.min", 1)
+	bindEnv()
+
+	if !viper.IsSet("num-sensors") || viper.GetInt("num-sensors") != 7 {
+		t.Errorf("Expected num-sensors 7 from the environment, got %d", viper.GetInt("num-sensors"))
+	}
+	if addr := viper.GetString("redis.addr"); addr != "redis.test:6380" {
+		t.Errorf("Expected the environment to override the redis.addr default, got %s", addr)
+	}
+	if min, max := channelRange("pressure"); min != 1 || max != 2.5 {
+		t.Errorf("Expected pressure range 1 to 2.5, got %g to %g", min, max)
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{"num-sensors": 20, "channels": {"pressure": {"max": 3.5}}}`,
+		"config.toml": "num-sensors = 20\n\n[channels.pressure]\nmax = 3.5\n",
+		"config.yml":  "num-sensors: 20\nchannels:\n  pressure: {max: 3.5}\n",
+		"config":      "num-sensors: 20\nchannels:\n  pressure: {max: 3.5}\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			viper.Set("config", path)
+			loadConfig()
+			if n := viper.GetInt("num-sensors"); n != 20 {
+				t.Errorf("Expected num-sensors 20, got %d", n)
+			}
+			if max := viper.GetFloat64("channels.pressure.max"); max != 3.5 {
+				t.Errorf("Expected the pressure max 3.5, got %g", max)
+			}
+		})
+	}
+}
+
+func TestWeightedChannel(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	names := []string{"temperature", "pressure", "humidity"}
+	for i := 0; i < 6; i++ {
+		if got := weightedChannel(names, i); got != names[i%3] {
+			t.Errorf("Expected sensor %d assigned round-robin to %s, got %s", i, names[i%3], got)
+		}
+	}
+
+	viper.Set("channels.temperature.weight", 60)
+	viper.Set("channels.pressure.weight", 30)
+	viper.Set("channels.humidity.weight", 10)
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[weightedChannel(names, i)]++
+	}
+	if counts["temperature"] != 600 || counts["pressure"] != 300 || counts["humidity"] != 100 {
+		t.Errorf("Expected sensors assigned 600/300/100, got %v", counts)
+	}
+	first := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		first[weightedChannel(names, i)]++
+	}
+	if first["humidity"] != 1 {
+		t.Errorf("Expected the sensors of each channel spread out, got %v in the first 10", first)
+	}
+
+	viper.Set("channels.humidity.weight", 0)
+	for i := 0; i < 100; i++ {
+		if weightedChannel(names, i) == "humidity" {
+			t.Fatalf("Expected no sensors assigned to a channel of weight 0")
+		}
+	}
+}
+
+func TestRampUp(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	viper.Set("ramp-up.rate", 5)
+
+	if delay := rampUpDelay(3, 5); delay != 600*time.Millisecond {
+		t.Errorf("Expected the fourth sensor to start after 600ms, got %s", delay)
+	}
+	if delay := rampUpDelay(3, 0); delay != 0 {
+		t.Errorf("Expected no delay without a ramp-up rate, got %s", delay)
+	}
+
+	sink := &recordingSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	sim, err := startSensorSimulations(ctx, sink, 10, 50, 50)
+	if err != nil {
+		cancel()
+		t.Fatalf("Error starting simulation: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	sim.wg.Wait()
+
+	started := make(map[string]bool)
+	for _, r := range sink.readings {
+		started[r.SensorID] = true
+	}
+	if len(started) == 0 || len(started) > 3 {
+		t.Errorf("Expected the first 2 sensors started after 300ms, got %d", len(started))
+	}
+	if len(sim.running) != 10 {
+		t.Errorf("Expected all 10 sensors running, got %d", len(sim.running))
+	}
+}
+
+func TestStopBetweenTicks(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+
+	sink := &recordingSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	sim, err := startSensorSimulations(ctx, sink, 4, 0.1, 0.1)
+	if err != nil {
+		cancel()
+		t.Fatalf("Error starting simulation: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	cancel()
+	sim.wg.Wait()
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("Expected the sensors to stop without waiting for their next tick, waited %s", waited)
+	}
+	if len(sink.readings) != 0 {
+		t.Errorf("Expected no readings published after the stop, got %d", len(sink.readings))
+	}
+}
+
+func TestChannelCounts(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("num-sensors", 1000)
+	viper.Set("channel-names", "temperature,pressure,humidity")
+	if n := bulkSensorCount(); n != 1000 {
+		t.Errorf("Expected num-sensors without channel counts, got %d", n)
+	}
+
+	viper.Set("channels.temperature.count", 500)
+	viper.Set("channels.pressure.count", 300)
+	viper.Set("channels.humidity.weight", 5) // ignored with counts
+	if n := bulkSensorCount(); n != 800 {
+		t.Fatalf("Expected the 800 sensors of the channel counts, got %d", n)
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 800; i++ {
+		counts[weightedChannel(channelNames(), i)]++
+	}
+	if counts["temperature"] != 500 || counts["pressure"] != 300 || counts["humidity"] != 0 {
+		t.Errorf("Expected sensors assigned 500/300/0, got %v", counts)
+	}
+}
+
+func TestRandomChannelAssignment(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	names := []string{"temperature", "pressure", "humidity"}
+	viper.Set("channel-assignment", "random")
+	viper.Set("seed", 42)
+	viper.Set("channels.temperature.weight", 60)
+	viper.Set("channels.pressure.weight", 30)
+	viper.Set("channels.humidity.weight", 10)
+
+	counts := make(map[string]int)
+	assigned := make([]string, 2000)
+	for i := range assigned {
+		assigned[i] = weightedChannel(names, i)
+		counts[assigned[i]]++
+	}
+	if counts["temperature"] < 1100 || counts["temperature"] > 1300 || counts["humidity"] < 120 || counts["humidity"] > 280 {
+		t.Errorf("Expected sensors drawn about 60/30/10%%, got %v", counts)
+	}
+
+	// Another run with the same seed assigns the same channels, in any
+	// order of the sensors.
+	assignments = make(map[string]*channelAssignment)
+	for i := len(assigned) - 1; i >= 0; i-- {
+		if got := weightedChannel(names, i); got != assigned[i] {
+			t.Fatalf("Expected sensor %d to keep channel %s, got %s", i, assigned[i], got)
+		}
+	}
+	viper.Set("seed", 43)
+	changed := 0
+	for i := range assigned {
+		if weightedChannel(names, i) != assigned[i] {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Errorf("Expected another seed to assign other channels")
+	}
+
+	viper.Set("channel-assignment", "shuffle")
+	if err := checkChannelAssignment(); err == nil {
+		t.Errorf("Expected an unknown channel-assignment rejected")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// The markov generator builds its states' generators from generatorTypes,
+// so it is registered at init to avoid an initialization cycle.
+func init() {
+	generatorTypes["markov"] = newMarkovGenerator
+}
+
+// markovState is an operating state of a markov generator.
+type markovState struct {
+	generator  ValueGenerator
+	targets    []int     // indexes of the states it can move to
+	cumulative []float64 // cumulative transition probabilities to targets
+}
+
+// newMarkovGenerator models equipment moving between discrete operating
+// states, each with its own value generator, e.g.
+//
+//	type: markov
+//	initial: idle
+//	step: 1s
+//	states:
+//	  idle:
+//	    generator: {type: gaussian, base: 20, stddev: 0.2}
+//	    transitions: {running: 0.05}
+//	  running:
+//	    generator: {type: gaussian, base: 65, stddev: 2}
+//	    transitions: {idle: 0.01, overload: 0.002}
+//
+// Transitions are the probabilities of moving to another state per step,
+// or per sample when step is not set; the remainder is the probability of
+// staying. On enum channels, states named after an enum label and without
+// a generator hold that label's code; other states without a generator
+// draw uniform values from the channel's range.
+func newMarkovGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	specs := cast.ToStringMap(spec["states"])
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("markov generator for %s: states must be set", sensor.ID)
+	}
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[strings.ToLower(name)] = i
+	}
+
+	catalog, err := enumCatalog(sensor.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]markovState, len(names))
+	for i, name := range names {
+		stateSpec := generatorSpec(cast.ToStringMap(specs[name]))
+		inner := generatorSpec(cast.ToStringMap(stateSpec["generator"]))
+		if code, ok := enumCode(catalog, name); ok && len(inner) == 0 {
+			inner = generatorSpec{"type": "square", "amplitude": 0, "offset": code}
+		}
+		typ := inner.str("type", "uniform")
+		factory, ok := generatorTypes[typ]
+		if !ok {
+			return nil, fmt.Errorf("markov generator for %s: unknown generator type %q in state %s", sensor.ID, typ, name)
+		}
+		generator, err := factory(inner, sensor)
+		if err != nil {
+			return nil, err
+		}
+		states[i].generator = generator
+
+		transitions := cast.ToStringMap(stateSpec["transitions"])
+		targets := make([]string, 0, len(transitions))
+		for target := range transitions {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+		var total float64
+		for _, target := range targets {
+			j, ok := index[strings.ToLower(target)]
+			if !ok {
+				return nil, fmt.Errorf("markov generator for %s: state %s has a transition to unknown state %s", sensor.ID, name, target)
+			}
+			p := cast.ToFloat64(transitions[target])
+			if p < 0 {
+				return nil, fmt.Errorf("markov generator for %s: negative probability from %s to %s", sensor.ID, name, target)
+			}
+			total += p
+			states[i].targets = append(states[i].targets, j)
+			states[i].cumulative = append(states[i].cumulative, total)
+		}
+		if total > 1 {
+			return nil, fmt.Errorf("markov generator for %s: transitions from %s add up to more than 1", sensor.ID, name)
+		}
+	}
+
+	initial := spec.str("initial", names[0])
+	current, ok := index[strings.ToLower(initial)]
+	if !ok {
+		return nil, fmt.Errorf("markov generator for %s: unknown initial state %q", sensor.ID, initial)
+	}
+	step := spec.duration("step", 0)
+	if step < 0 {
+		return nil, fmt.Errorf("markov generator for %s: step must not be negative", sensor.ID)
+	}
+
+	transition := func() {
+		state := states[current]
+		r := sensor.Rand.Float64()
+		if i := sort.Search(len(state.cumulative), func(i int) bool { return state.cumulative[i] > r }); i < len(state.targets) {
+			current = state.targets[i]
+		}
+	}
+	var steps int64 // transitions made so far in step mode
+	first := true
+	return generatorFunc(func(t time.Time) float64 {
+		switch {
+		case step > 0:
+			for due := int64(t.Sub(sensor.Start) / step); steps < due; steps++ {
+				transition()
+			}
+		case !first:
+			transition()
+		}
+		first = false
+		return states[current].generator.Next(t)
+	}), nil
+}
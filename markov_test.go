@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func constantState(value float64, transitions map[string]any) map[string]any {
+	return map[string]any{
+		"generator":   map[string]any{"type": "square", "amplitude": 0, "offset": value},
+		"transitions": transitions,
+	}
+}
+
+func TestMarkovGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{
+		"type":    "markov",
+		"initial": "idle",
+		"states": map[string]any{
+			"idle":    constantState(20, map[string]any{"running": 1}),
+			"running": constantState(60, map[string]any{"fault": 0.5}),
+			"fault":   constantState(-1, nil),
+		},
+	})
+	generator, err := newValueGenerator(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+
+	if got := generator.Next(testStart); got != 20 {
+		t.Fatalf("Expected the initial idle state, got %f", got)
+	}
+	if got := generator.Next(testStart); got != 60 {
+		t.Fatalf("Expected a certain move to running, got %f", got)
+	}
+	var running int
+	for i := 0; i < 100; i++ {
+		switch generator.Next(testStart) {
+		case 60:
+			running++
+		case -1:
+		default:
+			t.Fatalf("Expected only running or fault values")
+		}
+	}
+	if running > 20 {
+		t.Errorf("Expected the sensor to end up in the absorbing fault state, ran for %d samples", running)
+	}
+}
+
+func TestMarkovGeneratorSteps(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{
+		"type": "markov",
+		"step": "10s",
+		"states": map[string]any{
+			"a": constantState(1, map[string]any{"b": 1}),
+			"b": constantState(2, map[string]any{"a": 1}),
+		},
+	})
+	generator, err := newValueGenerator(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+
+	// The first state in name order is the default initial state, and
+	// transitions happen every 10s regardless of the sample rate.
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{0, 1},
+		{5 * time.Second, 1},
+		{10 * time.Second, 2},
+		{19 * time.Second, 2},
+		{40 * time.Second, 1},
+	} {
+		if got := generator.Next(testStart.Add(tt.at)); got != tt.want {
+			t.Errorf("At %v: expected %f, got %f", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestMarkovGeneratorErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	for _, spec := range []map[string]any{
+		{"type": "markov"},
+		{"type": "markov", "states": map[string]any{"a": constantState(1, map[string]any{"b": 0.1})}},
+		{"type": "markov", "states": map[string]any{"a": constantState(1, map[string]any{"a": 0.6, "b": 0.6}), "b": constantState(2, nil)}},
+		{"type": "markov", "states": map[string]any{"a": constantState(1, map[string]any{"a": -0.1})}},
+		{"type": "markov", "initial": "c", "states": map[string]any{"a": constantState(1, nil)}},
+		{"type": "markov", "states": map[string]any{"a": map[string]any{"generator": map[string]any{"type": "dice"}}}},
+	} {
+		viper.Set("channels.temperature.generator", spec)
+		if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+}
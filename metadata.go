@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// randomPlaceholder matches the placeholders of metadata values replaced
+// by random characters, e.g. {digits:6}.
+var randomPlaceholder = regexp.MustCompile(`\{(digits|hex|letters):([0-9]+)\}`)
+
+// randomAlphabets are the characters random placeholders draw from.
+var randomAlphabets = map[string]string{
+	"digits":  "0123456789",
+	"hex":     "0123456789abcdef",
+	"letters": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+}
+
+// sensorMetadata returns the static metadata of a sensor, such as its
+// location, model, serial number or firmware: the metadata setting, which
+// applies to all sensors, overridden key by key by
+// channels.<channel>.metadata and sensors.<id>.metadata, e.g.
+//
+//	metadata:
+//	  serial: "SN-{hex:8}"
+//	  firmware: ["1.4.2", "1.4.2", "1.5.0"]
+//	  location: "{site} rack {diu}"
+//	channels:
+//	  temperature:
+//	    metadata: {model: [PT100, PT1000]}
+//
+// A list picks one of its values at random for each sensor. A string can
+// use the variables of naming templates ({channel}, {sensor_id}, {index},
+// {diu} and {site}) and {digits:n}, {hex:n} and {letters:n} for n random
+// characters. The random choices are derived from the sensor's index and
+// the seed, so a seeded simulation keeps them from run to run.
+func sensorMetadata(info sensorInfo) (map[string]string, error) {
+	fields := make(map[string]any)
+	for _, key := range []string{"metadata", "channels." + info.Channel + ".metadata", "sensors." + info.ID + ".metadata"} {
+		maps.Copy(fields, viper.GetStringMap(key))
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	r := sensorRand(info.Index, "metadata")
+	vars := namingVars{Channel: info.Channel, SensorID: info.ID, Index: info.Index, DIU: info.DIU, Site: info.Site}
+	metadata := make(map[string]string, len(fields))
+	for _, field := range sortedKeys(fields) {
+		value := fields[field]
+		if choices, ok := value.([]any); ok {
+			if len(choices) == 0 {
+				return nil, fmt.Errorf("metadata %s of %s: no values to choose from", field, info.ID)
+			}
+			value = choices[r.Intn(len(choices))]
+		}
+		s, err := cast.ToStringE(value)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %s of %s must be a string or a list of them", field, info.ID)
+		}
+		metadata[field] = randomCharacters(expandNaming(s, vars), r)
+	}
+	return metadata, nil
+}
+
+// randomCharacters replaces the random placeholders in s.
+func randomCharacters(s string, r *rand.Rand) string {
+	return randomPlaceholder.ReplaceAllStringFunc(s, func(match string) string {
+		parts := randomPlaceholder.FindStringSubmatch(match)
+		alphabet := randomAlphabets[parts[1]]
+		n := cast.ToInt(parts[2])
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteByte(alphabet[r.Intn(len(alphabet))])
+		}
+		return b.String()
+	})
+}
+
+// registryChannel returns the channel sensors are announced on,
+// registry.channel (default registry).
+func registryChannel() string {
+	if channel := viper.GetString("registry.channel"); channel != "" {
+		return channel
+	}
+	return "registry"
+}
+
+// registryReading returns the reading announcing a sensor on the registry
+// channel, whose metadata is the sensor's metadata together with its
+// channel, DIU, site and unit.
+func (s *simulatedSensor) registryReading(t time.Time) Reading {
+	metadata := map[string]string{"channel": s.info.Channel, "diu": s.info.DIU}
+	if s.info.Site != "" {
+		metadata["site"] = s.info.Site
+	}
+	if s.unit != "" {
+		metadata["unit"] = s.unit
+	}
+	for key, value := range s.metadata {
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = value
+		}
+	}
+	return Reading{
+		SensorData: SensorData{
+			SensorID:  s.info.ID,
+			Channel:   s.registryChannel,
+			Timestamp: t.Format(time.RFC3339Nano),
+			Unit:      s.unit,
+			Metadata:  metadata,
+		},
+		Name:      sensorName(s.registryChannel, s.info),
+		DIU:       s.info.DIU,
+		Site:      s.info.Site,
+		Index:     s.info.Index,
+		auxiliary: true,
+	}
+}
+
+// announce publishes the sensor's registry reading.
+func (s *simulatedSensor) announce(ctx context.Context, sink Sink) {
+	if err := sink.Publish(ctx, s.registryReading(time.Now())); err != nil {
+		log.Printf("Error announcing %s on %s: %v\n", s.info.ID, s.registryChannel, err)
+	}
+}
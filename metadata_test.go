@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestSensorMetadata(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("seed", 7)
+	viper.Set("metadata", map[string]any{
+		"serial":   "SN-{hex:8}",
+		"firmware": []any{"1.4.2", "1.5.0"},
+		"location": "rack {diu}",
+		"model":    "generic",
+	})
+	viper.Set("channels.temperature.metadata", map[string]any{"model": []any{"PT100", "PT1000"}})
+	viper.Set("sensors.sensor_001.metadata", map[string]any{"location": "pump room"})
+
+	sensor := testSensor(1, "temperature")
+	metadata, err := sensorMetadata(sensor)
+	if err != nil {
+		t.Fatalf("Error generating metadata: %v", err)
+	}
+	if !regexp.MustCompile(`^SN-[0-9a-f]{8}$`).MatchString(metadata["serial"]) {
+		t.Errorf("Expected a random serial number, got %q", metadata["serial"])
+	}
+	if !slices.Contains([]string{"1.4.2", "1.5.0"}, metadata["firmware"]) {
+		t.Errorf("Expected a firmware picked from the list, got %q", metadata["firmware"])
+	}
+	if !slices.Contains([]string{"PT100", "PT1000"}, metadata["model"]) {
+		t.Errorf("Expected the channel's model to override the global one, got %q", metadata["model"])
+	}
+	if metadata["location"] != "pump room" {
+		t.Errorf("Expected the sensor's location to override the others, got %q", metadata["location"])
+	}
+	again, _ := sensorMetadata(sensor)
+	if again["serial"] != metadata["serial"] {
+		t.Errorf("Expected the same serial number with the same seed, got %q and %q", metadata["serial"], again["serial"])
+	}
+	pressure := testSensor(2, "pressure")
+	pressure.ID = "sensor_002"
+	other, _ := sensorMetadata(pressure)
+	if other["serial"] == metadata["serial"] || other["location"] != "rack diu_000" || other["model"] != "generic" {
+		t.Errorf("Expected metadata generated per sensor, got %v", other)
+	}
+
+	viper.Set("metadata.firmware", []any{})
+	if _, err := sensorMetadata(sensor); err == nil {
+		t.Errorf("Expected an empty list of values rejected")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	resetBatteries(t)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	viper.Set("registry.enabled", true)
+	viper.Set("registry.in-readings", false)
+	viper.Set("sensors.sensor_000.metadata", map[string]any{"model": "PT100"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := &recordingSink{}
+	sim, err := startSensorSimulations(ctx, sink, 2, 1, 1)
+	if err != nil {
+		cancel()
+		t.Fatalf("Error starting simulation: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.wg.Wait()
+	})
+	deadline := time.Now().Add(2 * time.Second)
+	for sink.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	var announced []string
+	for _, r := range sink.readings {
+		if r.Channel != "registry" {
+			if r.Metadata != nil {
+				t.Errorf("Expected no metadata in readings with registry.in-readings off, got %v", r.Metadata)
+			}
+			continue
+		}
+		announced = append(announced, r.SensorID)
+		if r.SensorID == "sensor_000" && (r.Metadata["model"] != "PT100" || r.Metadata["channel"] != "temperature" || r.Metadata["unit"] != "°C" || r.Name != "registry:sensor_000") {
+			t.Errorf("Expected sensor_000 announced with its metadata, got %+v", r)
+		}
+	}
+	slices.Sort(announced)
+	if !slices.Equal(announced, []string{"sensor_000", "sensor_001"}) {
+		t.Errorf("Expected both sensors announced once, got %v", announced)
+	}
+}
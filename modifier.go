@@ -0,0 +1,674 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// modifierFactory wraps a sensor's generator in a modifier of one type.
+type modifierFactory func(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error)
+
+// modifierTypes are the modifiers selectable with the type parameter.
+var modifierTypes = map[string]modifierFactory{
+	"drift":       newDriftModifier,
+	"profile":     newProfileModifier,
+	"anomaly":     newAnomalyModifier,
+	"dropout":     newDropoutModifier,
+	"stuck":       newStuckModifier,
+	"invalid":     newInvalidModifier,
+	"quantize":    newQuantizeModifier,
+	"calibration": newCalibrationModifier,
+	"slew":        newSlewModifier,
+	"noise":       newNoiseModifier,
+	"warmup":      newWarmupModifier,
+}
+
+// modifierSpecsFor returns the modifiers configured for a sensor, in the
+// order they are applied: channels.<channel>.modifiers followed by
+// sensors.<sensor_id>.modifiers.
+func modifierSpecsFor(sensor sensorInfo) []generatorSpec {
+	var specs []generatorSpec
+	for _, key := range []string{"channels." + sensor.Channel + ".modifiers", "sensors." + sensor.ID + ".modifiers"} {
+		for _, item := range cast.ToSlice(viper.Get(key)) {
+			specs = append(specs, cast.ToStringMap(item))
+		}
+	}
+	return specs
+}
+
+// applyModifiers layers the configured modifiers over a sensor's generator.
+func applyModifiers(sensor sensorInfo, generator ValueGenerator) (ValueGenerator, error) {
+	for _, spec := range modifierSpecsFor(sensor) {
+		typ := spec.str("type", "")
+		factory, ok := modifierTypes[typ]
+		if !ok {
+			return nil, fmt.Errorf("unknown modifier type %q for %s", typ, sensor.ID)
+		}
+		var err error
+		if generator, err = factory(spec, sensor, generator); err != nil {
+			return nil, err
+		}
+	}
+	return generator, nil
+}
+
+// newDriftModifier adds a slow trend to the values, beginning after delay.
+// In linear mode the offset grows by rate every per (default 1h); in
+// exponential mode it approaches limit with the given time-constant, like
+// an ageing sensor settling at a new bias.
+func newDriftModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	delay := spec.duration("delay", 0)
+
+	var offset func(elapsed time.Duration) float64
+	switch mode := spec.str("mode", "linear"); mode {
+	case "linear":
+		rate := spec.float("rate", 0)
+		per := spec.duration("per", time.Hour)
+		if per <= 0 {
+			return nil, fmt.Errorf("drift modifier for %s: per must be positive", sensor.ID)
+		}
+		offset = func(elapsed time.Duration) float64 {
+			return rate * float64(elapsed) / float64(per)
+		}
+	case "exponential":
+		limit := spec.float("limit", 0)
+		tau := spec.duration("time-constant", time.Hour)
+		if tau <= 0 {
+			return nil, fmt.Errorf("drift modifier for %s: time-constant must be positive", sensor.ID)
+		}
+		offset = func(elapsed time.Duration) float64 {
+			return limit * (1 - math.Exp(-float64(elapsed)/float64(tau)))
+		}
+	default:
+		return nil, fmt.Errorf("unknown drift mode %q for %s", mode, sensor.ID)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		value := inner.Next(t)
+		if elapsed := t.Sub(sensor.Start) - delay; elapsed > 0 {
+			value += offset(elapsed)
+		}
+		return value
+	}), nil
+}
+
+// cyclePeriods are the periods of the profile modifier, with the layout of
+// their at and peak times and the default peak.
+var cyclePeriods = map[string]struct {
+	layout string
+	peak   string
+}{
+	"daily":  {"15:04", "15:00"},
+	"weekly": {"Mon 15:04", "Wed 15:00"},
+	"yearly": {"01-02", "07-15"},
+}
+
+// cyclePosition returns how far into its daily, weekly or yearly cycle t
+// is, as a fraction in [0, 1). Weeks start on Monday.
+func cyclePosition(period string, t time.Time) float64 {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	day := float64(t.Sub(midnight)) / float64(24*time.Hour)
+	switch period {
+	case "weekly":
+		return (float64((int(t.Weekday())+6)%7) + day) / 7
+	case "yearly":
+		days := 365.0
+		if time.Date(t.Year(), 12, 31, 0, 0, 0, 0, time.UTC).YearDay() == 366 {
+			days = 366
+		}
+		return (float64(t.YearDay()-1) + day) / days
+	default:
+		return day
+	}
+}
+
+// parseCycleTime converts an at time of the profile modifier to its
+// position in the cycle.
+func parseCycleTime(period, at string) (float64, error) {
+	p, err := time.Parse(cyclePeriods[period].layout, at)
+	if err != nil {
+		return 0, err
+	}
+	day := float64(p.Hour()*60+p.Minute()) / (24 * 60)
+	switch period {
+	case "weekly":
+		// Parsing checks the weekday name but does not set the date.
+		weekday := strings.Index("MonTueWedThuFriSatSun", at[:3]) / 3
+		return (float64(weekday) + day) / 7, nil
+	case "yearly":
+		// Parsing leaves the date in year 0, a leap year; the days are
+		// counted in a common year, as cyclePosition counts them.
+		common := time.Date(2001, p.Month(), p.Day(), 0, 0, 0, 0, time.UTC)
+		return (float64(common.YearDay()-1) + day) / 365, nil
+	default:
+		return day, nil
+	}
+}
+
+type profilePoint struct {
+	pos   float64
+	value float64
+}
+
+// newProfileModifier modulates the values with a daily, weekly or yearly
+// profile of the time of day in the given timezone (default local). The
+// profile is either a cosine of the given amplitude that peaks at peak, or
+// piecewise linear through points, a list of {at, value} pairs. In add mode
+// the profile value is added to the values; in scale mode the values are
+// multiplied by 1 + the profile value.
+func newProfileModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	period := spec.str("period", "daily")
+	if _, ok := cyclePeriods[period]; !ok {
+		return nil, fmt.Errorf("unknown profile period %q for %s", period, sensor.ID)
+	}
+	loc, err := time.LoadLocation(spec.str("timezone", "Local"))
+	if err != nil {
+		return nil, fmt.Errorf("profile modifier for %s: %w", sensor.ID, err)
+	}
+
+	var profile func(pos float64) float64
+	if items := cast.ToSlice(spec["points"]); len(items) > 0 {
+		points := make([]profilePoint, len(items))
+		for i, item := range items {
+			point := generatorSpec(cast.ToStringMap(item))
+			pos, err := parseCycleTime(period, point.str("at", ""))
+			if err != nil {
+				return nil, fmt.Errorf("profile modifier for %s: %w", sensor.ID, err)
+			}
+			points[i] = profilePoint{pos: pos, value: point.float("value", 0)}
+		}
+		sort.Slice(points, func(i, j int) bool { return points[i].pos < points[j].pos })
+		profile = func(pos float64) float64 {
+			return interpolateCycle(points, pos)
+		}
+	} else {
+		amplitude := spec.float("amplitude", 0)
+		peak, err := parseCycleTime(period, spec.str("peak", cyclePeriods[period].peak))
+		if err != nil {
+			return nil, fmt.Errorf("profile modifier for %s: %w", sensor.ID, err)
+		}
+		profile = func(pos float64) float64 {
+			return amplitude * math.Cos(2*math.Pi*(pos-peak))
+		}
+	}
+
+	scale := false
+	switch mode := spec.str("mode", "add"); mode {
+	case "add":
+	case "scale":
+		scale = true
+	default:
+		return nil, fmt.Errorf("unknown profile mode %q for %s", mode, sensor.ID)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		value := inner.Next(t)
+		p := profile(cyclePosition(period, t.In(loc)))
+		if scale {
+			return value * (1 + p)
+		}
+		return value + p
+	}), nil
+}
+
+// interpolateCycle interpolates linearly between points sorted by their
+// position in a cycle, wrapping around from the last point to the first.
+func interpolateCycle(points []profilePoint, pos float64) float64 {
+	prev, next := points[len(points)-1], points[0]
+	prev.pos--
+	for _, point := range points {
+		if point.pos > pos {
+			next = point
+			break
+		}
+		prev = point
+		next = points[0]
+		next.pos++
+	}
+	if next.pos == prev.pos {
+		return prev.value
+	}
+	return prev.value + (next.value-prev.value)*(pos-prev.pos)/(next.pos-prev.pos)
+}
+
+// scheduleWindow is a period in a modifier's schedule, measured from the
+// start of the simulation.
+type scheduleWindow struct {
+	at       time.Duration
+	duration time.Duration
+	fired    bool // for one-off events at the start of the window
+}
+
+func (w *scheduleWindow) contains(elapsed time.Duration) bool {
+	return elapsed >= w.at && elapsed < w.at+w.duration
+}
+
+// parseSchedule reads the schedule parameter of a modifier, a list of
+// {at, duration} windows. Windows without a duration last def.
+func parseSchedule(spec generatorSpec, def time.Duration) []*scheduleWindow {
+	var windows []*scheduleWindow
+	for _, item := range cast.ToSlice(spec["schedule"]) {
+		window := generatorSpec(cast.ToStringMap(item))
+		windows = append(windows, &scheduleWindow{
+			at:       window.duration("at", 0),
+			duration: window.duration("duration", def),
+		})
+	}
+	return windows
+}
+
+// newAnomalyModifier injects anomalies of one kind and labels the affected
+// samples with it:
+//
+//	spike:          a single sample offset by magnitude
+//	level-shift:    samples offset by magnitude for duration
+//	variance-burst: samples with normal noise of stddev magnitude added for
+//	                duration
+//
+// Anomalies start at random, with the given probability per sample, and at
+// the times in schedule, a list of {at, duration} windows. Spikes and
+// shifts go up or down at random unless direction is up or down. The
+// magnitude defaults to half of the channel's range.
+func newAnomalyModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	kind := spec.str("kind", "spike")
+	switch kind {
+	case "spike", "level-shift", "variance-burst":
+	default:
+		return nil, fmt.Errorf("unknown anomaly kind %q for %s", kind, sensor.ID)
+	}
+	min, max, err := specRange(spec, sensor)
+	if err != nil {
+		return nil, err
+	}
+	magnitude := spec.float("magnitude", (max-min)/2)
+	probability := spec.float("probability", 0)
+	duration := spec.duration("duration", time.Minute)
+
+	var direction float64
+	switch dir := spec.str("direction", "random"); dir {
+	case "up":
+		direction = 1
+	case "down":
+		direction = -1
+	case "random":
+	default:
+		return nil, fmt.Errorf("unknown anomaly direction %q for %s", dir, sensor.ID)
+	}
+
+	windows := parseSchedule(spec, duration)
+
+	// sign picks the direction of a spike or shift.
+	sign := func() float64 {
+		if direction != 0 {
+			return direction
+		}
+		if sensor.Rand.Intn(2) == 0 {
+			return -1
+		}
+		return 1
+	}
+
+	var until time.Time // end of the random anomaly in progress
+	var shift float64   // offset of the level shift in progress
+	return generatorFunc(func(t time.Time) float64 {
+		value := inner.Next(t)
+		elapsed := t.Sub(sensor.Start)
+
+		active := t.Before(until)
+		for _, window := range windows {
+			if kind == "spike" {
+				// Scheduled spikes hit the first sample of their window.
+				if !window.fired && elapsed >= window.at {
+					window.fired = true
+					active = true
+				}
+			} else if window.contains(elapsed) {
+				if !active && shift == 0 {
+					shift = sign() * magnitude
+				}
+				active = true
+			}
+		}
+		if !active && probability > 0 && sensor.Rand.Float64() < probability {
+			active = true
+			if kind != "spike" {
+				until = t.Add(duration)
+				shift = sign() * magnitude
+			}
+		}
+		if !active {
+			shift = 0
+			return value
+		}
+
+		sensor.Notes.Anomaly = kind
+		switch kind {
+		case "spike":
+			return value + sign()*magnitude
+		case "level-shift":
+			return value + shift
+		default:
+			return value + sensor.Rand.NormFloat64()*magnitude
+		}
+	}), nil
+}
+
+// newDropoutModifier makes the sensor skip samples: each sample is dropped
+// with the given probability, or, if duration is set, starts an outage of
+// that length with that probability. The windows in schedule are outages
+// too. Dropped samples still use up a sequence number, so consumers can
+// see the gap.
+func newDropoutModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	probability := spec.float("probability", 0)
+	duration := spec.duration("duration", 0)
+	windows := parseSchedule(spec, time.Minute)
+
+	var until time.Time // end of the random outage in progress
+	return generatorFunc(func(t time.Time) float64 {
+		value := inner.Next(t)
+		elapsed := t.Sub(sensor.Start)
+
+		drop := t.Before(until)
+		for _, window := range windows {
+			drop = drop || window.contains(elapsed)
+		}
+		if !drop && probability > 0 && sensor.Rand.Float64() < probability {
+			drop = true
+			until = t.Add(duration)
+		}
+		if drop {
+			sensor.Notes.Drop = true
+		}
+		return value
+	}), nil
+}
+
+// newStuckModifier freezes the sensor for duration (default 1m), starting
+// at random with the given probability per sample and at the windows in
+// schedule. A stuck sensor repeats its last value, or value if that is set.
+func newStuckModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	probability := spec.float("probability", 0)
+	duration := spec.duration("duration", time.Minute)
+	windows := parseSchedule(spec, duration)
+	_, fixed := spec["value"]
+	fixedValue := spec.float("value", 0)
+
+	var until time.Time // end of the random fault in progress
+	var held float64
+	var holding bool
+	return generatorFunc(func(t time.Time) float64 {
+		value := inner.Next(t)
+		elapsed := t.Sub(sensor.Start)
+
+		stuck := t.Before(until)
+		for _, window := range windows {
+			stuck = stuck || window.contains(elapsed)
+		}
+		if !stuck && probability > 0 && sensor.Rand.Float64() < probability {
+			stuck = true
+			until = t.Add(duration)
+		}
+		if !stuck {
+			holding = false
+			return value
+		}
+
+		if !holding {
+			held, holding = value, true
+			if fixed {
+				held = fixedValue
+			}
+		}
+		sensor.Notes.Fault = "stuck"
+		return held
+	}), nil
+}
+
+// newInvalidModifier replaces samples with values no healthy sensor could
+// produce, at random with the given probability per sample and throughout
+// the windows in schedule. The kind of value is one of:
+//
+//	out-of-range: value, by default ten times the channel's range above max
+//	nan:          NaN
+//	inf:          +Inf, or -Inf with direction: down
+//	sentinel:     an error code, value (default -9999)
+func newInvalidModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	kind := spec.str("kind", "nan")
+	var invalid float64
+	switch kind {
+	case "out-of-range":
+		min, max, err := specRange(spec, sensor)
+		if err != nil {
+			return nil, err
+		}
+		invalid = spec.float("value", max+10*(max-min))
+	case "nan":
+		invalid = math.NaN()
+	case "inf":
+		invalid = math.Inf(1)
+		if spec.str("direction", "up") == "down" {
+			invalid = math.Inf(-1)
+		}
+	case "sentinel":
+		invalid = spec.float("value", -9999)
+	default:
+		return nil, fmt.Errorf("unknown invalid value kind %q for %s", kind, sensor.ID)
+	}
+	probability := spec.float("probability", 0)
+	windows := parseSchedule(spec, time.Minute)
+
+	return generatorFunc(func(t time.Time) float64 {
+		value := inner.Next(t)
+		elapsed := t.Sub(sensor.Start)
+
+		hit := probability > 0 && sensor.Rand.Float64() < probability
+		for _, window := range windows {
+			hit = hit || window.contains(elapsed)
+		}
+		if !hit {
+			return value
+		}
+		sensor.Notes.Fault = kind
+		return invalid
+	}), nil
+}
+
+// newQuantizeModifier makes values look like the output of an ADC by
+// rounding them to multiples of an LSB size, given directly as lsb or as
+// the resolution of an ADC with the given number of bits over min to max
+// (by default the channel's range), which also saturates at the ends of
+// the range. Rounding is to the nearest step, or floor or ceil. With
+// decimals the values are finally rounded to that many decimal places,
+// which on its own simulates a display resolution.
+func newQuantizeModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	var round func(float64) float64
+	switch rounding := spec.str("rounding", "nearest"); rounding {
+	case "nearest":
+		round = math.Round
+	case "floor":
+		round = math.Floor
+	case "ceil":
+		round = math.Ceil
+	default:
+		return nil, fmt.Errorf("quantize modifier for %s: unknown rounding %q", sensor.ID, rounding)
+	}
+
+	var base, lsb float64
+	minCode, maxCode := math.Inf(-1), math.Inf(1)
+	switch _, hasBits := spec["bits"]; {
+	case hasBits:
+		bits := spec.float("bits", 0)
+		if bits < 1 || bits > 32 {
+			return nil, fmt.Errorf("quantize modifier for %s: bits must be between 1 and 32", sensor.ID)
+		}
+		min, max, err := specRange(spec, sensor)
+		if err != nil {
+			return nil, err
+		}
+		maxCode = math.Exp2(bits) - 1
+		base, lsb, minCode = min, (max-min)/maxCode, 0
+	default:
+		lsb = spec.float("lsb", 0)
+	}
+	if lsb < 0 {
+		return nil, fmt.Errorf("quantize modifier for %s: lsb must not be negative", sensor.ID)
+	}
+
+	scale := -1.0
+	if _, ok := spec["decimals"]; ok {
+		scale = math.Pow(10, spec.float("decimals", 0))
+	}
+	if lsb == 0 && scale < 0 {
+		return nil, fmt.Errorf("quantize modifier for %s: set lsb, bits or decimals", sensor.ID)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		value := inner.Next(t)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return value
+		}
+		if lsb > 0 {
+			code := math.Max(minCode, math.Min(maxCode, round((value-base)/lsb)))
+			value = base + code*lsb
+		}
+		if scale > 0 {
+			value = math.Round(value*scale) / scale
+		}
+		return value
+	}), nil
+}
+
+// newCalibrationModifier applies a sensor's calibration error: values are
+// multiplied by gain and then offset is added. Either parameter can be a
+// [min, max] pair instead of a number, in which case each sensor is
+// assigned its own value in that range. The assignment is derived from the
+// sensor ID and seed, so a sensor keeps its calibration from run to run.
+func newCalibrationModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%s", spec.str("seed", ""), sensor.ID)
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	gain, err := calibrationParam(spec, "gain", 1, r)
+	if err != nil {
+		return nil, fmt.Errorf("calibration modifier for %s: %w", sensor.ID, err)
+	}
+	offset, err := calibrationParam(spec, "offset", 0, r)
+	if err != nil {
+		return nil, fmt.Errorf("calibration modifier for %s: %w", sensor.ID, err)
+	}
+	if isRange(spec["gain"]) || isRange(spec["offset"]) {
+		log.Printf("Calibration of %s: gain %g, offset %g", sensor.ID, gain, offset)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		return inner.Next(t)*gain + offset
+	}), nil
+}
+
+// calibrationParam returns a calibration parameter: the number it is set
+// to, or a value drawn from r within the [min, max] pair it is set to.
+func calibrationParam(spec generatorSpec, key string, def float64, r *rand.Rand) (float64, error) {
+	if !isRange(spec[key]) {
+		return spec.float(key, def), nil
+	}
+	bounds := cast.ToSlice(spec[key])
+	if len(bounds) != 2 {
+		return 0, fmt.Errorf("%s must be a number or a [min, max] pair", key)
+	}
+	min, max := cast.ToFloat64(bounds[0]), cast.ToFloat64(bounds[1])
+	if min > max {
+		return 0, fmt.Errorf("%s min %g is greater than max %g", key, min, max)
+	}
+	return min + r.Float64()*(max-min), nil
+}
+
+// isRange reports whether a parameter is given as a list.
+func isRange(v any) bool {
+	_, ok := v.([]any)
+	return ok
+}
+
+// newSlewModifier limits how fast values can change, like the response of
+// a physical sensor: each value moves from the previous one towards the
+// generated value by at most rate units per second, or per sample when
+// per is sample. Rising and falling values can be limited separately with
+// rise and fall, which default to rate. Invalid values pass through
+// without moving the limited value.
+func newSlewModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	rate := spec.float("rate", math.Inf(1))
+	rise, fall := spec.float("rise", rate), spec.float("fall", rate)
+	if rise <= 0 || fall <= 0 {
+		return nil, fmt.Errorf("slew modifier for %s: rate, rise and fall must be positive", sensor.ID)
+	}
+	if math.IsInf(rise, 1) && math.IsInf(fall, 1) {
+		return nil, fmt.Errorf("slew modifier for %s: set rate, rise or fall", sensor.ID)
+	}
+	perSecond := true
+	switch per := spec.str("per", "second"); per {
+	case "second":
+	case "sample":
+		perSecond = false
+	default:
+		return nil, fmt.Errorf("slew modifier for %s: unknown per %q", sensor.ID, per)
+	}
+
+	var last float64
+	var lastTime time.Time
+	started := false
+	return generatorFunc(func(t time.Time) float64 {
+		value := inner.Next(t)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return value
+		}
+		if started {
+			scale := 1.0
+			if perSecond {
+				scale = math.Max(t.Sub(lastTime).Seconds(), 0)
+			}
+			value = math.Max(last-fall*scale, math.Min(last+rise*scale, value))
+		}
+		last, lastTime, started = value, t, true
+		return value
+	}), nil
+}
+
+// newWarmupModifier simulates a sensor warming up after power-on: its
+// readings start at cold (by default the bottom of the sensor's range)
+// and converge exponentially on the generated values with the given
+// time-constant (default 1m). The sensor warms up again whenever it comes
+// back from an outage, whether its samples were dropped by a dropout
+// modifier applied before this one or it was not sampled for longer than
+// gap, if that is set.
+func newWarmupModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	min, _ := sensorRange(sensor)
+	cold := spec.float("cold", min)
+	tau := spec.duration("time-constant", time.Minute)
+	gap := spec.duration("gap", 0)
+	if tau <= 0 || gap < 0 {
+		return nil, fmt.Errorf("warmup modifier for %s: time-constant must be positive and gap must not be negative", sensor.ID)
+	}
+
+	var start, last time.Time // power-on and the previous sample
+	off := true
+	return generatorFunc(func(t time.Time) float64 {
+		value := inner.Next(t)
+		if sensor.Notes.Drop {
+			off = true
+			return value
+		}
+		if off || gap > 0 && t.Sub(last) > gap {
+			start, off = t, false
+		}
+		last = t
+		return value + (cold-value)*math.Exp(-t.Sub(start).Seconds()/tau.Seconds())
+	}), nil
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// constantGenerator sets the channel's generator to a constant value, as a
+// flat square wave with no amplitude.
+func constantGenerator(channel string, value float64) {
+	viper.Set("channels."+channel+".generator", map[string]any{"type": "square", "amplitude": 0, "offset": value})
+}
+
+func TestLinearDrift(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("temperature", 20)
+	viper.Set("channels.temperature.modifiers", []any{
+		map[string]any{"type": "drift", "rate": 0.5, "per": "1h", "delay": "1h"},
+	})
+
+	generator, err := newValueGenerator(testSensor(0, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{30 * time.Minute, 20},
+		{2 * time.Hour, 20.5},
+		{5 * time.Hour, 22},
+	} {
+		if got := generator.Next(testStart.Add(tt.at)); !approxEqual(got, tt.want) {
+			t.Errorf("At %v: expected %f, got %f", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestExponentialDriftPerSensor(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("pressure", 1)
+	viper.Set("sensors.sensor_001.modifiers", []any{
+		map[string]any{"type": "drift", "mode": "exponential", "limit": 0.1, "time-constant": "1h"},
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "pressure"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	if got := generator.Next(testStart.Add(time.Hour)); !approxEqual(got, 1+0.1*(1-1/2.718281828459045)) {
+		t.Errorf("Expected 63%% of the drift limit after one time constant, got %f", got)
+	}
+	if got := generator.Next(testStart.Add(100 * time.Hour)); !approxEqual(got, 1.1) {
+		t.Errorf("Expected the drift to settle at the limit, got %f", got)
+	}
+}
+
+func TestUnknownModifier(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.humidity.modifiers", []any{map[string]any{"type": "gremlins"}})
+
+	if _, err := newValueGenerator(testSensor(2, "humidity")); err == nil {
+		t.Errorf("Expected an error for an unknown modifier type")
+	}
+}
+
+func TestDailyProfile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("temperature", 20)
+	viper.Set("channels.temperature.modifiers", []any{
+		map[string]any{"type": "profile", "amplitude": 5, "peak": "15:00", "timezone": "UTC"},
+	})
+
+	generator, err := newValueGenerator(testSensor(0, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	if got := generator.Next(day.Add(15 * time.Hour)); !approxEqual(got, 25) {
+		t.Errorf("Expected the peak at 15:00, got %f", got)
+	}
+	if got := generator.Next(day.Add(3 * time.Hour)); !approxEqual(got, 15) {
+		t.Errorf("Expected the trough at 03:00, got %f", got)
+	}
+}
+
+func TestWeeklyProfilePoints(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("pressure", 1)
+	viper.Set("channels.pressure.modifiers", []any{
+		map[string]any{
+			"type":     "profile",
+			"period":   "weekly",
+			"mode":     "scale",
+			"timezone": "UTC",
+			"points": []any{
+				map[string]any{"at": "Mon 00:00", "value": 0},
+				map[string]any{"at": "Wed 00:00", "value": 0.2},
+			},
+		},
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "pressure"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	monday := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{0, 1},
+		{24 * time.Hour, 1.1},        // Tuesday, halfway up
+		{48 * time.Hour, 1.2},        // Wednesday
+		{(48 + 60) * time.Hour, 1.1}, // Friday noon, halfway back to Monday
+	} {
+		if got := generator.Next(monday.Add(tt.at)); !approxEqual(got, tt.want) {
+			t.Errorf("At Monday+%v: expected %f, got %f", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestYearlyCycleTime(t *testing.T) {
+	for at, date := range map[string]time.Time{
+		"01-01": time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		"03-01": time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		"12-31": time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC),
+	} {
+		pos, err := parseCycleTime("yearly", at)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", at, err)
+		}
+		if want := cyclePosition("yearly", date); !approxEqual(pos, want) || pos >= 1 {
+			t.Errorf("%s: expected position %f, got %f", at, want, pos)
+		}
+	}
+}
+
+func TestScheduledAnomalies(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("temperature", 20)
+	viper.Set("channels.temperature.modifiers", []any{
+		map[string]any{"type": "anomaly", "kind": "spike", "magnitude": 10, "direction": "up",
+			"schedule": []any{map[string]any{"at": "1m"}}},
+		map[string]any{"type": "anomaly", "kind": "level-shift", "magnitude": 2, "direction": "down",
+			"schedule": []any{map[string]any{"at": "5m", "duration": "2m"}}},
+	})
+
+	sensor := testSensor(0, "temperature")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at      time.Duration
+		want    float64
+		anomaly string
+	}{
+		{30 * time.Second, 20, ""},
+		{61 * time.Second, 30, "spike"},
+		{62 * time.Second, 20, ""},
+		{6 * time.Minute, 18, "level-shift"},
+		{8 * time.Minute, 20, ""},
+	} {
+		*sensor.Notes = sampleNotes{}
+		if got := generator.Next(testStart.Add(tt.at)); !approxEqual(got, tt.want) || sensor.Notes.Anomaly != tt.anomaly {
+			t.Errorf("At %v: expected %f (%q), got %f (%q)", tt.at, tt.want, tt.anomaly, got, sensor.Notes.Anomaly)
+		}
+	}
+}
+
+func TestRandomAnomalies(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("pressure", 1)
+	viper.Set("channels.pressure.modifiers", []any{
+		map[string]any{"type": "anomaly", "kind": "variance-burst", "magnitude": 0.1, "probability": 0.01, "duration": "10s"},
+	})
+
+	sensor := testSensor(1, "pressure")
+	generator, _ := newValueGenerator(sensor)
+	labelled := 0
+	for i := 0; i < 10000; i++ {
+		*sensor.Notes = sampleNotes{}
+		v := generator.Next(testStart.Add(time.Duration(i) * time.Second))
+		if sensor.Notes.Anomaly != "" {
+			labelled++
+		} else if v != 1 {
+			t.Fatalf("Unlabelled sample %d has value %f", i, v)
+		}
+	}
+	if labelled == 0 || labelled == 10000 {
+		t.Errorf("Expected some samples in variance bursts, got %d", labelled)
+	}
+}
+
+func TestDropout(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.humidity.modifiers", []any{
+		map[string]any{"type": "dropout", "schedule": []any{map[string]any{"at": "10m", "duration": "5m"}}},
+	})
+
+	sensor := testSensor(2, "humidity")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		drop bool
+	}{
+		{9 * time.Minute, false},
+		{10 * time.Minute, true},
+		{14 * time.Minute, true},
+		{15 * time.Minute, false},
+	} {
+		*sensor.Notes = sampleNotes{}
+		generator.Next(testStart.Add(tt.at))
+		if sensor.Notes.Drop != tt.drop {
+			t.Errorf("At %v: expected drop %v", tt.at, tt.drop)
+		}
+	}
+}
+
+func TestRandomOutages(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.humidity.modifiers", []any{
+		map[string]any{"type": "dropout", "probability": 0.01, "duration": "30s"},
+	})
+
+	sensor := testSensor(2, "humidity")
+	generator, _ := newValueGenerator(sensor)
+	dropped, outages := 0, 0
+	previous := false
+	for i := 0; i < 10000; i++ {
+		*sensor.Notes = sampleNotes{}
+		generator.Next(testStart.Add(time.Duration(i) * time.Second))
+		if sensor.Notes.Drop {
+			dropped++
+			if !previous {
+				outages++
+			}
+		}
+		previous = sensor.Notes.Drop
+	}
+	if outages == 0 || dropped < outages*30 {
+		t.Errorf("Expected outages of at least 30 samples, got %d samples in %d outages", dropped, outages)
+	}
+}
+
+func TestStuckModifier(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{"type": "sawtooth", "period": "10m", "amplitude": 5, "offset": 25})
+	viper.Set("channels.temperature.modifiers", []any{
+		map[string]any{"type": "stuck", "schedule": []any{map[string]any{"at": "2m", "duration": "3m"}}},
+		map[string]any{"type": "stuck", "value": -1, "schedule": []any{map[string]any{"at": "6m", "duration": "1m"}}},
+	})
+
+	sensor := testSensor(0, "temperature")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at    time.Duration
+		want  float64
+		fault string
+	}{
+		{1 * time.Minute, 21, ""},
+		{2 * time.Minute, 22, "stuck"},
+		{4 * time.Minute, 22, "stuck"},
+		{5 * time.Minute, 25, ""},
+		{6 * time.Minute, -1, "stuck"},
+	} {
+		*sensor.Notes = sampleNotes{}
+		if got := generator.Next(testStart.Add(tt.at)); !approxEqual(got, tt.want) || sensor.Notes.Fault != tt.fault {
+			t.Errorf("At %v: expected %f (%q), got %f (%q)", tt.at, tt.want, tt.fault, got, sensor.Notes.Fault)
+		}
+	}
+}
+
+func TestInvalidValues(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("pressure", 1)
+	viper.Set("channels.pressure.modifiers", []any{
+		map[string]any{"type": "invalid", "kind": "nan", "schedule": []any{map[string]any{"at": "1m"}}},
+		map[string]any{"type": "invalid", "kind": "sentinel", "schedule": []any{map[string]any{"at": "3m"}}},
+		map[string]any{"type": "invalid", "kind": "out-of-range", "schedule": []any{map[string]any{"at": "5m"}}},
+		map[string]any{"type": "invalid", "kind": "inf", "direction": "down", "schedule": []any{map[string]any{"at": "7m"}}},
+	})
+
+	sensor := testSensor(1, "pressure")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	check := func(at time.Duration, ok func(float64) bool, fault string) {
+		t.Helper()
+		*sensor.Notes = sampleNotes{}
+		if got := generator.Next(testStart.Add(at)); !ok(got) || sensor.Notes.Fault != fault {
+			t.Errorf("At %v: unexpected value %f (%q)", at, got, sensor.Notes.Fault)
+		}
+	}
+	check(0, func(v float64) bool { return v == 1 }, "")
+	check(time.Minute, math.IsNaN, "nan")
+	check(3*time.Minute, func(v float64) bool { return v == -9999 }, "sentinel")
+	check(5*time.Minute, func(v float64) bool { return approxEqual(v, 5.2) }, "out-of-range")
+	check(7*time.Minute, func(v float64) bool { return math.IsInf(v, -1) }, "inf")
+}
+
+func TestQuantizeModifier(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	tests := []struct {
+		modifier map[string]any
+		value    float64
+		want     float64
+	}{
+		{map[string]any{"lsb": 0.25}, 20.3, 20.25},
+		{map[string]any{"lsb": 0.25, "rounding": "ceil"}, 20.3, 20.5},
+		{map[string]any{"lsb": 0.1, "decimals": 1}, 0.34, 0.3},
+		{map[string]any{"decimals": 2}, 1.23456, 1.23},
+		// 8 bits over 0..255 gives whole numbers, saturating at 255.
+		{map[string]any{"bits": 8, "min": 0, "max": 255}, 12.6, 13},
+		{map[string]any{"bits": 8, "min": 0, "max": 255}, 300, 255},
+		{map[string]any{"bits": 8, "min": 0, "max": 255, "rounding": "floor"}, -3, 0},
+	}
+	for _, tt := range tests {
+		constantGenerator("temperature", tt.value)
+		tt.modifier["type"] = "quantize"
+		viper.Set("channels.temperature.modifiers", []any{tt.modifier})
+		generator, err := newValueGenerator(testSensor(1, "temperature"))
+		if err != nil {
+			t.Fatalf("%v: error creating generator: %v", tt.modifier, err)
+		}
+		if got := generator.Next(testStart); !approxEqual(got, tt.want) {
+			t.Errorf("%v: expected %g to quantize to %g, got %g", tt.modifier, tt.value, tt.want, got)
+		}
+	}
+
+	for _, modifier := range []map[string]any{
+		{"type": "quantize"},
+		{"type": "quantize", "bits": 0},
+		{"type": "quantize", "lsb": 0.1, "rounding": "banker"},
+	} {
+		viper.Set("channels.temperature.modifiers", []any{modifier})
+		if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+			t.Errorf("Expected an error for %v", modifier)
+		}
+	}
+}
+
+func TestCalibrationModifier(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("pressure", 2)
+	viper.Set("channels.pressure.modifiers", []any{
+		map[string]any{"type": "calibration", "gain": 1.5, "offset": -0.5},
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "pressure"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	if got := generator.Next(testStart); !approxEqual(got, 2.5) {
+		t.Errorf("Expected 2 * 1.5 - 0.5, got %f", got)
+	}
+}
+
+func TestRandomCalibrationPerSensor(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("pressure", 1)
+	viper.Set("channels.pressure.modifiers", []any{
+		map[string]any{"type": "calibration", "gain": []any{0.9, 1.1}, "offset": []any{0, 0.05}},
+	})
+
+	values := make(map[string]float64)
+	for _, id := range []string{"sensor_001", "sensor_004", "sensor_001"} {
+		sensor := testSensor(1, "pressure")
+		sensor.ID = id
+		generator, err := newValueGenerator(sensor)
+		if err != nil {
+			t.Fatalf("Error creating generator: %v", err)
+		}
+		v := generator.Next(testStart)
+		if v < 0.9 || v > 1.15 {
+			t.Errorf("%s: expected a value within the calibration bounds, got %f", id, v)
+		}
+		if previous, ok := values[id]; ok && previous != v {
+			t.Errorf("%s: expected a stable calibration, got %f and %f", id, previous, v)
+		}
+		values[id] = v
+	}
+	if values["sensor_001"] == values["sensor_004"] {
+		t.Errorf("Expected sensors to be calibrated differently")
+	}
+
+	viper.Set("channels.pressure.modifiers", []any{
+		map[string]any{"type": "calibration", "gain": []any{1.1, 0.9}},
+	})
+	if _, err := newValueGenerator(testSensor(1, "pressure")); err == nil {
+		t.Errorf("Expected an error for inverted bounds")
+	}
+}
+
+func TestSlewModifier(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	// A step from 0 up to 100 at 10s and back down at 20s.
+	viper.Set("channels.temperature.generator", map[string]any{
+		"type": "schedule",
+		"steps": []any{
+			map[string]any{"value": 0, "duration": "10s"},
+			map[string]any{"value": 100, "duration": "10s"},
+			map[string]any{"value": 0, "duration": "1h"},
+		},
+	})
+
+	tests := []struct {
+		modifier map[string]any
+		want     map[int]float64 // values by second
+	}{
+		{map[string]any{"rate": 5}, map[int]float64{9: 0, 10: 5, 14: 25, 20: 45, 21: 40, 30: 0}},
+		{map[string]any{"rise": 20}, map[int]float64{10: 20, 14: 100, 20: 0}},
+		{map[string]any{"rate": 2, "per": "sample"}, map[int]float64{10: 2, 12: 6, 20: 18, 21: 16}},
+	}
+	for _, tt := range tests {
+		tt.modifier["type"] = "slew"
+		viper.Set("channels.temperature.modifiers", []any{tt.modifier})
+		generator, err := newValueGenerator(testSensor(1, "temperature"))
+		if err != nil {
+			t.Fatalf("%v: error creating generator: %v", tt.modifier, err)
+		}
+		for i := 0; i <= 30; i++ {
+			got := generator.Next(testStart.Add(time.Duration(i) * time.Second))
+			if want, ok := tt.want[i]; ok && !approxEqual(got, want) {
+				t.Errorf("%v: expected %g at %ds, got %g", tt.modifier, want, i, got)
+			}
+		}
+	}
+
+	for _, modifier := range []map[string]any{
+		{"type": "slew"},
+		{"type": "slew", "rate": 0},
+		{"type": "slew", "rate": 1, "per": "minute"},
+	} {
+		viper.Set("channels.temperature.modifiers", []any{modifier})
+		if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+			t.Errorf("Expected an error for %v", modifier)
+		}
+	}
+}
+
+func TestWarmupModifier(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("temperature", 30)
+	viper.Set("channels.temperature.modifiers", []any{
+		map[string]any{"type": "dropout", "schedule": []any{map[string]any{"at": "10m", "duration": "1m"}}},
+		map[string]any{"type": "warmup", "cold": 10, "time-constant": "1m", "gap": "10m"},
+	})
+
+	sensor := testSensor(1, "temperature")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+		drop bool
+	}{
+		{0, 10, false},
+		{time.Minute, 30 - 20/math.E, false},
+		{9 * time.Minute, 30 - 20*math.Exp(-9), false},
+		{10*time.Minute + 30*time.Second, 30, true},
+		// Back from the outage.
+		{11 * time.Minute, 10, false},
+		{12 * time.Minute, 30 - 20/math.E, false},
+		// Not sampled for longer than the gap.
+		{25 * time.Minute, 10, false},
+	} {
+		*sensor.Notes = sampleNotes{}
+		got := generator.Next(testStart.Add(tt.at))
+		if tt.drop != sensor.Notes.Drop || !tt.drop && !approxEqual(got, tt.want) {
+			t.Errorf("At %v: expected %f (dropped: %t), got %f (dropped: %t)", tt.at, tt.want, tt.drop, got, sensor.Notes.Drop)
+		}
+	}
+
+	viper.Set("channels.temperature.modifiers", []any{map[string]any{"type": "warmup", "time-constant": "0s"}})
+	if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+		t.Errorf("Expected an error for a zero time-constant")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// The default naming templates, giving sensor IDs such as sensor_007 and
+// names such as temperature:sensor_007.
+const (
+	defaultSensorIDTemplate = "sensor_{index:03}"
+	defaultNameTemplate     = "{channel}:{sensor_id}"
+)
+
+// namingVariable matches the variables of naming templates, with an
+// optional width, e.g. {index:03}.
+var namingVariable = regexp.MustCompile(`\{(channel|sensor_id|index|diu|site)(?::(0?[0-9]+))?\}`)
+
+// namingVars are the values of the variables of naming templates.
+type namingVars struct {
+	Channel  string
+	SensorID string
+	Index    int
+	DIU      string
+	Site     string
+}
+
+// expandNaming substitutes the {channel}, {sensor_id}, {index}, {diu} and
+// {site} variables in a naming template. A width pads a value on the
+// left, with zeros if it starts with 0, e.g. {index:03} writes index 7 as
+// 007. Other text is kept as it is.
+func expandNaming(template string, v namingVars) string {
+	return namingVariable.ReplaceAllStringFunc(template, func(match string) string {
+		parts := namingVariable.FindStringSubmatch(match)
+		var value string
+		switch parts[1] {
+		case "channel":
+			value = v.Channel
+		case "sensor_id":
+			value = v.SensorID
+		case "index":
+			value = strconv.Itoa(v.Index)
+		case "diu":
+			value = v.DIU
+		case "site":
+			value = v.Site
+		}
+		if width := parts[2]; width != "" {
+			pad := " "
+			if strings.HasPrefix(width, "0") {
+				pad = "0"
+			}
+			if n, _ := strconv.Atoi(width); len(value) < n {
+				value = strings.Repeat(pad, n-len(value)) + value
+			}
+		}
+		return value
+	})
+}
+
+// sensorIDTemplate returns the template of the IDs of sensors generated in
+// bulk, naming.sensor-id, e.g. "{site}-{channel}-{index:04}".
+func sensorIDTemplate() string {
+	if template := viper.GetString("naming.sensor-id"); template != "" {
+		return template
+	}
+	return defaultSensorIDTemplate
+}
+
+// nameTemplate returns the template of the names readings are published
+// under, naming.name, e.g. "{diu}/{sensor_id}/{channel}".
+func nameTemplate() string {
+	if template := viper.GetString("naming.name"); template != "" {
+		return template
+	}
+	return defaultNameTemplate
+}
+
+// checkNaming checks that the sensor ID template tells the sensors
+// generated in bulk apart.
+func checkNaming() error {
+	if template := sensorIDTemplate(); !strings.Contains(template, "{index") {
+		return fmt.Errorf("naming.sensor-id %q must contain {index} to give each sensor its own ID", template)
+	}
+	return nil
+}
+
+// sensorName returns the name a sensor's readings on channel are
+// published under.
+func sensorName(channel string, info sensorInfo) string {
+	return expandNaming(nameTemplate(), namingVars{
+		Channel:  channel,
+		SensorID: info.ID,
+		Index:    info.Index,
+		DIU:      info.DIU,
+		Site:     info.Site,
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestExpandNaming(t *testing.T) {
+	vars := namingVars{Channel: "temperature", SensorID: "t7", Index: 7, DIU: "diu_000", Site: "plant_a"}
+	tests := map[string]string{
+		defaultSensorIDTemplate:           "sensor_007",
+		defaultNameTemplate:               "temperature:t7",
+		"{site}.{diu}.{channel}.{index}":  "plant_a.diu_000.temperature.7",
+		"TMP-{index:5}":                   "TMP-    7",
+		"{sensor_id}/{unknown}/{index:2}": "t7/{unknown}/ 7",
+	}
+	for template, want := range tests {
+		if got := expandNaming(template, vars); got != want {
+			t.Errorf("Expected %q to expand to %q, got %q", template, want, got)
+		}
+	}
+}
+
+func TestNamingTemplates(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	resetBatteries(t)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+
+	if id := bulkSensorID(12); id != "sensor_012" {
+		t.Errorf("Expected the default sensor ID sensor_012, got %s", id)
+	}
+
+	viper.Set("naming.sensor-id", "{diu}-{channel}-{index:04}")
+	viper.Set("naming.name", "{site}/{diu}/{sensor_id}/{channel}")
+	viper.Set("sensors", map[string]any{
+		"diu_000-pressure-0001": map[string]any{"channel": "humidity"},
+		"inlet_temp":            map[string]any{"channel": "temperature", "site": "plant_a"},
+	})
+	if id := bulkSensorID(1); id != "diu_000-pressure-0001" {
+		t.Errorf("Expected the templated sensor ID diu_000-pressure-0001, got %s", id)
+	}
+	if ids := definedSensorIDs(2); !slices.Equal(ids, []string{"inlet_temp"}) {
+		t.Errorf("Expected the entry of a bulk sensor not to define another sensor, got %v", ids)
+	}
+
+	sensor, err := newSimulatedSensor(1)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if reading := sensor.sample(testStart, 1); reading.SensorID != "diu_000-pressure-0001" || reading.Name != "/diu_000/diu_000-pressure-0001/humidity" {
+		t.Errorf("Expected the templated ID and name, got %s and %s", reading.SensorID, reading.Name)
+	}
+	defined, err := newConfiguredSensor(2, "inlet_temp", "")
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if reading := defined.sample(testStart, 1); reading.Name != "plant_a/diu_000/inlet_temp/temperature" {
+		t.Errorf("Expected the name of the defined sensor from the template, got %s", reading.Name)
+	}
+
+	if err := checkNaming(); err != nil {
+		t.Errorf("Expected the sensor ID template accepted, got %v", err)
+	}
+	viper.Set("naming.sensor-id", "{channel}")
+	if err := checkNaming(); err == nil {
+		t.Errorf("Expected a sensor ID template without {index} rejected")
+	}
+}
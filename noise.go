@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"time"
+)
+
+// pinkRows is the number of octaves pink noise is generated over.
+const pinkRows = 16
+
+// newNoiseSource returns a source of noise of the given color with a
+// standard deviation of stddev:
+//
+//	white  independent samples, with a flat spectrum
+//	pink   a 1/f spectrum over 16 octaves (the Voss-McCartney algorithm)
+//	brown  a 1/f² spectrum: integrated white noise that leaks back
+//	       towards zero by leak (a fraction per sample) to stay bounded
+//
+// Noise of any color is normally distributed.
+func newNoiseSource(color string, stddev, leak float64, r *rand.Rand) (func() float64, error) {
+	switch color {
+	case "", "white":
+		return func() float64 { return r.NormFloat64() * stddev }, nil
+	case "pink":
+		// Row i is redrawn every 2^i samples, and each sample adds
+		// a white sample to the sum of the rows.
+		var rows [pinkRows]float64
+		var sum float64
+		for i := range rows {
+			rows[i] = r.NormFloat64()
+			sum += rows[i]
+		}
+		scale := stddev / math.Sqrt(pinkRows+1)
+		var n uint64
+		return func() float64 {
+			n++
+			if i := bits.TrailingZeros64(n); i < pinkRows {
+				sum -= rows[i]
+				rows[i] = r.NormFloat64()
+				sum += rows[i]
+			}
+			return (sum + r.NormFloat64()) * scale
+		}, nil
+	case "brown":
+		if leak <= 0 || leak >= 1 {
+			return nil, fmt.Errorf("leak must be between 0 and 1")
+		}
+		// Steps are scaled for the stationary deviation to be stddev.
+		a := 1 - leak
+		step := stddev * math.Sqrt(1-a*a)
+		x := r.NormFloat64() * stddev
+		return func() float64 {
+			x = a*x + r.NormFloat64()*step
+			return x
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown noise color %q", color)
+}
+
+// newNoiseModifier adds noise of the given color (default white) and
+// stddev to the values, as described at newNoiseSource.
+func newNoiseModifier(spec generatorSpec, sensor sensorInfo, inner ValueGenerator) (ValueGenerator, error) {
+	stddev := spec.float("stddev", 0)
+	if stddev <= 0 {
+		return nil, fmt.Errorf("noise modifier for %s: stddev must be positive", sensor.ID)
+	}
+	noise, err := newNoiseSource(spec.str("color", "white"), stddev, spec.float("leak", 0.01), sensor.Rand)
+	if err != nil {
+		return nil, fmt.Errorf("noise modifier for %s: %w", sensor.ID, err)
+	}
+	return generatorFunc(func(t time.Time) float64 {
+		return inner.Next(t) + noise()
+	}), nil
+}
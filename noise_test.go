@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// noiseStats returns the standard deviation and lag-1 autocorrelation of n
+// samples of noise.
+func noiseStats(noise func() float64, n int) (stddev, autocorrelation float64) {
+	samples := make([]float64, n)
+	var mean float64
+	for i := range samples {
+		samples[i] = noise()
+		mean += samples[i] / float64(n)
+	}
+	var variance, covariance float64
+	for i, v := range samples {
+		variance += (v - mean) * (v - mean)
+		if i > 0 {
+			covariance += (v - mean) * (samples[i-1] - mean)
+		}
+	}
+	return math.Sqrt(variance / float64(n)), covariance / variance
+}
+
+func TestNoiseColors(t *testing.T) {
+	tests := []struct {
+		color            string
+		minCorr, maxCorr float64
+	}{
+		{"white", -0.05, 0.05},
+		{"pink", 0.5, 0.9},
+		{"brown", 0.9, 0.99},
+	}
+	for _, tt := range tests {
+		noise, err := newNoiseSource(tt.color, 2, 0.05, rand.New(rand.NewSource(1)))
+		if err != nil {
+			t.Fatalf("%s: error creating noise: %v", tt.color, err)
+		}
+		stddev, corr := noiseStats(noise, 200000)
+		if math.Abs(stddev-2) > 0.2 {
+			t.Errorf("%s: expected a stddev of about 2, got %f", tt.color, stddev)
+		}
+		if corr < tt.minCorr || corr > tt.maxCorr {
+			t.Errorf("%s: expected a lag-1 autocorrelation between %g and %g, got %f", tt.color, tt.minCorr, tt.maxCorr, corr)
+		}
+	}
+
+	if _, err := newNoiseSource("blue", 1, 0.01, rand.New(rand.NewSource(1))); err == nil {
+		t.Errorf("Expected an error for blue noise")
+	}
+	if _, err := newNoiseSource("brown", 1, 0, rand.New(rand.NewSource(1))); err == nil {
+		t.Errorf("Expected an error for brown noise without leak")
+	}
+}
+
+func TestNoiseModifier(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("temperature", 20)
+	viper.Set("channels.temperature.modifiers", []any{
+		map[string]any{"type": "noise", "color": "pink", "stddev": 0.5},
+	})
+	generator, err := newValueGenerator(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	stddev, _ := noiseStats(func() float64 { return generator.Next(testStart) - 20 }, 50000)
+	if math.Abs(stddev-0.5) > 0.1 {
+		t.Errorf("Expected pink noise with a stddev of about 0.5, got %f", stddev)
+	}
+
+	viper.Set("channels.temperature.generator", map[string]any{"type": "gaussian", "color": "violet"})
+	viper.Set("channels.temperature.modifiers", nil)
+	if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+		t.Errorf("Expected an error for an unknown noise color")
+	}
+	viper.Set("channels.temperature.modifiers", []any{map[string]any{"type": "noise"}})
+	constantGenerator("temperature", 20)
+	if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+		t.Errorf("Expected an error for noise without stddev")
+	}
+}
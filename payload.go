@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Message is a reading encoded for transmission by a sink.
+type Message struct {
+	Body        []byte
+	ContentType string
+	// Headers carries transport-level attributes, such as CloudEvents
+	// binary-mode attributes, for sinks that support message headers.
+	Headers map[string]string
+}
+
+// Encoder turns readings into messages.
+type Encoder interface {
+	Encode(r Reading) (Message, error)
+}
+
+// encoderFunc adapts a function to the Encoder interface.
+type encoderFunc func(r Reading) (Message, error)
+
+func (f encoderFunc) Encode(r Reading) (Message, error) {
+	return f(r)
+}
+
+// BatchEncoder turns several readings into a single message.
+type BatchEncoder interface {
+	EncodeBatch(rs []Reading) (Message, error)
+}
+
+// batchEncoderFunc adapts a function to the BatchEncoder interface.
+type batchEncoderFunc func(rs []Reading) (Message, error)
+
+func (f batchEncoderFunc) EncodeBatch(rs []Reading) (Message, error) {
+	return f(rs)
+}
+
+// formatMessage renders a reading as a name=value message, followed by
+// anomaly=<type> if it carries an anomaly label.
+func formatMessage(r Reading) string {
+	msg := r.Name + "=" + r.Text
+	if r.Text == "" {
+		msg = fmt.Sprintf("%s=%f", r.Name, r.Value)
+	}
+	if r.Anomaly {
+		msg += " anomaly=" + r.AnomalyType
+	}
+	return msg
+}
+
+func encodeText(r Reading) (Message, error) {
+	return Message{Body: []byte(formatMessage(r)), ContentType: "text/plain"}, nil
+}
+
+// encodeTextBatch renders readings as name=value lines.
+func encodeTextBatch(rs []Reading) (Message, error) {
+	lines := make([]string, len(rs))
+	for i, r := range rs {
+		lines[i] = formatMessage(r)
+	}
+	return Message{Body: []byte(strings.Join(lines, "\n")), ContentType: "text/plain"}, nil
+}
+
+// MarshalJSON encodes SensorData, writing the text of text sensors as
+// their value, boolean values as true or false and values that JSON numbers
+// cannot hold, such as injected NaN faults, as the strings "NaN", "+Inf"
+// and "-Inf".
+func (d SensorData) MarshalJSON() ([]byte, error) {
+	type plain SensorData
+	var value any
+	switch {
+	case d.Text != "":
+		value = d.Text
+	case d.Boolean:
+		value = d.Value != 0
+	case math.IsNaN(d.Value) || math.IsInf(d.Value, 0):
+		value = strconv.FormatFloat(d.Value, 'g', -1, 64)
+	default:
+		return json.Marshal(plain(d))
+	}
+	return json.Marshal(struct {
+		plain
+		Value any `json:"value"`
+	}{plain(d), value})
+}
+
+// encodeJSON encodes a reading as a SensorData JSON object.
+func encodeJSON(r Reading) (Message, error) {
+	body, err := json.Marshal(r.SensorData)
+	return Message{Body: body, ContentType: "application/json"}, err
+}
+
+// encodeJSONBatch encodes readings as a JSON array of SensorData objects.
+func encodeJSONBatch(rs []Reading) (Message, error) {
+	data := make([]SensorData, len(rs))
+	for i, r := range rs {
+		data[i] = r.SensorData
+	}
+	body, err := json.Marshal(data)
+	return Message{Body: body, ContentType: "application/json"}, err
+}
+
+// encodeCSV encodes a reading as a sensor_id,channel,timestamp,value
+// record, followed by the type of the anomaly it is labelled with if it
+// carries an anomaly label.
+func encodeCSV(r Reading) (Message, error) {
+	return encodeCSVBatch([]Reading{r})
+}
+
+// encodeCSVBatch encodes readings as one CSV record each, without a header.
+// Text sensors have their message in the value column.
+func encodeCSVBatch(rs []Reading) (Message, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	for _, r := range rs {
+		value := r.Text
+		if value == "" {
+			value = strconv.FormatFloat(r.Value, 'f', -1, 64)
+		}
+		record := []string{r.SensorID, r.Channel, r.Timestamp, value}
+		if r.Anomaly {
+			record = append(record, r.AnomalyType)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return Message{Body: []byte(strings.TrimSuffix(b.String(), "\n")), ContentType: "text/csv"}, w.Error()
+}
+
+// sinkSetting returns the value of key for the named sink: <sink>.<key> if
+// it is set, otherwise the global <key>.
+func sinkSetting(sink, key string) string {
+	return viper.GetString(sinkKey(sink, key))
+}
+
+// sinkKey returns the full viper key to read the named sink's setting
+// from, rather than its value: <sink>.<key> if it is set, otherwise the
+// global <key>. It lets settings that are not strings be read with the
+// matching viper getter.
+func sinkKey(sink, key string) string {
+	if viper.IsSet(sink + "." + key) {
+		return sink + "." + key
+	}
+	return key
+}
+
+// payloadEncoders are the encoders selectable with payload-format.
+var payloadEncoders = map[string]encoderFunc{
+	"json":        encodeJSON,
+	"kv":          encodeText,
+	"csv":         encodeCSV,
+	"senml-json":  encodeSenMLJSON,
+	"senml-cbor":  encodeSenMLCBOR,
+	"protobuf":    encodeProtobuf,
+	"flatbuffers": encodeFlatBuffers,
+}
+
+// unlabelledFormats are the payload formats that cannot carry the labels of
+// injected anomalies.
+var unlabelledFormats = []string{"diu-frame"}
+
+// batchEncoders are the batch forms of the payload formats, used when a sink
+// batches readings.
+var batchEncoders = map[string]batchEncoderFunc{
+	"json":        encodeJSONBatch,
+	"kv":          encodeTextBatch,
+	"csv":         encodeCSVBatch,
+	"senml-json":  encodeSenMLJSONBatch,
+	"senml-cbor":  encodeSenMLCBORBatch,
+	"protobuf":    encodeProtobufBatch,
+	"flatbuffers": encodeFlatBuffersBatch,
+}
+
+// payloadCodec encodes both single readings and batches. Every encoder
+// layer is one, so a sink's encoder serves either way.
+type payloadCodec interface {
+	Encoder
+	BatchEncoder
+}
+
+// formatCodec pairs the single and batch forms of a payload format.
+type formatCodec struct {
+	encoderFunc
+	batchEncoderFunc
+}
+
+// newEncoder builds the encoder for the named sink from its payload-format,
+// envelope, cloudevents and compression settings. Sinks that can carry message
+// headers pass headers=true; the others fall back from binary to structured
+// CloudEvents mode, since binary mode relies on headers.
+func newEncoder(sink string, headers bool) (payloadCodec, error) {
+	var codec payloadCodec
+	switch format := payloadFormat(sink); format {
+	case "template":
+		encoder, err := newTemplateEncoder(sink)
+		if err != nil {
+			return nil, err
+		}
+		codec = encoder
+	case "diu-frame":
+		codec = newDIUFrameEncoder()
+	default:
+		encode, ok := payloadEncoders[format]
+		if !ok {
+			return nil, fmt.Errorf("unknown payload format %q", format)
+		}
+		codec = formatCodec{encode, batchEncoders[format]}
+	}
+
+	envelope, err := newEnvelopeEncoder(sink)
+	if err != nil {
+		return nil, err
+	}
+	if envelope != nil {
+		envelope.data = codec
+		codec = envelope
+	}
+
+	event, err := newCloudEventsEncoder(sink, headers)
+	if err != nil {
+		return nil, err
+	}
+	if event != nil {
+		event.data = codec
+		codec = event
+	}
+
+	compressor, err := newCompressingEncoder(sink)
+	if err != nil {
+		return nil, err
+	}
+	if compressor != nil {
+		compressor.data = codec
+		codec = compressor
+	}
+	return codec, nil
+}
+
+func payloadFormat(sink string) string {
+	if format := sinkSetting(sink, "payload-format"); format != "" {
+		return format
+	}
+	return "json"
+}
+
+// newCloudEventsEncoder returns the CloudEvents envelope configured for the
+// named sink, or nil if CloudEvents are off.
+func newCloudEventsEncoder(sink string, headers bool) (*cloudEventsEncoder, error) {
+	switch mode := sinkSetting(sink, "cloudevents.mode"); mode {
+	case "", "off":
+		return nil, nil
+	case "structured", "binary":
+		if mode == "binary" && !headers {
+			log.Printf("The %s sink has no message headers; using structured CloudEvents mode", sink)
+			mode = "structured"
+		}
+		return &cloudEventsEncoder{
+			binary:  mode == "binary",
+			source:  sinkSetting(sink, "cloudevents.source"),
+			typ:     sinkSetting(sink, "cloudevents.type"),
+			subject: sinkSetting(sink, "cloudevents.subject"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown cloudevents mode %q", mode)
+	}
+}
+
+// cloudEventsEncoder wraps readings in a CloudEvents 1.0 envelope whose data
+// is the reading in the configured payload format. In structured mode the
+// whole event is the JSON message body, with JSON payloads embedded as-is,
+// text payloads as strings and binary payloads base64-encoded; in binary
+// mode the body is the payload and the context attributes travel as ce-*
+// headers. The source, type and subject attributes are templates expanded
+// per reading, or per batch from its first reading.
+type cloudEventsEncoder struct {
+	data    payloadCodec
+	binary  bool
+	source  string
+	typ     string
+	subject string
+}
+
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+func (e *cloudEventsEncoder) Encode(r Reading) (Message, error) {
+	payload, err := e.data.Encode(r)
+	if err != nil {
+		return Message{}, err
+	}
+	return e.wrap(r, payload)
+}
+
+func (e *cloudEventsEncoder) EncodeBatch(rs []Reading) (Message, error) {
+	payload, err := e.data.EncodeBatch(rs)
+	if err != nil {
+		return Message{}, err
+	}
+	return e.wrap(rs[0], payload)
+}
+
+// wrap puts an encoded payload into an event whose attributes are taken
+// from r.
+func (e *cloudEventsEncoder) wrap(r Reading, payload Message) (Message, error) {
+	id, err := newEventID()
+	if err != nil {
+		return Message{}, err
+	}
+
+	event := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              id,
+		Source:          expandTemplate(e.source, r),
+		Type:            expandTemplate(e.typ, r),
+		Subject:         expandTemplate(e.subject, r),
+		Time:            r.Timestamp,
+		DataContentType: payload.ContentType,
+	}
+
+	if !e.binary {
+		event.Data, event.DataBase64 = embedPayload(payload)
+		body, err := json.Marshal(event)
+		return Message{Body: body, ContentType: "application/cloudevents+json"}, err
+	}
+
+	headers := map[string]string{
+		"ce-specversion": event.SpecVersion,
+		"ce-id":          event.ID,
+		"ce-source":      event.Source,
+		"ce-type":        event.Type,
+	}
+	if event.Subject != "" {
+		headers["ce-subject"] = event.Subject
+	}
+	if event.Time != "" {
+		headers["ce-time"] = event.Time
+	}
+	return Message{Body: payload.Body, ContentType: payload.ContentType, Headers: headers}, nil
+}
+
+// embedPayload prepares a payload for embedding in a JSON document: JSON
+// payloads are returned as-is and text payloads as a JSON string, while
+// binary payloads are returned as the second result, which encoding/json
+// writes in base64.
+func embedPayload(payload Message) (data json.RawMessage, base64 []byte) {
+	switch {
+	case isJSONContentType(payload.ContentType):
+		return payload.Body, nil
+	case isTextContentType(payload.ContentType):
+		data, _ = json.Marshal(string(payload.Body))
+		return data, nil
+	default:
+		return nil, payload.Body
+	}
+}
+
+func isJSONContentType(contentType string) bool {
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
+
+func isTextContentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") || isJSONContentType(contentType)
+}
+
+// newEventID returns a random UUID (version 4) to identify an event.
+func newEventID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(b[:])
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32]), nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+var testReading = Reading{
+	SensorData: SensorData{
+		SensorID:  "sensor_001",
+		Channel:   "pressure",
+		Timestamp: "2024-07-01T12:00:00Z",
+		Value:     1.05,
+	},
+	Name: "pressure:sensor_001",
+	DIU:  "diu_000",
+}
+
+func TestCloudEventsStructuredMode(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("payload-format", "kv")
+	viper.Set("cloudevents.mode", "structured")
+	viper.Set("cloudevents.source", "/diu_sim/{diu}")
+	viper.Set("cloudevents.type", "diusim.{channel}")
+	encoder, err := newEncoder("redis", false)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+
+	msg, err := encoder.Encode(testReading)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	if msg.ContentType != "application/cloudevents+json" {
+		t.Errorf("Unexpected content type %s", msg.ContentType)
+	}
+
+	var event cloudEvent
+	if err := json.Unmarshal(msg.Body, &event); err != nil {
+		t.Fatalf("Error decoding event: %v", err)
+	}
+	if event.SpecVersion != "1.0" || event.ID == "" || event.Source != "/diu_sim/diu_000" || event.Type != "diusim.pressure" {
+		t.Errorf("Unexpected context attributes: %+v", event)
+	}
+	if event.Time != testReading.Timestamp || event.DataContentType != "text/plain" {
+		t.Errorf("Unexpected event time or data content type: %+v", event)
+	}
+	if string(event.Data) != `"pressure:sensor_001=1.050000"` {
+		t.Errorf("Expected the kv payload as a string, got %s", event.Data)
+	}
+
+	// JSON payloads are embedded rather than quoted.
+	viper.Set("payload-format", "senml-json")
+	encoder, _ = newEncoder("redis", false)
+	msg, _ = encoder.Encode(testReading)
+	json.Unmarshal(msg.Body, &event)
+	var pack []senmlRecord
+	if err := json.Unmarshal(event.Data, &pack); err != nil || len(pack) != 1 {
+		t.Errorf("Expected an embedded SenML pack, got %s (%v)", event.Data, err)
+	}
+
+	// Binary payloads go in data_base64.
+	viper.Set("payload-format", "senml-cbor")
+	encoder, _ = newEncoder("redis", false)
+	msg, _ = encoder.Encode(testReading)
+	event = cloudEvent{}
+	json.Unmarshal(msg.Body, &event)
+	if len(event.DataBase64) == 0 || event.Data != nil {
+		t.Errorf("Expected CBOR data in data_base64, got %s", msg.Body)
+	}
+}
+
+func TestCloudEventsBinaryMode(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("payload-format", "kv")
+	viper.Set("cloudevents.mode", "binary")
+	viper.Set("cloudevents.source", "/diu_sim")
+	viper.Set("cloudevents.type", "diusim.reading")
+	encoder, err := newEncoder("stomp", true)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+
+	msg, err := encoder.Encode(testReading)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	if msg.Headers["ce-specversion"] != "1.0" || msg.Headers["ce-source"] != "/diu_sim" || msg.Headers["ce-id"] == "" {
+		t.Errorf("Unexpected headers: %v", msg.Headers)
+	}
+
+	if string(msg.Body) != "pressure:sensor_001=1.050000" || msg.ContentType != "text/plain" {
+		t.Errorf("Expected the body to be the kv payload, got %s (%s)", msg.Body, msg.ContentType)
+	}
+
+	// Sinks without headers fall back to structured mode.
+	encoder, _ = newEncoder("redis", false)
+	if msg, _ := encoder.Encode(testReading); msg.Headers != nil {
+		t.Errorf("Expected structured mode for a sink without headers")
+	}
+}
+
+func TestSinkSettingOverride(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("cloudevents.mode", "structured")
+	viper.Set("sse.cloudevents.mode", "off")
+	if got := sinkSetting("sse", "cloudevents.mode"); got != "off" {
+		t.Errorf("Expected the sse override, got %s", got)
+	}
+	if got := sinkSetting("redis", "cloudevents.mode"); got != "structured" {
+		t.Errorf("Expected the global setting, got %s", got)
+	}
+}
+
+func TestDefaultPayloadFormatIsJSON(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	encoder, err := newEncoder("redis", false)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+	msg, err := encoder.Encode(testReading)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	var data SensorData
+	if err := json.Unmarshal(msg.Body, &data); err != nil {
+		t.Fatalf("Expected a JSON payload, got %s: %v", msg.Body, err)
+	}
+	if !reflect.DeepEqual(data, testReading.SensorData) || msg.ContentType != "application/json" {
+		t.Errorf("Unexpected payload %s (%s)", msg.Body, msg.ContentType)
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	msg, err := encodeCSV(testReading)
+	if err != nil {
+		t.Fatalf("Error encoding CSV: %v", err)
+	}
+	if want := "sensor_001,pressure,2024-07-01T12:00:00Z,1.05"; string(msg.Body) != want {
+		t.Errorf("Expected %q, got %q", want, msg.Body)
+	}
+}
+
+func TestTextPayloadAnomalyLabels(t *testing.T) {
+	labelled := testReading
+	labelled.Anomaly, labelled.AnomalyType = true, "spike"
+
+	msg, _ := encodeText(labelled)
+	if want := "pressure:sensor_001=1.050000 anomaly=spike"; string(msg.Body) != want {
+		t.Errorf("Expected %q, got %q", want, msg.Body)
+	}
+	msg, _ = encodeCSVBatch([]Reading{testReading, labelled})
+	if want := "sensor_001,pressure,2024-07-01T12:00:00Z,1.05\nsensor_001,pressure,2024-07-01T12:00:00Z,1.05,spike"; string(msg.Body) != want {
+		t.Errorf("Expected %q, got %q", want, msg.Body)
+	}
+}
+
+func TestMarshalNonFiniteValues(t *testing.T) {
+	data := testReading.SensorData
+	data.Value = math.NaN()
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Error marshaling NaN reading: %v", err)
+	}
+	var decoded map[string]any
+	json.Unmarshal(body, &decoded)
+	if decoded["value"] != "NaN" || decoded["sensor_id"] != "sensor_001" {
+		t.Errorf("Expected the value as the string NaN, got %s", body)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// plantStep is the longest time step plant models are integrated with.
+const plantStep = 100 * time.Millisecond
+
+// plantModel is a first-order physical model whose state is advanced in
+// time and read through named outputs.
+type plantModel interface {
+	step(dt float64) // advance by dt seconds
+	output(name string) (float64, bool)
+}
+
+// plant is a model instance shared by the sensors of one DIU. It is
+// advanced lazily to the time of each reading.
+type plant struct {
+	mu    sync.Mutex
+	model plantModel
+	last  time.Time
+}
+
+func (p *plant) read(output string, t time.Time) (float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.last.IsZero() {
+		p.last = t
+	}
+	for p.last.Before(t) {
+		dt := t.Sub(p.last)
+		if dt > plantStep {
+			dt = plantStep
+		}
+		p.model.step(dt.Seconds())
+		p.last = p.last.Add(dt)
+	}
+	return p.model.output(output)
+}
+
+// plantModels build the models selectable with the model parameter.
+var plantModels = map[string]func(spec generatorSpec) (plantModel, error){
+	"thermal": newThermalModel,
+	"tank":    newTankModel,
+	"motor":   newMotorModel,
+}
+
+var (
+	plantsMu sync.Mutex
+	plants   = make(map[string]*plant)
+)
+
+// plantSpecFor returns the plant configuration of a DIU:
+// dius.<diu>.plant if set, otherwise plant. It is empty when the DIU has
+// no plant.
+func plantSpecFor(diu string) generatorSpec {
+	if spec := viper.GetStringMap("dius." + diu + ".plant"); len(spec) > 0 {
+		return spec
+	}
+	return viper.GetStringMap("plant")
+}
+
+// plantFor returns the plant of a DIU, creating it on first use, or nil if
+// the DIU has none.
+func plantFor(diu string) (*plant, error) {
+	plantsMu.Lock()
+	defer plantsMu.Unlock()
+
+	if p, ok := plants[diu]; ok {
+		return p, nil
+	}
+	spec := plantSpecFor(diu)
+	if len(spec) == 0 {
+		return nil, nil
+	}
+	name := spec.str("model", "")
+	build, ok := plantModels[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown plant model %q for %s", name, diu)
+	}
+	model, err := build(spec)
+	if err != nil {
+		return nil, fmt.Errorf("plant for %s: %w", diu, err)
+	}
+	p := &plant{model: model}
+	plants[diu] = p
+	return p, nil
+}
+
+// newPlantGenerator reads a sensor's value from an output of its DIU's
+// plant, by default the output named after the sensor's channel.
+func newPlantGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	p, err := plantFor(sensor.DIU)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("plant generator for %s: %s has no plant", sensor.ID, sensor.DIU)
+	}
+	output := spec.str("output", sensor.Channel)
+	if _, ok := p.model.output(output); !ok {
+		return nil, fmt.Errorf("plant generator for %s: the plant has no output %q", sensor.ID, output)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		value, _ := p.read(output, t)
+		return value
+	}), nil
+}
+
+// thermalModel is a lumped thermal RC model of a heated body, such as an
+// enclosure, losing heat to the ambient through a thermal resistance. The
+// heater runs at constant power or, with a setpoint, under on/off
+// thermostat control with the given hysteresis.
+//
+// Outputs: temperature (°C), heater (0 or 1), ambient (°C).
+type thermalModel struct {
+	ambient     float64 // °C
+	resistance  float64 // K/W
+	capacitance float64 // J/K
+	power       float64 // W
+	setpoint    float64
+	hysteresis  float64
+	thermostat  bool
+
+	temperature float64
+	heater      bool
+}
+
+func newThermalModel(spec generatorSpec) (plantModel, error) {
+	m := &thermalModel{
+		ambient:     spec.float("ambient", 20),
+		resistance:  spec.float("resistance", 0.5),
+		capacitance: spec.float("capacitance", 2000),
+		power:       spec.float("power", 20),
+		hysteresis:  spec.float("hysteresis", 1),
+		heater:      true,
+	}
+	if m.resistance <= 0 || m.capacitance <= 0 {
+		return nil, fmt.Errorf("thermal model: resistance and capacitance must be positive")
+	}
+	_, m.thermostat = spec["setpoint"]
+	m.setpoint = spec.float("setpoint", 0)
+	m.temperature = spec.float("initial", m.ambient)
+	return m, nil
+}
+
+func (m *thermalModel) step(dt float64) {
+	if m.thermostat {
+		switch {
+		case m.temperature > m.setpoint+m.hysteresis/2:
+			m.heater = false
+		case m.temperature < m.setpoint-m.hysteresis/2:
+			m.heater = true
+		}
+	}
+	power := 0.0
+	if m.heater {
+		power = m.power
+	}
+	m.temperature += dt * ((m.ambient-m.temperature)/m.resistance + power) / m.capacitance
+}
+
+func (m *thermalModel) output(name string) (float64, bool) {
+	switch name {
+	case "temperature":
+		return m.temperature, true
+	case "heater":
+		if m.heater {
+			return 1, true
+		}
+		return 0, true
+	case "ambient":
+		return m.ambient, true
+	}
+	return 0, false
+}
+
+// tankModel is a tank filled by a pump and draining through an outlet,
+// whose outflow follows Torricelli's law. The pump runs under level
+// control, switching on at low and off at high.
+//
+// Outputs: level (m), inflow and outflow (m³/s), pump (0 or 1).
+type tankModel struct {
+	area    float64 // m²
+	inflow  float64 // m³/s while the pump runs
+	outlet  float64 // outflow coefficient, m^2.5/s
+	low     float64 // m
+	high    float64 // m
+	maximum float64 // m
+
+	level float64
+	pump  bool
+}
+
+func newTankModel(spec generatorSpec) (plantModel, error) {
+	m := &tankModel{
+		area:    spec.float("area", 1),
+		inflow:  spec.float("inflow", 0.02),
+		outlet:  spec.float("outlet", 0.01),
+		low:     spec.float("low", 1),
+		high:    spec.float("high", 3),
+		maximum: spec.float("height", 4),
+		pump:    true,
+	}
+	if m.area <= 0 || m.low >= m.high {
+		return nil, fmt.Errorf("tank model: area must be positive and low below high")
+	}
+	m.level = spec.float("initial", m.low)
+	return m, nil
+}
+
+func (m *tankModel) step(dt float64) {
+	switch {
+	case m.level >= m.high:
+		m.pump = false
+	case m.level <= m.low:
+		m.pump = true
+	}
+	m.level += dt * (m.currentInflow() - m.outflow()) / m.area
+	m.level = math.Max(0, math.Min(m.level, m.maximum))
+}
+
+func (m *tankModel) currentInflow() float64 {
+	if m.pump {
+		return m.inflow
+	}
+	return 0
+}
+
+func (m *tankModel) outflow() float64 {
+	return m.outlet * math.Sqrt(m.level)
+}
+
+func (m *tankModel) output(name string) (float64, bool) {
+	switch name {
+	case "level":
+		return m.level, true
+	case "inflow":
+		return m.currentInflow(), true
+	case "outflow":
+		return m.outflow(), true
+	case "pump":
+		if m.pump {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// motorModel is a DC motor whose speed settles, with the given time
+// constant, at a point that falls linearly from the no-load speed as the
+// load approaches the stall load. The load oscillates sinusoidally around
+// its mean when load-swing and load-period are set.
+//
+// Outputs: rpm, current (A), load (N·m).
+type motorModel struct {
+	noLoadRPM  float64
+	stallLoad  float64 // N·m
+	tau        float64 // s
+	meanLoad   float64
+	loadSwing  float64
+	loadPeriod float64 // s
+	idleAmps   float64
+	stallAmps  float64
+
+	elapsed float64
+	rpm     float64
+}
+
+func newMotorModel(spec generatorSpec) (plantModel, error) {
+	m := &motorModel{
+		noLoadRPM:  spec.float("no-load-rpm", 3000),
+		stallLoad:  spec.float("stall-load", 10),
+		tau:        spec.float("time-constant", 2),
+		meanLoad:   spec.float("load", 4),
+		loadSwing:  spec.float("load-swing", 0),
+		loadPeriod: spec.duration("load-period", time.Minute).Seconds(),
+		idleAmps:   spec.float("idle-current", 0.5),
+		stallAmps:  spec.float("stall-current", 20),
+	}
+	if m.stallLoad <= 0 || m.tau <= 0 || m.loadPeriod <= 0 {
+		return nil, fmt.Errorf("motor model: stall-load, time-constant and load-period must be positive")
+	}
+	m.rpm = spec.float("initial", 0)
+	return m, nil
+}
+
+func (m *motorModel) load() float64 {
+	load := m.meanLoad + m.loadSwing*math.Sin(2*math.Pi*m.elapsed/m.loadPeriod)
+	return math.Max(0, math.Min(load, m.stallLoad))
+}
+
+func (m *motorModel) step(dt float64) {
+	m.elapsed += dt
+	target := m.noLoadRPM * (1 - m.load()/m.stallLoad)
+	m.rpm += dt * (target - m.rpm) / m.tau
+}
+
+func (m *motorModel) output(name string) (float64, bool) {
+	switch name {
+	case "rpm":
+		return m.rpm, true
+	case "current":
+		return m.idleAmps + (m.stallAmps-m.idleAmps)*m.load()/m.stallLoad, true
+	case "load":
+		return m.load(), true
+	}
+	return 0, false
+}
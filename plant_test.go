@@ -0,0 +1,147 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func resetPlants(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := plants
+	plants = make(map[string]*plant)
+	t.Cleanup(func() { plants = saved })
+}
+
+func TestThermalPlantDrivesDIUSensors(t *testing.T) {
+	resetPlants(t)
+	viper.Set("dius.diu_000.plant", map[string]any{"model": "thermal"})
+
+	first, err := newValueGenerator(testSensor(0, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	second, err := newValueGenerator(testSensor(3, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+
+	if got := first.Next(testStart); got != 20 {
+		t.Errorf("Expected the plant to start at ambient, got %f", got)
+	}
+	// The steady state is ambient + power * resistance = 30 °C, reached
+	// after several RC time constants of 1000s.
+	later := testStart.Add(time.Hour + 40*time.Minute)
+	a, b := first.Next(later), second.Next(later)
+	if a != b {
+		t.Errorf("Expected sensors on one plant to agree, got %f and %f", a, b)
+	}
+	if math.Abs(a-30) > 0.1 {
+		t.Errorf("Expected the temperature to settle near 30, got %f", a)
+	}
+
+	// Channels the plant has no output for keep their default generator.
+	humidity, err := newValueGenerator(testSensor(2, "humidity"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	if v := humidity.Next(testStart); v < 70 || v > 90 {
+		t.Errorf("Expected default humidity values, got %f", v)
+	}
+}
+
+func TestThermalPlantThermostat(t *testing.T) {
+	resetPlants(t)
+	viper.Set("plant", map[string]any{"model": "thermal", "setpoint": 25, "hysteresis": 1})
+
+	generator, err := newValueGenerator(testSensor(0, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	heater, err := newValueGenerator(sensorWithGenerator(map[string]any{"type": "plant", "output": "heater"}))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+
+	generator.Next(testStart)
+	var switches int
+	last := 1.0
+	for i := 1; i <= 7200; i++ {
+		now := testStart.Add(time.Duration(i) * time.Second)
+		if v := generator.Next(now); i > 3600 && (v < 24.4 || v > 25.6) {
+			t.Fatalf("Expected the thermostat to hold 25 ± 0.5, got %f at %ds", v, i)
+		}
+		if h := heater.Next(now); h != last {
+			switches++
+			last = h
+		}
+	}
+	if switches < 2 {
+		t.Errorf("Expected the heater to cycle, got %d switches", switches)
+	}
+}
+
+func TestTankPlantLevelControl(t *testing.T) {
+	resetPlants(t)
+	viper.Set("plant", map[string]any{"model": "tank"})
+
+	level, err := newValueGenerator(sensorWithGenerator(map[string]any{"type": "plant", "output": "level"}))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	minimum, maximum := math.Inf(1), math.Inf(-1)
+	for i := 0; i <= 3600; i++ {
+		v := level.Next(testStart.Add(time.Duration(i) * time.Second))
+		minimum, maximum = math.Min(minimum, v), math.Max(maximum, v)
+	}
+	if minimum < 0.95 || maximum > 3.05 {
+		t.Errorf("Expected the level to stay between 1 and 3, got %f to %f", minimum, maximum)
+	}
+	if maximum < 2.9 {
+		t.Errorf("Expected the pump to fill the tank to 3, got a maximum of %f", maximum)
+	}
+}
+
+func TestMotorPlantSettlesUnderLoad(t *testing.T) {
+	resetPlants(t)
+	viper.Set("plant", map[string]any{"model": "motor", "load": 4})
+
+	rpm, err := newValueGenerator(sensorWithGenerator(map[string]any{"type": "plant", "output": "rpm"}))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	rpm.Next(testStart)
+	// 3000 rpm at no load, falling by 40% at 4 of 10 N·m.
+	if got := rpm.Next(testStart.Add(30 * time.Second)); math.Abs(got-1800) > 1 {
+		t.Errorf("Expected the motor to settle at 1800 rpm, got %f", got)
+	}
+}
+
+func TestPlantErrors(t *testing.T) {
+	resetPlants(t)
+
+	if _, err := newValueGenerator(sensorWithGenerator(map[string]any{"type": "plant"})); err == nil {
+		t.Errorf("Expected an error for a DIU without a plant")
+	}
+
+	viper.Set("plant", map[string]any{"model": "boiler"})
+	if _, err := newValueGenerator(testSensor(0, "temperature")); err == nil {
+		t.Errorf("Expected an error for an unknown plant model")
+	}
+
+	plants = make(map[string]*plant)
+	viper.Set("plant", map[string]any{"model": "motor"})
+	if _, err := newValueGenerator(sensorWithGenerator(map[string]any{"type": "plant", "output": "torque"})); err == nil {
+		t.Errorf("Expected an error for an unknown plant output")
+	}
+}
+
+// sensorWithGenerator returns a test sensor configured with the given
+// generator.
+func sensorWithGenerator(spec map[string]any) sensorInfo {
+	sensor := testSensor(1, "pressure")
+	viper.Set("sensors."+sensor.ID+".generator", spec)
+	return sensor
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"plugin"
+
+	"rgehrsitz/diu_sim/diusimgen"
+)
+
+// loadPlugins opens the Go plugins listed under plugins, whose init
+// functions register their generator types with diusimgen (see the package
+// documentation). Plugin types must not clash with the built-in ones.
+func loadPlugins() error {
+	for _, path := range configList("plugins") {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("loading plugin %s: %w", path, err)
+		}
+		log.Printf("Loaded plugin %s", path)
+	}
+	for _, name := range diusimgen.Types() {
+		if _, ok := generatorTypes[name]; ok {
+			return fmt.Errorf("generator type %q registered by a plugin is built in", name)
+		}
+	}
+	return nil
+}
+
+// pluginGenerator builds a generator of a type registered with diusimgen,
+// or returns false if no such type is registered.
+func pluginGenerator(typ string, spec generatorSpec, sensor sensorInfo) (ValueGenerator, bool, error) {
+	factory, ok := diusimgen.Lookup(typ)
+	if !ok {
+		return nil, false, nil
+	}
+	generator, err := factory(diusimgen.Spec(spec), diusimgen.Sensor{
+		Index:   sensor.Index,
+		ID:      sensor.ID,
+		Channel: sensor.Channel,
+		DIU:     sensor.DIU,
+		Start:   sensor.Start,
+		Rand:    sensor.Rand,
+	})
+	if err != nil {
+		return nil, true, fmt.Errorf("%s generator for %s: %w", typ, sensor.ID, err)
+	}
+	return generator, true, nil
+}
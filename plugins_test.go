@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"rgehrsitz/diu_sim/diusimgen"
+)
+
+// pluginRamp is a generator of the kind plugins register: a ramp from the
+// sensor's index rising by slope per second.
+type pluginRamp struct {
+	start time.Time
+	base  float64
+	slope float64
+}
+
+func (r pluginRamp) Next(t time.Time) float64 {
+	return r.base + r.slope*t.Sub(r.start).Seconds()
+}
+
+func init() {
+	diusimgen.Register("test-ramp", func(spec diusimgen.Spec, sensor diusimgen.Sensor) (diusimgen.ValueGenerator, error) {
+		return pluginRamp{start: sensor.Start, base: float64(sensor.Index), slope: generatorSpec(spec).float("slope", 1)}, nil
+	})
+}
+
+func TestPluginGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.generator", map[string]any{"type": "test-ramp", "slope": 0.5})
+	viper.Set("channels.temperature.modifiers", []any{map[string]any{"type": "calibration", "offset": 10}})
+
+	generator, err := newValueGenerator(testSensor(2, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	if got := generator.Next(testStart.Add(4 * time.Second)); !approxEqual(got, 14) {
+		t.Errorf("Expected the plugin's ramp with the modifiers applied, 14, got %g", got)
+	}
+
+	viper.Set("channels.temperature.generator", map[string]any{"type": "missing"})
+	if _, err := newValueGenerator(testSensor(2, "temperature")); err == nil {
+		t.Errorf("Expected an error for an unknown generator type")
+	}
+}
+
+func TestLoadPlugins(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	if err := loadPlugins(); err != nil {
+		t.Errorf("Expected no error without plugins, got %v", err)
+	}
+	viper.Set("plugins", "missing.so")
+	if err := loadPlugins(); err == nil {
+		t.Errorf("Expected an error for a missing plugin")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// earthRadius is the mean radius of the Earth in metres.
+const earthRadius = 6371e3
+
+// Position is the location of a position sensor, in degrees and metres
+// above sea level, with its heading in degrees clockwise from north.
+type Position struct {
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	Alt     float64 `json:"alt"`
+	Heading float64 `json:"heading"`
+}
+
+// distance returns the great-circle distance between two positions in
+// metres.
+func distance(a, b Position) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat, dLon := lat2-lat1, (b.Lon-a.Lon)*math.Pi/180
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// bearing returns the initial heading from a to b in degrees.
+func bearing(a, b Position) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// move returns the position d metres from p in the given heading, which is
+// accurate enough for the short steps between samples.
+func move(p Position, heading, d float64) Position {
+	h := heading * math.Pi / 180
+	p.Lat += d * math.Cos(h) / earthRadius * 180 / math.Pi
+	p.Lon += d * math.Sin(h) / (earthRadius * math.Cos(p.Lat*math.Pi/180)) * 180 / math.Pi
+	p.Heading = heading
+	return p
+}
+
+// routeLeg is a stretch of a route between two waypoints.
+type routeLeg struct {
+	from, to Position
+	length   float64       // metres
+	start    time.Duration // time into the route the leg begins
+	duration time.Duration
+}
+
+// newRouteGenerator moves a position sensor along a route of waypoints,
+// each {lat, lon, alt}, at speed metres per second, or the speed of the
+// waypoint a leg starts from. In loop mode the route starts over from the
+// first waypoint after the last, in reverse mode it is driven back and
+// forth, and in once mode the sensor stops at the last waypoint. The
+// sensor's value is its speed; its position is published alongside.
+func newRouteGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	items := cast.ToSlice(spec["waypoints"])
+	if len(items) < 2 {
+		return nil, fmt.Errorf("route generator for %s: at least two waypoints must be set", sensor.ID)
+	}
+	mode := spec.str("mode", "loop")
+	switch mode {
+	case "loop", "reverse", "once":
+	default:
+		return nil, fmt.Errorf("route generator for %s: unknown mode %q", sensor.ID, mode)
+	}
+
+	waypoints := make([]Position, len(items))
+	speeds := make([]float64, len(items))
+	for i, item := range items {
+		point := generatorSpec(cast.ToStringMap(item))
+		waypoints[i] = Position{Lat: point.float("lat", 0), Lon: point.float("lon", 0), Alt: point.float("alt", 0)}
+		if speeds[i] = point.float("speed", spec.float("speed", 10)); speeds[i] <= 0 {
+			return nil, fmt.Errorf("route generator for %s: speeds must be positive", sensor.ID)
+		}
+	}
+	// Each leg is driven at the speed of the waypoint it starts from on
+	// the way out, and the same speed on the way back.
+	var legs []routeLeg
+	var total time.Duration
+	addLeg := func(from, to, speed int) {
+		leg := routeLeg{from: waypoints[from], to: waypoints[to], start: total}
+		leg.length = distance(leg.from, leg.to)
+		leg.duration = time.Duration(leg.length / speeds[speed] * float64(time.Second))
+		total += leg.duration
+		legs = append(legs, leg)
+	}
+	last := len(waypoints) - 1
+	for i := 0; i < last; i++ {
+		addLeg(i, i+1, i)
+	}
+	switch mode {
+	case "loop":
+		addLeg(last, 0, last)
+	case "reverse":
+		for i := last; i > 0; i-- {
+			addLeg(i, i-1, i-1)
+		}
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("route generator for %s: the waypoints are all in one place", sensor.ID)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		elapsed := t.Sub(sensor.Start)
+		if mode == "once" && elapsed >= total {
+			last := legs[len(legs)-1]
+			p := last.to
+			p.Heading = bearing(last.from, last.to)
+			sensor.Notes.Position = &p
+			return 0
+		}
+		elapsed %= total
+		i := 0
+		for i < len(legs)-1 && elapsed >= legs[i+1].start {
+			i++
+		}
+		leg := legs[i]
+		f := 0.0
+		if leg.duration > 0 {
+			f = float64(elapsed-leg.start) / float64(leg.duration)
+		}
+		p := Position{
+			Lat:     leg.from.Lat + f*(leg.to.Lat-leg.from.Lat),
+			Lon:     leg.from.Lon + f*(leg.to.Lon-leg.from.Lon),
+			Alt:     leg.from.Alt + f*(leg.to.Alt-leg.from.Alt),
+			Heading: bearing(leg.from, leg.to),
+		}
+		sensor.Notes.Position = &p
+		return leg.length / leg.duration.Seconds()
+	}), nil
+}
+
+// newWanderGenerator moves a position sensor at random around a centre
+// {lat, lon, alt} at speed metres per second, changing heading by turn
+// degrees per second on average and turning back towards the centre when
+// it is more than radius metres away. Its value is its speed.
+func newWanderGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	center := Position{Lat: spec.float("lat", 0), Lon: spec.float("lon", 0), Alt: spec.float("alt", 0)}
+	speed := spec.float("speed", 1)
+	radius := spec.float("radius", 100)
+	turn := spec.float("turn", 10)
+	if speed < 0 || radius <= 0 || turn < 0 {
+		return nil, fmt.Errorf("wander generator for %s: speed and turn must not be negative and radius must be positive", sensor.ID)
+	}
+
+	p := center
+	p.Heading = sensor.Rand.Float64() * 360
+	var last time.Time
+	return generatorFunc(func(t time.Time) float64 {
+		if !last.IsZero() && t.After(last) {
+			dt := t.Sub(last).Seconds()
+			heading := p.Heading + sensor.Rand.NormFloat64()*turn*math.Sqrt(dt)
+			if distance(p, center) > radius {
+				heading = bearing(p, center)
+			}
+			p = move(p, math.Mod(heading+360, 360), speed*dt)
+		}
+		last = t
+		current := p
+		sensor.Notes.Position = &current
+		return speed
+	}), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestDistanceAndBearing(t *testing.T) {
+	london := Position{Lat: 51.5074, Lon: -0.1278}
+	paris := Position{Lat: 48.8566, Lon: 2.3522}
+	if d := distance(london, paris); math.Abs(d-343.5e3) > 1e3 {
+		t.Errorf("Expected London to Paris to be about 343.5km, got %.1fkm", d/1e3)
+	}
+	if b := bearing(london, paris); math.Abs(b-148) > 1 {
+		t.Errorf("Expected a bearing of about 148°, got %.1f°", b)
+	}
+	if d := distance(london, move(london, 45, 500)); math.Abs(d-500) > 0.5 {
+		t.Errorf("Expected a move of 500m, got %.1fm", d)
+	}
+}
+
+func TestRouteGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	east := move(Position{}, 90, 1000)
+	waypoints := []any{
+		map[string]any{"lat": 0, "lon": 0, "alt": 100},
+		map[string]any{"lat": east.Lat, "lon": east.Lon, "alt": 200, "speed": 20},
+	}
+
+	tests := []struct {
+		mode    string
+		at      time.Duration
+		speed   float64
+		lon     float64 // as a fraction of the way east
+		heading float64
+	}{
+		{"loop", 50 * time.Second, 10, 0.5, 90},
+		{"loop", 125 * time.Second, 20, 0.5, 270},
+		{"loop", 160 * time.Second, 10, 0.1, 90},
+		{"reverse", 125 * time.Second, 10, 0.75, 270},
+		{"once", 300 * time.Second, 0, 1, 90},
+	}
+	for _, tt := range tests {
+		viper.Set("channels.position.generator", map[string]any{
+			"type":      "route",
+			"mode":      tt.mode,
+			"speed":     10,
+			"waypoints": waypoints,
+		})
+		sensor := testSensor(1, "position")
+		generator, err := newValueGenerator(sensor)
+		if err != nil {
+			t.Fatalf("Error creating generator: %v", err)
+		}
+		speed := generator.Next(testStart.Add(tt.at))
+		p := sensor.Notes.Position
+		if p == nil {
+			t.Fatalf("%s at %v: expected a position", tt.mode, tt.at)
+		}
+		if !approxEqual(speed, tt.speed) || math.Abs(p.Lon-tt.lon*east.Lon) > 1e-7 || math.Abs(p.Heading-tt.heading) > 1e-6 {
+			t.Errorf("%s at %v: expected %g m/s at %g heading %g, got %g m/s at %+v",
+				tt.mode, tt.at, tt.speed, tt.lon*east.Lon, tt.heading, speed, *p)
+		}
+	}
+
+	viper.Set("channels.position.generator", map[string]any{"type": "route", "waypoints": waypoints[:1]})
+	if _, err := newValueGenerator(testSensor(1, "position")); err == nil {
+		t.Errorf("Expected an error for a route with one waypoint")
+	}
+}
+
+func TestWanderGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	center := Position{Lat: 47.37, Lon: 8.54, Alt: 408}
+	viper.Set("channels.position.generator", map[string]any{
+		"type":   "wander",
+		"lat":    center.Lat,
+		"lon":    center.Lon,
+		"alt":    center.Alt,
+		"speed":  1.5,
+		"radius": 50,
+	})
+
+	sensor := testSensor(1, "position")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	var farthest float64
+	for i := 0; i < 3600; i++ {
+		if speed := generator.Next(testStart.Add(time.Duration(i) * time.Second)); speed != 1.5 {
+			t.Fatalf("Expected a speed of 1.5 m/s, got %g", speed)
+		}
+		farthest = math.Max(farthest, distance(*sensor.Notes.Position, center))
+	}
+	if farthest < 20 || farthest > 55 {
+		t.Errorf("Expected the sensor to wander up to about 50m, got %.1fm", farthest)
+	}
+}
+
+func TestPositionInPayloads(t *testing.T) {
+	r := Reading{SensorData: SensorData{SensorID: "sensor_001", Channel: "position", Value: 3, Position: &Position{Lat: 1, Lon: 2, Alt: 3, Heading: 4}}}
+	body, _ := json.Marshal(r.SensorData)
+	if !strings.Contains(string(body), `"position":{"lat":1,"lon":2,"alt":3,"heading":4}`) {
+		t.Errorf("Expected the position in the JSON payload, got %s", body)
+	}
+	if msg := toSensorReading(r); msg.Position.GetLat() != 1 || msg.Position.GetHeading() != 4 {
+		t.Errorf("Expected the position in the protobuf payload, got %v", msg)
+	}
+}
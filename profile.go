@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// applyProfile merges the settings of the profile selected with profile
+// over those of the config file, e.g. with --profile load
+//
+//	num-sensors: 100
+//	profiles:
+//	  smoke: {num-sensors: 5, sinks: sse}
+//	  load:
+//	    num-sensors: 20000
+//	    channels:
+//	      temperature: {rate: 50}
+//
+// Maps are merged key by key, so a profile only needs to set what it
+// changes. Flags and the environment still provide the same defaults and
+// overrides as without a profile.
+func applyProfile() error {
+	name := viper.GetString("profile")
+	if name == "" {
+		return nil
+	}
+	profiles := viper.GetStringMap("profiles")
+	profile, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown profile %q (profiles: %s)", name, strings.Join(sortedKeys(profiles), ", "))
+	}
+	return viper.MergeConfigMap(cast.ToStringMap(profile))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestApplyProfile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+num-sensors: 100
+min-rate: 2
+channels:
+  temperature: {min: 10, max: 30}
+profiles:
+  smoke: {num-sensors: 5}
+  Load:
+    num-sensors: 20000
+    channels:
+      temperature: {max: 40}
+`
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Error reading config: %v", err)
+	}
+
+	if err := applyProfile(); err != nil || viper.GetInt("num-sensors") != 100 {
+		t.Errorf("Expected the base settings without a profile, got %d sensors, error %v", viper.GetInt("num-sensors"), err)
+	}
+
+	viper.SetDefault("profile", "load")
+	if err := applyProfile(); err != nil {
+		t.Fatalf("Error applying profile: %v", err)
+	}
+	if n := viper.GetInt("num-sensors"); n != 20000 {
+		t.Errorf("Expected num-sensors 20000 from the profile, got %d", n)
+	}
+	if rate := viper.GetFloat64("min-rate"); rate != 2 {
+		t.Errorf("Expected min-rate kept from the base settings, got %g", rate)
+	}
+	if min, max := channelRange("temperature"); min != 10 || max != 40 {
+		t.Errorf("Expected the channel settings merged to 10 to 40, got %g to %g", min, max)
+	}
+
+	viper.SetDefault("profile", "chaos")
+	if err := applyProfile(); err == nil || !strings.Contains(err.Error(), "load, smoke") {
+		t.Errorf("Expected an unknown profile error listing the profiles, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"rgehrsitz/diu_sim/diusimpb"
+)
+
+// toSensorReading converts a reading to its protobuf representation.
+func toSensorReading(r Reading) *diusimpb.SensorReading {
+	msg := &diusimpb.SensorReading{
+		SensorId:    r.SensorID,
+		Channel:     r.Channel,
+		Value:       r.Value,
+		Diu:         r.DIU,
+		Name:        r.Name,
+		Unit:        r.Unit,
+		Label:       r.Label,
+		Text:        r.Text,
+		Samples:     r.Samples,
+		Quality:     r.Quality,
+		Rssi:        r.RSSI,
+		Snr:         r.SNR,
+		Metadata:    r.Metadata,
+		Anomaly:     r.Anomaly,
+		AnomalyType: r.AnomalyType,
+	}
+	if p := r.Position; p != nil {
+		msg.Position = &diusimpb.Position{Lat: p.Lat, Lon: p.Lon, Alt: p.Alt, Heading: p.Heading}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, r.Timestamp); err == nil {
+		msg.Timestamp = timestamppb.New(t)
+	}
+	return msg
+}
+
+// encodeProtobuf encodes a reading as a diusim.v1.SensorReading message (see
+// diusimpb/reading.proto).
+func encodeProtobuf(r Reading) (Message, error) {
+	body, err := proto.Marshal(toSensorReading(r))
+	return Message{Body: body, ContentType: "application/x-protobuf"}, err
+}
+
+// encodeProtobufBatch encodes readings as a diusim.v1.SensorReadingBatch
+// message.
+func encodeProtobufBatch(rs []Reading) (Message, error) {
+	batch := &diusimpb.SensorReadingBatch{Readings: make([]*diusimpb.SensorReading, len(rs))}
+	for i, r := range rs {
+		batch.Readings[i] = toSensorReading(r)
+	}
+	body, err := proto.Marshal(batch)
+	return Message{Body: body, ContentType: "application/x-protobuf"}, err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"rgehrsitz/diu_sim/diusimpb"
+)
+
+func TestEncodeProtobuf(t *testing.T) {
+	msg, err := encodeProtobuf(testReading)
+	if err != nil {
+		t.Fatalf("Error encoding protobuf: %v", err)
+	}
+	if msg.ContentType != "application/x-protobuf" {
+		t.Errorf("Unexpected content type %s", msg.ContentType)
+	}
+
+	var decoded diusimpb.SensorReading
+	if err := proto.Unmarshal(msg.Body, &decoded); err != nil {
+		t.Fatalf("Error decoding protobuf: %v", err)
+	}
+	if decoded.GetSensorId() != "sensor_001" || decoded.GetChannel() != "pressure" || decoded.GetValue() != 1.05 || decoded.GetDiu() != "diu_000" {
+		t.Errorf("Unexpected decoded reading %v", &decoded)
+	}
+	if got := decoded.GetTimestamp().AsTime().Unix(); got != 1719835200 {
+		t.Errorf("Expected timestamp 1719835200, got %d", got)
+	}
+
+	labelled := testReading
+	labelled.Anomaly, labelled.AnomalyType = true, "spike"
+	msg, _ = encodeProtobuf(labelled)
+	if err := proto.Unmarshal(msg.Body, &decoded); err != nil || !decoded.GetAnomaly() || decoded.GetAnomalyType() != "spike" {
+		t.Errorf("Expected the anomaly labels decoded, got %v, %v", &decoded, err)
+	}
+}
+
+func TestEncodeProtobufBatch(t *testing.T) {
+	second := testReading
+	second.Value = 1.07
+
+	msg, err := encodeProtobufBatch([]Reading{testReading, second})
+	if err != nil {
+		t.Fatalf("Error encoding protobuf batch: %v", err)
+	}
+
+	var decoded diusimpb.SensorReadingBatch
+	if err := proto.Unmarshal(msg.Body, &decoded); err != nil {
+		t.Fatalf("Error decoding protobuf batch: %v", err)
+	}
+	if len(decoded.GetReadings()) != 2 || decoded.GetReadings()[1].GetValue() != 1.07 {
+		t.Errorf("Unexpected decoded batch %v", &decoded)
+	}
+}
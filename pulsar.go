@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/spf13/viper"
+)
+
+// pulsarAvroSchema describes SensorData for the json and avro schema modes.
+const pulsarAvroSchema = `{
+	"type": "record",
+	"name": "SensorData",
+	"namespace": "diusim",
+	"fields": [
+		{"name": "sensor_id", "type": "string"},
+		{"name": "channel", "type": "string"},
+		{"name": "timestamp", "type": "string"},
+		{"name": "value", "type": "double"},
+		{"name": "unit", "type": "string", "default": ""},
+		{"name": "label", "type": "string", "default": ""},
+		{"name": "anomaly", "type": "boolean", "default": false},
+		{"name": "anomaly_type", "type": "string", "default": ""}
+	]
+}`
+
+// pulsarSink produces readings to Apache Pulsar. The topic of each message
+// is rendered from pulsar.topic, with one producer created per distinct
+// topic. Messages are keyed by the pulsar.key template, which decides the
+// partition on partitioned topics; an empty key spreads messages
+// round-robin across partitions.
+type pulsarSink struct {
+	client  pulsar.Client
+	schema  pulsar.Schema
+	encoder Encoder
+	topic   string
+	prefix  string // topic-prefix
+	key     string
+
+	mu        sync.Mutex
+	producers map[string]pulsar.Producer
+}
+
+func newPulsarSink() (*pulsarSink, error) {
+	schema, err := pulsarSchema(viper.GetString("pulsar.schema"))
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := newEncoder("pulsar", true)
+	if err != nil {
+		return nil, err
+	}
+
+	options := pulsar.ClientOptions{
+		URL:                        viper.GetString("pulsar.url"),
+		TLSTrustCertsFilePath:      viper.GetString("pulsar.tls.ca-file"),
+		TLSAllowInsecureConnection: viper.GetBool("pulsar.tls.insecure-skip-verify"),
+	}
+	if token := viper.GetString("pulsar.token"); token != "" {
+		options.Authentication = pulsar.NewAuthenticationToken(token)
+	}
+
+	client, err := pulsar.NewClient(options)
+	if err != nil {
+		return nil, fmt.Errorf("creating Pulsar client: %w", err)
+	}
+
+	return &pulsarSink{
+		client:    client,
+		schema:    schema,
+		encoder:   encoder,
+		topic:     viper.GetString("pulsar.topic"),
+		prefix:    viper.GetString("topic-prefix"),
+		key:       viper.GetString("pulsar.key"),
+		producers: make(map[string]pulsar.Producer),
+	}, nil
+}
+
+// pulsarSchema returns the Pulsar schema for the given mode: none sends the
+// plain message text, json and avro send SensorData records registered with
+// the broker's schema registry.
+func pulsarSchema(mode string) (pulsar.Schema, error) {
+	switch mode {
+	case "", "none":
+		return nil, nil
+	case "json":
+		return pulsar.NewJSONSchemaWithValidation(pulsarAvroSchema, nil)
+	case "avro":
+		return pulsar.NewAvroSchemaWithValidation(pulsarAvroSchema, nil)
+	default:
+		return nil, fmt.Errorf("unknown pulsar schema %q", mode)
+	}
+}
+
+func (s *pulsarSink) producer(topic string) (pulsar.Producer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if producer, ok := s.producers[topic]; ok {
+		return producer, nil
+	}
+
+	producer, err := s.client.CreateProducer(pulsar.ProducerOptions{
+		Topic:                   topic,
+		Schema:                  s.schema,
+		BatchingMaxPublishDelay: viper.GetDuration("pulsar.batching-max-delay"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating Pulsar producer for %s: %w", topic, err)
+	}
+	s.producers[topic] = producer
+	return producer, nil
+}
+
+func (s *pulsarSink) Publish(ctx context.Context, r Reading) error {
+	producer, err := s.producer(expandTopic(s.topic, s.prefix, r))
+	if err != nil {
+		return err
+	}
+
+	msg := &pulsar.ProducerMessage{
+		Key: expandTemplate(s.key, r),
+	}
+	if t, err := time.Parse(time.RFC3339Nano, r.Timestamp); err == nil {
+		msg.EventTime = t
+	}
+	if s.schema != nil {
+		msg.Value = r.SensorData
+	} else {
+		encoded, err := s.encoder.Encode(r)
+		if err != nil {
+			return err
+		}
+		msg.Payload = encoded.Body
+		msg.Properties = encoded.Headers
+	}
+
+	_, err = producer.Send(ctx, msg)
+	return err
+}
+
+func (s *pulsarSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, producer := range s.producers {
+		if err := producer.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+		producer.Close()
+	}
+	s.client.Close()
+	return errors.Join(errs...)
+}
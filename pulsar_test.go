@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+func TestPulsarSchema(t *testing.T) {
+	tests := []struct {
+		mode string
+		want pulsar.SchemaType
+	}{
+		{"json", pulsar.JSON},
+		{"avro", pulsar.AVRO},
+	}
+
+	for _, tt := range tests {
+		schema, err := pulsarSchema(tt.mode)
+		if err != nil {
+			t.Fatalf("pulsarSchema(%q) returned error: %v", tt.mode, err)
+		}
+		if schema.GetSchemaInfo().Type != tt.want {
+			t.Errorf("pulsarSchema(%q) type = %v, want %v", tt.mode, schema.GetSchemaInfo().Type, tt.want)
+		}
+	}
+
+	if schema, err := pulsarSchema("none"); schema != nil || err != nil {
+		t.Errorf("Expected no schema for none, got %v, %v", schema, err)
+	}
+	if _, err := pulsarSchema("thrift"); err == nil {
+		t.Errorf("Expected an error for an unknown schema")
+	}
+}
+
+func TestPulsarAvroSchemaEncodesSensorData(t *testing.T) {
+	schema, err := pulsarSchema("avro")
+	if err != nil {
+		t.Fatalf("Error creating schema: %v", err)
+	}
+
+	data := SensorData{SensorID: "sensor_001", Channel: "pressure", Timestamp: "2024-07-01T12:00:00Z", Value: 1.01}
+	encoded, err := schema.Encode(data)
+	if err != nil {
+		t.Fatalf("Error encoding SensorData: %v", err)
+	}
+
+	var decoded SensorData
+	if err := schema.Decode(encoded, &decoded); err != nil {
+		t.Fatalf("Error decoding SensorData: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("Round trip mismatch: got %+v, want %+v", decoded, data)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// OPC-style quality codes of readings.
+const (
+	qualityGood      = "GOOD"
+	qualityUncertain = "UNCERTAIN"
+	qualityBad       = "BAD"
+)
+
+// isQualityCode reports whether code is one of the quality codes.
+func isQualityCode(code string) bool {
+	return code == qualityGood || code == qualityUncertain || code == qualityBad
+}
+
+// linkQuality assesses the quality of a sensor's readings: the signal
+// strength (RSSI, in dBm) and signal-to-noise ratio (SNR, in dB) of its
+// radio link, drawn around the sensor's own means, and a quality code
+// derived from them and from the faults affecting the reading.
+type linkQuality struct {
+	rssiMean, rssiStddev float64
+	snrMean, snrStddev   float64
+
+	// A reading is UNCERTAIN below the uncertain and BAD below the bad
+	// thresholds.
+	uncertainRSSI, badRSSI float64
+	uncertainSNR, badSNR   float64
+
+	rand *rand.Rand
+}
+
+// linkQualityFor returns the link quality of a sensor, or nil if quality
+// fields are not enabled. They are configured with, e.g.
+//
+//	quality:
+//	  enabled: true
+//	  rssi: {mean: [-80, -60], stddev: 3, uncertain: -90, bad: -100}
+//	  snr: {mean: [15, 30], stddev: 2, uncertain: 10, bad: 3}
+//
+// where a [min, max] mean gives each sensor its own within the range.
+// Scenario quality events degrade the link or force a quality code.
+func linkQualityFor(sensor sensorInfo) (*linkQuality, error) {
+	if !viper.GetBool("quality.enabled") {
+		return nil, nil
+	}
+	r := sensorRand(sensor.Index, "quality")
+	rssi := generatorSpec(cast.ToStringMap(viper.Get("quality.rssi")))
+	snr := generatorSpec(cast.ToStringMap(viper.Get("quality.snr")))
+
+	q := &linkQuality{
+		rssiStddev:    rssi.float("stddev", 2),
+		snrStddev:     snr.float("stddev", 2),
+		uncertainRSSI: rssi.float("uncertain", -90),
+		badRSSI:       rssi.float("bad", -100),
+		uncertainSNR:  snr.float("uncertain", 10),
+		badSNR:        snr.float("bad", 3),
+		rand:          r,
+	}
+	var err error
+	if q.rssiMean, err = calibrationParam(rssi, "mean", -70, r); err != nil {
+		return nil, fmt.Errorf("quality rssi: %w", err)
+	}
+	if q.snrMean, err = calibrationParam(snr, "mean", 25, r); err != nil {
+		return nil, fmt.Errorf("quality snr: %w", err)
+	}
+	switch {
+	case q.rssiStddev < 0 || q.snrStddev < 0:
+		return nil, fmt.Errorf("quality: stddev must not be negative")
+	case q.badRSSI > q.uncertainRSSI || q.badSNR > q.uncertainSNR:
+		return nil, fmt.Errorf("quality: bad thresholds must not be above uncertain ones")
+	}
+	return q, nil
+}
+
+// assess returns the quality code, RSSI and SNR of a reading of value.
+// A code forced by the scenario wins; otherwise the reading is BAD if a
+// fault affects it, it is not a number or the link is below the bad
+// thresholds, UNCERTAIN if the link is below the uncertain ones, and GOOD
+// otherwise.
+func (q *linkQuality) assess(notes *sampleNotes, value float64) (code string, rssi, snr float64) {
+	rssi = q.rssiMean + q.rand.NormFloat64()*q.rssiStddev - notes.LinkLoss
+	snr = q.snrMean + q.rand.NormFloat64()*q.snrStddev - notes.LinkLoss
+
+	switch {
+	case notes.Quality != "":
+		code = notes.Quality
+	case notes.Fault != "" || math.IsNaN(value) || math.IsInf(value, 0):
+		code = qualityBad
+	case rssi < q.badRSSI || snr < q.badSNR:
+		code = qualityBad
+	case rssi < q.uncertainRSSI || snr < q.uncertainSNR:
+		code = qualityUncertain
+	default:
+		code = qualityGood
+	}
+	return code, rssi, snr
+}
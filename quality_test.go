@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestLinkQualityAssess(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("quality.enabled", true)
+	viper.Set("quality.rssi", map[string]any{"mean": -70, "stddev": 0})
+	viper.Set("quality.snr", map[string]any{"mean": 25, "stddev": 0})
+
+	q, err := linkQualityFor(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating link quality: %v", err)
+	}
+	for _, tt := range []struct {
+		name  string
+		notes sampleNotes
+		value float64
+		want  string
+	}{
+		{"good link", sampleNotes{}, 20, qualityGood},
+		{"fault", sampleNotes{Fault: "stuck"}, 20, qualityBad},
+		{"invalid value", sampleNotes{}, math.NaN(), qualityBad},
+		{"weak link", sampleNotes{LinkLoss: 22}, 20, qualityUncertain},
+		{"lost link", sampleNotes{LinkLoss: 40}, 20, qualityBad},
+		{"forced", sampleNotes{Fault: "stuck", Quality: qualityUncertain}, 20, qualityUncertain},
+	} {
+		code, rssi, snr := q.assess(&tt.notes, tt.value)
+		if code != tt.want {
+			t.Errorf("%s: expected quality %s, got %s", tt.name, tt.want, code)
+		}
+		if !approxEqual(rssi, -70-tt.notes.LinkLoss) || !approxEqual(snr, 25-tt.notes.LinkLoss) {
+			t.Errorf("%s: expected RSSI %g and SNR %g, got %g and %g",
+				tt.name, -70-tt.notes.LinkLoss, 25-tt.notes.LinkLoss, rssi, snr)
+		}
+	}
+
+	viper.Set("quality.rssi", map[string]any{"mean": []any{-80, -60}})
+	if q, err = linkQualityFor(testSensor(1, "temperature")); err != nil {
+		t.Fatalf("Error creating link quality: %v", err)
+	}
+	if q.rssiMean < -80 || q.rssiMean > -60 {
+		t.Errorf("Expected a mean RSSI in [-80, -60], got %g", q.rssiMean)
+	}
+
+	for _, spec := range []map[string]any{
+		{"mean": []any{-60, -80}},
+		{"stddev": -1},
+		{"uncertain": -100, "bad": -90},
+	} {
+		viper.Set("quality.rssi", spec)
+		if _, err := linkQualityFor(testSensor(1, "temperature")); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+
+	viper.Set("quality.enabled", false)
+	if q, err := linkQualityFor(testSensor(1, "temperature")); q != nil || err != nil {
+		t.Errorf("Expected no link quality when disabled, got %v, %v", q, err)
+	}
+}
+
+func TestScenarioQuality(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { scenario = nil })
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	constantGenerator("temperature", 20)
+	viper.Set("quality.enabled", true)
+	viper.Set("quality.rssi", map[string]any{"stddev": 0})
+	viper.Set("quality.snr", map[string]any{"stddev": 0})
+
+	events, err := loadScenario(writeScenario(t, `
+events:
+  - at: 1m
+    duration: 1m
+    channel: temperature
+    action: quality
+    loss: 20
+  - at: 3m
+    duration: 1m
+    channel: temperature
+    action: quality
+    quality: BAD
+`))
+	if err != nil {
+		t.Fatalf("Error loading scenario: %v", err)
+	}
+	scenario = events
+	info := testSensor(1, "temperature")
+	generator, err := newValueGenerator(info)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	s, err := newSensor(info, generator)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want string
+		rssi float64
+	}{
+		{30 * time.Second, qualityGood, -70},
+		{90 * time.Second, qualityUncertain, -90},
+		{150 * time.Second, qualityGood, -70},
+		{210 * time.Second, qualityBad, -70},
+	} {
+		r := s.sample(testStart.Add(tt.at), 1)
+		if r.Quality != tt.want || r.RSSI == nil || !approxEqual(*r.RSSI, tt.rssi) {
+			t.Errorf("At %v: expected quality %s with RSSI %g, got %s with %v", tt.at, tt.want, tt.rssi, r.Quality, r.RSSI)
+		}
+	}
+
+	for _, event := range []string{"quality: POOR", "loss: -3"} {
+		_, err := loadScenario(writeScenario(t, "events:\n  - action: quality\n    "+event+"\n"))
+		if err == nil {
+			t.Errorf("Expected an error for %q", event)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// rateStep is a publish rate range in effect from pos in the cycle of a
+// rate profile until the next step.
+type rateStep struct {
+	pos              float64
+	minRate, maxRate float64
+}
+
+// rateProfile varies the publish rate of a sensor with the time of day,
+// week or year.
+type rateProfile struct {
+	period string
+	loc    *time.Location
+	steps  []rateStep // sorted by pos
+}
+
+// rateProfileFor returns the rate profile of a sensor:
+// sensors.<sensor_id>.rate-profile if set, otherwise
+// channels.<channel>.rate-profile, or nil if neither is set. A profile is
+// a list of the rates in effect from given times of its period (daily,
+// weekly or yearly, as for the profile modifier) in the given timezone
+// (default local), e.g.
+//
+//	rate-profile:
+//	  timezone: Europe/Berlin
+//	  rates:
+//	    - {at: "00:00", rate: 1}
+//	    - {at: "08:00", min-rate: 8, max-rate: 12}
+//	    - {at: "18:00", rate: 2}
+//
+// Each entry sets a fixed rate or a min-rate to max-rate range, and is in
+// effect until the next one; the last one carries over into the next cycle
+// until the first.
+func rateProfileFor(sensor sensorInfo) (*rateProfile, error) {
+	spec := generatorSpec(viper.GetStringMap("sensors." + sensor.ID + ".rate-profile"))
+	if len(spec) == 0 {
+		spec = viper.GetStringMap("channels." + sensor.Channel + ".rate-profile")
+	}
+	if len(spec) == 0 {
+		return nil, nil
+	}
+
+	p := &rateProfile{period: spec.str("period", "daily")}
+	if _, ok := cyclePeriods[p.period]; !ok {
+		return nil, fmt.Errorf("rate profile for %s: unknown period %q", sensor.ID, p.period)
+	}
+	var err error
+	if p.loc, err = time.LoadLocation(spec.str("timezone", "Local")); err != nil {
+		return nil, fmt.Errorf("rate profile for %s: %w", sensor.ID, err)
+	}
+	for _, item := range cast.ToSlice(spec["rates"]) {
+		entry := generatorSpec(cast.ToStringMap(item))
+		pos, err := parseCycleTime(p.period, entry.str("at", ""))
+		if err != nil {
+			return nil, fmt.Errorf("rate profile for %s: %w", sensor.ID, err)
+		}
+		rate := entry.float("rate", 0)
+		step := rateStep{pos: pos, minRate: entry.float("min-rate", rate), maxRate: entry.float("max-rate", rate)}
+		if step.minRate <= 0 || step.maxRate < step.minRate {
+			return nil, fmt.Errorf("rate profile for %s: rates at %s must be positive, with min-rate no greater than max-rate", sensor.ID, entry.str("at", ""))
+		}
+		p.steps = append(p.steps, step)
+	}
+	if len(p.steps) == 0 {
+		return nil, fmt.Errorf("rate profile for %s: rates must be set", sensor.ID)
+	}
+	sort.Slice(p.steps, func(i, j int) bool { return p.steps[i].pos < p.steps[j].pos })
+	return p, nil
+}
+
+// at returns the publish rate range in effect at t.
+func (p *rateProfile) at(t time.Time) (minRate, maxRate float64) {
+	pos := cyclePosition(p.period, t.In(p.loc))
+	step := p.steps[len(p.steps)-1]
+	for _, s := range p.steps {
+		if s.pos > pos {
+			break
+		}
+		step = s
+	}
+	return step.minRate, step.maxRate
+}
+
+// rateScheduleStep is a publish rate range in effect until end, the time
+// since the sensor started.
+type rateScheduleStep struct {
+	end              time.Duration
+	minRate, maxRate float64
+}
+
+// rateSchedule varies the publish rate of a sensor over the run, in steps
+// of given durations from the time it starts.
+type rateSchedule struct {
+	steps  []rateScheduleStep // in order
+	repeat bool
+}
+
+// rateScheduleFor returns the rate schedule of a sensor:
+// sensors.<sensor_id>.rate-schedule if set, otherwise
+// channels.<channel>.rate-schedule, or nil if neither is set. A schedule
+// is a list of rates and how long each is in effect, from when the sensor
+// starts, e.g.
+//
+//	rate-schedule:
+//	  repeat: true
+//	  rates:
+//	    - {duration: 10m, rate: 1}
+//	    - {duration: 5m, min-rate: 15, max-rate: 25}
+//
+// Each entry sets a fixed rate or a min-rate to max-rate range, as for rate
+// profiles. After the last one the schedule starts over with repeat, and
+// otherwise the sensor's other rates apply.
+func rateScheduleFor(sensor sensorInfo) (*rateSchedule, error) {
+	spec := generatorSpec(viper.GetStringMap("sensors." + sensor.ID + ".rate-schedule"))
+	if len(spec) == 0 {
+		spec = viper.GetStringMap("channels." + sensor.Channel + ".rate-schedule")
+	}
+	if len(spec) == 0 {
+		return nil, nil
+	}
+
+	r := &rateSchedule{repeat: cast.ToBool(spec["repeat"])}
+	var end time.Duration
+	for i, item := range cast.ToSlice(spec["rates"]) {
+		entry := generatorSpec(cast.ToStringMap(item))
+		duration := entry.duration("duration", 0)
+		if duration <= 0 {
+			return nil, fmt.Errorf("rate schedule for %s: rates entry %d must have a positive duration", sensor.ID, i+1)
+		}
+		end += duration
+		rate := entry.float("rate", 0)
+		step := rateScheduleStep{end: end, minRate: entry.float("min-rate", rate), maxRate: entry.float("max-rate", rate)}
+		if step.minRate <= 0 || step.maxRate < step.minRate {
+			return nil, fmt.Errorf("rate schedule for %s: rates of entry %d must be positive, with min-rate no greater than max-rate", sensor.ID, i+1)
+		}
+		r.steps = append(r.steps, step)
+	}
+	if len(r.steps) == 0 {
+		return nil, fmt.Errorf("rate schedule for %s: rates must be set", sensor.ID)
+	}
+	return r, nil
+}
+
+// at returns the publish rate range in effect elapsed after the sensor
+// started, and false once a schedule that does not repeat is over.
+func (r *rateSchedule) at(elapsed time.Duration) (minRate, maxRate float64, ok bool) {
+	total := r.steps[len(r.steps)-1].end
+	if elapsed >= total {
+		if !r.repeat {
+			return 0, 0, false
+		}
+		elapsed %= total
+	}
+	for _, step := range r.steps {
+		if elapsed < step.end {
+			return step.minRate, step.maxRate, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// recordingColumns are the columns of CSV recordings, one reading per row.
+var recordingColumns = []string{"time", "sensor_id", "channel", "diu", "site", "value", "unit", "label", "text", "quality"}
+
+// csvRecorder is a sink writing the readings to a CSV recording, which
+// replayRecording publishes again.
+type csvRecorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *csv.Writer
+}
+
+func newCSVRecorder(path string) (*csvRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.Write(recordingColumns); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &csvRecorder{file: file, writer: writer}, nil
+}
+
+func (c *csvRecorder) Publish(ctx context.Context, r Reading) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writer.Write([]string{
+		r.Timestamp, r.SensorID, r.Channel, r.DIU, r.Site,
+		strconv.FormatFloat(r.Value, 'g', -1, 64), r.Unit, r.Label, r.Text, r.Quality,
+	})
+}
+
+func (c *csvRecorder) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writer.Flush()
+	return errors.Join(c.writer.Error(), c.file.Close())
+}
+
+// recordedReading is a reading of a recording with the time it was taken.
+type recordedReading struct {
+	at      time.Time
+	reading Reading
+}
+
+// readRecording reads the readings of a CSV recording, sorted by time.
+// Sensors are indexed in the order of their first readings, and named by
+// the name template.
+func readRecording(file string) ([]recordedReading, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header row: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"time", "sensor_id", "channel", "value"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var readings []recordedReading
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		at, err := time.Parse(time.RFC3339Nano, field(record, "time"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		value, err := strconv.ParseFloat(field(record, "value"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		id, channel := field(record, "sensor_id"), field(record, "channel")
+		readings = append(readings, recordedReading{at: at, reading: Reading{
+			SensorData: SensorData{
+				SensorID:  id,
+				Channel:   channel,
+				Timestamp: field(record, "time"),
+				Value:     value,
+				Unit:      field(record, "unit"),
+				Label:     field(record, "label"),
+				Text:      field(record, "text"),
+				Quality:   field(record, "quality"),
+			},
+			DIU:  field(record, "diu"),
+			Site: field(record, "site"),
+		}})
+	}
+	if len(readings) == 0 {
+		return nil, errors.New("no readings recorded")
+	}
+	sort.SliceStable(readings, func(i, j int) bool { return readings[i].at.Before(readings[j].at) })
+	indexes := make(map[string]int)
+	for i := range readings {
+		id := readings[i].reading.SensorID
+		if _, ok := indexes[id]; !ok {
+			indexes[id] = len(indexes)
+		}
+		r := &readings[i].reading
+		r.Index = indexes[id]
+		r.Name = expandNaming(nameTemplate(), namingVars{Channel: r.Channel, SensorID: id, Index: r.Index, DIU: r.DIU, Site: r.Site})
+	}
+	return readings, nil
+}
+
+// replayRecording publishes the readings of a CSV recording to sink at
+// their recorded times relative to the first, sped up by speed, until the
+// end of the recording, or until ctx is cancelled in loop mode. Readings
+// are timestamped with the time they are replayed at, unless
+// originalTimestamps is set, and numbered from 1 per sensor.
+func replayRecording(ctx context.Context, sink Sink, file string, speed float64, loop, originalTimestamps bool) error {
+	readings, err := readRecording(file)
+	if err != nil {
+		return err
+	}
+	sequences := make(map[string]uint64)
+	first := readings[0].at
+	for {
+		start := time.Now()
+		for _, recorded := range readings {
+			at := start.Add(time.Duration(float64(recorded.at.Sub(first)) / speed))
+			if wait := time.Until(at); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(wait):
+				}
+			} else if ctx.Err() != nil {
+				return nil
+			}
+			reading := recorded.reading
+			sequences[reading.SensorID]++
+			reading.Sequence = sequences[reading.SensorID]
+			if !originalTimestamps {
+				reading.Timestamp = at.Format(time.RFC3339Nano)
+			}
+			if err := sink.Publish(ctx, reading); err != nil {
+				log.Printf("Error publishing data for %s: %v\n", reading.Name, err)
+			}
+		}
+		if !loop {
+			return nil
+		}
+	}
+}
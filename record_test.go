@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "recording.csv")
+	recorder, err := newCSVRecorder(file)
+	if err != nil {
+		t.Fatalf("Error creating recording: %v", err)
+	}
+	readings := []Reading{
+		{SensorData: SensorData{SensorID: "sensor_001", Channel: "pressure", Timestamp: testStart.Add(200 * time.Millisecond).Format(time.RFC3339Nano), Value: math.NaN(), Quality: qualityBad}, DIU: "diu_000"},
+		{SensorData: SensorData{SensorID: "sensor_000", Channel: "temperature", Timestamp: testStart.Format(time.RFC3339Nano), Value: 21.5, Unit: "°C"}, DIU: "diu_000", Site: "plant_a"},
+		{SensorData: SensorData{SensorID: "sensor_000", Channel: "temperature", Timestamp: testStart.Add(100 * time.Millisecond).Format(time.RFC3339Nano), Value: 21.75, Unit: "°C"}, DIU: "diu_000", Site: "plant_a"},
+	}
+	for _, r := range readings {
+		if err := recorder.Publish(context.Background(), r); err != nil {
+			t.Fatalf("Error recording: %v", err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Error closing recording: %v", err)
+	}
+
+	sink := &recordingSink{}
+	start := time.Now()
+	if err := replayRecording(context.Background(), sink, file, 2, false, true); err != nil {
+		t.Fatalf("Error replaying: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected the 200ms recording replayed in about 100ms at speed 2, took %s", elapsed)
+	}
+	if len(sink.readings) != 3 {
+		t.Fatalf("Expected 3 readings replayed, got %d", len(sink.readings))
+	}
+	first, second, third := sink.readings[0], sink.readings[1], sink.readings[2]
+	if first.SensorID != "sensor_000" || first.Value != 21.5 || first.Site != "plant_a" || first.Name != "temperature:sensor_000" || first.Sequence != 1 {
+		t.Errorf("Expected the earliest reading replayed first, got %+v", first)
+	}
+	if second.Sequence != 2 || second.Timestamp != readings[2].Timestamp {
+		t.Errorf("Expected the second reading of sensor_000 with its recorded timestamp, got %+v", second)
+	}
+	if !math.IsNaN(third.Value) || third.Quality != qualityBad || third.Sequence != 1 || third.Index != 1 {
+		t.Errorf("Expected the invalid pressure reading replayed, got %+v", third)
+	}
+
+	sink = &recordingSink{}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := replayRecording(ctx, sink, file, 4, true, false); err != nil {
+		t.Fatalf("Error replaying: %v", err)
+	}
+	if n := sink.count(); n < 6 {
+		t.Errorf("Expected the recording replayed repeatedly in loop mode, got %d readings", n)
+	}
+	if sink.readings[0].Timestamp == readings[1].Timestamp {
+		t.Errorf("Expected readings timestamped with the time of replay")
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func setupRedisClient() *redis.Client {
+	tlsConfig, err := redisTLSConfig()
+	if err != nil {
+		log.Fatalf("Error configuring Redis TLS: %v", err)
+	}
+
+	network, addr := redisNetworkAddr(viper.GetString("redis.addr"))
+
+	// Zero pool sizes and timeouts leave the client's defaults.
+	client := redis.NewClient(&redis.Options{
+		Network:      network,
+		Addr:         addr,
+		Username:     viper.GetString("redis.username"),
+		Password:     viper.GetString("redis.password"),
+		DB:           viper.GetInt("redis.db"),
+		PoolSize:     viper.GetInt("redis.pool-size"),
+		MinIdleConns: viper.GetInt("redis.min-idle-conns"),
+		DialTimeout:  viper.GetDuration("redis.dial-timeout"),
+		ReadTimeout:  viper.GetDuration("redis.read-timeout"),
+		WriteTimeout: viper.GetDuration("redis.write-timeout"),
+		TLSConfig:    tlsConfig,
+	})
+
+	return client
+}
+
+// redisPrefix returns the prefix of every Redis channel and key: the
+// topic-prefix of everything published, followed by redis.prefix.
+func redisPrefix() string {
+	return viper.GetString("topic-prefix") + viper.GetString("redis.prefix")
+}
+
+// redisNetworkAddr splits a Redis address into the network and address to
+// dial. Addresses of the form unix:///path/to/redis.sock, absolute paths and
+// paths ending in .sock are treated as unix domain sockets; anything else is
+// a TCP host:port.
+func redisNetworkAddr(addr string) (string, string) {
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		return "unix", path
+	}
+	if strings.HasPrefix(addr, "/") || strings.HasSuffix(addr, ".sock") {
+		return "unix", addr
+	}
+	return "tcp", addr
+}
+
+// redisTLSConfig builds the TLS configuration for the Redis connection from
+// the redis.tls.* settings. It returns nil when TLS is not enabled.
+func redisTLSConfig() (*tls.Config, error) {
+	// Supplying any TLS material implies TLS, so the enabled switch is only
+	// needed when connecting with the system roots.
+	if !viper.GetBool("redis.tls.enabled") &&
+		viper.GetString("redis.tls.ca-file") == "" &&
+		viper.GetString("redis.tls.cert-file") == "" &&
+		!viper.GetBool("redis.tls.insecure-skip-verify") {
+		return nil, nil
+	}
+	return tlsConfig("redis.tls")
+}
+
+// redisSink publishes readings on the Redis pub/sub channel named after the
+// reading's channel, prefixed with redisPrefix.
+type redisSink struct {
+	client  *redis.Client
+	prefix  string
+	encoder Encoder
+}
+
+func newRedisSink(client *redis.Client) (*redisSink, error) {
+	encoder, err := newEncoder("redis", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisSink{
+		client:  client,
+		prefix:  redisPrefix(),
+		encoder: encoder,
+	}, nil
+}
+
+func (s *redisSink) Publish(ctx context.Context, r Reading) error {
+	msg, err := s.encoder.Encode(r)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, r, msg)
+}
+
+func (s *redisSink) send(ctx context.Context, r Reading, msg Message) error {
+	return s.client.Publish(ctx, s.prefix+r.Channel, msg.Body).Err()
+}
+
+func (s *redisSink) Close() error {
+	return s.client.Close()
+}
+
+// redisKVSink stores the latest value of every sensor under
+// <prefix>sensor:<sensor_id>:<channel> so that consumers which poll for current
+// values can be tested. Writes are optionally pipelined, flushing once
+// redis-kv.pipeline-size commands are queued or every
+// redis-kv.pipeline-interval, whichever comes first.
+type redisKVSink struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+	json   bool
+
+	pipelineSize int
+	mu           sync.Mutex
+	pipe         redis.Pipeliner
+	stop         chan struct{}
+	stopped      chan struct{}
+}
+
+func newRedisKVSink(client *redis.Client) (*redisKVSink, error) {
+	s := &redisKVSink{
+		client:       client,
+		prefix:       redisPrefix(),
+		ttl:          viper.GetDuration("redis-kv.ttl"),
+		pipelineSize: viper.GetInt("redis-kv.pipeline-size"),
+	}
+
+	switch format := viper.GetString("redis-kv.format"); format {
+	case "", "value":
+	case "json":
+		s.json = true
+	default:
+		return nil, fmt.Errorf("unknown redis-kv format %q", format)
+	}
+
+	if s.pipelineSize > 1 {
+		interval := viper.GetDuration("redis-kv.pipeline-interval")
+		if interval <= 0 {
+			interval = 100 * time.Millisecond
+		}
+		s.pipe = client.Pipeline()
+		s.stop = make(chan struct{})
+		s.stopped = make(chan struct{})
+		go s.flushPeriodically(interval)
+	}
+
+	return s, nil
+}
+
+func (s *redisKVSink) key(r Reading) string {
+	return fmt.Sprintf("%ssensor:%s:%s", s.prefix, r.SensorID, r.Channel)
+}
+
+func (s *redisKVSink) value(r Reading) (interface{}, error) {
+	if s.json {
+		return json.Marshal(r.SensorData)
+	}
+	return strconv.FormatFloat(r.Value, 'f', -1, 64), nil
+}
+
+func (s *redisKVSink) Publish(ctx context.Context, r Reading) error {
+	value, err := s.value(r)
+	if err != nil {
+		return err
+	}
+
+	if s.pipe == nil {
+		return s.client.Set(ctx, s.key(r), value, s.ttl).Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pipe.Set(ctx, s.key(r), value, s.ttl)
+	if s.pipe.Len() >= s.pipelineSize {
+		return s.flush(ctx)
+	}
+	return nil
+}
+
+// flush sends the queued commands. The caller must hold s.mu.
+func (s *redisKVSink) flush(ctx context.Context) error {
+	if s.pipe.Len() == 0 {
+		return nil
+	}
+	_, err := s.pipe.Exec(ctx)
+	return err
+}
+
+func (s *redisKVSink) flushPeriodically(interval time.Duration) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if err := s.flush(context.Background()); err != nil {
+				log.Printf("Error flushing Redis pipeline: %v", err)
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *redisKVSink) Close() error {
+	if s.pipe != nil {
+		close(s.stop)
+		<-s.stopped
+
+		s.mu.Lock()
+		err := s.flush(context.Background())
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("Error flushing Redis pipeline: %v", err)
+		}
+	}
+	return s.client.Close()
+}
+
+// redisHashSink maintains one hash per DIU, <prefix>diu:<diu_id>,
+// holding the latest <sensor_id>.value and <sensor_id>.timestamp of each of
+// its sensors, for HMIs that poll hashes rather than subscribing.
+type redisHashSink struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func newRedisHashSink(client *redis.Client) *redisHashSink {
+	return &redisHashSink{
+		client: client,
+		prefix: redisPrefix(),
+		ttl:    viper.GetDuration("redis-hash.ttl"),
+	}
+}
+
+func (s *redisHashSink) Publish(ctx context.Context, r Reading) error {
+	key := s.prefix + "diu:" + r.DIU
+
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			r.SensorID+".value", strconv.FormatFloat(r.Value, 'f', -1, 64),
+			r.SensorID+".timestamp", r.Timestamp,
+		)
+		if s.ttl > 0 {
+			pipe.Expire(ctx, key, s.ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *redisHashSink) Close() error {
+	return s.client.Close()
+}
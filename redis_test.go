@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// useTestRedis points the Redis settings at the server the tests use:
+// DIUSIM_REDIS_ADDR if set, as for the simulator, or else localhost:6379.
+func useTestRedis(t *testing.T) {
+	t.Helper()
+	t.Cleanup(viper.Reset)
+	addr := os.Getenv("DIUSIM_REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	viper.Set("redis.addr", addr)
+}
+
+func TestSetupRedisClientOptions(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("redis.addr", "redis.example:6380")
+	viper.Set("redis.db", 2)
+	viper.Set("redis.pool-size", 50)
+	viper.Set("redis.min-idle-conns", 5)
+	viper.Set("redis.dial-timeout", "2s")
+	viper.Set("redis.read-timeout", "500ms")
+
+	client := setupRedisClient()
+	defer client.Close()
+	opts := client.Options()
+	if opts.Addr != "redis.example:6380" || opts.DB != 2 {
+		t.Errorf("Expected redis.example:6380 DB 2, got %s DB %d", opts.Addr, opts.DB)
+	}
+	if opts.PoolSize != 50 || opts.MinIdleConns != 5 {
+		t.Errorf("Expected a pool of 50 with 5 idle, got %d with %d", opts.PoolSize, opts.MinIdleConns)
+	}
+	if opts.DialTimeout != 2*time.Second || opts.ReadTimeout != 500*time.Millisecond {
+		t.Errorf("Expected timeouts of 2s and 500ms, got %s and %s", opts.DialTimeout, opts.ReadTimeout)
+	}
+	// Unset, the write timeout defaults to the read timeout.
+	if opts.WriteTimeout != 500*time.Millisecond {
+		t.Errorf("Expected the write timeout to default to 500ms, got %s", opts.WriteTimeout)
+	}
+}
+
+func TestRedisTLSConfig(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Reset()
+	config, err := redisTLSConfig()
+	if err != nil || config != nil {
+		t.Fatalf("Expected TLS to be disabled by default, got %v, %v", config, err)
+	}
+
+	viper.Set("redis.tls.insecure-skip-verify", true)
+	config, err = redisTLSConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config == nil || !config.InsecureSkipVerify {
+		t.Errorf("Expected TLS config with verification disabled, got %+v", config)
+	}
+
+	viper.Set("redis.tls.cert-file", "client.crt")
+	if _, err := redisTLSConfig(); err == nil {
+		t.Errorf("Expected an error for a client certificate without a key")
+	}
+
+	viper.Reset()
+	viper.Set("redis.tls.ca-file", "does-not-exist.pem")
+	if _, err := redisTLSConfig(); err == nil {
+		t.Errorf("Expected an error for a missing CA file")
+	}
+}
+
+func TestRedisNetworkAddr(t *testing.T) {
+	tests := []struct {
+		addr, network, want string
+	}{
+		{"localhost:6379", "tcp", "localhost:6379"},
+		{"unix:///var/run/redis/redis.sock", "unix", "/var/run/redis/redis.sock"},
+		{"/tmp/redis.sock", "unix", "/tmp/redis.sock"},
+		{"redis.sock", "unix", "redis.sock"},
+	}
+
+	for _, tt := range tests {
+		network, addr := redisNetworkAddr(tt.addr)
+		if network != tt.network || addr != tt.want {
+			t.Errorf("redisNetworkAddr(%q) = %q, %q; want %q, %q", tt.addr, network, addr, tt.network, tt.want)
+		}
+	}
+}
+
+func TestRedisKVSink(t *testing.T) {
+	useTestRedis(t)
+	ctx := context.Background()
+
+	viper.Set("redis-kv.format", "json")
+	viper.Set("redis-kv.ttl", "1m")
+	sink, err := newRedisKVSink(setupRedisClient())
+	if err != nil {
+		t.Fatalf("Error creating redis-kv sink: %v", err)
+	}
+	defer sink.Close()
+
+	reading := Reading{SensorData: SensorData{SensorID: "sensor_kv1", Channel: "humidity", Value: 80.5}}
+	if err := sink.Publish(ctx, reading); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+
+	stored, err := sink.client.Get(ctx, "sensor:sensor_kv1:humidity").Bytes()
+	if err != nil {
+		t.Fatalf("Error reading key: %v", err)
+	}
+	var data SensorData
+	if err := json.Unmarshal(stored, &data); err != nil || data.Value != 80.5 {
+		t.Errorf("Expected JSON value 80.5, got %s (%v)", stored, err)
+	}
+	if ttl := sink.client.TTL(ctx, "sensor:sensor_kv1:humidity").Val(); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected a TTL of up to 1m, got %v", ttl)
+	}
+}
+
+func TestRedisKVSinkPipeline(t *testing.T) {
+	useTestRedis(t)
+	ctx := context.Background()
+
+	viper.Set("redis-kv.pipeline-size", 2)
+	viper.Set("redis-kv.pipeline-interval", "1h")
+	sink, err := newRedisKVSink(setupRedisClient())
+	if err != nil {
+		t.Fatalf("Error creating redis-kv sink: %v", err)
+	}
+	client := setupRedisClient()
+	defer client.Close()
+	client.Del(ctx, "sensor:sensor_kv2:pressure")
+
+	reading := Reading{SensorData: SensorData{SensorID: "sensor_kv2", Channel: "pressure", Value: 1.1}}
+	if err := sink.Publish(ctx, reading); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+	if n := client.Exists(ctx, "sensor:sensor_kv2:pressure").Val(); n != 0 {
+		t.Errorf("Expected the write to be queued in the pipeline")
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %v", err)
+	}
+	if value := client.Get(ctx, "sensor:sensor_kv2:pressure").Val(); value != "1.1" {
+		t.Errorf("Expected queued value to be flushed on close, got %q", value)
+	}
+}
+
+func TestRedisHashSink(t *testing.T) {
+	useTestRedis(t)
+	ctx := context.Background()
+
+	sink := newRedisHashSink(setupRedisClient())
+	defer sink.Close()
+	sink.client.Del(ctx, "diu:diu_test")
+
+	reading := Reading{
+		SensorData: SensorData{SensorID: "sensor_007", Channel: "temperature", Timestamp: "2024-07-01T12:00:00Z", Value: 27.25},
+		DIU:        "diu_test",
+	}
+	if err := sink.Publish(ctx, reading); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+
+	fields := sink.client.HGetAll(ctx, "diu:diu_test").Val()
+	if fields["sensor_007.value"] != "27.25" {
+		t.Errorf("Expected sensor_007.value 27.25, got %q", fields["sensor_007.value"])
+	}
+	if fields["sensor_007.timestamp"] != "2024-07-01T12:00:00Z" {
+		t.Errorf("Expected sensor_007.timestamp to be set, got %q", fields["sensor_007.timestamp"])
+	}
+}
+
+func TestRedisSinkPrefixAndDB(t *testing.T) {
+	useTestRedis(t)
+	ctx := context.Background()
+
+	viper.Set("redis.db", 3)
+	viper.Set("redis.prefix", "sim1:")
+
+	client := setupRedisClient()
+	if db := client.Options().DB; db != 3 {
+		t.Errorf("Expected client to use DB 3, got %d", db)
+	}
+
+	pubsub := client.Subscribe(ctx, "sim1:temperature")
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+
+	sink, err := newRedisSink(setupRedisClient())
+	if err != nil {
+		t.Fatalf("Error creating Redis sink: %v", err)
+	}
+	defer sink.Close()
+	reading := Reading{SensorData: SensorData{Channel: "temperature", Value: 30}, Name: "temperature:sensor_000"}
+	if err := sink.Publish(ctx, reading); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		if msg.Channel != "sim1:temperature" {
+			t.Errorf("Expected message on sim1:temperature, got %s", msg.Channel)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive message in time")
+	}
+}
+
+func TestRedisTopicPrefix(t *testing.T) {
+	useTestRedis(t)
+	viper.Set("topic-prefix", "sim.lab3.")
+	viper.Set("redis.prefix", "sim1:")
+
+	sink, err := newRedisKVSink(setupRedisClient())
+	if err != nil {
+		t.Fatalf("Error creating redis-kv sink: %v", err)
+	}
+	defer sink.Close()
+	reading := Reading{SensorData: SensorData{SensorID: "sensor_000", Channel: "temperature"}}
+	if key := sink.key(reading); key != "sim.lab3.sim1:sensor:sensor_000:temperature" {
+		t.Errorf("Expected the key prefixed with the topic prefix and the Redis prefix, got %s", key)
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// sinkConfigKeys are the config keys that sinks are set up from. The sinks
+// are set up again when a config reload changes any of them.
+var sinkConfigKeys = []string{
+	"sinks", "redis", "redis-kv", "redis-hash", "sse", "serial", "syslog", "stomp", "grpc", "pulsar", "failover",
+	"payload-format", "payload-template", "payload-template-file", "payload-template-content-type", "diu-frame",
+	"envelope", "instance-id", "compression", "compression-marker", "cloudevents", "batch",
+}
+
+// sinkSettings returns the current values of sinkConfigKeys.
+func sinkSettings() map[string]any {
+	settings := make(map[string]any, len(sinkConfigKeys))
+	for _, key := range sinkConfigKeys {
+		settings[key] = viper.Get(key)
+	}
+	return settings
+}
+
+// swappableSink publishes to a sink that can be replaced while readings
+// are being published.
+type swappableSink struct {
+	mu   sync.RWMutex
+	sink Sink
+}
+
+func (s *swappableSink) Publish(ctx context.Context, r Reading) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sink.Publish(ctx, r)
+}
+
+func (s *swappableSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sink.Close()
+}
+
+// swap replaces the sink, returning the one it replaces once no reading is
+// being published to it any more.
+func (s *swappableSink) swap(sink Sink) Sink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.sink
+	s.sink = sink
+	return old
+}
+
+// simulation runs the simulated sensors, by ID, until its context is
+// cancelled, and applies config reloads to them.
+type simulation struct {
+	ctx     context.Context
+	sink    *swappableSink
+	counter *countingSink  // counts the readings published to sink; sensors publish to it
+	wg      sync.WaitGroup // running sensors, including derived ones
+	started time.Time
+	paused  atomic.Bool // sensors skip their samples while set
+
+	mu               sync.Mutex
+	running          map[string]sensorRun
+	sensors          map[string]*simulatedSensor
+	added            map[string]map[string]any // sensors added at runtime, by ID
+	removed          map[string]bool           // configured sensors removed at runtime
+	rates            map[string][2]float64     // rate ranges set at runtime, by sensor ID
+	nextIndex        int                       // index of the next sensor defined later
+	numSensors       int
+	minRate, maxRate float64
+	sinkSettings     map[string]any
+}
+
+// sensorRun is the goroutine simulating a sensor: cancel stops it, and
+// done is closed once it has returned.
+type sensorRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// start starts simulating a sensor, first announcing it on the registry
+// channel if the registry is enabled.
+func (sim *simulation) start(sensor *simulatedSensor) {
+	sim.startAfter(sensor, 0)
+}
+
+// startAfter is start, with the sensor publishing only after delay. It
+// counts as running from now, so it can be stopped while it waits.
+func (sim *simulation) startAfter(sensor *simulatedSensor, delay time.Duration) {
+	ctx, cancel := context.WithCancel(sim.ctx)
+	run := sensorRun{cancel: cancel, done: make(chan struct{})}
+	sim.running[sensor.info.ID] = run
+	sim.sensors[sensor.info.ID] = sensor
+	sensor.simPaused = &sim.paused
+	minRate, maxRate := sim.minRate, sim.maxRate
+	announce := viper.GetBool("registry.enabled")
+	sim.wg.Add(1)
+	go func() {
+		defer sim.wg.Done()
+		defer close(run.done)
+		if delay > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+		if announce {
+			sensor.announce(ctx, sim.counter)
+		}
+		sensor.run(ctx, sim.counter, minRate, maxRate)
+	}()
+}
+
+// watchConfig reloads the config file whenever it changes.
+func (sim *simulation) watchConfig() {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		log.Printf("Config file %s changed, reloading", e.Name)
+		sim.reload()
+	})
+	viper.WatchConfig()
+}
+
+// reload applies the reloaded config to the running simulation: it starts
+// sensors that were added, stops those that were removed, applies changed
+// publish rates to the others and sets up the sinks again if their
+// settings changed. Other settings of running sensors, such as their
+// generators, take effect when they are restarted. A reload that fails
+// leaves the simulation as it was, as far as it got. It returns once the
+// sensors it stops have stopped.
+func (sim *simulation) reload() {
+	var stopped []sensorRun
+	defer func() {
+		for _, run := range stopped {
+			<-run.done
+		}
+	}()
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	if err := applyIncludes(); err != nil {
+		log.Printf("Error reloading included config files: %v", err)
+		return
+	}
+	if err := applyProfile(); err != nil {
+		log.Printf("Error reloading profile: %v", err)
+		return
+	}
+	// The topology is expanded into sensors again from the reloaded file,
+	// and the sensors added and rates set at runtime are kept.
+	viper.Set("sensors", nil)
+	if err := loadTopology(); err != nil {
+		log.Printf("Error reloading topology: %v", err)
+		return
+	}
+	for id, spec := range sim.added {
+		setSensorConfig(id, spec)
+	}
+	for id, rates := range sim.rates {
+		setSensorRateConfig(id, rates[0], rates[1])
+	}
+	if _, total := channelCounts(channelNames()); total > 0 || viper.InConfig("num-sensors") {
+		sim.numSensors = bulkSensorCount()
+	}
+	minRate, maxRate := sim.minRate, sim.maxRate
+	if viper.InConfig("min-rate") {
+		minRate = viper.GetFloat64("min-rate")
+	}
+	if viper.InConfig("max-rate") {
+		maxRate = viper.GetFloat64("max-rate")
+	}
+	if minRate <= 0 || maxRate <= 0 || minRate > maxRate {
+		log.Printf("Error reloading config: invalid rates %g to %g Hz", minRate, maxRate)
+	} else {
+		sim.minRate, sim.maxRate = minRate, maxRate
+	}
+
+	if settings := sinkSettings(); !reflect.DeepEqual(settings, sim.sinkSettings) {
+		if sink, err := setupSinks(); err != nil {
+			log.Printf("Error setting up sinks: %v", err)
+		} else {
+			if err := sim.sink.swap(sink).Close(); err != nil {
+				log.Printf("Error closing sinks: %v", err)
+			}
+			sim.sinkSettings = settings
+			log.Printf("Sinks set up again")
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for i := 0; i < sim.numSensors; i++ {
+		id := bulkSensorID(i)
+		if sim.removed[id] {
+			continue
+		}
+		wanted[id] = true
+		if _, ok := sim.running[id]; ok {
+			continue
+		}
+		sensor, err := newSimulatedSensor(i)
+		if err != nil {
+			log.Printf("Error setting up sensor %s: %v", id, err)
+			continue
+		}
+		sim.start(sensor)
+		log.Printf("Started sensor %s", id)
+	}
+	for _, id := range definedSensorIDs(sim.numSensors) {
+		if sim.removed[id] {
+			continue
+		}
+		wanted[id] = true
+		if _, ok := sim.running[id]; ok {
+			continue
+		}
+		sensor, err := newConfiguredSensor(sim.nextIndex, id, "")
+		if err != nil {
+			log.Printf("Error setting up sensor %s: %v", id, err)
+			continue
+		}
+		sim.nextIndex++
+		sim.start(sensor)
+		log.Printf("Started sensor %s", id)
+	}
+
+	for id, run := range sim.running {
+		if !wanted[id] {
+			run.cancel()
+			stopped = append(stopped, run)
+			delete(sim.running, id)
+			delete(sim.sensors, id)
+			log.Printf("Stopped sensor %s", id)
+			continue
+		}
+		sensor := sim.sensors[id]
+		if err := sensor.loadRates(); err != nil {
+			log.Printf("Error reloading the rates of sensor %s: %v", id, err)
+		}
+		sensor.setGlobalRates(sim.minRate, sim.maxRate)
+	}
+}
+
+var (
+	errSensorExists   = errors.New("sensor already exists")
+	errSensorNotFound = errors.New("sensor not found")
+)
+
+// addSensor adds a sensor to the running simulation, configured by spec as
+// a sensors.<id> entry would be, and starts it. Added sensors are kept
+// when the config is reloaded.
+func (sim *simulation) addSensor(id string, spec map[string]any) (*simulatedSensor, error) {
+	id = strings.ToLower(id)
+	if id == "" {
+		return nil, errors.New("sensor ID must be set")
+	}
+	if cast.ToString(spec["channel"]) == "" {
+		return nil, fmt.Errorf("sensor %s: channel must be set", id)
+	}
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	if _, ok := sim.running[id]; ok {
+		return nil, fmt.Errorf("%w: %s", errSensorExists, id)
+	}
+
+	previous := viper.Get("sensors." + id)
+	setSensorConfig(id, spec)
+	sensor, err := newConfiguredSensor(sim.nextIndex, id, "")
+	if err != nil {
+		setSensorConfig(id, previous)
+		return nil, err
+	}
+	sim.nextIndex++
+	sim.added[id] = spec
+	delete(sim.removed, id)
+	delete(sim.rates, id)
+	sim.start(sensor)
+	log.Printf("Added sensor %s", id)
+	return sensor, nil
+}
+
+// removeSensor stops a sensor of the running simulation, returning once it
+// has stopped, so it publishes nothing after its removal. Configured
+// sensors stay removed when the config is reloaded.
+func (sim *simulation) removeSensor(id string) error {
+	id = strings.ToLower(id)
+	sim.mu.Lock()
+	run, ok := sim.running[id]
+	if !ok {
+		sim.mu.Unlock()
+		return fmt.Errorf("%w: %s", errSensorNotFound, id)
+	}
+	run.cancel()
+	delete(sim.running, id)
+	delete(sim.sensors, id)
+	delete(sim.rates, id)
+	if _, ok := sim.added[id]; ok {
+		delete(sim.added, id)
+		setSensorConfig(id, nil)
+	} else {
+		sim.removed[id] = true
+	}
+	sim.mu.Unlock()
+
+	<-run.done
+	log.Printf("Removed sensor %s", id)
+	return nil
+}
+
+// runningSensors returns the sensors being simulated, sorted by ID.
+func (sim *simulation) runningSensors() []*simulatedSensor {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sensors := make([]*simulatedSensor, 0, len(sim.sensors))
+	for _, id := range sortedKeys(sim.sensors) {
+		sensors = append(sensors, sim.sensors[id])
+	}
+	return sensors
+}
+
+// setRates sets the global publish rate range of the running simulation,
+// which applies to the sensors that have no rates of their own, until a
+// config reload sets it again.
+func (sim *simulation) setRates(minRate, maxRate float64) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.minRate, sim.maxRate = minRate, maxRate
+	for _, sensor := range sim.sensors {
+		sensor.setGlobalRates(minRate, maxRate)
+	}
+	log.Printf("Set the publish rates to %g to %g Hz", minRate, maxRate)
+}
+
+// setSensorRates sets the publish rate range of a running sensor, as its
+// sensors.<id> entry would. It is kept when the config is reloaded.
+func (sim *simulation) setSensorRates(id string, minRate, maxRate float64) (*simulatedSensor, error) {
+	id = strings.ToLower(id)
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sensor, ok := sim.sensors[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errSensorNotFound, id)
+	}
+	previous := viper.Get("sensors." + id)
+	setSensorRateConfig(id, minRate, maxRate)
+	if err := sensor.loadRates(); err != nil {
+		setSensorConfig(id, previous)
+		return nil, err
+	}
+	sim.rates[id] = [2]float64{minRate, maxRate}
+	log.Printf("Set the publish rates of sensor %s to %g to %g Hz", id, minRate, maxRate)
+	return sensor, nil
+}
+
+// triggerFault puts a running sensor into a fault of one of the
+// runtimeFaults kinds for duration d.
+func (sim *simulation) triggerFault(id, kind string, d time.Duration) (*simulatedSensor, error) {
+	if !slices.Contains(runtimeFaults, kind) {
+		return nil, fmt.Errorf("unknown fault %q (want one of %s)", kind, strings.Join(runtimeFaults, ", "))
+	}
+	if d <= 0 {
+		return nil, errors.New("fault duration must be greater than 0")
+	}
+	id = strings.ToLower(id)
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sensor, ok := sim.sensors[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errSensorNotFound, id)
+	}
+	sensor.triggerFault(kind, d)
+	log.Printf("Triggered a %s fault on sensor %s for %s", kind, id, d)
+	return sensor, nil
+}
+
+// setPaused pauses or resumes all the sensors of the simulation.
+func (sim *simulation) setPaused(paused bool) {
+	if sim.paused.Swap(paused) == paused {
+		return
+	}
+	if paused {
+		log.Printf("Simulation paused")
+	} else {
+		log.Printf("Simulation resumed")
+	}
+}
+
+// sensorSelector selects running sensors by an ID pattern, as path.Match
+// matches them (so * does not match the / of topology IDs), and/or a
+// channel.
+type sensorSelector struct {
+	ID      string `json:"id"`
+	Channel string `json:"channel"`
+}
+
+func (sel sensorSelector) matches(s *simulatedSensor) (bool, error) {
+	if sel.Channel != "" && sel.Channel != s.info.Channel {
+		return false, nil
+	}
+	if sel.ID == "" {
+		return true, nil
+	}
+	return path.Match(sel.ID, s.info.ID)
+}
+
+// pauseSensors pauses or resumes the running sensors that sel selects, to
+// simulate partial outages, and returns them, sorted by ID.
+func (sim *simulation) pauseSensors(sel sensorSelector, paused bool) ([]*simulatedSensor, error) {
+	if sel.ID == "" && sel.Channel == "" {
+		return nil, errors.New("select sensors by id or channel")
+	}
+	var selected []*simulatedSensor
+	for _, s := range sim.runningSensors() {
+		ok, err := sel.matches(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sensor ID pattern %q: %w", sel.ID, err)
+		}
+		if ok {
+			selected = append(selected, s)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("%w: none match", errSensorNotFound)
+	}
+	verb := "Resumed"
+	if paused {
+		verb = "Paused"
+	}
+	for _, s := range selected {
+		if s.paused.Swap(paused) != paused {
+			log.Printf("%s sensor %s", verb, s.info.ID)
+		}
+	}
+	return selected, nil
+}
+
+// simulationStats is the state of a running simulation.
+type simulationStats struct {
+	Paused            bool    `json:"paused"`
+	UptimeSeconds     float64 `json:"uptime_seconds"`
+	Sensors           int     `json:"sensors"`
+	Readings          int64   `json:"readings"`
+	Errors            int64   `json:"errors"`
+	ReadingsPerSecond float64 `json:"readings_per_second"`
+	MinRate           float64 `json:"min_rate"`
+	MaxRate           float64 `json:"max_rate"`
+}
+
+// stats returns the state of the simulation, with the readings published
+// since it started.
+func (sim *simulation) stats() simulationStats {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	uptime := time.Since(sim.started)
+	readings := sim.counter.readings.Load()
+	return simulationStats{
+		Paused:            sim.paused.Load(),
+		UptimeSeconds:     uptime.Seconds(),
+		Sensors:           len(sim.running),
+		Readings:          readings,
+		Errors:            sim.counter.errors.Load(),
+		ReadingsPerSecond: float64(readings) / uptime.Seconds(),
+		MinRate:           sim.minRate,
+		MaxRate:           sim.maxRate,
+	}
+}
+
+// setSensorRateConfig sets the rate range of the sensors.<id> entry,
+// keeping its other settings.
+func setSensorRateConfig(id string, minRate, maxRate float64) {
+	spec := maps.Clone(viper.GetStringMap("sensors." + id))
+	if spec == nil {
+		spec = make(map[string]any)
+	}
+	delete(spec, "rate")
+	spec["min-rate"], spec["max-rate"] = minRate, maxRate
+	setSensorConfig(id, spec)
+}
+
+// setSensorConfig sets the sensors.<id> entry to spec, or removes it if
+// spec is nil. The whole sensors map is set, as viper would otherwise hide
+// the entries of the config file behind it.
+func setSensorConfig(id string, spec any) {
+	sensors := maps.Clone(viper.GetStringMap("sensors"))
+	if spec == nil {
+		delete(sensors, id)
+	} else {
+		sensors[id] = spec
+	}
+	viper.Set("sensors", sensors)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func runningSensorIDs(sim *simulation) []string {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	var ids []string
+	for id := range sim.running {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestConfigReload(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		viper.SetConfigFile(file)
+		if err := viper.ReadInConfig(); err != nil {
+			t.Fatalf("Error reading config: %v", err)
+		}
+	}
+	writeConfig("sinks: recording\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := &recordingSink{}
+	sim, err := startSensorSimulations(ctx, sink, 2, 1, 1)
+	if err != nil {
+		cancel()
+		t.Fatalf("Error starting simulation: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.wg.Wait()
+		sim.sink.Close()
+	})
+	if ids := runningSensorIDs(sim); !slices.Equal(ids, []string{"sensor_000", "sensor_001"}) {
+		t.Fatalf("Expected two sensors running, got %v", ids)
+	}
+
+	writeConfig(`
+sinks: recording
+num-sensors: 1
+max-rate: 2
+channels:
+  temperature: {rate: 5}
+sensors:
+  inlet_temp: {channel: temperature}
+`)
+	sim.reload()
+
+	if ids := runningSensorIDs(sim); !slices.Equal(ids, []string{"inlet_temp", "sensor_000"}) {
+		t.Errorf("Expected sensor_001 stopped and inlet_temp started, got %v", ids)
+	}
+	if sim.maxRate != 2 {
+		t.Errorf("Expected the global max-rate reloaded, got %g", sim.maxRate)
+	}
+	if low, high := sim.sensors["sensor_000"].rateRange(testStart, 1, 2); low != 5 || high != 5 {
+		t.Errorf("Expected the channel rate reloaded, got %g to %g Hz", low, high)
+	}
+	if sink.closed {
+		t.Errorf("Expected the sinks kept while their settings are unchanged")
+	}
+
+	writeConfig(`
+sinks: sse
+sse: {addr: "127.0.0.1:0"}
+num-sensors: 1
+max-rate: 2
+sensors:
+  inlet_temp: {channel: temperature}
+`)
+	sim.reload()
+	if !sink.closed {
+		t.Errorf("Expected the old sinks closed once the sink settings changed")
+	}
+	if _, ok := sim.sink.sink.(*sseSink); !ok {
+		t.Errorf("Expected readings published to the new sinks, got %T", sim.sink.sink)
+	}
+
+	// Flag values are defaults, and only the settings in the file replace
+	// those the simulation runs with.
+	viper.SetDefault("num-sensors", "10")
+	viper.SetDefault("min-rate", "1")
+	viper.SetDefault("max-rate", "10")
+	writeConfig(`
+sinks: sse
+sse: {addr: "127.0.0.1:0"}
+min-rate: 3
+sensors:
+  inlet_temp: {channel: temperature}
+`)
+	sim.reload()
+	if ids := runningSensorIDs(sim); !slices.Equal(ids, []string{"inlet_temp", "sensor_000"}) {
+		t.Errorf("Expected the sensors kept, got %v", ids)
+	}
+	if sim.minRate != 1 || sim.maxRate != 2 {
+		t.Errorf("Expected invalid rates ignored, got %g to %g Hz", sim.minRate, sim.maxRate)
+	}
+}
+
+func TestRemovedSensorStopsPublishing(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+
+	sink := &recordingSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	sim, err := startSensorSimulations(ctx, sink, 2, 100, 100)
+	if err != nil {
+		cancel()
+		t.Fatalf("Error starting simulation: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.wg.Wait()
+	})
+	published := func() int {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		n := 0
+		for _, r := range sink.readings {
+			if r.SensorID == "sensor_000" {
+				n++
+			}
+		}
+		return n
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if err := sim.removeSensor("sensor_000"); err != nil {
+		t.Fatalf("Error removing sensor: %v", err)
+	}
+	before := published()
+	time.Sleep(100 * time.Millisecond)
+	if after := published(); before == 0 || after != before {
+		t.Errorf("Expected no readings after the removal, got %d before and %d after", before, after)
+	}
+}
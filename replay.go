@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/spf13/cast"
+)
+
+// replayTable is a recorded dataset: columns of cells by column name, all of
+// the same length.
+type replayTable struct {
+	columns map[string][]string
+	rows    int
+}
+
+var (
+	replayTablesMu sync.Mutex
+	replayTables   = make(map[string]*replayTable)
+)
+
+// loadReplayTable reads a CSV file with a header row, or a Parquet file,
+// caching it so that all the sensors replaying it share one copy.
+func loadReplayTable(file, format string) (*replayTable, error) {
+	replayTablesMu.Lock()
+	defer replayTablesMu.Unlock()
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+	}
+	read, ok := map[string]func(string) (*replayTable, error){
+		"csv":     readCSVTable,
+		"parquet": readParquetTable,
+	}[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown replay format %q for %s", format, file)
+	}
+	if table, ok := replayTables[file]; ok {
+		return table, nil
+	}
+	table, err := read(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+	if table.rows == 0 {
+		return nil, fmt.Errorf("%s has no rows", file)
+	}
+	replayTables[file] = table
+	return table, nil
+}
+
+func readCSVTable(file string) (*replayTable, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("missing header row")
+	}
+	table := &replayTable{columns: make(map[string][]string), rows: len(records) - 1}
+	for i, name := range records[0] {
+		column := make([]string, table.rows)
+		for j, record := range records[1:] {
+			column[j] = record[i]
+		}
+		table.columns[strings.TrimSpace(name)] = column
+	}
+	return table, nil
+}
+
+func readParquetTable(file string) (*replayTable, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := parquet.NewReader(f)
+	defer reader.Close()
+
+	schema := reader.Schema()
+	paths := schema.Columns()
+	names := make([]string, len(paths))
+	units := make([]time.Duration, len(paths)) // of timestamp columns
+	for i, path := range paths {
+		names[i] = strings.Join(path, ".")
+		leaf, _ := schema.Lookup(path...)
+		if logical := leaf.Node.Type().LogicalType(); logical != nil && logical.Timestamp != nil {
+			switch unit := logical.Timestamp.Unit; {
+			case unit.Millis != nil:
+				units[i] = time.Millisecond
+			case unit.Micros != nil:
+				units[i] = time.Microsecond
+			default:
+				units[i] = time.Nanosecond
+			}
+		}
+	}
+
+	table := &replayTable{columns: make(map[string][]string)}
+	rows := make([]parquet.Row, 256)
+	for {
+		n, err := reader.ReadRows(rows)
+		for _, row := range rows[:n] {
+			for _, v := range row {
+				name := names[v.Column()]
+				table.columns[name] = append(table.columns[name], parquetCell(v, units[v.Column()]))
+			}
+		}
+		table.rows += n
+		if err == io.EOF {
+			return table, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parquetCell renders a Parquet value like a CSV cell. Timestamps, whose
+// unit is given, are written in RFC 3339 format.
+func parquetCell(v parquet.Value, timestampUnit time.Duration) string {
+	switch {
+	case v.IsNull():
+		return ""
+	case timestampUnit != 0:
+		return time.Unix(0, v.Int64()*int64(timestampUnit)).UTC().Format(time.RFC3339Nano)
+	case v.Kind() == parquet.Double:
+		return strconv.FormatFloat(v.Double(), 'g', -1, 64)
+	default:
+		return v.String()
+	}
+}
+
+// newReplayGenerator replays a column of a recorded CSV or Parquet dataset,
+// by default the column named after the sensor ID. Without a time column
+// each sample takes the next row, so the publish rate sets the replay rate;
+// with one, rows are replayed at their recorded times, sped up by speed.
+// In loop mode the replay starts over at the end of the dataset; in once
+// mode it holds the last value.
+func newReplayGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	file := spec.str("file", "")
+	if file == "" {
+		return nil, fmt.Errorf("replay generator for %s: file must be set", sensor.ID)
+	}
+	table, err := loadReplayTable(file, spec.str("format", ""))
+	if err != nil {
+		return nil, fmt.Errorf("replay generator for %s: %w", sensor.ID, err)
+	}
+
+	name := spec.str("column", sensor.ID)
+	column, ok := table.columns[name]
+	if !ok {
+		return nil, fmt.Errorf("replay generator for %s: %s has no column %q", sensor.ID, file, name)
+	}
+	values := make([]float64, len(column))
+	for i, cell := range column {
+		if values[i], err = cast.ToFloat64E(strings.TrimSpace(cell)); err != nil {
+			return nil, fmt.Errorf("replay generator for %s: row %d of %s: %w", sensor.ID, i+1, name, err)
+		}
+	}
+
+	var loop bool
+	switch mode := spec.str("mode", "loop"); mode {
+	case "loop":
+		loop = true
+	case "once":
+	default:
+		return nil, fmt.Errorf("replay generator for %s: unknown mode %q", sensor.ID, mode)
+	}
+
+	timeColumn := spec.str("time-column", "")
+	if timeColumn == "" {
+		row := 0
+		return generatorFunc(func(time.Time) float64 {
+			value := values[row]
+			if row++; row == len(values) {
+				if loop {
+					row = 0
+				} else {
+					row--
+				}
+			}
+			return value
+		}), nil
+	}
+
+	offsets, err := replayOffsets(table, timeColumn)
+	if err != nil {
+		return nil, fmt.Errorf("replay generator for %s: %w", sensor.ID, err)
+	}
+	speed := spec.float("speed", 1)
+	if speed <= 0 {
+		return nil, fmt.Errorf("replay generator for %s: speed must be positive", sensor.ID)
+	}
+	// A loop lasts until one average row interval after the last row.
+	length := offsets[len(offsets)-1]
+	if len(offsets) > 1 {
+		length += length / time.Duration(len(offsets)-1)
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		elapsed := time.Duration(float64(t.Sub(sensor.Start)) * speed)
+		if loop && length > 0 {
+			elapsed %= length
+		}
+		row := sort.Search(len(offsets), func(i int) bool { return offsets[i] > elapsed }) - 1
+		return values[max(row, 0)]
+	}), nil
+}
+
+// replayOffsets parses the time column of a dataset, in RFC 3339 format or
+// as seconds, into offsets from its first row.
+func replayOffsets(table *replayTable, name string) ([]time.Duration, error) {
+	column, ok := table.columns[name]
+	if !ok {
+		return nil, fmt.Errorf("no time column %q", name)
+	}
+	offsets := make([]time.Duration, len(column))
+	var first time.Time
+	for i, cell := range column {
+		cell = strings.TrimSpace(cell)
+		t, err := time.Parse(time.RFC3339Nano, cell)
+		if err != nil {
+			seconds, numErr := strconv.ParseFloat(cell, 64)
+			if numErr != nil {
+				return nil, fmt.Errorf("row %d of %s: %q is neither an RFC 3339 time nor seconds", i+1, name, cell)
+			}
+			t = time.Unix(0, int64(seconds*float64(time.Second)))
+		}
+		if i == 0 {
+			first = t
+		}
+		if offsets[i] = t.Sub(first); i > 0 && offsets[i] < offsets[i-1] {
+			return nil, fmt.Errorf("row %d of %s is earlier than the row before", i+1, name)
+		}
+	}
+	return offsets, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/spf13/viper"
+)
+
+func resetReplayTables(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := replayTables
+	replayTables = make(map[string]*replayTable)
+	t.Cleanup(func() { replayTables = saved })
+}
+
+func writeReplayCSV(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "field.csv")
+	data := "time,sensor_001,inlet\n" +
+		"2024-07-01T00:00:00Z,20.5,1\n" +
+		"2024-07-01T00:00:10Z,21.0,2\n" +
+		"2024-07-01T00:00:20Z,21.5,3\n"
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestReplayGeneratorRows(t *testing.T) {
+	resetReplayTables(t)
+	file := writeReplayCSV(t)
+
+	tests := []struct {
+		spec map[string]any
+		want []float64
+	}{
+		{map[string]any{}, []float64{20.5, 21, 21.5, 20.5}},
+		{map[string]any{"column": "inlet", "mode": "once"}, []float64{1, 2, 3, 3}},
+	}
+	for _, tt := range tests {
+		tt.spec["type"], tt.spec["file"] = "replay", file
+		viper.Set("channels.temperature.generator", tt.spec)
+		generator, err := newValueGenerator(testSensor(1, "temperature"))
+		if err != nil {
+			t.Fatalf("Error creating generator: %v", err)
+		}
+		for i, want := range tt.want {
+			if got := generator.Next(testStart); got != want {
+				t.Errorf("%v: expected sample %d to be %f, got %f", tt.spec, i, want, got)
+			}
+		}
+	}
+}
+
+func TestReplayGeneratorTimed(t *testing.T) {
+	resetReplayTables(t)
+	viper.Set("channels.temperature.generator", map[string]any{
+		"type":        "replay",
+		"file":        writeReplayCSV(t),
+		"time-column": "time",
+		"speed":       2,
+	})
+	generator, err := newValueGenerator(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+
+	// At double speed, rows come every 5s and the loop lasts 15s.
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{0, 20.5},
+		{4 * time.Second, 20.5},
+		{5 * time.Second, 21},
+		{12 * time.Second, 21.5},
+		{16 * time.Second, 20.5},
+	} {
+		if got := generator.Next(testStart.Add(tt.at)); got != tt.want {
+			t.Errorf("At %v: expected %f, got %f", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestReplayGeneratorParquet(t *testing.T) {
+	resetReplayTables(t)
+	type row struct {
+		Time   time.Time `parquet:"time,timestamp(millisecond)"`
+		Sensor float64   `parquet:"sensor_001"`
+	}
+	file := filepath.Join(t.TempDir(), "field.parquet")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	err = parquet.Write(f, []row{{start, 1.25}, {start.Add(time.Second), 2.5}})
+	f.Close()
+	if err != nil {
+		t.Fatalf("Error writing Parquet file: %v", err)
+	}
+
+	viper.Set("channels.temperature.generator", map[string]any{"type": "replay", "file": file, "time-column": "time"})
+	generator, err := newValueGenerator(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	if got := generator.Next(testStart.Add(1500 * time.Millisecond)); got != 2.5 {
+		t.Errorf("Expected the second row at 1.5s, got %f", got)
+	}
+}
+
+func TestReplayGeneratorErrors(t *testing.T) {
+	resetReplayTables(t)
+	file := writeReplayCSV(t)
+
+	for _, spec := range []map[string]any{
+		{"type": "replay"},
+		{"type": "replay", "file": "missing.csv"},
+		{"type": "replay", "file": file, "column": "outlet"},
+		{"type": "replay", "file": file, "mode": "shuffle"},
+		{"type": "replay", "file": file, "time-column": "inlet", "speed": 0},
+		{"type": "replay", "file": file, "format": "xlsx"},
+	} {
+		viper.Set("channels.temperature.generator", spec)
+		if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// scenarioEvent is a timed change to the readings of some sensors, read from
+// the scenario file. At and Duration are measured from the start of the
+// simulation; an event without a duration lasts until the end of the run.
+//
+// Actions:
+//
+//	step:     add value to the readings, e.g. to raise a baseline
+//	setpoint: replace the readings with value
+//	script:   call the on_event hook of script generators with event
+//	alarm:    drive the readings across an alarm threshold and back
+//	quality:  degrade the sensors' links by loss dB and/or force the
+//	          quality code of the readings to quality (see linkQualityFor)
+//	start:    keep the sensors silent until at
+//	stop:     keep the sensors silent, dropping their samples
+//	fault:    put the sensors into a fault: stuck (default), repeating
+//	          their value, invalid, reading NaN, or any other of the
+//	          faults that can be triggered at runtime (see applyFaults)
+//	rate:     publish at rate Hz instead of the sensors' own rates
+//
+// An alarm event ramps the readings over ramp from their own value to
+// margin (default hysteresis) beyond threshold, above it or below it as
+// direction is high or low, and holds them there for dwell. Then it ramps
+// them back over the threshold to margin beyond the other edge of the
+// hysteresis band, so that the alarm clears, holds them there for dwell
+// and ramps back to their own value. Without a dwell the alarm is held
+// until the end of the run.
+type scenarioEvent struct {
+	At       time.Duration `mapstructure:"at"`
+	Duration time.Duration `mapstructure:"duration"`
+	Sensor   string        `mapstructure:"sensor"`  // sensor ID or glob, e.g. sensor_00*
+	Channel  string        `mapstructure:"channel"` // all sensors of a channel
+	Action   string        `mapstructure:"action"`
+	Value    float64       `mapstructure:"value"`
+	Event    string        `mapstructure:"event"` // event name for the script action
+
+	Threshold  float64       `mapstructure:"threshold"`
+	Hysteresis float64       `mapstructure:"hysteresis"`
+	Margin     float64       `mapstructure:"margin"`
+	Direction  string        `mapstructure:"direction"` // high (default) or low
+	Ramp       time.Duration `mapstructure:"ramp"`
+	Dwell      time.Duration `mapstructure:"dwell"`
+
+	Quality string  `mapstructure:"quality"` // GOOD, UNCERTAIN or BAD
+	Loss    float64 `mapstructure:"loss"`    // link degradation in dB
+
+	Fault string  `mapstructure:"fault"` // kind of fault for the fault action
+	Rate  float64 `mapstructure:"rate"`  // publish rate in Hz for the rate action
+}
+
+// scenario holds the events of the scenario file, if one is loaded.
+var scenario []scenarioEvent
+
+// loadScenario reads the events of a scenario file, sorted by time.
+func loadScenario(file string) ([]scenarioEvent, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading scenario file: %w", err)
+	}
+
+	var events []scenarioEvent
+	if err := v.UnmarshalKey("events", &events); err != nil {
+		return nil, fmt.Errorf("parsing scenario file: %w", err)
+	}
+	for i, event := range events {
+		switch event.Action {
+		case "step", "setpoint", "script", "start", "stop":
+		case "alarm":
+			if err := events[i].checkAlarm(); err != nil {
+				return nil, fmt.Errorf("scenario event %d: %w", i+1, err)
+			}
+		case "quality":
+			if event.Quality != "" && !isQualityCode(event.Quality) {
+				return nil, fmt.Errorf("scenario event %d: unknown quality code %q", i+1, event.Quality)
+			}
+			if event.Loss < 0 {
+				return nil, fmt.Errorf("scenario event %d: loss must not be negative", i+1)
+			}
+		case "fault":
+			switch {
+			case event.Fault == "":
+				events[i].Fault = "stuck"
+			case event.Fault != "invalid" && !slices.Contains(runtimeFaults, event.Fault):
+				return nil, fmt.Errorf("scenario event %d: unknown fault %q", i+1, event.Fault)
+			}
+		case "rate":
+			if event.Rate <= 0 {
+				return nil, fmt.Errorf("scenario event %d: rate must be greater than 0", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("scenario event %d: unknown action %q", i+1, event.Action)
+		}
+		if _, err := path.Match(event.Sensor, ""); err != nil {
+			return nil, fmt.Errorf("scenario event %d: bad sensor pattern %q", i+1, event.Sensor)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+	return events, nil
+}
+
+// matches reports whether the event applies to a sensor. Events that name
+// neither a sensor nor a channel apply to all sensors.
+func (e scenarioEvent) matches(sensor sensorInfo) bool {
+	if e.Channel != "" && e.Channel != sensor.Channel {
+		return false
+	}
+	if e.Sensor != "" {
+		matched, _ := path.Match(e.Sensor, sensor.ID)
+		return matched
+	}
+	return true
+}
+
+// active reports whether the event is in effect at elapsed time into the
+// simulation.
+func (e scenarioEvent) active(elapsed time.Duration) bool {
+	return elapsed >= e.At && (e.Duration <= 0 || elapsed < e.At+e.Duration)
+}
+
+// end returns the time the event ends for a simulation started at start,
+// or a time far in the future if it lasts until the end of the run.
+func (e scenarioEvent) end(start time.Time) time.Time {
+	if e.Duration <= 0 {
+		return start.Add(math.MaxInt64)
+	}
+	return start.Add(e.At + e.Duration)
+}
+
+// scenarioRate returns the publish rate the scenario sets for a sensor at
+// elapsed time into the simulation, or 0 if it sets none. Of several rate
+// events in effect, the latest one wins.
+func scenarioRate(sensor sensorInfo, elapsed time.Duration) float64 {
+	var rate float64
+	for _, event := range scenario {
+		if event.Action == "rate" && event.matches(sensor) && event.active(elapsed) {
+			rate = event.Rate
+		}
+	}
+	return rate
+}
+
+// checkAlarm validates the parameters of an alarm event, filling in the
+// defaults.
+func (e *scenarioEvent) checkAlarm() error {
+	switch e.Direction {
+	case "":
+		e.Direction = "high"
+	case "high", "low":
+	default:
+		return fmt.Errorf("unknown alarm direction %q", e.Direction)
+	}
+	if e.Hysteresis < 0 || e.Margin < 0 || e.Ramp < 0 || e.Dwell < 0 {
+		return fmt.Errorf("alarm hysteresis, margin, ramp and dwell must not be negative")
+	}
+	if e.Margin == 0 {
+		e.Margin = e.Hysteresis
+	}
+	if e.Margin == 0 {
+		return fmt.Errorf("alarm margin or hysteresis must be set")
+	}
+	return nil
+}
+
+// alarm returns the reading an alarm event turns value into at elapsed
+// time into the simulation.
+func (e scenarioEvent) alarm(value float64, elapsed time.Duration) float64 {
+	sign := 1.0
+	if e.Direction == "low" {
+		sign = -1
+	}
+	raise := e.Threshold + sign*e.Margin
+	clear := e.Threshold - sign*(e.Hysteresis+e.Margin)
+
+	// ramp moves from one level to another over the ramp time, starting
+	// at time into the event.
+	in := elapsed - e.At
+	ramp := func(from, to float64, start time.Duration) float64 {
+		if e.Ramp <= 0 {
+			return to
+		}
+		f := float64(in-start) / float64(e.Ramp)
+		return from + f*(to-from)
+	}
+	switch {
+	case in < 0:
+		return value
+	case in < e.Ramp:
+		return ramp(value, raise, 0)
+	case e.Dwell <= 0 || in < e.Ramp+e.Dwell:
+		return raise
+	case in < 2*e.Ramp+e.Dwell:
+		return ramp(raise, clear, e.Ramp+e.Dwell)
+	case in < 2*e.Ramp+2*e.Dwell:
+		return clear
+	case in < 3*e.Ramp+2*e.Dwell:
+		return ramp(clear, value, 2*e.Ramp+2*e.Dwell)
+	}
+	return value
+}
+
+// applyScenario layers the scenario events for a sensor over its generator.
+func applyScenario(sensor sensorInfo, generator ValueGenerator) ValueGenerator {
+	var events []scenarioEvent
+	for _, event := range scenario {
+		if event.matches(sensor) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return generator
+	}
+
+	return generatorFunc(func(t time.Time) float64 {
+		value := generator.Next(t)
+		elapsed := t.Sub(sensor.Start)
+		for _, event := range events {
+			switch {
+			case event.Action == "alarm":
+				value = event.alarm(value, elapsed)
+				continue
+			case event.Action == "start" && elapsed < event.At:
+				sensor.Notes.Drop = true
+				continue
+			}
+			if !event.active(elapsed) {
+				continue
+			}
+			switch event.Action {
+			case "step":
+				value += event.Value
+			case "setpoint":
+				value = event.Value
+			case "quality":
+				sensor.Notes.LinkLoss += event.Loss
+				if event.Quality != "" {
+					sensor.Notes.Quality = event.Quality
+				}
+			case "stop":
+				sensor.Notes.Drop = true
+			case "fault":
+				if event.Fault == "invalid" {
+					value = math.NaN()
+					sensor.Notes.Fault = "invalid"
+				} else {
+					// Runtime faults are applied over the scenario, so the
+					// fault takes effect with this sample.
+					sensor.Faults.trigger(event.Fault, event.end(sensor.Start))
+				}
+			}
+		}
+		return value
+	})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// writeScenario writes a scenario file and returns its path.
+func writeScenario(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadScenario(t *testing.T) {
+	events, err := loadScenario(writeScenario(t, `
+events:
+  - at: 20m
+    sensor: sensor_00*
+    action: setpoint
+    value: 0
+  - at: 10m
+    channel: pressure
+    action: step
+    value: 0.15
+`))
+	if err != nil {
+		t.Fatalf("Error loading scenario: %v", err)
+	}
+	if len(events) != 2 || events[0].At != 10*time.Minute || events[0].Channel != "pressure" || events[1].Sensor != "sensor_00*" {
+		t.Errorf("Unexpected events %+v", events)
+	}
+
+	if _, err := loadScenario(writeScenario(t, "events:\n  - at: 1m\n    action: explode\n")); err == nil {
+		t.Errorf("Expected an error for an unknown action")
+	}
+}
+
+func TestScenarioStepChanges(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { scenario = nil })
+	constantGenerator("pressure", 1)
+	scenario = []scenarioEvent{
+		{At: 10 * time.Minute, Channel: "pressure", Action: "step", Value: 0.15},
+		{At: 20 * time.Minute, Duration: 5 * time.Minute, Sensor: "sensor_001", Action: "setpoint", Value: 0.5},
+		{At: 30 * time.Minute, Channel: "temperature", Action: "step", Value: 10},
+	}
+
+	generator, err := newValueGenerator(testSensor(1, "pressure"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{5 * time.Minute, 1},
+		{10 * time.Minute, 1.15},
+		{22 * time.Minute, 0.5},
+		{40 * time.Minute, 1.15},
+	} {
+		if got := generator.Next(testStart.Add(tt.at)); !approxEqual(got, tt.want) {
+			t.Errorf("At %v: expected %f, got %f", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestScenarioAlarm(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { scenario = nil })
+	constantGenerator("temperature", 50)
+
+	events, err := loadScenario(writeScenario(t, `
+events:
+  - at: 1m
+    channel: temperature
+    action: alarm
+    threshold: 80
+    hysteresis: 2
+    ramp: 10s
+    dwell: 30s
+  - at: 10m
+    channel: temperature
+    action: alarm
+    direction: low
+    threshold: 40
+    margin: 1
+`))
+	if err != nil {
+		t.Fatalf("Error loading scenario: %v", err)
+	}
+	scenario = events
+	generator, err := newValueGenerator(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{59 * time.Second, 50},
+		{65 * time.Second, 66}, // halfway up to 82
+		{70 * time.Second, 82},
+		{99 * time.Second, 82},
+		{105 * time.Second, 79}, // halfway down to 76
+		{110 * time.Second, 76}, // below the hysteresis band, clearing the alarm
+		{139 * time.Second, 76},
+		{145 * time.Second, 63},
+		{150 * time.Second, 50},
+		{10 * time.Minute, 39},
+		{time.Hour, 39},
+	} {
+		if got := generator.Next(testStart.Add(tt.at)); !approxEqual(got, tt.want) {
+			t.Errorf("At %v: expected %f, got %f", tt.at, tt.want, got)
+		}
+	}
+
+	for _, event := range []string{
+		"action: alarm\n    threshold: 80",
+		"action: alarm\n    threshold: 80\n    hysteresis: 1\n    direction: sideways",
+		"action: alarm\n    threshold: 80\n    margin: 1\n    dwell: -1s",
+	} {
+		if _, err := loadScenario(writeScenario(t, "events:\n  - at: 1m\n    "+event+"\n")); err == nil {
+			t.Errorf("Expected an error for %q", event)
+		}
+	}
+}
+
+func TestScenarioSensorControl(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { scenario = nil })
+	constantGenerator("pressure", 1)
+
+	events, err := loadScenario(writeScenario(t, `
+events:
+  - at: 1m
+    sensor: sensor_001
+    action: start
+  - at: 5m
+    duration: 1m
+    channel: pressure
+    action: stop
+  - at: 10m
+    duration: 1m
+    channel: pressure
+    action: fault
+    fault: invalid
+  - at: 15m
+    duration: 1m
+    channel: pressure
+    action: step
+    value: 1
+  - at: 15m30s
+    duration: 1m
+    channel: pressure
+    action: fault
+  - at: 20m
+    duration: 5m
+    channel: pressure
+    action: rate
+    rate: 10
+  - at: 22m
+    duration: 1m
+    sensor: sensor_001
+    action: rate
+    rate: 0.5
+`))
+	if err != nil {
+		t.Fatalf("Error loading scenario: %v", err)
+	}
+	scenario = events
+	sensor := testSensor(1, "pressure")
+	generator, err := newValueGenerator(sensor)
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at    time.Duration
+		want  float64
+		drop  bool
+		fault string
+	}{
+		{30 * time.Second, 1, true, ""},
+		{2 * time.Minute, 1, false, ""},
+		{5 * time.Minute, 1, true, ""},
+		{6 * time.Minute, 1, false, ""},
+		{10 * time.Minute, math.NaN(), false, "invalid"},
+		{15 * time.Minute, 2, false, ""},
+		{15*time.Minute + 45*time.Second, 2, false, "stuck"},
+		{16*time.Minute + 15*time.Second, 2, false, "stuck"},
+		{17 * time.Minute, 1, false, ""},
+	} {
+		*sensor.Notes = sampleNotes{}
+		got := generator.Next(testStart.Add(tt.at))
+		if !approxEqual(got, tt.want) && !(math.IsNaN(got) && math.IsNaN(tt.want)) {
+			t.Errorf("At %v: expected %f, got %f", tt.at, tt.want, got)
+		}
+		if sensor.Notes.Drop != tt.drop || sensor.Notes.Fault != tt.fault {
+			t.Errorf("At %v: expected drop %v and fault %q, got %+v", tt.at, tt.drop, tt.fault, *sensor.Notes)
+		}
+	}
+
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{19 * time.Minute, 0},
+		{21 * time.Minute, 10},
+		{22 * time.Minute, 0.5},
+		{24 * time.Minute, 10},
+	} {
+		if got := scenarioRate(sensor, tt.at); got != tt.want {
+			t.Errorf("At %v: expected a rate of %g Hz, got %g", tt.at, tt.want, got)
+		}
+	}
+
+	for _, event := range []string{"action: fault\n    fault: melted", "action: rate"} {
+		if _, err := loadScenario(writeScenario(t, "events:\n  - "+event+"\n")); err == nil {
+			t.Errorf("Expected an error for %q", event)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// schema is a JSON Schema (draft 2020-12) document or subschema.
+type schema = map[string]any
+
+// listKeys are the settings read with configList, which take a list or a
+// comma-separated string.
+var listKeys = []string{"config", "include", "plugins", "sinks", "channel-names"}
+
+var (
+	rateSchema     = schema{"type": "number", "exclusiveMinimum": 0}
+	durationSchema = schema{"type": []any{"string", "integer"}, "pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|^0$`}
+	objectSchema   = schema{"type": "object"}
+	listSchema     = schema{"type": []any{"string", "array"}, "items": schema{"type": "string"}}
+	generatorBlock = schema{"type": "object", "properties": schema{"type": schema{"type": "string"}}}
+	modifiersBlock = schema{"type": "array", "items": schema{
+		"type":       "object",
+		"properties": schema{"type": schema{"type": "string"}},
+		"required":   []any{"type"},
+	}}
+)
+
+// channelSchema is the schema of channels.<channel>.
+var channelSchema = schema{
+	"type": "object",
+	"properties": schema{
+		"min":            schema{"type": "number"},
+		"max":            schema{"type": "number"},
+		"weight":         schema{"type": "number", "minimum": 0},
+		"count":          schema{"type": "integer", "minimum": 0},
+		"metadata":       objectSchema,
+		"unit":           schema{"type": "string"},
+		"convert-to":     schema{"type": "string"},
+		"kind":           schema{"enum": []any{"number", "boolean", "enum", "text"}},
+		"distribution":   schema{"type": "string"},
+		"enum":           schema{"type": "array"},
+		"messages":       schema{"type": "array"},
+		"boolean-format": schema{"enum": []any{"number", "bool"}},
+		"generator":      generatorBlock,
+		"modifiers":      modifiersBlock,
+		"rate":           rateSchema,
+		"min-rate":       rateSchema,
+		"max-rate":       rateSchema,
+		"rate-profile":   objectSchema,
+		"rate-schedule":  objectSchema,
+		"jitter":         schema{},
+	},
+}
+
+// sensorSchema is the schema of sensors.<id>.
+var sensorSchema = schema{
+	"type": "object",
+	"properties": schema{
+		"channel":       schema{"type": "string"},
+		"diu":           schema{"type": "string"},
+		"site":          schema{"type": "string"},
+		"min":           schema{"type": "number"},
+		"max":           schema{"type": "number"},
+		"metadata":      objectSchema,
+		"generator":     generatorBlock,
+		"modifiers":     modifiersBlock,
+		"rate":          rateSchema,
+		"min-rate":      rateSchema,
+		"max-rate":      rateSchema,
+		"rate-profile":  objectSchema,
+		"rate-schedule": objectSchema,
+		"jitter":        schema{},
+	},
+}
+
+// diuSchema is the schema of a DIU of a site, and of a device model.
+var diuSchema = schema{
+	"type": "object",
+	"properties": schema{
+		"model":     schema{"type": "string"},
+		"instances": schema{"type": "integer", "minimum": 0},
+		"metadata":  objectSchema,
+		"sensors":   schema{"type": "object", "additionalProperties": sensorSchema},
+		"count":     schema{"type": "integer", "minimum": 0},
+		"channels":  schema{"type": "array", "items": schema{"type": "string"}},
+		"rate":      rateSchema,
+		"min-rate":  rateSchema,
+		"max-rate":  rateSchema,
+	},
+}
+
+// blockSchemas are the schemas of the settings that are not set by flags.
+var blockSchemas = schema{
+	"include":  listSchema,
+	"profiles": schema{"type": "object", "additionalProperties": schema{"$ref": "#"}},
+	"channels": schema{"type": "object", "additionalProperties": channelSchema},
+	"sensors":  schema{"type": "object", "additionalProperties": sensorSchema},
+	"models":   schema{"type": "object", "additionalProperties": diuSchema},
+	"sites": schema{"type": "object", "additionalProperties": schema{
+		"type": "object",
+		"properties": schema{
+			"metadata": objectSchema,
+			"dius":     schema{"type": "object", "additionalProperties": diuSchema},
+		},
+	}},
+	"metadata": objectSchema,
+	"derived": schema{"type": "array", "items": schema{
+		"type": "object",
+		"properties": schema{
+			"id":         schema{"type": "string"},
+			"channel":    schema{"type": "string"},
+			"expression": schema{"type": "string"},
+		},
+		"required": []any{"id", "expression"},
+	}},
+	"derived-interval": durationSchema,
+}
+
+var (
+	configSchemaOnce sync.Once
+	configSchemaDoc  schema
+)
+
+// configSchema returns the JSON Schema of the config file. It is generated
+// from the flags, which give the types of the settings they set, and the
+// schemas of the blocks, such as channels and sensors, that no flag sets;
+// the other known keys (see configKeys) are described as settings of any
+// type. Unknown keys are allowed, as validate reports them separately.
+func configSchema() schema {
+	configSchemaOnce.Do(func() {
+		root := schema{
+			"$schema":    "https://json-schema.org/draft/2020-12/schema",
+			"title":      "diu_sim configuration",
+			"type":       "object",
+			"properties": schema{},
+		}
+		properties := root["properties"].(schema)
+		for _, key := range configKeys {
+			properties[key] = schema{}
+		}
+		cmd := newRootCommand()
+		visit := func(f *pflag.Flag) {
+			if key, ok := flagConfigKeys[f.Name]; ok {
+				setSchemaProperty(root, strings.Split(key, "."), flagSchema(f, key))
+			}
+		}
+		cmd.PersistentFlags().VisitAll(visit)
+		cmd.Flags().VisitAll(visit)
+		for key, s := range blockSchemas {
+			properties[key] = s
+		}
+		configSchemaDoc = root
+	})
+	return configSchemaDoc
+}
+
+// flagSchema returns the schema of the setting key that the flag f sets.
+func flagSchema(f *pflag.Flag, key string) schema {
+	var s schema
+	switch f.Value.Type() {
+	case "int", "int64":
+		s = schema{"type": "integer"}
+	case "float64":
+		s = schema{"type": "number"}
+	case "bool":
+		s = schema{"type": "boolean"}
+	case "duration":
+		s = maps.Clone(durationSchema)
+	default:
+		if slices.Contains(listKeys, key) {
+			s = maps.Clone(listSchema)
+		} else {
+			s = schema{"type": "string"}
+		}
+	}
+	s["description"] = f.Usage
+	return s
+}
+
+// setSchemaProperty sets the schema of the property at path below s,
+// making the properties on the way objects.
+func setSchemaProperty(s schema, path []string, property schema) {
+	for _, key := range path[:len(path)-1] {
+		properties, _ := s["properties"].(schema)
+		if properties == nil {
+			properties = schema{}
+			s["type"], s["properties"] = "object", properties
+		}
+		next, _ := properties[key].(schema)
+		if next == nil {
+			next = schema{}
+			properties[key] = next
+		}
+		s = next
+	}
+	properties, _ := s["properties"].(schema)
+	if properties == nil {
+		properties = schema{}
+		s["type"], s["properties"] = "object", properties
+	}
+	properties[path[len(path)-1]] = property
+}
+
+// schemaViolation is a value of a config file that does not match the
+// schema, at the path of segments, keys and list indexes.
+type schemaViolation struct {
+	path    []string
+	message string
+}
+
+// pathString returns a path as a config key, e.g. channels.temperature.min
+// or derived[0].id.
+func pathString(path []string) string {
+	var b strings.Builder
+	for _, segment := range path {
+		if strings.HasPrefix(segment, "[") {
+			b.WriteString(segment)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+// validateSchema checks a value, decoded from a config file, against the
+// schema s of root, appending the violations found to violations. It
+// supports the parts of JSON Schema that configSchema uses.
+func validateSchema(root, s schema, value any, path []string, violations *[]schemaViolation) {
+	if ref, ok := s["$ref"]; ok && ref == "#" {
+		s = root
+	}
+	if types, ok := s["type"]; ok && !matchesType(types, value) {
+		*violations = append(*violations, schemaViolation{path, fmt.Sprintf("expected %s, got %s", typeNames(types), jsonType(value))})
+		return
+	}
+	if enum, ok := s["enum"].([]any); ok && !slices.Contains(enum, value) {
+		*violations = append(*violations, schemaViolation{path, fmt.Sprintf("expected one of %v, got %v", enum, value)})
+	}
+	if n, ok := toNumber(value); ok {
+		if min, ok := s["minimum"]; ok && n < float64(min.(int)) {
+			*violations = append(*violations, schemaViolation{path, fmt.Sprintf("must be at least %v, got %v", min, value)})
+		}
+		if min, ok := s["exclusiveMinimum"]; ok && n <= float64(min.(int)) {
+			*violations = append(*violations, schemaViolation{path, fmt.Sprintf("must be greater than %v, got %v", min, value)})
+		}
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		if str, ok := value.(string); ok && !regexp.MustCompile(pattern).MatchString(str) {
+			*violations = append(*violations, schemaViolation{path, fmt.Sprintf("%q is not a valid value", str)})
+		}
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := s["properties"].(schema)
+		additional, _ := s["additionalProperties"].(schema)
+		for _, key := range sortedKeys(v) {
+			if property, ok := properties[key].(schema); ok {
+				validateSchema(root, property, v[key], append(slices.Clip(path), key), violations)
+			} else if additional != nil {
+				validateSchema(root, additional, v[key], append(slices.Clip(path), key), violations)
+			}
+		}
+		if required, ok := s["required"].([]any); ok {
+			for _, key := range required {
+				if _, ok := v[key.(string)]; !ok {
+					*violations = append(*violations, schemaViolation{path, fmt.Sprintf("%s must be set", key)})
+				}
+			}
+		}
+	case []any:
+		if items, ok := s["items"].(schema); ok {
+			for i, item := range v {
+				validateSchema(root, items, item, append(slices.Clip(path), fmt.Sprintf("[%d]", i)), violations)
+			}
+		}
+	}
+}
+
+func matchesType(types, value any) bool {
+	if list, ok := types.([]any); ok {
+		for _, t := range list {
+			if matchesType(t, value) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t := jsonType(value); types {
+	case "number":
+		return t == "integer" || t == "number"
+	default:
+		return t == types
+	}
+}
+
+func typeNames(types any) string {
+	if list, ok := types.([]any); ok {
+		names := make([]string, len(list))
+		for i, t := range list {
+			names[i] = fmt.Sprint(t)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(types)
+}
+
+// jsonType returns the JSON Schema type of a decoded value.
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func toNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// checkConfigFile checks a config file against the config schema, and
+// returns the violations found with the lines they are on, for YAML and
+// JSON files; TOML files are checked without lines.
+func checkConfigFile(path string) ([]validationIssue, error) {
+	var value any
+	var lines func([]string) int
+	if configType(path) == "toml" {
+		v := viper.New()
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("reading config file %s: %w", path, err)
+		}
+		value = normalizeConfigValue(v.AllSettings())
+		lines = func([]string) int { return 0 }
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// JSON is YAML, so both are decoded as YAML, keeping the lines.
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("reading config file %s: %w", path, err)
+		}
+		if len(doc.Content) == 0 {
+			return nil, nil
+		}
+		var decoded any
+		if err := doc.Content[0].Decode(&decoded); err != nil {
+			return nil, fmt.Errorf("reading config file %s: %w", path, err)
+		}
+		value = normalizeConfigValue(decoded)
+		lines = func(path []string) int { return yamlLine(doc.Content[0], path) }
+	}
+
+	root := configSchema()
+	var violations []schemaViolation
+	validateSchema(root, root, value, nil, &violations)
+	issues := make([]validationIssue, len(violations))
+	for i, v := range violations {
+		issues[i] = validationIssue{File: path, Line: lines(v.path), Path: pathString(v.path), Message: v.message}
+	}
+	return issues, nil
+}
+
+// normalizeConfigValue converts a decoded config file to the values
+// validateSchema checks: maps with lowercase string keys, as viper reads
+// them, and times as strings.
+func normalizeConfigValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[strings.ToLower(key)] = normalizeConfigValue(item)
+		}
+		return m
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[strings.ToLower(fmt.Sprint(key))] = normalizeConfigValue(item)
+		}
+		return m
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = normalizeConfigValue(item)
+		}
+		return list
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case int64:
+		return int(v)
+	}
+	return value
+}
+
+// yamlLine returns the line of the key or list item at path in a YAML
+// document, or of the nearest enclosing one found.
+func yamlLine(node *yaml.Node, path []string) int {
+	line := node.Line
+	for _, segment := range path {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if strings.EqualFold(node.Content[i].Value, segment) {
+					line, next = node.Content[i].Line, node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			var i int
+			if _, err := fmt.Sscanf(segment, "[%d]", &i); err == nil && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
+
+// writeConfigSchema writes the config schema as indented JSON.
+func writeConfigSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(configSchema())
+}
+
+// sortIssues sorts issues by file and line, and otherwise as text.
+func sortIssues(issues []validationIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.String() < b.String()
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestConfigSchemaCoversKeys(t *testing.T) {
+	properties := configSchema()["properties"].(schema)
+	for _, key := range configKeys {
+		if _, ok := properties[key]; !ok {
+			t.Errorf("Expected %s in the config schema", key)
+		}
+	}
+	for _, tt := range []struct {
+		block schema
+		keys  []string
+	}{
+		{channelSchema, channelConfigKeys},
+		{sensorSchema, sensorConfigKeys},
+	} {
+		for _, key := range tt.keys {
+			if _, ok := tt.block["properties"].(schema)[key]; !ok {
+				t.Errorf("Expected %s in the schema of its block", key)
+			}
+		}
+	}
+	if s := properties["redis"].(schema)["properties"].(schema)["db"].(schema); s["type"] != "integer" {
+		t.Errorf("Expected redis.db typed by its flag, got %v", s)
+	}
+
+	// The schema is valid JSON.
+	var out bytes.Buffer
+	if err := writeConfigSchema(&out); err != nil || !json.Valid(out.Bytes()) {
+		t.Errorf("Expected the schema written as JSON, got error %v", err)
+	}
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	content := `num-sensors: ten
+min-rate: 2
+channels:
+  temperature:
+    min: low
+    rate: 0
+    kind: analog
+batch: {window: soon, size: 10}
+derived:
+  - id: delta
+    expression: sensor("a")
+  - {id: sum}
+profiles:
+  load: {max-rate: fast}
+`
+	if err := os.WriteFile(yamlFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	issues, err := checkConfigFile(yamlFile)
+	if err != nil {
+		t.Fatalf("Error checking config file: %v", err)
+	}
+	sortIssues(issues)
+	var got []string
+	for _, issue := range issues {
+		got = append(got, strings.TrimPrefix(issue.String(), dir+string(filepath.Separator)))
+	}
+	want := []string{
+		"config.yaml:1: num-sensors: expected integer, got string",
+		"config.yaml:5: channels.temperature.min: expected number, got string",
+		"config.yaml:6: channels.temperature.rate: must be greater than 0, got 0",
+		"config.yaml:7: channels.temperature.kind: expected one of [number boolean enum text], got analog",
+		`config.yaml:8: batch.window: "soon" is not a valid value`,
+		"config.yaml:12: derived[1]: expression must be set",
+		"config.yaml:14: profiles.load.max-rate: expected number, got string",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected the violations\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	jsonFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(jsonFile, []byte("{\n  \"sinks\": [\"sse\"],\n  \"redis\": {\n    \"db\": \"one\"\n  }\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	issues, err = checkConfigFile(jsonFile)
+	if err != nil || len(issues) != 1 || issues[0].Line != 4 || issues[0].Path != "redis.db" {
+		t.Errorf("Expected redis.db on line 4 reported, got %v (%v)", issues, err)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	resetBatteries(t)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	viper.Set("sinks", "syslog")
+	viper.Set("unknown-setting", 1)
+
+	var out bytes.Buffer
+	if code := runValidate(&out, 2, 1, 5, false, false, true); code != 0 {
+		t.Fatalf("Expected a valid config, got exit status %d:\n%s", code, out.String())
+	}
+	var report struct {
+		Valid    bool
+		Errors   []validationIssue
+		Warnings []validationIssue
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Error decoding report: %v\n%s", err, out.String())
+	}
+	if !report.Valid || report.Errors == nil || len(report.Warnings) != 1 || report.Warnings[0].Message != "unknown key unknown-setting" {
+		t.Errorf("Expected a valid report with one warning, got %+v", report)
+	}
+}
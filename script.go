@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// newScriptGenerator computes values with a Starlark
+// (https://github.com/bazelbuild/starlark) script, given inline as script
+// or in a file. The script defines
+//
+//	generate(sensor, t, state) -> value
+//
+// where sensor has the fields id, channel, diu and index, t is the time in
+// seconds since the simulation started and state is a dict the script can
+// keep its own state in between calls. Optional hooks:
+//
+//	setup(sensor, state)               called once before the first value
+//	on_event(sensor, event, t, state)  called when a scenario event with
+//	                                   the script action fires
+//
+// Besides the Starlark built-ins, scripts can use the math module,
+// random() and gauss(mu, sigma), and sensor_value(source, lag=0) to read
+// another sensor as the follow generator does.
+//
+// Each sensor runs its own instance of the script. Module-level values are
+// frozen once the script has loaded, so mutable state belongs in state.
+func newScriptGenerator(spec generatorSpec, sensor sensorInfo) (ValueGenerator, error) {
+	filename, src := spec.str("file", ""), spec.str("script", "")
+	switch {
+	case filename != "" && src != "":
+		return nil, fmt.Errorf("script generator for %s: set either file or script, not both", sensor.ID)
+	case filename != "":
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("script generator for %s: %w", sensor.ID, err)
+		}
+		src = string(data)
+	case src != "":
+		filename = sensor.ID + ".star"
+	default:
+		return nil, fmt.Errorf("script generator for %s: file or script must be set", sensor.ID)
+	}
+
+	thread := &starlark.Thread{
+		Name:  sensor.ID,
+		Print: func(_ *starlark.Thread, msg string) { log.Printf("%s: %s", sensor.ID, msg) },
+	}
+	var now time.Time
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, filename, src, scriptBuiltins(sensor, &now))
+	if err != nil {
+		return nil, fmt.Errorf("script generator for %s: %w", sensor.ID, err)
+	}
+	function := spec.str("function", "generate")
+	generate, ok := globals[function].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script generator for %s: the script does not define %s", sensor.ID, function)
+	}
+
+	info := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"id":      starlark.String(sensor.ID),
+		"channel": starlark.String(sensor.Channel),
+		"diu":     starlark.String(sensor.DIU),
+		"index":   starlark.MakeInt(sensor.Index),
+	})
+	state := starlark.NewDict(0)
+	if setup, ok := globals["setup"].(starlark.Callable); ok {
+		if _, err := starlark.Call(thread, setup, starlark.Tuple{info, state}, nil); err != nil {
+			return nil, fmt.Errorf("script generator for %s: %w", sensor.ID, err)
+		}
+	}
+
+	onEvent, _ := globals["on_event"].(starlark.Callable)
+	var events []scenarioEvent // pending script events, in time order
+	if onEvent != nil {
+		for _, event := range scenario {
+			if event.Action == "script" && event.matches(sensor) {
+				events = append(events, event)
+			}
+		}
+	}
+
+	var (
+		value  float64
+		failed bool
+	)
+	return generatorFunc(func(t time.Time) float64 {
+		now = t
+		elapsed := starlark.Float(t.Sub(sensor.Start).Seconds())
+		var err error
+		for ; len(events) > 0 && events[0].At <= t.Sub(sensor.Start) && err == nil; events = events[1:] {
+			_, err = starlark.Call(thread, onEvent, starlark.Tuple{info, starlark.String(events[0].Event), elapsed, state}, nil)
+		}
+		var result starlark.Value
+		if err == nil {
+			result, err = starlark.Call(thread, generate, starlark.Tuple{info, elapsed, state}, nil)
+		}
+		if err == nil {
+			if v, ok := starlark.AsFloat(result); ok {
+				value = v
+				return value
+			}
+			err = fmt.Errorf("%s returned %s, not a number", function, result.Type())
+		}
+		// Keep the previous value, reporting the error only once rather
+		// than on every sample.
+		if !failed {
+			log.Printf("Error running script for %s: %v", sensor.ID, err)
+			failed = true
+		}
+		return value
+	}), nil
+}
+
+// scriptBuiltins returns the predeclared names of sensor scripts. now points
+// at the time of the sample being generated.
+func scriptBuiltins(sensor sensorInfo, now *time.Time) starlark.StringDict {
+	sources := make(map[string]string) // source parameters resolved to sensor IDs
+	return starlark.StringDict{
+		"math": math.Module,
+		"random": starlark.NewBuiltin("random", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			return starlark.Float(sensor.Rand.Float64()), nil
+		}),
+		"gauss": starlark.NewBuiltin("gauss", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var mu, sigma starlark.Float
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "mu", &mu, "sigma", &sigma); err != nil {
+				return nil, err
+			}
+			return starlark.Float(float64(mu) + sensor.Rand.NormFloat64()*float64(sigma)), nil
+		}),
+		"sensor_value": starlark.NewBuiltin("sensor_value", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var source string
+			var lagSeconds starlark.Float
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "source", &source, "lag?", &lagSeconds); err != nil {
+				return nil, err
+			}
+			id, ok := sources[source]
+			if !ok {
+				if id, ok = signals.resolve(source, sensor); !ok {
+					return starlark.Float(0), nil
+				}
+				sources[source] = id
+			}
+			lag := time.Duration(float64(lagSeconds) * float64(time.Second))
+			signals.watch(id, lag)
+			value, _ := signals.valueAt(id, now.Add(-lag))
+			return starlark.Float(value), nil
+		}),
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const testScript = `
+def setup(sensor, state):
+    state["level"] = 10 * sensor.index
+
+def on_event(sensor, event, t, state):
+    if event == "reset":
+        state["level"] = 0
+
+def generate(sensor, t, state):
+    state["level"] += 1
+    return state["level"] + math.floor(t)
+`
+
+func TestScriptGenerator(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := scenario
+	scenario = []scenarioEvent{{At: 5 * time.Second, Channel: "temperature", Action: "script", Event: "reset"}}
+	t.Cleanup(func() { scenario = saved })
+
+	file := filepath.Join(t.TempDir(), "level.star")
+	if err := os.WriteFile(file, []byte(testScript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("channels.temperature.generator", map[string]any{"type": "script", "file": file})
+
+	generator, err := newValueGenerator(testSensor(2, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{0, 21},
+		{time.Second, 23},
+		{5500 * time.Millisecond, 6}, // reset, then 1 + 5
+		{6 * time.Second, 8},
+	} {
+		if got := generator.Next(testStart.Add(tt.at)); got != tt.want {
+			t.Errorf("At %v: expected %f, got %f", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestScriptGeneratorInline(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.pressure.generator", map[string]any{
+		"type":   "script",
+		"script": "def generate(sensor, t, state):\n    return gauss(1.0, 0.0) if sensor.channel == 'pressure' else 0\n",
+	})
+
+	generator, err := newValueGenerator(testSensor(1, "pressure"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	if got := generator.Next(testStart); got != 1 {
+		t.Errorf("Expected 1, got %f", got)
+	}
+}
+
+func TestScriptGeneratorErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	for _, spec := range []map[string]any{
+		{"type": "script"},
+		{"type": "script", "script": "def generate(:"},
+		{"type": "script", "script": "x = 1"},
+		{"type": "script", "file": "missing.star"},
+		{"type": "script", "script": "def generate(sensor, t, state):\n    return 1\n", "file": "level.star"},
+	} {
+		viper.Set("channels.temperature.generator", spec)
+		if _, err := newValueGenerator(testSensor(1, "temperature")); err == nil {
+			t.Errorf("Expected an error for %v", spec)
+		}
+	}
+
+	// Runtime errors keep the previous value.
+	viper.Set("channels.temperature.generator", map[string]any{
+		"type":   "script",
+		"script": "def generate(sensor, t, state):\n    return 5 if t < 1 else 'high'\n",
+	})
+	generator, err := newValueGenerator(testSensor(1, "temperature"))
+	if err != nil {
+		t.Fatalf("Error creating generator: %v", err)
+	}
+	generator.Next(testStart)
+	if got := generator.Next(testStart.Add(time.Second)); got != 5 {
+		t.Errorf("Expected the previous value after an error, got %f", got)
+	}
+}
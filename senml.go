@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// senmlRecord is a SenML record. The CBOR keys are the integer labels from
+// RFC 8428 section 6.
+type senmlRecord struct {
+	BaseName string  `json:"bn,omitempty" cbor:"-2,keyasint,omitempty"`
+	BaseTime float64 `json:"bt,omitempty" cbor:"-3,keyasint,omitempty"`
+	Name     string  `json:"n,omitempty" cbor:"0,keyasint,omitempty"`
+	Unit     string  `json:"u,omitempty" cbor:"1,keyasint,omitempty"`
+	Value    float64 `json:"v" cbor:"2,keyasint"`
+	Time     float64 `json:"t,omitempty" cbor:"6,keyasint,omitempty"`
+
+	// Anomaly is the type of anomaly injected into the reading, an
+	// extension label set when anomaly labels are embedded in readings.
+	Anomaly string `json:"anomaly,omitempty" cbor:"anomaly,omitempty"`
+}
+
+// senmlPack converts readings from one DIU into a SenML pack. The first
+// record carries the DIU as base name and the first reading's time as base
+// time; each record is then named <sensor_id>:<channel> with its time
+// relative to the base time.
+func senmlPack(readings []Reading) []senmlRecord {
+	pack := make([]senmlRecord, len(readings))
+
+	var baseTime time.Time
+	for i, r := range readings {
+		t, _ := time.Parse(time.RFC3339Nano, r.Timestamp)
+		record := senmlRecord{
+			Name:    r.SensorID + ":" + r.Channel,
+			Unit:    senmlUnit(r),
+			Value:   r.Value,
+			Anomaly: r.AnomalyType,
+		}
+		if i == 0 {
+			baseTime = t
+			record.BaseName = r.DIU + ":"
+			record.BaseTime = float64(t.UnixNano()) / 1e9
+		} else {
+			record.Time = t.Sub(baseTime).Seconds()
+		}
+		pack[i] = record
+	}
+	return pack
+}
+
+func encodeSenMLJSON(r Reading) (Message, error) {
+	body, err := json.Marshal(senmlPack([]Reading{r}))
+	return Message{Body: body, ContentType: "application/senml+json"}, err
+}
+
+func encodeSenMLCBOR(r Reading) (Message, error) {
+	body, err := cbor.Marshal(senmlPack([]Reading{r}))
+	return Message{Body: body, ContentType: "application/senml+cbor"}, err
+}
+
+func encodeSenMLJSONBatch(rs []Reading) (Message, error) {
+	body, err := json.Marshal(senmlPack(rs))
+	return Message{Body: body, ContentType: "application/senml+json"}, err
+}
+
+func encodeSenMLCBORBatch(rs []Reading) (Message, error) {
+	body, err := cbor.Marshal(senmlPack(rs))
+	return Message{Body: body, ContentType: "application/senml+cbor"}, err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func TestSenMLPack(t *testing.T) {
+	second := testReading
+	second.SensorID = "sensor_002"
+	second.Channel = "temperature"
+	second.Timestamp = "2024-07-01T12:00:00.5Z"
+	second.Value = 27.5
+
+	pack := senmlPack([]Reading{testReading, second})
+	if pack[0].BaseName != "diu_000:" || pack[0].BaseTime != 1719835200 {
+		t.Errorf("Unexpected base fields: %+v", pack[0])
+	}
+	if pack[0].Name != "sensor_001:pressure" || pack[0].Unit != "bar" || pack[0].Value != 1.05 {
+		t.Errorf("Unexpected first record: %+v", pack[0])
+	}
+	if pack[1].BaseName != "" || pack[1].Name != "sensor_002:temperature" || pack[1].Unit != "Cel" || math.Abs(pack[1].Time-0.5) > 1e-9 {
+		t.Errorf("Unexpected second record: %+v", pack[1])
+	}
+}
+
+func TestSenMLEncodings(t *testing.T) {
+	msg, err := encodeSenMLJSON(testReading)
+	if err != nil {
+		t.Fatalf("Error encoding SenML JSON: %v", err)
+	}
+	if want := `[{"bn":"diu_000:","bt":1719835200,"n":"sensor_001:pressure","u":"bar","v":1.05}]`; string(msg.Body) != want {
+		t.Errorf("Unexpected SenML JSON %s", msg.Body)
+	}
+	var records []senmlRecord
+	if err := json.Unmarshal(msg.Body, &records); err != nil {
+		t.Errorf("SenML JSON does not round trip: %v", err)
+	}
+
+	msg, err = encodeSenMLCBOR(testReading)
+	if err != nil {
+		t.Fatalf("Error encoding SenML CBOR: %v", err)
+	}
+	var labelled []map[int]interface{}
+	if err := cbor.Unmarshal(msg.Body, &labelled); err != nil {
+		t.Fatalf("Error decoding SenML CBOR: %v", err)
+	}
+	if labelled[0][-2] != "diu_000:" || labelled[0][0] != "sensor_001:pressure" || labelled[0][2] != 1.05 {
+		t.Errorf("Expected integer SenML labels, got %v", labelled[0])
+	}
+
+	spike := testReading
+	spike.Anomaly, spike.AnomalyType = true, "spike"
+	msg, _ = encodeSenMLJSON(spike)
+	if want := `[{"bn":"diu_000:","bt":1719835200,"n":"sensor_001:pressure","u":"bar","v":1.05,"anomaly":"spike"}]`; string(msg.Body) != want {
+		t.Errorf("Unexpected labelled SenML JSON %s", msg.Body)
+	}
+	msg, _ = encodeSenMLCBOR(spike)
+	var spikes []map[any]any
+	if err := cbor.Unmarshal(msg.Body, &spikes); err != nil || spikes[0]["anomaly"] != "spike" {
+		t.Errorf("Expected the anomaly label in SenML CBOR, got %v, %v", spikes, err)
+	}
+}
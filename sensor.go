@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// simulationStart is the time the simulation started. Time-based generators
+// measure their periods and schedules from it.
+var simulationStart = time.Now()
+
+// simulatedSensor is one simulated sensor with its value generator.
+type simulatedSensor struct {
+	info      sensorInfo
+	name      string
+	generator ValueGenerator
+	unit      string                // unit readings are reported in
+	convert   func(float64) float64 // from the generator's unit to unit
+	booleans  bool                  // values are written as false/true
+	labels    map[int]string        // enum labels by code
+	messages  map[int]string        // status message texts by code
+
+	// Publish rate range of the sensor or its channel, overriding the
+	// global one when set, the rate profile overriding both and the rate
+	// schedule overriding all while it lasts. Config reloads change them
+	// while the sensor runs.
+	ratesMu              sync.Mutex
+	minRate, maxRate     float64
+	rates                *rateProfile
+	schedule             *rateSchedule
+	globalMin, globalMax float64
+	rateRand             *rand.Rand // draws rates from the range
+
+	last atomic.Pointer[SensorData] // data of the last reading published
+
+	// The sensor skips its samples while it is paused itself or the
+	// simulation it runs in, whose pause switch is simPaused, is.
+	paused    atomic.Bool
+	simPaused *atomic.Bool
+
+	// Static metadata, sent with the readings if embedMetadata is set and
+	// announced on registryChannel when the sensor starts if the registry
+	// is enabled.
+	metadata        map[string]string
+	embedMetadata   bool
+	registryChannel string
+
+	battery *battery     // battery of the sensor's DIU, if it has one
+	quality *linkQuality // set when quality fields are enabled
+	clock   *diuClock    // clock of the sensor's DIU, if it is off true time
+	jitter  *timingJitter
+
+	// How anomaly labels are published: embedded in the readings and/or
+	// as a parallel stream of labelled readings on labelsChannel.
+	embedLabels   bool
+	streamLabels  bool
+	labelsChannel string
+}
+
+// newSimulatedSensor sets up the index-th of the sensors generated in bulk,
+// sensor_000 onwards by default, which are assigned to the channels by
+// weightedChannel.
+func newSimulatedSensor(index int) (*simulatedSensor, error) {
+	return newConfiguredSensor(index, bulkSensorID(index), weightedChannel(channelNames(), index))
+}
+
+// bulkSensorID returns the ID of the index-th sensor generated in bulk,
+// named by the sensor ID template after its index, its channel and DIU.
+func bulkSensorID(index int) string {
+	return bulkSensorName(index, weightedChannel(channelNames(), index), diuID(index), "")
+}
+
+// bulkSensorName expands the sensor ID template for the index-th sensor
+// generated in bulk on a channel, DIU and site.
+func bulkSensorName(index int, channel, diu, site string) string {
+	return expandNaming(sensorIDTemplate(), namingVars{Channel: channel, Index: index, DIU: diu, Site: site})
+}
+
+// definedSensorIDs returns the IDs of the sensors defined explicitly in
+// the config, in addition to the numSensors generated in bulk: the
+// entries of sensors that set a channel, e.g.
+//
+//	sensors:
+//	  inlet_temp:
+//	    channel: temperature
+//	    diu: diu_pump
+//	    rate: 1               # or min-rate and max-rate
+//	    min: -20
+//	    max: 60
+//	    generator: {type: walk, step: 0.2}
+//	    metadata: {location: pump room, model: PT100}
+//
+// Entries for the sensors generated in bulk configure them instead, and
+// can change their channel and DIU the same way. Viper lowercases the
+// IDs, so sensor ID templates with capitals cannot be configured this
+// way. Defined sensors are sorted by ID.
+func definedSensorIDs(numSensors int) []string {
+	bulk := make(map[string]bool, numSensors)
+	for i := 0; i < numSensors; i++ {
+		bulk[strings.ToLower(bulkSensorID(i))] = true
+	}
+	var ids []string
+	for id := range viper.GetStringMap("sensors") {
+		if bulk[id] {
+			continue
+		}
+		if viper.GetString("sensors."+id+".channel") != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// newConfiguredSensor sets up a sensor with the given index, ID and
+// default channel, which sensors.<id>.channel and diu override.
+func newConfiguredSensor(index int, id, channel string) (*simulatedSensor, error) {
+	key := "sensors." + id
+	if c := viper.GetString(key + ".channel"); c != "" {
+		channel = c
+	}
+	diu := viper.GetString(key + ".diu")
+	if diu == "" {
+		diu = diuID(index)
+	}
+	info := sensorInfo{
+		Index:   index,
+		ID:      id,
+		Channel: channel,
+		DIU:     diu,
+		Site:    viper.GetString(key + ".site"),
+		Start:   simulationStart,
+		Rand:    sensorRand(index, "values"),
+		Notes:   &sampleNotes{},
+		Faults:  &faultTriggers{},
+	}
+
+	generator, err := newValueGenerator(info)
+	if err != nil {
+		return nil, err
+	}
+	return newSensor(info, generator)
+}
+
+// newSensor sets up a sensor that generates its values with generator,
+// registering it on the signal bus.
+func newSensor(info sensorInfo, generator ValueGenerator) (*simulatedSensor, error) {
+	signals.register(info)
+
+	channel := info.Channel
+	s := &simulatedSensor{
+		info:          info,
+		name:          sensorName(channel, info),
+		generator:     generator,
+		labelsChannel: viper.GetString("anomalies.labels-channel"),
+	}
+	switch mode := viper.GetString("anomalies.labels"); mode {
+	case "", "embed":
+		s.embedLabels = true
+	case "stream":
+		s.streamLabels = true
+	case "both":
+		s.embedLabels, s.streamLabels = true, true
+	case "none":
+	default:
+		return nil, fmt.Errorf("unknown anomaly labels mode %q", mode)
+	}
+	if s.labelsChannel == "" {
+		s.labelsChannel = "labels"
+	}
+	s.rateRand = sensorRand(info.Index, "rate")
+	if err := s.loadRates(); err != nil {
+		return nil, err
+	}
+	var err error
+	if s.metadata, err = sensorMetadata(info); err != nil {
+		return nil, err
+	}
+	s.embedMetadata = !viper.IsSet("registry.in-readings") || viper.GetBool("registry.in-readings")
+	s.registryChannel = registryChannel()
+	if s.battery, err = batteryFor(info.DIU, info.Start); err != nil {
+		return nil, err
+	}
+	if s.quality, err = linkQualityFor(info); err != nil {
+		return nil, err
+	}
+	if s.clock, err = clockFor(info.DIU, info.Start); err != nil {
+		return nil, err
+	}
+	if s.jitter, err = jitterFor(info); err != nil {
+		return nil, err
+	}
+	unit, reported, err := channelUnits(channel)
+	if err != nil {
+		return nil, err
+	}
+	s.unit = reported
+	if s.convert, err = unitConverter(unit, reported); err != nil {
+		return nil, err
+	}
+
+	kind, err := channelKind(channel)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "boolean":
+		switch format := viper.GetString("channels." + channel + ".boolean-format"); format {
+		case "", "number":
+		case "bool":
+			s.booleans = true
+		default:
+			return nil, fmt.Errorf("channel %s: unknown boolean format %q", channel, format)
+		}
+	case "enum":
+		catalog, err := enumCatalog(channel)
+		if err != nil {
+			return nil, err
+		}
+		s.labels = make(map[int]string, len(catalog))
+		for _, value := range catalog {
+			s.labels[value.code] = value.label
+		}
+	case "text":
+		catalog, err := messageCatalog(channel)
+		if err != nil {
+			return nil, err
+		}
+		s.messages = make(map[int]string, len(catalog))
+		for _, message := range catalog {
+			s.messages[message.code] = message.text
+		}
+	}
+	return s, nil
+}
+
+// loadRates reads the sensor's publish rate settings from the config.
+func (s *simulatedSensor) loadRates() error {
+	minRate, maxRate, err := channelRates(s.info.Channel)
+	if err != nil {
+		return err
+	}
+	if low, high, err := configuredRates("sensors."+s.info.ID, "sensor "+s.info.ID); err != nil {
+		return err
+	} else if low > 0 {
+		minRate, maxRate = low, high
+	}
+	rates, err := rateProfileFor(s.info)
+	if err != nil {
+		return err
+	}
+	schedule, err := rateScheduleFor(s.info)
+	if err != nil {
+		return err
+	}
+
+	s.ratesMu.Lock()
+	defer s.ratesMu.Unlock()
+	s.minRate, s.maxRate, s.rates, s.schedule = minRate, maxRate, rates, schedule
+	return nil
+}
+
+// setGlobalRates sets the global publish rate range, which applies to the
+// sensor unless its own or its channel's overrides it.
+func (s *simulatedSensor) setGlobalRates(minRate, maxRate float64) {
+	s.ratesMu.Lock()
+	defer s.ratesMu.Unlock()
+	s.globalMin, s.globalMax = minRate, maxRate
+}
+
+// sensorRand returns the random source of one of a sensor's streams of
+// random numbers, such as its values or its publish rate. With a seed set,
+// it is derived from the seed, the sensor's index and the stream, so that
+// every run draws the same numbers; otherwise it is seeded from the clock.
+func sensorRand(index int, stream string) *rand.Rand {
+	if seed := viper.GetInt64("seed"); seed != 0 {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%d/%d/%s", seed, index, stream)
+		return rand.New(rand.NewSource(int64(h.Sum64())))
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano() + int64(index)))
+}
+
+// channelRates returns the publish rate range configured for a channel with
+// channels.<channel>.rate, or min-rate and max-rate, or zeros if there is
+// none. If only one of min-rate and max-rate is set, the channel publishes
+// at that fixed rate.
+func channelRates(channel string) (minRate, maxRate float64, err error) {
+	return configuredRates("channels."+channel, "channel "+channel)
+}
+
+// configuredRates returns the publish rate range configured under key,
+// with a fixed rate or min-rate and max-rate, or zeros if there is none.
+// what names the channel or sensor in errors.
+func configuredRates(key, what string) (minRate, maxRate float64, err error) {
+	if viper.IsSet(key + ".rate") {
+		rate := viper.GetFloat64(key + ".rate")
+		if rate <= 0 {
+			return 0, 0, fmt.Errorf("%s: rate must be greater than 0", what)
+		}
+		return rate, rate, nil
+	}
+	minRate, maxRate = viper.GetFloat64(key+".min-rate"), viper.GetFloat64(key+".max-rate")
+	if !viper.IsSet(key+".min-rate") && !viper.IsSet(key+".max-rate") {
+		return 0, 0, nil
+	}
+	if !viper.IsSet(key + ".max-rate") {
+		maxRate = minRate
+	} else if !viper.IsSet(key + ".min-rate") {
+		minRate = maxRate
+	}
+	if minRate <= 0 || maxRate <= 0 {
+		return 0, 0, fmt.Errorf("%s: min-rate and max-rate must be greater than 0", what)
+	}
+	if minRate > maxRate {
+		return 0, 0, fmt.Errorf("%s: min-rate cannot be greater than max-rate", what)
+	}
+	return minRate, maxRate, nil
+}
+
+// triggerFault puts the sensor into a fault of the given kind, such as
+// stuck, for duration d from now.
+func (s *simulatedSensor) triggerFault(kind string, d time.Duration) {
+	s.info.Faults.trigger(kind, time.Now().Add(d))
+}
+
+// sample generates the reading taken at time t. Other sensors see its
+// value in the generator's unit, before any unit conversion.
+func (s *simulatedSensor) sample(t time.Time, sequence uint64) Reading {
+	*s.info.Notes = sampleNotes{}
+	value := s.generator.Next(t)
+	if s.battery != nil {
+		if soc, _ := s.battery.read(t); soc <= 0 {
+			s.info.Notes.Drop = true
+		}
+	}
+	signals.record(s.info.ID, t, value)
+	value = s.convert(value)
+
+	var samples []float64
+	if s.info.Notes.Samples != nil {
+		samples = make([]float64, len(s.info.Notes.Samples))
+		for i, v := range s.info.Notes.Samples {
+			samples[i] = s.convert(v)
+		}
+	}
+
+	stamp := t
+	if s.clock != nil {
+		stamp = s.clock.at(t)
+	}
+	if s.jitter != nil {
+		stamp = s.jitter.stamp(stamp)
+	}
+
+	var label, text string
+	if !math.IsNaN(value) {
+		label = s.labels[int(math.Round(value))]
+		text = s.messages[int(math.Round(value))]
+	}
+
+	data := SensorData{
+		SensorID:    s.info.ID,
+		Channel:     s.info.Channel,
+		Timestamp:   stamp.Format(time.RFC3339Nano),
+		Value:       value,
+		Unit:        s.unit,
+		Boolean:     s.booleans,
+		Label:       label,
+		Text:        text,
+		Position:    s.info.Notes.Position,
+		Samples:     samples,
+		Anomaly:     s.info.Notes.Anomaly != "",
+		AnomalyType: s.info.Notes.Anomaly,
+	}
+	if s.embedMetadata {
+		data.Metadata = s.metadata
+	}
+	if s.quality != nil {
+		var rssi, snr float64
+		data.Quality, rssi, snr = s.quality.assess(s.info.Notes, value)
+		data.RSSI, data.SNR = &rssi, &snr
+	}
+
+	return Reading{
+		SensorData: data,
+		Name:       s.name,
+		DIU:        s.info.DIU,
+		Site:       s.info.Site,
+		Index:      s.info.Index,
+		Sequence:   sequence,
+	}
+}
+
+// publish sends a reading to the sink, with its anomaly labels embedded
+// and/or followed by a labelled copy on the labels channel.
+func (s *simulatedSensor) publish(ctx context.Context, sink Sink, reading Reading) error {
+	label := reading
+	if !s.embedLabels {
+		reading.Anomaly, reading.AnomalyType = false, ""
+	}
+	err := sink.Publish(ctx, reading)
+
+	if s.streamLabels && label.Anomaly && !errors.Is(err, errLimitReached) {
+		label.Channel = s.labelsChannel
+		label.Name = sensorName(s.labelsChannel, s.info)
+		label.auxiliary = true
+		if labelErr := sink.Publish(ctx, label); labelErr != nil && err == nil {
+			err = labelErr
+		}
+	}
+	return err
+}
+
+// emit publishes a reading just sampled, unless the sample was dropped.
+func (s *simulatedSensor) emit(ctx context.Context, sink Sink, reading Reading) {
+	if s.info.Notes.Drop {
+		log.Printf("Dropped sample %d of %s\n", reading.Sequence, s.name)
+		return
+	}
+	switch err := s.publish(ctx, sink, reading); {
+	case errors.Is(err, errLimitReached):
+		// The simulation is stopping at its message limit.
+	case err != nil:
+		log.Printf("Error publishing data for %s: %v\n", s.name, err)
+	default:
+		data := reading.SensorData
+		s.last.Store(&data)
+		if s.battery != nil {
+			s.battery.transmit()
+		}
+		log.Printf("Published data for %s to channel %s: %s\n", s.name, s.info.Channel, formatMessage(reading))
+	}
+}
+
+// rateRange returns the publish rate range of the sensor at t: the rate
+// set by the scenario, that of its rate schedule while it lasts, that of
+// its rate profile, its own or its channel's
+// if it has one, or else minRate to maxRate.
+func (s *simulatedSensor) rateRange(t time.Time, minRate, maxRate float64) (float64, float64) {
+	if rate := scenarioRate(s.info, t.Sub(s.info.Start)); rate > 0 {
+		return rate, rate
+	}
+	s.ratesMu.Lock()
+	defer s.ratesMu.Unlock()
+	if s.schedule != nil {
+		if minRate, maxRate, ok := s.schedule.at(t.Sub(s.info.Start)); ok {
+			return minRate, maxRate
+		}
+	}
+	switch {
+	case s.rates != nil:
+		return s.rates.at(t)
+	case s.minRate > 0:
+		return s.minRate, s.maxRate
+	}
+	return minRate, maxRate
+}
+
+// currentRates returns the publish rate range of the sensor now, with the
+// global range set by setGlobalRates.
+func (s *simulatedSensor) currentRates() (float64, float64) {
+	s.ratesMu.Lock()
+	minRate, maxRate := s.globalMin, s.globalMax
+	s.ratesMu.Unlock()
+	return s.rateRange(time.Now(), minRate, maxRate)
+}
+
+// isPaused reports whether the sensor is skipping its samples.
+func (s *simulatedSensor) isPaused() bool {
+	return s.paused.Load() || s.simPaused != nil && s.simPaused.Load()
+}
+
+// run publishes readings at a rate drawn for every sample from the
+// sensor's rate range (see rateRange), with minRate to maxRate as the
+// global range until setGlobalRates changes it, until ctx is cancelled.
+// With timing jitter, each reading is sent after its send delay. Samples
+// are skipped while the sensor is paused.
+func (s *simulatedSensor) run(ctx context.Context, sink Sink, minRate, maxRate float64) {
+	s.setGlobalRates(minRate, maxRate)
+	nextRate := func() float64 {
+		low, high := s.currentRates()
+		return low + s.rateRand.Float64()*(high-low)
+	}
+
+	// Start with an initial rate
+	rate := nextRate()
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+
+	var sequence uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.isPaused() {
+			continue
+		}
+		sequence++
+		reading := s.sample(time.Now(), sequence)
+
+		// Calculate and set the next tick duration
+		rate = nextRate()
+		nextTickDuration := time.Duration(float64(time.Second) / rate)
+		ticker.Reset(nextTickDuration)
+
+		if s.jitter != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.jitter.delay()):
+			}
+		}
+		// A sample taken as the simulation stopped is not published.
+		if ctx.Err() != nil {
+			return
+		}
+		s.emit(ctx, sink, reading)
+	}
+}
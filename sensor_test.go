@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestSensorAnomalyLabels(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	constantGenerator("pressure", 1)
+	viper.Set("channels.pressure.modifiers", []any{
+		map[string]any{"type": "anomaly", "probability": 1, "magnitude": 1, "direction": "up"},
+	})
+
+	for _, tt := range []struct {
+		mode          string
+		readings      int
+		embedded      bool
+		labelsChannel string
+	}{
+		{"embed", 1, true, ""},
+		{"stream", 2, false, "labels"},
+		{"none", 1, false, ""},
+	} {
+		viper.Set("anomalies.labels", tt.mode)
+		sensor, err := newSimulatedSensor(1)
+		if err != nil {
+			t.Fatalf("Error creating sensor: %v", err)
+		}
+		reading := sensor.sample(time.Now(), 1)
+		if reading.Value != 2 || !reading.Anomaly || reading.AnomalyType != "spike" {
+			t.Fatalf("Expected a labelled spike, got %+v", reading)
+		}
+
+		sink := &recordingSink{}
+		if err := sensor.publish(context.Background(), sink, reading); err != nil {
+			t.Fatalf("Error publishing: %v", err)
+		}
+		if len(sink.readings) != tt.readings {
+			t.Fatalf("%s: expected %d readings, got %d", tt.mode, tt.readings, len(sink.readings))
+		}
+		if sink.readings[0].Anomaly != tt.embedded {
+			t.Errorf("%s: expected embedded label %v, got %+v", tt.mode, tt.embedded, sink.readings[0])
+		}
+		if tt.labelsChannel != "" && (sink.readings[1].Channel != tt.labelsChannel || !sink.readings[1].Anomaly) {
+			t.Errorf("%s: expected a labelled reading on %s, got %+v", tt.mode, tt.labelsChannel, sink.readings[1])
+		}
+	}
+}
+
+func TestUserDefinedChannels(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channel-names", "voltage,current")
+	viper.Set("channels.voltage", map[string]any{"min": 228, "max": 232, "unit": "V", "min-rate": 10})
+	viper.Set("channels.current", map[string]any{"min-rate": 1, "max-rate": 2})
+
+	voltage, err := newSimulatedSensor(2)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	reading := voltage.sample(time.Now(), 1)
+	if reading.Channel != "voltage" || reading.Name != "voltage:sensor_002" || reading.Unit != "V" {
+		t.Errorf("Expected a voltage reading in V, got %+v", reading)
+	}
+	if reading.Value < 228 || reading.Value > 232 {
+		t.Errorf("Expected a voltage between 228 and 232, got %f", reading.Value)
+	}
+	if voltage.minRate != 10 || voltage.maxRate != 10 {
+		t.Errorf("Expected a fixed rate of 10 Hz, got %g to %g", voltage.minRate, voltage.maxRate)
+	}
+
+	current, err := newSimulatedSensor(3)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if current.info.Channel != "current" || current.minRate != 1 || current.maxRate != 2 {
+		t.Errorf("Expected a current sensor at 1 to 2 Hz, got %s at %g to %g", current.info.Channel, current.minRate, current.maxRate)
+	}
+
+	viper.Set("channels.current.max-rate", 0.5)
+	if _, err := newSimulatedSensor(3); err == nil {
+		t.Errorf("Expected an error for min-rate above max-rate")
+	}
+}
+
+func TestSeededSensors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("seed", 42)
+	viper.Set("channels.temperature.modifiers", []any{
+		map[string]any{"type": "anomaly", "kind": "spike", "probability": 0.3},
+	})
+
+	samples := func(index int) []Reading {
+		s, err := newSimulatedSensor(index)
+		if err != nil {
+			t.Fatalf("Error creating sensor: %v", err)
+		}
+		readings := make([]Reading, 20)
+		for i := range readings {
+			readings[i] = s.sample(testStart.Add(time.Duration(i)*time.Second), uint64(i))
+		}
+		return readings
+	}
+	first, second, other := samples(0), samples(0), samples(3)
+	for i := range first {
+		if first[i].Value != second[i].Value || first[i].AnomalyType != second[i].AnomalyType {
+			t.Fatalf("Sample %d differs between runs with the same seed: %+v and %+v", i, first[i], second[i])
+		}
+	}
+	if first[0].Value == other[0].Value {
+		t.Errorf("Expected sensors to draw different numbers, both got %f", first[0].Value)
+	}
+	if sensorRand(0, "rate").Int63() != sensorRand(0, "rate").Int63() || sensorRand(0, "rate").Int63() == sensorRand(0, "values").Int63() {
+		t.Errorf("Expected reproducible and independent random streams")
+	}
+}
+
+func TestRateProfiles(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.rate-profile", map[string]any{
+		"timezone": "UTC",
+		"rates": []any{
+			map[string]any{"at": "18:00", "rate": 1},
+			map[string]any{"at": "08:00", "min-rate": 8, "max-rate": 12},
+		},
+	})
+	viper.Set("sensors.sensor_003.rate-profile", map[string]any{
+		"period":   "weekly",
+		"timezone": "UTC",
+		"rates": []any{
+			map[string]any{"at": "Mon 00:00", "rate": 5},
+			map[string]any{"at": "Sat 00:00", "rate": 0.1},
+		},
+	})
+
+	day := time.Date(2024, 7, 6, 0, 0, 0, 0, time.UTC) // a Saturday
+	tests := []struct {
+		index            int
+		at               time.Duration
+		minRate, maxRate float64
+	}{
+		{0, 3 * time.Hour, 1, 1}, // carried over from 18:00 the day before
+		{0, 8 * time.Hour, 8, 12},
+		{0, 20 * time.Hour, 1, 1},
+		{3, 12 * time.Hour, 0.1, 0.1},
+		{3, 60 * time.Hour, 5, 5}, // Monday noon
+		{1, 12 * time.Hour, 2, 4}, // pressure has no profile
+	}
+	for _, tt := range tests {
+		s, err := newSimulatedSensor(tt.index)
+		if err != nil {
+			t.Fatalf("Error creating sensor: %v", err)
+		}
+		if minRate, maxRate := s.rateRange(day.Add(tt.at), 2, 4); minRate != tt.minRate || maxRate != tt.maxRate {
+			t.Errorf("%s at %v: expected %g to %g Hz, got %g to %g", s.info.ID, tt.at, tt.minRate, tt.maxRate, minRate, maxRate)
+		}
+	}
+
+	for _, profile := range []map[string]any{
+		{"rates": []any{}},
+		{"rates": []any{map[string]any{"at": "25:00", "rate": 1}}},
+		{"rates": []any{map[string]any{"at": "08:00"}}},
+		{"rates": []any{map[string]any{"at": "08:00", "min-rate": 3, "max-rate": 2}}},
+		{"period": "hourly", "rates": []any{map[string]any{"at": "08:00", "rate": 1}}},
+	} {
+		viper.Set("channels.temperature.rate-profile", profile)
+		if _, err := newSimulatedSensor(0); err == nil {
+			t.Errorf("Expected an error for %v", profile)
+		}
+	}
+}
+
+func TestRateSchedules(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("channels.temperature.rate-profile", map[string]any{
+		"rates": []any{map[string]any{"at": "00:00", "rate": 3}},
+	})
+	viper.Set("channels.temperature.rate-schedule", map[string]any{
+		"rates": []any{
+			map[string]any{"duration": "10m", "rate": 1},
+			map[string]any{"duration": "5m", "min-rate": 15, "max-rate": 25},
+		},
+	})
+	viper.Set("sensors.sensor_001.rate-schedule", map[string]any{
+		"repeat": true,
+		"rates": []any{
+			map[string]any{"duration": "1m", "rate": 0.5},
+			map[string]any{"duration": "1m", "rate": 5},
+		},
+	})
+
+	tests := []struct {
+		index            int
+		at               time.Duration
+		minRate, maxRate float64
+	}{
+		{0, 0, 1, 1},
+		{0, 10 * time.Minute, 15, 25},
+		{0, 20 * time.Minute, 3, 3}, // the rate profile, once the schedule is over
+		{1, 30 * time.Second, 0.5, 0.5},
+		{1, 90 * time.Second, 5, 5},
+		{1, 150 * time.Second, 0.5, 0.5}, // repeated
+		{2, 0, 2, 4},                     // humidity has no schedule
+	}
+	for _, tt := range tests {
+		s, err := newSimulatedSensor(tt.index)
+		if err != nil {
+			t.Fatalf("Error creating sensor: %v", err)
+		}
+		if minRate, maxRate := s.rateRange(s.info.Start.Add(tt.at), 2, 4); minRate != tt.minRate || maxRate != tt.maxRate {
+			t.Errorf("%s at %v: expected %g to %g Hz, got %g to %g", s.info.ID, tt.at, tt.minRate, tt.maxRate, minRate, maxRate)
+		}
+	}
+
+	for _, schedule := range []map[string]any{
+		{"rates": []any{}},
+		{"rates": []any{map[string]any{"rate": 1}}},
+		{"rates": []any{map[string]any{"duration": "1m"}}},
+		{"rates": []any{map[string]any{"duration": "1m", "min-rate": 3, "max-rate": 2}}},
+	} {
+		viper.Set("channels.temperature.rate-schedule", schedule)
+		if _, err := newSimulatedSensor(0); err == nil {
+			t.Errorf("Expected an error for %v", schedule)
+		}
+	}
+}
+
+func TestDefinedSensors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("sensors", map[string]any{
+		"inlet_temp": map[string]any{
+			"channel":   "temperature",
+			"diu":       "diu_pump",
+			"rate":      0.5,
+			"min":       40,
+			"max":       41,
+			"metadata":  map[string]any{"location": "pump room"},
+			"modifiers": []any{},
+		},
+		"outlet_flow": map[string]any{"channel": "flow", "min-rate": 1, "max-rate": 3},
+		"sensor_001":  map[string]any{"channel": "humidity", "diu": "diu_lab"},
+		"sensor_009":  map[string]any{"generator": map[string]any{"type": "walk"}},
+	})
+
+	if ids := definedSensorIDs(4); !slices.Equal(ids, []string{"inlet_temp", "outlet_flow"}) {
+		t.Errorf("Expected the sensors with a channel outside the bulk ones, got %v", ids)
+	}
+	if ids := definedSensorIDs(1); !slices.Equal(ids, []string{"inlet_temp", "outlet_flow", "sensor_001"}) {
+		t.Errorf("Expected sensor_001 to be defined once it is not generated in bulk, got %v", ids)
+	}
+
+	inlet, err := newConfiguredSensor(4, "inlet_temp", "")
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	reading := inlet.sample(testStart, 1)
+	if reading.SensorID != "inlet_temp" || reading.Channel != "temperature" || reading.DIU != "diu_pump" {
+		t.Errorf("Expected inlet_temp on temperature of diu_pump, got %+v", reading)
+	}
+	if reading.Value < 40 || reading.Value > 41 || reading.Metadata["location"] != "pump room" {
+		t.Errorf("Expected a value between 40 and 41 with its metadata, got %+v", reading)
+	}
+	if inlet.minRate != 0.5 || inlet.maxRate != 0.5 {
+		t.Errorf("Expected a fixed rate of 0.5 Hz, got %g to %g", inlet.minRate, inlet.maxRate)
+	}
+
+	bulk, err := newSimulatedSensor(1)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if bulk.info.Channel != "humidity" || bulk.info.DIU != "diu_lab" {
+		t.Errorf("Expected sensor_001 moved to humidity on diu_lab, got %s on %s", bulk.info.Channel, bulk.info.DIU)
+	}
+
+	viper.Set("sensors.outlet_flow.rate", 0)
+	if _, err := newConfiguredSensor(5, "outlet_flow", ""); err == nil {
+		t.Errorf("Expected an error for a rate of 0")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"go.bug.st/serial"
+)
+
+// Frame delimiters for the stx-etx framing.
+const (
+	serialSTX = 0x02
+	serialETX = 0x03
+)
+
+// serialSink writes framed readings to a serial port, emulating a DIU
+// talking to a gateway over RS-232/RS-485.
+type serialSink struct {
+	port    serial.Port
+	framing string
+	encoder Encoder
+
+	mu sync.Mutex
+}
+
+func newSerialSink() (*serialSink, error) {
+	device := viper.GetString("serial.device")
+	if device == "" {
+		return nil, fmt.Errorf("serial.device must be set")
+	}
+
+	framing := viper.GetString("serial.framing")
+	if _, err := frameMessage(framing, nil); err != nil {
+		return nil, err
+	}
+
+	encoder, err := newEncoder("serial", false)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := serialMode()
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := serial.Open(device, mode)
+	if err != nil {
+		return nil, fmt.Errorf("opening serial port %s: %w", device, err)
+	}
+
+	return &serialSink{port: port, framing: framing, encoder: encoder}, nil
+}
+
+// serialMode builds the port settings from the serial.* config keys.
+func serialMode() (*serial.Mode, error) {
+	mode := &serial.Mode{
+		BaudRate: viper.GetInt("serial.baud"),
+		DataBits: 8,
+	}
+	if viper.IsSet("serial.data-bits") {
+		mode.DataBits = viper.GetInt("serial.data-bits")
+	}
+
+	switch parity := strings.ToLower(viper.GetString("serial.parity")); parity {
+	case "", "none":
+		mode.Parity = serial.NoParity
+	case "odd":
+		mode.Parity = serial.OddParity
+	case "even":
+		mode.Parity = serial.EvenParity
+	case "mark":
+		mode.Parity = serial.MarkParity
+	case "space":
+		mode.Parity = serial.SpaceParity
+	default:
+		return nil, fmt.Errorf("unknown serial parity %q", parity)
+	}
+
+	switch stopBits := viper.GetString("serial.stop-bits"); stopBits {
+	case "", "1":
+		mode.StopBits = serial.OneStopBit
+	case "1.5":
+		mode.StopBits = serial.OnePointFiveStopBits
+	case "2":
+		mode.StopBits = serial.TwoStopBits
+	default:
+		return nil, fmt.Errorf("unknown serial stop bits %q", stopBits)
+	}
+
+	return mode, nil
+}
+
+// frameMessage wraps a payload for transmission on the wire:
+//
+//	line:    payload followed by CR LF
+//	stx-etx: STX, payload, ETX
+//	length:  2-byte big-endian payload length, payload
+//	raw:     payload as-is, for self-delimiting payloads such as diu-frame
+func frameMessage(framing string, payload []byte) ([]byte, error) {
+	switch framing {
+	case "", "line":
+		return append(append([]byte{}, payload...), '\r', '\n'), nil
+	case "stx-etx":
+		frame := append([]byte{serialSTX}, payload...)
+		return append(frame, serialETX), nil
+	case "raw":
+		return payload, nil
+	case "length":
+		if len(payload) > 0xFFFF {
+			return nil, fmt.Errorf("payload of %d bytes is too long for length framing", len(payload))
+		}
+		return append(binary.BigEndian.AppendUint16(nil, uint16(len(payload))), payload...), nil
+	default:
+		return nil, fmt.Errorf("unknown serial framing %q", framing)
+	}
+}
+
+func (s *serialSink) Publish(ctx context.Context, r Reading) error {
+	msg, err := s.encoder.Encode(r)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, r, msg)
+}
+
+func (s *serialSink) send(ctx context.Context, r Reading, msg Message) error {
+	frame, err := frameMessage(s.framing, msg.Body)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.port.Write(frame)
+	return err
+}
+
+func (s *serialSink) Close() error {
+	return s.port.Close()
+}
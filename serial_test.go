@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameMessage(t *testing.T) {
+	tests := []struct {
+		framing string
+		want    []byte
+	}{
+		{"line", []byte("a=1\r\n")},
+		{"stx-etx", []byte("\x02a=1\x03")},
+		{"length", []byte("\x00\x03a=1")},
+	}
+
+	for _, tt := range tests {
+		frame, err := frameMessage(tt.framing, []byte("a=1"))
+		if err != nil {
+			t.Errorf("frameMessage(%q) returned error: %v", tt.framing, err)
+			continue
+		}
+		if !bytes.Equal(frame, tt.want) {
+			t.Errorf("frameMessage(%q) = %q, want %q", tt.framing, frame, tt.want)
+		}
+	}
+
+	if _, err := frameMessage("morse", nil); err == nil {
+		t.Errorf("Expected an error for an unknown framing")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Reading is a single sample taken by a simulated sensor.
+type Reading struct {
+	SensorData
+	Name     string // qualified sensor name, e.g. "temperature:sensor_001"
+	DIU      string // data interface unit the sensor belongs to, e.g. "diu_000"
+	Site     string // site the DIU is at, if the topology has sites
+	Index    int    // sensor index within the simulation
+	Sequence uint64 // per-sensor sequence number, starting at 1
+
+	// auxiliary marks the registry announcements and anomaly label copies
+	// published alongside the readings, which are not counted as readings.
+	auxiliary bool
+}
+
+// Sink is an output that readings are published to.
+type Sink interface {
+	Publish(ctx context.Context, r Reading) error
+	Close() error
+}
+
+// expandTemplate substitutes the {channel}, {sensor_id}, {diu}, {site} and
+// {name} placeholders in a destination or topic template.
+func expandTemplate(template string, r Reading) string {
+	return strings.NewReplacer(
+		"{channel}", r.Channel,
+		"{sensor_id}", r.SensorID,
+		"{diu}", r.DIU,
+		"{site}", r.Site,
+		"{name}", r.Name,
+	).Replace(template)
+}
+
+// expandTopic is expandTemplate for the destinations and topics readings
+// are published to, with prefix, the topic-prefix setting, prepended to
+// the channel substituted for {channel}.
+func expandTopic(template, prefix string, r Reading) string {
+	r.Channel = prefix + r.Channel
+	return expandTemplate(template, r)
+}
+
+// multiSink fans each reading out to several sinks.
+type multiSink []Sink
+
+func (m multiSink) Publish(ctx context.Context, r Reading) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Publish(ctx, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setupSinks creates the sinks named by the sinks setting.
+func setupSinks() (Sink, error) {
+	var sinks multiSink
+	for _, name := range configList("sinks") {
+		sink, err := newSink(name)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("no sinks configured")
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
+
+// newSink creates the named sink, wrapped for batching if that is
+// configured for it.
+func newSink(name string) (Sink, error) {
+	sink, err := openSink(name)
+	if err != nil {
+		return nil, err
+	}
+	return withBatching(name, sink)
+}
+
+// sinkTypes are the sinks selectable with sinks, by name.
+var sinkTypes = map[string]func() (Sink, error){
+	"redis":      func() (Sink, error) { return newRedisSink(setupRedisClient()) },
+	"redis-kv":   func() (Sink, error) { return newRedisKVSink(setupRedisClient()) },
+	"redis-hash": func() (Sink, error) { return newRedisHashSink(setupRedisClient()), nil },
+	"sse":        func() (Sink, error) { return newSSESink(viper.GetString("sse.addr")) },
+	"serial":     func() (Sink, error) { return newSerialSink() },
+	"syslog":     func() (Sink, error) { return newSyslogSink() },
+	"stomp":      func() (Sink, error) { return newStompSink() },
+	"grpc":       func() (Sink, error) { return newGRPCSink() },
+	"pulsar":     func() (Sink, error) { return newPulsarSink() },
+}
+
+// The failover sink opens its primary and secondary sinks from sinkTypes,
+// so it is registered at init to avoid an initialization cycle.
+func init() {
+	sinkTypes["failover"] = func() (Sink, error) { return newFailoverSink() }
+}
+
+func openSink(name string) (Sink, error) {
+	open, ok := sinkTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q", name)
+	}
+	return open()
+}
+
+// configList returns a list setting, accepting either a YAML list or a
+// comma-separated string as given on the command line.
+func configList(key string) []string {
+	var list []string
+	for _, item := range viper.GetStringSlice(key) {
+		for _, part := range strings.Split(item, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// recordingSink is a Sink that records what it is given and can be told
+// to fail.
+type recordingSink struct {
+	mu       sync.Mutex
+	readings []Reading
+	fail     bool
+	closed   bool
+}
+
+func (s *recordingSink) Publish(ctx context.Context, r Reading) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.readings = append(s.readings, r)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *recordingSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.readings)
+}
+
+func (s *recordingSink) setFail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func TestMultiSinkPublishesToAll(t *testing.T) {
+	a, b := &recordingSink{}, &recordingSink{fail: true}
+	sinks := multiSink{a, b}
+
+	if err := sinks.Publish(context.Background(), Reading{}); err == nil {
+		t.Errorf("Expected the failing sink's error to be returned")
+	}
+	if a.count() != 1 {
+		t.Errorf("Expected the healthy sink to still receive the reading")
+	}
+
+	sinks.Close()
+	if !a.closed || !b.closed {
+		t.Errorf("Expected all sinks to be closed")
+	}
+}
+
+func TestConfigList(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("sinks", "redis, sse")
+	if got := configList("sinks"); !reflect.DeepEqual(got, []string{"redis", "sse"}) {
+		t.Errorf("Unexpected list from comma-separated string: %v", got)
+	}
+
+	viper.Set("sinks", []string{"stomp", "grpc"})
+	if got := configList("sinks"); !reflect.DeepEqual(got, []string{"stomp", "grpc"}) {
+		t.Errorf("Unexpected list from YAML list: %v", got)
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	r := Reading{SensorData: SensorData{SensorID: "sensor_004", Channel: "humidity"}, Name: "humidity:sensor_004", DIU: "diu_000"}
+	if got := expandTemplate("site/{diu}/{channel}/{sensor_id}", r); got != "site/diu_000/humidity/sensor_004" {
+		t.Errorf("Unexpected expansion %q", got)
+	}
+	if got := expandTopic("persistent://public/default/{channel}", "sim.lab3.", r); got != "persistent://public/default/sim.lab3.humidity" {
+		t.Errorf("Expected the channel prefixed, got %q", got)
+	}
+	if r.Channel != "humidity" {
+		t.Errorf("Expected the reading unchanged, got channel %q", r.Channel)
+	}
+}
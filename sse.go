@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// sseKeepAlive is how often an idle event stream receives a comment line so
+// that proxies and clients don't time the connection out.
+const sseKeepAlive = 15 * time.Second
+
+// sseSink serves readings to HTTP clients as a Server-Sent Events stream on
+// GET /events. Clients may restrict the stream with one or more channel
+// query parameters, e.g. /events?channel=temperature. Events are named
+// after the channels with the topic-prefix, which the query names too.
+type sseSink struct {
+	server  *http.Server
+	encoder Encoder
+	prefix  string // topic-prefix, prepended to the event names
+	done    chan struct{}
+
+	mu      sync.Mutex
+	clients map[*sseClient]struct{}
+}
+
+type sseClient struct {
+	channels map[string]bool // empty means all channels
+	events   chan sseEvent
+}
+
+type sseEvent struct {
+	channel string
+	data    []byte
+}
+
+func newSSESink(addr string) (*sseSink, error) {
+	encoder, err := newEncoder("sse", false)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("starting SSE server: %w", err)
+	}
+
+	s := &sseSink{
+		encoder: encoder,
+		prefix:  viper.GetString("topic-prefix"),
+		done:    make(chan struct{}),
+		clients: make(map[*sseClient]struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", s.handleEvents)
+	s.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("SSE server error: %v", err)
+		}
+	}()
+	log.Printf("Serving Server-Sent Events on http://%s/events", listener.Addr())
+
+	return s, nil
+}
+
+func (s *sseSink) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	client := &sseClient{
+		channels: make(map[string]bool),
+		events:   make(chan sseEvent, 64),
+	}
+	for _, channel := range r.URL.Query()["channel"] {
+		client.channels[channel] = true
+	}
+
+	s.mu.Lock()
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-client.events:
+			writeSSEEvent(w, event)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSSEEvent writes one event, splitting multi-line data over several
+// data fields as the SSE format requires.
+func writeSSEEvent(w io.Writer, event sseEvent) {
+	fmt.Fprintf(w, "event: %s\n", event.channel)
+	for _, line := range bytes.Split(event.data, []byte("\n")) {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// Publish queues the reading for every connected client subscribed to its
+// channel. Readings are dropped for clients that are not keeping up rather
+// than slowing down the simulation.
+func (s *sseSink) Publish(ctx context.Context, r Reading) error {
+	msg, err := s.encoder.Encode(r)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, r, msg)
+}
+
+func (s *sseSink) send(ctx context.Context, r Reading, msg Message) error {
+	event := sseEvent{channel: s.prefix + r.Channel, data: msg.Body}
+	if !isTextContentType(msg.ContentType) {
+		// Event streams are text, so binary payloads are sent base64-encoded.
+		event.data = []byte(base64.StdEncoding.EncodeToString(msg.Body))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for client := range s.clients {
+		if len(client.channels) > 0 && !client.channels[event.channel] {
+			continue
+		}
+		select {
+		case client.events <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *sseSink) Close() error {
+	close(s.done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
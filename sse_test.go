@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSESinkStreamsMatchingChannel(t *testing.T) {
+	sink := &sseSink{
+		encoder: encoderFunc(encodeText),
+		done:    make(chan struct{}),
+		clients: make(map[*sseClient]struct{}),
+	}
+	server := httptest.NewServer(http.HandlerFunc(sink.handleEvents))
+	defer server.Close()
+	defer close(sink.done)
+
+	resp, err := http.Get(server.URL + "/events?channel=pressure")
+	if err != nil {
+		t.Fatalf("Error connecting to SSE endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+
+	// Publishing races with the handler registering the client, so keep
+	// publishing until the event arrives.
+	go func() {
+		for i := 0; i < 50; i++ {
+			sink.Publish(context.Background(), Reading{SensorData: SensorData{Channel: "temperature", Value: 30}, Name: "temperature:sensor_000"})
+			sink.Publish(context.Background(), Reading{SensorData: SensorData{Channel: "pressure", Value: 1}, Name: "pressure:sensor_001"})
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			if line != "event: pressure" {
+				t.Fatalf("Expected only pressure events, got %q", line)
+			}
+			scanner.Scan()
+			if want := "data: pressure:sensor_001=1.000000"; scanner.Text() != want {
+				t.Errorf("Expected %q, got %q", want, scanner.Text())
+			}
+			return
+		}
+	}
+	t.Fatalf("Stream ended without an event: %v", scanner.Err())
+}
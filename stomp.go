@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/go-stomp/stomp/v3"
+	"github.com/go-stomp/stomp/v3/frame"
+	"github.com/spf13/viper"
+)
+
+// stompSink sends readings to a STOMP broker such as ActiveMQ. The
+// destination of each message is rendered from the stomp.destination
+// template, so readings can be spread over per-channel or per-sensor
+// topics and queues.
+type stompSink struct {
+	conn        *stomp.Conn
+	destination string
+	prefix      string // topic-prefix
+	encoder     Encoder
+}
+
+func newStompSink() (*stompSink, error) {
+	addr := viper.GetString("stomp.addr")
+
+	encoder, err := newEncoder("stomp", true)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []func(*stomp.Conn) error{
+		stomp.ConnOpt.HeartBeat(viper.GetDuration("stomp.heartbeat-send"), viper.GetDuration("stomp.heartbeat-receive")),
+	}
+	if login := viper.GetString("stomp.login"); login != "" {
+		opts = append(opts, stomp.ConnOpt.Login(login, viper.GetString("stomp.passcode")))
+	}
+	if host := viper.GetString("stomp.host"); host != "" {
+		opts = append(opts, stomp.ConnOpt.Host(host))
+	}
+
+	var conn *stomp.Conn
+	if viper.GetBool("stomp.tls.enabled") {
+		config, tlsErr := tlsConfig("stomp.tls")
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		netConn, dialErr := tls.Dial("tcp", addr, config)
+		if dialErr != nil {
+			return nil, fmt.Errorf("connecting to STOMP broker %s: %w", addr, dialErr)
+		}
+		conn, err = stomp.Connect(netConn, opts...)
+		if err != nil {
+			netConn.Close()
+		}
+	} else {
+		conn, err = stomp.Dial("tcp", addr, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to STOMP broker %s: %w", addr, err)
+	}
+
+	return &stompSink{
+		conn:        conn,
+		destination: viper.GetString("stomp.destination"),
+		prefix:      viper.GetString("topic-prefix"),
+		encoder:     encoder,
+	}, nil
+}
+
+func (s *stompSink) Publish(ctx context.Context, r Reading) error {
+	msg, err := s.encoder.Encode(r)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, r, msg)
+}
+
+func (s *stompSink) send(ctx context.Context, r Reading, msg Message) error {
+	var opts []func(*frame.Frame) error
+	for name, value := range msg.Headers {
+		opts = append(opts, stomp.SendOpt.Header(name, value))
+	}
+	return s.conn.Send(expandTopic(s.destination, s.prefix, r), msg.ContentType, msg.Body, opts...)
+}
+
+func (s *stompSink) Close() error {
+	return s.conn.Disconnect()
+}
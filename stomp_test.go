@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-stomp/stomp/v3"
+	"github.com/go-stomp/stomp/v3/server"
+	"github.com/spf13/viper"
+)
+
+func TestStompSinkDestinationTemplate(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go server.Serve(listener)
+
+	viper.Set("stomp.addr", listener.Addr().String())
+	viper.Set("stomp.destination", "/topic/{diu}.{channel}")
+	viper.Set("payload-format", "kv")
+
+	consumer, err := stomp.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting consumer: %v", err)
+	}
+	defer consumer.Disconnect()
+	sub, err := consumer.Subscribe("/topic/diu_002.humidity", stomp.AckAuto)
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+
+	sink, err := newStompSink()
+	if err != nil {
+		t.Fatalf("Error creating STOMP sink: %v", err)
+	}
+	defer sink.Close()
+
+	reading := Reading{SensorData: SensorData{Channel: "humidity", Value: 75}, Name: "humidity:sensor_032", DIU: "diu_002"}
+	if err := sink.Publish(context.Background(), reading); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+
+	select {
+	case msg := <-sub.C:
+		if msg.Err != nil {
+			t.Fatalf("Error receiving message: %v", msg.Err)
+		}
+		if string(msg.Body) != "humidity:sensor_032=75.000000" {
+			t.Errorf("Unexpected message body %q", msg.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive message in time")
+	}
+}
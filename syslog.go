@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// syslogSeverityInfo is the RFC 5424 severity used for every reading.
+const syslogSeverityInfo = 6
+
+// syslogSink emits readings as RFC 5424 syslog messages over UDP, TCP or
+// TLS. Each message carries the reading as structured data so collectors
+// can index the fields without parsing the message text.
+type syslogSink struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+
+	encoder Encoder
+
+	facility int
+	hostname string
+	appName  string
+	procID   string
+	sdID     string
+	prefix   string // topic-prefix, prepended to the MSGID
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogSink() (*syslogSink, error) {
+	s := &syslogSink{
+		network:  viper.GetString("syslog.network"),
+		addr:     viper.GetString("syslog.addr"),
+		facility: viper.GetInt("syslog.facility"),
+		appName:  viper.GetString("syslog.app-name"),
+		procID:   strconv.Itoa(os.Getpid()),
+		sdID:     viper.GetString("syslog.sd-id"),
+		prefix:   viper.GetString("topic-prefix"),
+	}
+	if s.appName == "" {
+		s.appName = "diu_sim"
+	}
+	if s.sdID == "" {
+		s.sdID = "reading@32473"
+	}
+	if s.facility < 0 || s.facility > 23 {
+		return nil, fmt.Errorf("syslog facility must be between 0 and 23, got %d", s.facility)
+	}
+
+	var err error
+	if s.encoder, err = newEncoder("syslog", false); err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s.hostname = hostname
+
+	switch s.network {
+	case "udp", "tcp":
+	case "tls":
+		if s.tlsConfig, err = tlsConfig("syslog.tls"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown syslog network %q", s.network)
+	}
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslogSink) connect() error {
+	var err error
+	if s.network == "tls" {
+		s.conn, err = tls.Dial("tcp", s.addr, s.tlsConfig)
+	} else {
+		s.conn, err = net.Dial(s.network, s.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to syslog server %s: %w", s.addr, err)
+	}
+	return nil
+}
+
+// formatSyslogMessage renders a reading as an RFC 5424 message whose MSG
+// part is the encoded reading.
+func (s *syslogSink) formatSyslogMessage(r Reading) (string, error) {
+	msg, err := s.encoder.Encode(r)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s [%s sensor_id=\"%s\" channel=\"%s\" value=\"%s\"] %s",
+		s.facility*8+syslogSeverityInfo,
+		syslogTimestamp(r.Timestamp),
+		s.hostname,
+		s.appName,
+		s.procID,
+		s.prefix+r.Channel,
+		s.sdID,
+		escapeSDParam(r.SensorID),
+		escapeSDParam(r.Channel),
+		strconv.FormatFloat(r.Value, 'f', -1, 64),
+		msg.Body,
+	), nil
+}
+
+// syslogTimestamp converts a reading timestamp to the RFC 5424 form, which
+// allows at most microsecond precision.
+func syslogTimestamp(timestamp string) string {
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return "-"
+	}
+	return t.Format("2006-01-02T15:04:05.000000Z07:00")
+}
+
+// escapeSDParam escapes the characters RFC 5424 does not allow unescaped in
+// structured data parameter values.
+func escapeSDParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+func (s *syslogSink) Publish(ctx context.Context, r Reading) error {
+	message, err := s.formatSyslogMessage(r)
+	if err != nil {
+		return err
+	}
+
+	// Stream transports use octet-counting framing (RFC 6587, RFC 5425).
+	if s.network != "udp" {
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := s.conn.Write([]byte(message)); err != nil {
+		// Drop the connection so the next reading reconnects.
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSyslogSinkTCP(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	viper.Set("syslog.network", "tcp")
+	viper.Set("syslog.addr", listener.Addr().String())
+	viper.Set("syslog.facility", 16)
+
+	sink, err := newSyslogSink()
+	if err != nil {
+		t.Fatalf("Error creating syslog sink: %v", err)
+	}
+	defer sink.Close()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	defer conn.Close()
+
+	reading := Reading{
+		SensorData: SensorData{
+			SensorID:  "sensor_001",
+			Channel:   "pressure",
+			Timestamp: "2024-07-01T12:00:00.123456789Z",
+			Value:     1.05,
+		},
+		Name: "pressure:sensor_001",
+	}
+	if err := sink.Publish(context.Background(), reading); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString(']')
+	if err != nil {
+		t.Fatalf("Error reading message: %v", err)
+	}
+
+	pattern := `^\d+ <134>1 2024-07-01T12:00:00\.123456Z \S+ diu_sim \d+ pressure \[reading@32473 sensor_id="sensor_001" channel="pressure" value="1\.05"\]$`
+	if !regexp.MustCompile(pattern).MatchString(line) {
+		t.Errorf("Unexpected syslog message: %q", line)
+	}
+}
+
+func TestEscapeSDParam(t *testing.T) {
+	if got, want := escapeSDParam(`a"b\c]`), `a\"b\\c\]`; got != want {
+		t.Errorf("escapeSDParam = %q, want %q", got, want)
+	}
+}
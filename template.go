@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"text/template"
+)
+
+// templateEncoder renders readings with a user-supplied Go text/template,
+// so that legacy formats can be produced without code changes. The template
+// is payload-template, or the contents of payload-template-file, and is
+// executed with a templateData value. Batches render the template once per
+// reading, one reading per line.
+type templateEncoder struct {
+	tmpl        *template.Template
+	contentType string
+}
+
+// templateData is what payload templates are executed with.
+type templateData struct {
+	Sensor    string
+	Channel   string
+	Value     float64
+	Unit      string
+	Label     string
+	Text      string
+	Position  *Position
+	Samples   []float64
+	Quality   string
+	RSSI      *float64
+	SNR       *float64
+	Timestamp string
+	Metadata  map[string]string
+}
+
+func newTemplateEncoder(sink string) (*templateEncoder, error) {
+	text := sinkSetting(sink, "payload-template")
+	if file := sinkSetting(sink, "payload-template-file"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading payload template: %w", err)
+		}
+		text = string(data)
+	}
+	if text == "" {
+		return nil, fmt.Errorf("the template payload format needs payload-template or payload-template-file")
+	}
+
+	tmpl, err := template.New("payload").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing payload template: %w", err)
+	}
+
+	contentType := sinkSetting(sink, "payload-template-content-type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	return &templateEncoder{tmpl: tmpl, contentType: contentType}, nil
+}
+
+func newTemplateData(r Reading) templateData {
+	metadata := map[string]string{
+		"diu":   r.DIU,
+		"site":  r.Site,
+		"name":  r.Name,
+		"index": strconv.Itoa(r.Index),
+	}
+	for key, value := range r.Metadata {
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = value
+		}
+	}
+	return templateData{
+		Sensor:    r.SensorID,
+		Channel:   r.Channel,
+		Value:     r.Value,
+		Unit:      r.Unit,
+		Label:     r.Label,
+		Text:      r.Text,
+		Position:  r.Position,
+		Samples:   r.Samples,
+		Quality:   r.Quality,
+		RSSI:      r.RSSI,
+		SNR:       r.SNR,
+		Timestamp: r.Timestamp,
+		Metadata:  metadata,
+	}
+}
+
+func (e *templateEncoder) Encode(r Reading) (Message, error) {
+	var b bytes.Buffer
+	if err := e.tmpl.Execute(&b, newTemplateData(r)); err != nil {
+		return Message{}, fmt.Errorf("rendering payload template: %w", err)
+	}
+	return Message{Body: b.Bytes(), ContentType: e.contentType}, nil
+}
+
+func (e *templateEncoder) EncodeBatch(rs []Reading) (Message, error) {
+	var b bytes.Buffer
+	for i, r := range rs {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		if err := e.tmpl.Execute(&b, newTemplateData(r)); err != nil {
+			return Message{}, fmt.Errorf("rendering payload template: %w", err)
+		}
+	}
+	return Message{Body: b.Bytes(), ContentType: e.contentType}, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTemplateEncoder(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("payload-format", "template")
+	viper.Set("payload-template", `{{.Metadata.diu}}|{{.Sensor}}|{{.Channel}}|{{printf "%.2f" .Value}}|{{.Timestamp}}`)
+
+	encoder, err := newEncoder("redis", false)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+	msg, err := encoder.Encode(testReading)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	if want := "diu_000|sensor_001|pressure|1.05|2024-07-01T12:00:00Z"; string(msg.Body) != want {
+		t.Errorf("Expected %q, got %q", want, msg.Body)
+	}
+	if msg.ContentType != "text/plain" {
+		t.Errorf("Expected text/plain, got %s", msg.ContentType)
+	}
+
+	batch, err := newEncoder("redis", false)
+	if err != nil {
+		t.Fatalf("Error creating batch encoder: %v", err)
+	}
+	msg, _ = batch.EncodeBatch([]Reading{testReading, testReading})
+	if want := "diu_000|sensor_001|pressure|1.05|2024-07-01T12:00:00Z\ndiu_000|sensor_001|pressure|1.05|2024-07-01T12:00:00Z"; string(msg.Body) != want {
+		t.Errorf("Expected one line per reading, got %q", msg.Body)
+	}
+}
+
+func TestTemplateEncoderFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	file := filepath.Join(t.TempDir(), "payload.tmpl")
+	if err := os.WriteFile(file, []byte(`<reading id="{{.Sensor}}">{{.Value}}</reading>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("payload-format", "template")
+	viper.Set("sse.payload-template-file", file)
+	viper.Set("sse.payload-template-content-type", "application/xml")
+
+	encoder, err := newEncoder("sse", false)
+	if err != nil {
+		t.Fatalf("Error creating encoder: %v", err)
+	}
+	msg, _ := encoder.Encode(testReading)
+	if string(msg.Body) != `<reading id="sensor_001">1.05</reading>` || msg.ContentType != "application/xml" {
+		t.Errorf("Unexpected payload %q (%s)", msg.Body, msg.ContentType)
+	}
+
+	if _, err := newEncoder("redis", false); err == nil {
+		t.Errorf("Expected an error when no template is configured")
+	}
+}
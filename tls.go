@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// tlsConfig builds a client TLS configuration from the settings under
+// prefix: ca-file, cert-file, key-file, server-name and
+// insecure-skip-verify.
+func tlsConfig(prefix string) (*tls.Config, error) {
+	caFile := viper.GetString(prefix + ".ca-file")
+	certFile := viper.GetString(prefix + ".cert-file")
+	keyFile := viper.GetString(prefix + ".key-file")
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         viper.GetString(prefix + ".server-name"),
+		InsecureSkipVerify: viper.GetBool(prefix + ".insecure-skip-verify"),
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("both a client certificate and key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// loadTopology expands the sites of the fleet, the DIUs they contain and
+// the sensors those contain into sensors entries (see definedSensorIDs),
+// e.g.
+//
+//	sites:
+//	  plant_a:
+//	    metadata: {region: eu-west}
+//	    dius:
+//	      pump:
+//	        metadata: {room: basement}
+//	        sensors:
+//	          inlet_temp: {channel: temperature, rate: 1}
+//	      boiler:
+//	        count: 4
+//	        channels: [temperature, pressure]
+//	      line:
+//	        model: conveyor
+//	        instances: 20
+//
+// Each level contributes to the IDs, which are site/diu/sensor for sensors
+// and site/diu for DIUs, and to the metadata, which the sensors inherit
+// from their DIU and site unless they set it themselves. The site is also
+// available to topic templates as {site}. A DIU can also have count
+// sensors generated in bulk, sensor_000 onwards, assigned to its channels
+// (default those of the simulation) by weight as weightedChannel does.
+// Their names within the DIU follow the sensor ID template (see
+// sensorIDTemplate), with the DIU and site names as {diu} and {site}. A
+// rate, min-rate or max-rate of the DIU applies to its sensors that do not
+// set their own.
+//
+// A DIU can be of a device model, models.<model>, which provides the
+// settings the DIU does not set itself (see applyModel), and with
+// instances stands for that many DIUs, named <diu>_000 onwards.
+//
+// The sensors of the inventory file, if any, are loaded first (see
+// loadInventory).
+func loadTopology() error {
+	if err := loadInventory(); err != nil {
+		return err
+	}
+	sites := viper.GetStringMap("sites")
+	if len(sites) == 0 {
+		return nil
+	}
+	models := viper.GetStringMap("models")
+	sensors := viper.GetStringMap("sensors")
+	for _, site := range sortedKeys(sites) {
+		siteSpec := generatorSpec(cast.ToStringMap(sites[site]))
+		dius := cast.ToStringMap(siteSpec["dius"])
+		if len(dius) == 0 {
+			return fmt.Errorf("site %s: no DIUs", site)
+		}
+		for _, diu := range sortedKeys(dius) {
+			diuSpec, err := applyModel(models, path.Join(site, diu), cast.ToStringMap(dius[diu]))
+			if err != nil {
+				return err
+			}
+			if _, ok := diuSpec["instances"]; !ok {
+				if err := expandDIU(sensors, site, diu, siteSpec, diuSpec); err != nil {
+					return err
+				}
+				continue
+			}
+			for i := 0; i < int(diuSpec.float("instances", 0)); i++ {
+				if err := expandDIU(sensors, site, fmt.Sprintf("%s_%03d", diu, i), siteSpec, diuSpec); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	viper.Set("sensors", sensors)
+	return nil
+}
+
+// diuRateKeys are the rate settings a DIU passes on to its sensors.
+var diuRateKeys = []string{"rate", "min-rate", "max-rate"}
+
+// expandDIU adds the sensors of a DIU of a site to sensors.
+func expandDIU(sensors map[string]any, site, diu string, siteSpec, diuSpec generatorSpec) error {
+	diuID := path.Join(site, diu)
+	metadata := cast.ToStringMap(siteSpec["metadata"])
+	maps.Copy(metadata, cast.ToStringMap(diuSpec["metadata"]))
+
+	// The blocks are copied, as the same model or DIU can be expanded
+	// more than once.
+	blocks := make(map[string]map[string]any)
+	for name, item := range cast.ToStringMap(diuSpec["sensors"]) {
+		blocks[name] = maps.Clone(cast.ToStringMap(item))
+	}
+	channels := cast.ToStringSlice(diuSpec["channels"])
+	if len(channels) == 0 {
+		channels = channelNames()
+	}
+	for i := 0; i < int(diuSpec.float("count", 0)); i++ {
+		channel := weightedChannel(channels, i)
+		name := bulkSensorName(i, channel, diu, site)
+		if _, ok := blocks[name]; !ok {
+			blocks[name] = map[string]any{"channel": channel}
+		}
+	}
+
+	for name, block := range blocks {
+		id := path.Join(diuID, name)
+		if _, ok := sensors[id]; ok {
+			return fmt.Errorf("sensor %s is defined more than once", id)
+		}
+		if cast.ToString(block["channel"]) == "" {
+			return fmt.Errorf("sensor %s: channel must be set", id)
+		}
+		if _, ok := block["rate"]; !ok && block["min-rate"] == nil && block["max-rate"] == nil {
+			for _, key := range diuRateKeys {
+				if value, ok := diuSpec[key]; ok {
+					block[key] = value
+				}
+			}
+		}
+		sensorMetadata := maps.Clone(metadata)
+		maps.Copy(sensorMetadata, cast.ToStringMap(block["metadata"]))
+		block["site"], block["diu"], block["metadata"] = site, diuID, sensorMetadata
+		sensors[id] = block
+	}
+	return nil
+}
+
+// applyModel returns the settings of a DIU with those of its device model,
+// if it names one with model, under its own, e.g.
+//
+//	models:
+//	  conveyor:
+//	    metadata: {vendor: acme}
+//	    rate: 2
+//	    sensors:
+//	      motor_temp: {channel: temperature}
+//	      belt_speed: {channel: speed, rate: 10}
+//	    count: 2
+//	    channels: [vibration]
+//
+// The sensors and metadata of the DIU are merged with the model's, by
+// name; its other settings replace the model's. The sensors get the model
+// name as metadata, model, unless they set it.
+func applyModel(models map[string]any, diuID string, spec generatorSpec) (generatorSpec, error) {
+	name := spec.str("model", "")
+	if name == "" {
+		return spec, nil
+	}
+	model, ok := models[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("DIU %s: unknown model %q", diuID, name)
+	}
+	merged := generatorSpec(maps.Clone(cast.ToStringMap(model)))
+	for _, key := range []string{"metadata", "sensors"} {
+		layer := make(map[string]any)
+		if key == "metadata" {
+			layer["model"] = name
+		}
+		maps.Copy(layer, cast.ToStringMap(merged[key]))
+		maps.Copy(layer, cast.ToStringMap(spec[key]))
+		merged[key] = layer
+	}
+	for key, value := range spec {
+		if key != "metadata" && key != "sensors" {
+			merged[key] = value
+		}
+	}
+	return merged, nil
+}
+
+// sortedKeys returns the keys of a map, sorted.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTopology(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("sensors.extra", map[string]any{"channel": "humidity"})
+	viper.Set("sites", map[string]any{
+		"plant_a": map[string]any{
+			"metadata": map[string]any{"region": "eu-west", "room": "unknown"},
+			"dius": map[string]any{
+				"pump": map[string]any{
+					"metadata": map[string]any{"room": "basement"},
+					"sensors": map[string]any{
+						"inlet_temp": map[string]any{"channel": "temperature", "metadata": map[string]any{"model": "PT100"}},
+					},
+				},
+				"boiler": map[string]any{"count": 3, "channels": []any{"temperature", "pressure"}},
+			},
+		},
+	})
+	if err := loadTopology(); err != nil {
+		t.Fatalf("Error loading topology: %v", err)
+	}
+
+	want := []string{"extra", "plant_a/boiler/sensor_000", "plant_a/boiler/sensor_001", "plant_a/boiler/sensor_002", "plant_a/pump/inlet_temp"}
+	if ids := definedSensorIDs(0); !slices.Equal(ids, want) {
+		t.Fatalf("Expected sensors %v, got %v", want, ids)
+	}
+
+	inlet, err := newConfiguredSensor(0, "plant_a/pump/inlet_temp", "")
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	reading := inlet.sample(testStart, 1)
+	if reading.Site != "plant_a" || reading.DIU != "plant_a/pump" || reading.Channel != "temperature" {
+		t.Errorf("Expected a temperature reading of plant_a/pump, got %+v", reading)
+	}
+	if m := reading.Metadata; m["region"] != "eu-west" || m["room"] != "basement" || m["model"] != "PT100" {
+		t.Errorf("Expected metadata inherited from the DIU and site, got %v", m)
+	}
+	if topic := expandTemplate("{site}/{diu}/{channel}", reading); topic != "plant_a/plant_a/pump/temperature" {
+		t.Errorf("Expected the site in topics, got %s", topic)
+	}
+
+	boiler, err := newConfiguredSensor(1, "plant_a/boiler/sensor_001", "")
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if boiler.info.Channel != "pressure" || boiler.info.DIU != "plant_a/boiler" {
+		t.Errorf("Expected the second boiler sensor on pressure, got %s on %s", boiler.info.Channel, boiler.info.DIU)
+	}
+
+	for name, sites := range map[string]map[string]any{
+		"no DIUs":    {"plant_b": map[string]any{}},
+		"no channel": {"plant_b": map[string]any{"dius": map[string]any{"x": map[string]any{"sensors": map[string]any{"s": map[string]any{}}}}}},
+		"duplicate":  {"plant_a": map[string]any{"dius": map[string]any{"pump": map[string]any{"sensors": map[string]any{"inlet_temp": map[string]any{"channel": "flow"}}}}}},
+	} {
+		viper.Set("sites", sites)
+		if err := loadTopology(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTopologyModels(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("models", map[string]any{
+		"conveyor": map[string]any{
+			"metadata": map[string]any{"vendor": "acme"},
+			"rate":     2,
+			"sensors": map[string]any{
+				"motor_temp": map[string]any{"channel": "temperature"},
+				"belt_speed": map[string]any{"channel": "speed", "rate": 10},
+			},
+		},
+	})
+	viper.Set("sites", map[string]any{
+		"plant_a": map[string]any{
+			"dius": map[string]any{
+				"line": map[string]any{"model": "conveyor", "instances": 3},
+				"spare": map[string]any{
+					"model":    "conveyor",
+					"metadata": map[string]any{"vendor": "other"},
+					"sensors":  map[string]any{"motor_current": map[string]any{"channel": "current"}},
+				},
+			},
+		},
+	})
+	if err := loadTopology(); err != nil {
+		t.Fatalf("Error loading topology: %v", err)
+	}
+
+	want := []string{
+		"plant_a/line_000/belt_speed", "plant_a/line_000/motor_temp",
+		"plant_a/line_001/belt_speed", "plant_a/line_001/motor_temp",
+		"plant_a/line_002/belt_speed", "plant_a/line_002/motor_temp",
+		"plant_a/spare/belt_speed", "plant_a/spare/motor_current", "plant_a/spare/motor_temp",
+	}
+	if ids := definedSensorIDs(0); !slices.Equal(ids, want) {
+		t.Fatalf("Expected sensors %v, got %v", want, ids)
+	}
+
+	motor, err := newConfiguredSensor(0, "plant_a/line_001/motor_temp", "")
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if motor.info.DIU != "plant_a/line_001" || motor.minRate != 2 || motor.maxRate != 2 {
+		t.Errorf("Expected the model's rate of 2 Hz on plant_a/line_001, got %g to %g Hz on %s", motor.minRate, motor.maxRate, motor.info.DIU)
+	}
+	if m := motor.sample(testStart, 1).Metadata; m["model"] != "conveyor" || m["vendor"] != "acme" {
+		t.Errorf("Expected the model and its metadata, got %v", m)
+	}
+	if rate := viper.GetFloat64("sensors.plant_a/line_000/belt_speed.rate"); rate != 10 {
+		t.Errorf("Expected the sensor's own rate kept, got %g", rate)
+	}
+	if vendor := viper.GetString("sensors.plant_a/spare/motor_temp.metadata.vendor"); vendor != "other" {
+		t.Errorf("Expected the DIU's metadata over the model's, got %q", vendor)
+	}
+
+	viper.Set("sites.plant_a.dius.line.model", "crane")
+	viper.Set("sensors", nil)
+	if err := loadTopology(); err == nil {
+		t.Errorf("Expected an unknown model rejected")
+	}
+}
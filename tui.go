@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// tuiRefresh is how often the terminal UI is redrawn.
+	tuiRefresh = 500 * time.Millisecond
+	// tuiFaultDuration is how long the faults triggered from the terminal
+	// UI last.
+	tuiFaultDuration = 30 * time.Second
+	// tuiFaultLines is the number of faulty sensors the terminal UI lists.
+	tuiFaultLines = 10
+	// tuiLogLines is the number of recent log lines the terminal UI shows.
+	tuiLogLines = 8
+)
+
+// terminalUI shows a running simulation on the terminal: the throughput
+// and errors of each channel, the active faults and the recent log, with
+// keys to control it:
+//
+//	space   pause or resume the simulation
+//	↑ ↓     select a channel (also k and j)
+//	p       pause the sensors of the selected channel, or resume them if all are paused
+//	f       put the sensors of the selected channel into a stuck fault for 30s
+//	+ -     double or halve the global publish rates
+//	q       quit (also Ctrl-C)
+//
+// The log goes to the UI rather than stderr while it is shown.
+type terminalUI struct {
+	sim  *simulation
+	quit func()
+
+	selected string // selected channel
+	last     map[string]channelCount
+	lastTime time.Time
+	rates    map[string]float64 // readings/s by channel, since the last redraw
+	logs     *logTail
+
+	restore func()
+	keys    chan string
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// startTerminalUI puts the terminal into raw mode and shows the UI until
+// Close is called. Quitting from the UI calls quit.
+func startTerminalUI(sim *simulation, quit func()) (*terminalUI, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("the terminal UI needs a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("starting the terminal UI: %w", err)
+	}
+	ui := newTerminalUI(sim, quit)
+	log.SetOutput(ui.logs)
+	// Switch to the alternate screen and hide the cursor.
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+	ui.restore = func() {
+		fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[?1049l")
+		term.Restore(fd, state)
+		log.SetOutput(os.Stderr)
+	}
+
+	// The reader is left blocked on stdin when the UI closes.
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, key := range parseKeys(buf[:n]) {
+				select {
+				case ui.keys <- key:
+				case <-ui.done:
+					return
+				}
+			}
+		}
+	}()
+	go ui.loop()
+	return ui, nil
+}
+
+func newTerminalUI(sim *simulation, quit func()) *terminalUI {
+	return &terminalUI{
+		sim:      sim,
+		quit:     quit,
+		last:     make(map[string]channelCount),
+		lastTime: time.Now(),
+		rates:    make(map[string]float64),
+		logs:     &logTail{size: tuiLogLines},
+		keys:     make(chan string),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Close stops the UI and restores the terminal.
+func (ui *terminalUI) Close() error {
+	close(ui.done)
+	<-ui.stopped
+	ui.restore()
+	return nil
+}
+
+func (ui *terminalUI) loop() {
+	defer close(ui.stopped)
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+	ui.draw()
+	for {
+		select {
+		case key := <-ui.keys:
+			ui.handleKey(key)
+		case <-ticker.C:
+			ui.measure(time.Now())
+		case <-ui.done:
+			return
+		}
+		ui.draw()
+	}
+}
+
+func (ui *terminalUI) draw() {
+	var buf bytes.Buffer
+	ui.render(&buf)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		// Long lines are cut rather than wrapped, which would scroll the screen.
+		for i, line := range lines {
+			if runes := []rune(line); len(runes) > width {
+				lines[i] = string(runes[:width])
+			}
+		}
+	}
+	// Raw mode leaves line feeds alone, so lines are ended with CRLF.
+	fmt.Fprint(os.Stdout, "\x1b[H"+strings.Join(lines, "\x1b[K\r\n")+"\x1b[K\x1b[J")
+}
+
+// parseKeys splits the bytes read from the terminal into keys, naming the
+// arrow keys up and down.
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch {
+		case bytes.HasPrefix(b, []byte("\x1b[A")):
+			keys, b = append(keys, "up"), b[3:]
+		case bytes.HasPrefix(b, []byte("\x1b[B")):
+			keys, b = append(keys, "down"), b[3:]
+		case b[0] == 3: // Ctrl-C
+			keys, b = append(keys, "q"), b[1:]
+		default:
+			keys, b = append(keys, string(b[0])), b[1:]
+		}
+	}
+	return keys
+}
+
+// measure updates the readings/s of each channel since the last time.
+func (ui *terminalUI) measure(now time.Time) {
+	counts := ui.sim.counter.byChannel()
+	elapsed := now.Sub(ui.lastTime).Seconds()
+	for channel, count := range counts {
+		ui.rates[channel] = float64(count.readings-ui.last[channel].readings) / elapsed
+	}
+	ui.last, ui.lastTime = counts, now
+}
+
+// channels returns the channels of the running sensors and of the readings
+// published so far, sorted, with the numbers of running and of paused
+// sensors of each.
+func (ui *terminalUI) channels() ([]string, map[string]int, map[string]int) {
+	sensors := make(map[string]int)
+	paused := make(map[string]int)
+	for _, s := range ui.sim.runningSensors() {
+		sensors[s.info.Channel]++
+		if s.paused.Load() {
+			paused[s.info.Channel]++
+		}
+	}
+	for channel := range ui.last {
+		if _, ok := sensors[channel]; !ok {
+			sensors[channel] = 0
+		}
+	}
+	return sortedKeys(sensors), sensors, paused
+}
+
+func (ui *terminalUI) handleKey(key string) {
+	switch key {
+	case "q":
+		ui.quit()
+	case " ":
+		ui.sim.setPaused(!ui.sim.paused.Load())
+	case "up", "k", "down", "j":
+		channels, _, _ := ui.channels()
+		if len(channels) == 0 {
+			return
+		}
+		i := sort.SearchStrings(channels, ui.selected)
+		if key == "up" || key == "k" {
+			i--
+		} else if i < len(channels) && channels[i] == ui.selected {
+			i++
+		}
+		ui.selected = channels[min(max(i, 0), len(channels)-1)]
+	case "p":
+		_, sensors, paused := ui.channels()
+		if sensors[ui.selected] == 0 {
+			return
+		}
+		pause := paused[ui.selected] < sensors[ui.selected]
+		if _, err := ui.sim.pauseSensors(sensorSelector{Channel: ui.selected}, pause); err != nil {
+			log.Printf("Error pausing sensors: %v", err)
+		}
+	case "f":
+		for _, s := range ui.sim.runningSensors() {
+			if s.info.Channel == ui.selected {
+				if _, err := ui.sim.triggerFault(s.info.ID, "stuck", tuiFaultDuration); err != nil {
+					log.Printf("Error triggering fault: %v", err)
+				}
+			}
+		}
+	case "+", "-":
+		stats := ui.sim.stats()
+		factor := 2.0
+		if key == "-" {
+			factor = 0.5
+		}
+		ui.sim.setRates(stats.MinRate*factor, stats.MaxRate*factor)
+	}
+}
+
+// render writes the screen of the UI.
+func (ui *terminalUI) render(w io.Writer) {
+	stats := ui.sim.stats()
+	channels, sensors, paused := ui.channels()
+	if ui.selected == "" && len(channels) > 0 {
+		ui.selected = channels[0]
+	}
+
+	state := "running"
+	if stats.Paused {
+		state = "PAUSED"
+	}
+	fmt.Fprintf(w, "diu_sim: %s for %s, %d sensors at %g to %g Hz\n", state,
+		(time.Duration(stats.UptimeSeconds) * time.Second).String(), stats.Sensors, stats.MinRate, stats.MaxRate)
+	fmt.Fprintf(w, "Published %d readings, %d errors\n\n", stats.Readings, stats.Errors)
+
+	fmt.Fprintf(w, "  %-20s %8s %8s %12s %10s %8s\n", "CHANNEL", "SENSORS", "PAUSED", "READINGS/S", "READINGS", "ERRORS")
+	for _, channel := range channels {
+		cursor := " "
+		if channel == ui.selected {
+			cursor = ">"
+		}
+		count := ui.last[channel]
+		fmt.Fprintf(w, "%s %-20s %8d %8d %12.1f %10d %8d\n", cursor, channel, sensors[channel], paused[channel], ui.rates[channel], count.readings, count.errors)
+	}
+
+	fmt.Fprintf(w, "\nActive faults:\n")
+	now := time.Now()
+	faulty := 0
+	for _, s := range ui.sim.runningSensors() {
+		if kinds := s.info.Faults.activeKinds(now); len(kinds) > 0 {
+			if faulty < tuiFaultLines {
+				fmt.Fprintf(w, "  %-30s %s\n", s.info.ID, strings.Join(kinds, ", "))
+			}
+			faulty++
+		}
+	}
+	switch {
+	case faulty == 0:
+		fmt.Fprintf(w, "  none\n")
+	case faulty > tuiFaultLines:
+		fmt.Fprintf(w, "  and %d more\n", faulty-tuiFaultLines)
+	}
+
+	fmt.Fprintf(w, "\nLog:\n")
+	for _, line := range ui.logs.recent() {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+	fmt.Fprintf(w, "\nspace pause/resume  ↑↓ select channel  p pause/resume it  f fault its sensors for %s  +/- double/halve rates  q quit\n", tuiFaultDuration)
+}
+
+// logTail keeps the last size lines written to it.
+type logTail struct {
+	mu    sync.Mutex
+	size  int
+	lines []string
+}
+
+func (l *logTail) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		l.lines = append(l.lines, line)
+	}
+	if len(l.lines) > l.size {
+		l.lines = l.lines[len(l.lines)-l.size:]
+	}
+	return len(p), nil
+}
+
+// recent returns the lines kept, oldest first.
+func (l *logTail) recent() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
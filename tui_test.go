@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("\x1b[Bf\x1b[A+\x03"))
+	if want := []string{"down", "f", "up", "+", "q"}; !slices.Equal(got, want) {
+		t.Errorf("Expected keys %v, got %v", want, got)
+	}
+}
+
+func TestLogTail(t *testing.T) {
+	logs := &logTail{size: 2}
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(logs, "line %d\n", i)
+	}
+	if got := logs.recent(); !slices.Equal(got, []string{"line 1", "line 2"}) {
+		t.Errorf("Expected the last two lines, got %v", got)
+	}
+}
+
+func TestTerminalUI(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	viper.Set("channel-names", []string{"temperature", "pressure"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sim, err := startSensorSimulations(ctx, &recordingSink{}, 4, 20, 20)
+	if err != nil {
+		cancel()
+		t.Fatalf("Error starting simulation: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.wg.Wait()
+	})
+	quit := false
+	ui := newTerminalUI(sim, func() { quit = true })
+
+	time.Sleep(200 * time.Millisecond)
+	ui.measure(time.Now())
+	var screen strings.Builder
+	ui.render(&screen)
+	if !strings.Contains(screen.String(), "> pressure") {
+		t.Errorf("Expected the first channel selected, got\n%s", screen.String())
+	}
+	if ui.last["temperature"].readings == 0 || ui.rates["temperature"] == 0 {
+		t.Errorf("Expected readings counted for temperature, got %+v at %g/s", ui.last["temperature"], ui.rates["temperature"])
+	}
+
+	for _, key := range []string{"down", " ", "+", "f", "p", "q"} {
+		ui.handleKey(key)
+	}
+	if ui.selected != "temperature" {
+		t.Errorf("Expected temperature selected, got %s", ui.selected)
+	}
+	if stats := sim.stats(); !stats.Paused || stats.MinRate != 40 || stats.MaxRate != 40 {
+		t.Errorf("Expected the simulation paused with doubled rates, got %+v", stats)
+	}
+	if !quit {
+		t.Errorf("Expected q to quit")
+	}
+	screen.Reset()
+	ui.render(&screen)
+	for _, want := range []string{"PAUSED", "sensor_000", "stuck"} {
+		if !strings.Contains(screen.String(), want) {
+			t.Errorf("Expected %q on the screen, got\n%s", want, screen.String())
+		}
+	}
+	for _, s := range sim.runningSensors() {
+		if stuck := len(s.info.Faults.activeKinds(time.Now())) > 0; stuck != (s.info.Channel == "temperature") {
+			t.Errorf("Expected only the temperature sensors faulted, got %s on %s faulted: %v", s.info.ID, s.info.Channel, stuck)
+		}
+		if paused := s.paused.Load(); paused != (s.info.Channel == "temperature") {
+			t.Errorf("Expected only the temperature sensors paused, got %s on %s paused: %v", s.info.ID, s.info.Channel, paused)
+		}
+	}
+
+	ui.handleKey("p")
+	for _, s := range sim.runningSensors() {
+		if s.paused.Load() {
+			t.Errorf("Expected p to resume the paused channel, got %s paused", s.info.ID)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/spf13/viper"
+)
+
+// engineeringUnit is a unit that values can be converted from and to. A
+// value v in the unit is v*scale + offset in the base unit of its quantity.
+type engineeringUnit struct {
+	quantity      string
+	scale, offset float64
+	senml         string // SenML unit symbol (RFC 8428, RFC 8798), if any
+}
+
+// engineeringUnits are the units conversion is supported for, by symbol.
+var engineeringUnits = map[string]engineeringUnit{
+	"°C":    {"temperature", 1, 0, "Cel"},
+	"°F":    {"temperature", 5.0 / 9, -32 * 5.0 / 9, ""},
+	"K":     {"temperature", 1, -273.15, "K"},
+	"bar":   {"pressure", 1e5, 0, "bar"},
+	"mbar":  {"pressure", 100, 0, ""},
+	"Pa":    {"pressure", 1, 0, "Pa"},
+	"hPa":   {"pressure", 100, 0, "hPa"},
+	"kPa":   {"pressure", 1e3, 0, "kPa"},
+	"psi":   {"pressure", 6894.757293168, 0, ""},
+	"%RH":   {"humidity", 1, 0, "%RH"},
+	"V":     {"voltage", 1, 0, "V"},
+	"mV":    {"voltage", 1e-3, 0, "mV"},
+	"A":     {"current", 1, 0, "A"},
+	"mA":    {"current", 1e-3, 0, "mA"},
+	"m":     {"length", 1, 0, "m"},
+	"mm":    {"length", 1e-3, 0, "mm"},
+	"ft":    {"length", 0.3048, 0, ""},
+	"m3/s":  {"flow", 1, 0, "m3/s"},
+	"l/s":   {"flow", 1e-3, 0, "l/s"},
+	"l/min": {"flow", 1e-3 / 60, 0, ""},
+	"m3/h":  {"flow", 1.0 / 3600, 0, ""},
+	"gpm":   {"flow", 3.785411784e-3 / 60, 0, ""},
+	"rpm":   {"rotation", 1, 0, ""},
+	"Hz":    {"frequency", 1, 0, "Hz"},
+}
+
+// unitAliases are alternative spellings of unit symbols.
+var unitAliases = map[string]string{
+	"C":    "°C",
+	"degC": "°C",
+	"Cel":  "°C",
+	"F":    "°F",
+	"degF": "°F",
+	"RH":   "%RH",
+}
+
+// defaultChannelUnits are the units of the built-in channels.
+var defaultChannelUnits = map[string]string{
+	"temperature": "°C",
+	"pressure":    "bar",
+	"humidity":    "%RH",
+}
+
+// canonicalUnit returns the standard symbol of a unit.
+func canonicalUnit(unit string) string {
+	if symbol, ok := unitAliases[unit]; ok {
+		return symbol
+	}
+	return unit
+}
+
+// channelUnits returns the unit a channel's generators produce values in,
+// channels.<channel>.unit or the built-in channel's unit, and the unit its
+// readings are reported in, channels.<channel>.convert-to if set. Units
+// without conversion are reported as configured, as metadata only.
+func channelUnits(channel string) (unit, reported string, err error) {
+	key := "channels." + channel
+	unit = defaultChannelUnits[channel]
+	if viper.IsSet(key + ".unit") {
+		unit = viper.GetString(key + ".unit")
+	}
+	unit = canonicalUnit(unit)
+	reported = unit
+	if target := viper.GetString(key + ".convert-to"); target != "" {
+		reported = canonicalUnit(target)
+		if _, err := unitConverter(unit, reported); err != nil {
+			return "", "", fmt.Errorf("channel %s: %w", channel, err)
+		}
+	}
+	return unit, reported, nil
+}
+
+// unitConverter returns a function converting values from one unit to
+// another of the same quantity.
+func unitConverter(from, to string) (func(float64) float64, error) {
+	if from == to {
+		return func(v float64) float64 { return v }, nil
+	}
+	src, ok := engineeringUnits[from]
+	if !ok {
+		return nil, fmt.Errorf("cannot convert from unknown unit %q", from)
+	}
+	dst, ok := engineeringUnits[to]
+	if !ok {
+		return nil, fmt.Errorf("cannot convert to unknown unit %q", to)
+	}
+	if src.quantity != dst.quantity {
+		return nil, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, src.quantity, to, dst.quantity)
+	}
+	return func(v float64) float64 {
+		converted := (v*src.scale + src.offset - dst.offset) / dst.scale
+		// Drop the rounding noise that conversion factors leave behind.
+		return math.Round(converted*1e9) / 1e9
+	}, nil
+}
+
+// senmlUnit returns the SenML symbol for a reading's unit. Units without
+// a SenML symbol are passed through; readings without a unit fall back to
+// the unit of their built-in channel.
+func senmlUnit(r Reading) string {
+	unit := r.Unit
+	if unit == "" {
+		unit = defaultChannelUnits[r.Channel]
+	}
+	if u, ok := engineeringUnits[canonicalUnit(unit)]; ok && u.senml != "" {
+		return u.senml
+	}
+	return unit
+}
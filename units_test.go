@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestUnitConverter(t *testing.T) {
+	tests := []struct {
+		from, to  string
+		value     float64
+		converted float64
+	}{
+		{"°C", "°F", 100, 212},
+		{"°F", "°C", -40, -40},
+		{"°C", "K", 25, 298.15},
+		{"bar", "psi", 1, 14.503773773},
+		{"bar", "kPa", 1.2, 120},
+		{"l/min", "m3/h", 60, 3.6},
+		{"V", "V", 230, 230},
+	}
+	for _, tt := range tests {
+		convert, err := unitConverter(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("%s to %s: %v", tt.from, tt.to, err)
+		}
+		if got := convert(tt.value); !approxEqual(got, tt.converted) {
+			t.Errorf("Expected %g %s to be %g %s, got %g", tt.value, tt.from, tt.converted, tt.to, got)
+		}
+	}
+
+	for _, pair := range [][2]string{{"°C", "bar"}, {"furlong", "m"}, {"m", "cubit"}} {
+		if _, err := unitConverter(pair[0], pair[1]); err == nil {
+			t.Errorf("Expected an error converting %s to %s", pair[0], pair[1])
+		}
+	}
+}
+
+func TestSensorUnitConversion(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+
+	constantGenerator("temperature", 20)
+	viper.Set("channels.temperature.convert-to", "degF")
+	viper.Set("channels.humidity.unit", "RH")
+
+	sensor, err := newSimulatedSensor(0)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	signals.watch(sensor.info.ID, time.Minute)
+	now := time.Now()
+	reading := sensor.sample(now, 1)
+	if reading.Value != 68 || reading.Unit != "°F" {
+		t.Errorf("Expected 68 °F, got %g %s", reading.Value, reading.Unit)
+	}
+	if v, _ := signals.valueAt(sensor.info.ID, now); v != 20 {
+		t.Errorf("Expected other sensors to see the unconverted value, got %g", v)
+	}
+
+	pressure, err := newSimulatedSensor(1)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if unit := pressure.sample(now, 1).Unit; unit != "bar" {
+		t.Errorf("Expected the built-in pressure unit, got %q", unit)
+	}
+	humidity, err := newSimulatedSensor(2)
+	if err != nil {
+		t.Fatalf("Error creating sensor: %v", err)
+	}
+	if unit := humidity.sample(now, 1).Unit; unit != "%RH" {
+		t.Errorf("Expected the canonical humidity unit, got %q", unit)
+	}
+
+	viper.Set("channels.temperature.convert-to", "psi")
+	if _, err := newSimulatedSensor(0); err == nil {
+		t.Errorf("Expected an error converting a temperature to psi")
+	}
+}
+
+func TestSenMLUnit(t *testing.T) {
+	for _, tt := range []struct {
+		r    Reading
+		want string
+	}{
+		{Reading{SensorData: SensorData{Channel: "temperature"}}, "Cel"},
+		{Reading{SensorData: SensorData{Channel: "temperature", Unit: "K"}}, "K"},
+		{Reading{SensorData: SensorData{Channel: "pressure", Unit: "psi"}}, "psi"},
+		{Reading{SensorData: SensorData{Channel: "vibration"}}, ""},
+	} {
+		if got := senmlUnit(tt.r); got != tt.want {
+			t.Errorf("%+v: expected SenML unit %q, got %q", tt.r.SensorData, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// configKeys are the known top-level config keys.
+var configKeys = []string{
+	"config", "include", "profile", "profiles", "watch-config", "tui", "duration", "max-messages", "control", "scenario", "seed", "plugins", "num-sensors", "min-rate", "max-rate",
+	"ramp-up", "sensors-per-diu", "naming", "metadata", "registry", "channel-assignment", "channel-names", "channels", "sensors", "inventory", "models", "sites", "dius", "derived", "derived-interval",
+	"plant", "correlated-noise", "environment", "battery", "clock", "jitter", "quality", "anomalies",
+	"sinks", "topic-prefix", "redis", "redis-kv", "redis-hash", "sse", "serial", "syslog", "stomp", "grpc", "pulsar", "failover",
+	"diu-frame", "payload-format", "payload-template", "payload-template-file", "payload-template-content-type",
+	"envelope", "instance-id", "compression", "compression-marker", "cloudevents", "batch",
+}
+
+// channelConfigKeys are the known keys of channels.<channel>.
+var channelConfigKeys = []string{
+	"min", "max", "weight", "count", "metadata", "unit", "convert-to", "kind", "distribution", "enum", "messages", "boolean-format",
+	"generator", "modifiers", "rate", "min-rate", "max-rate", "rate-profile", "rate-schedule", "jitter",
+}
+
+// sensorConfigKeys are the known keys of sensors.<id>.
+var sensorConfigKeys = []string{
+	"channel", "diu", "site", "min", "max", "metadata",
+	"generator", "modifiers", "rate", "min-rate", "max-rate", "rate-profile", "rate-schedule", "jitter",
+}
+
+// validationIssue is a problem found in the config, at the setting Path
+// in File at Line, as far as they are known.
+type validationIssue struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i validationIssue) String() string {
+	var b strings.Builder
+	if i.File != "" {
+		b.WriteString(i.File)
+		if i.Line > 0 {
+			fmt.Fprintf(&b, ":%d", i.Line)
+		}
+		b.WriteString(": ")
+	}
+	if i.Path != "" {
+		b.WriteString(i.Path + ": ")
+	}
+	b.WriteString(i.Message)
+	return b.String()
+}
+
+// validationReport collects the problems found in the config.
+type validationReport struct {
+	errors   []validationIssue
+	warnings []validationIssue
+}
+
+func (r *validationReport) errorf(format string, args ...any) {
+	r.errors = append(r.errors, validationIssue{Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *validationReport) warnf(format string, args ...any) {
+	r.warnings = append(r.warnings, validationIssue{Message: fmt.Sprintf(format, args...)})
+}
+
+// check records err as an error, if it is one.
+func (r *validationReport) check(err error) {
+	if err != nil {
+		r.errorf("%v", err)
+	}
+}
+
+// print writes the report, ending with a summary.
+func (r *validationReport) print(w io.Writer) {
+	for _, e := range r.errors {
+		fmt.Fprintf(w, "error: %s\n", e)
+	}
+	for _, warning := range r.warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	if len(r.errors) == 0 {
+		fmt.Fprintf(w, "Config is valid (%d warnings)\n", len(r.warnings))
+	} else {
+		fmt.Fprintf(w, "Config is invalid: %d errors, %d warnings\n", len(r.errors), len(r.warnings))
+	}
+}
+
+// printJSON writes the report as a JSON object, for tools: whether the
+// config is valid, and the errors and warnings with their files, lines
+// and paths where they are known.
+func (r *validationReport) printJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Valid    bool              `json:"valid"`
+		Errors   []validationIssue `json:"errors"`
+		Warnings []validationIssue `json:"warnings"`
+	}{len(r.errors) == 0, append([]validationIssue{}, r.errors...), append([]validationIssue{}, r.warnings...)})
+}
+
+// runValidate validates the config, prints the report to w, as text or
+// with asJSON as JSON, and returns the exit status: 1 if there are
+// errors, or with strict warnings, else 0.
+func runValidate(w io.Writer, numSensors int, minRate, maxRate float64, ping, strict, asJSON bool) int {
+	r := validateConfig(numSensors, minRate, maxRate, ping)
+	if asJSON {
+		if err := r.printJSON(w); err != nil {
+			log.Printf("Error writing report: %v", err)
+		}
+	} else {
+		r.print(w)
+	}
+	if len(r.errors) > 0 || strict && len(r.warnings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// validateConfig checks the loaded config without starting the simulation:
+// it checks the config files against the config schema (see configSchema),
+// reports unknown keys, sets up the plugins, topology, scenario and all
+// sensors as a run would, and checks the rates, sensor IDs and sinks. With
+// ping, the sinks are also set up, connecting to the servers they
+// connect to, and Redis is pinged.
+func validateConfig(numSensors int, minRate, maxRate float64, ping bool) *validationReport {
+	r := &validationReport{}
+	for _, file := range configFiles() {
+		issues, err := checkConfigFile(file)
+		r.check(err)
+		r.errors = append(r.errors, issues...)
+	}
+	checkKeys(r, viper.AllSettings(), configKeys, "")
+	for channel, block := range viper.GetStringMap("channels") {
+		// Channels naming a distribution take its parameters as well.
+		if _, ok := cast.ToStringMap(block)["distribution"]; ok {
+			continue
+		}
+		checkKeys(r, cast.ToStringMap(block), channelConfigKeys, "channels."+channel+".")
+	}
+	for id, block := range viper.GetStringMap("sensors") {
+		checkKeys(r, cast.ToStringMap(block), sensorConfigKeys, "sensors."+id+".")
+	}
+
+	if minRate <= 0 || maxRate <= 0 {
+		r.errorf("min-rate and max-rate must be greater than 0")
+	} else if minRate > maxRate {
+		r.errorf("min-rate cannot be greater than max-rate")
+	}
+	if viper.GetFloat64("ramp-up.rate") < 0 {
+		r.errorf("ramp-up.rate must not be negative")
+	}
+	for _, channel := range channelNames() {
+		if min, max := channelRange(channel); min > max {
+			r.errorf("channel %s: min %g is greater than max %g", channel, min, max)
+		}
+		if weight := viper.GetFloat64("channels." + channel + ".weight"); weight < 0 {
+			r.errorf("channel %s: weight %g is negative", channel, weight)
+		}
+		if count := viper.GetInt("channels." + channel + ".count"); count < 0 {
+			r.errorf("channel %s: count %d is negative", channel, count)
+		}
+	}
+
+	r.check(loadPlugins())
+	r.check(checkNaming())
+	r.check(checkChannelAssignment())
+	r.check(loadTopology())
+	if file := viper.GetString("scenario"); file != "" {
+		events, err := loadScenario(file)
+		r.check(err)
+		scenario = events
+	}
+
+	// Set up every sensor as a run would, to find misconfigured
+	// generators, modifiers, rates and batteries, and IDs used twice.
+	ids := make(map[string]bool)
+	for i := 0; i < numSensors; i++ {
+		ids[bulkSensorID(i)] = true
+		_, err := newSimulatedSensor(i)
+		r.check(err)
+	}
+	defined := definedSensorIDs(numSensors)
+	for i, id := range defined {
+		ids[id] = true
+		_, err := newConfiguredSensor(numSensors+i, id, "")
+		r.check(err)
+	}
+	for _, item := range cast.ToSlice(viper.Get("derived")) {
+		if id := cast.ToString(cast.ToStringMap(item)["id"]); ids[id] {
+			r.errorf("derived sensor %s has the ID of a simulated sensor", id)
+		}
+	}
+	_, err := newDerivedSensors(numSensors + len(defined))
+	r.check(err)
+	if numSensors+len(defined) == 0 {
+		r.warnf("no sensors are simulated")
+	}
+
+	sinks := configList("sinks")
+	if len(sinks) == 0 {
+		r.errorf("no sinks configured")
+	}
+	labels := viper.GetString("anomalies.labels")
+	embedLabels := labels == "" || labels == "embed" || labels == "both"
+	for _, name := range sinks {
+		if _, ok := sinkTypes[name]; !ok {
+			r.errorf("unknown sink %q", name)
+			continue
+		}
+		if name != "grpc" && name != "failover" {
+			if _, err := newEncoder(name, headerSinks[name]); err != nil {
+				r.errorf("sink %s: %v", name, err)
+			}
+			if format := payloadFormat(name); embedLabels && slices.Contains(unlabelledFormats, format) {
+				r.errorf("sink %s: the %s payload format cannot carry anomaly labels (set anomalies.labels to stream or none)", name, format)
+			}
+		}
+	}
+	if ping && len(r.errors) == 0 {
+		pingSinks(r, sinks)
+	}
+	sortIssues(r.errors)
+	sortIssues(r.warnings)
+	return r
+}
+
+// checkKeys reports the keys of a config block that are not known.
+func checkKeys(r *validationReport, block map[string]any, known []string, prefix string) {
+	for key := range block {
+		found := false
+		for _, k := range known {
+			found = found || k == key
+		}
+		if !found {
+			r.warnf("unknown key %s%s", prefix, key)
+		}
+	}
+}
+
+// pingSinks sets up the sinks, connecting to their servers, and pings
+// Redis if a Redis sink is used.
+func pingSinks(r *validationReport, sinks []string) {
+	sink, err := setupSinks()
+	if err != nil {
+		r.errorf("setting up sinks: %v", err)
+		return
+	}
+	defer sink.Close()
+	for _, name := range sinks {
+		if name == "redis" || name == "redis-kv" || name == "redis-hash" {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := setupRedisClient().Ping(ctx).Err(); err != nil {
+				r.errorf("pinging Redis at %s: %v", viper.GetString("redis.addr"), err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestFlagConfigKeysAreKnown(t *testing.T) {
+	for flag, key := range flagConfigKeys {
+		if top, _, _ := strings.Cut(key, "."); !slices.Contains(configKeys, top) {
+			t.Errorf("Flag --%s sets %s, which validate reports as unknown", flag, key)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	resetBatteries(t)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	viper.Set("sinks", "syslog")
+	viper.Set("sensors.inlet_temp", map[string]any{"channel": "temperature"})
+
+	var out bytes.Buffer
+	if code := runValidate(&out, 2, 1, 5, false, false, false); code != 0 {
+		t.Fatalf("Expected a valid config, got exit status %d:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Config is valid (0 warnings)") {
+		t.Errorf("Expected a valid report, got:\n%s", out.String())
+	}
+
+	viper.Set("sensors.inlet_temp.colour", "red")
+	viper.Set("unknown-setting", 1)
+	out.Reset()
+	if code := runValidate(&out, 2, 1, 5, false, false, false); code != 0 {
+		t.Errorf("Expected unknown keys to only warn, got exit status %d", code)
+	}
+	for _, want := range []string{"warning: unknown key sensors.inlet_temp.colour", "warning: unknown key unknown-setting"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the report, got:\n%s", want, out.String())
+		}
+	}
+	if code := runValidate(&out, 2, 1, 5, false, true, false); code != 1 {
+		t.Errorf("Expected warnings to fail with strict, got exit status %d", code)
+	}
+}
+
+func TestValidateConfigErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	resetBatteries(t)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	viper.Set("sinks", "syslog,carrier-pigeon")
+	viper.Set("syslog.payload-format", "diu-frame")
+	viper.Set("channels.pressure", map[string]any{"min": 10, "max": 5})
+	viper.Set("channels.humidity.generator", map[string]any{"type": "no-such-generator"})
+	viper.Set("derived", []any{map[string]any{"id": "sensor_000", "expression": "1"}})
+
+	r := validateConfig(3, 5, 1, false)
+	wants := []string{
+		"min-rate cannot be greater than max-rate",
+		"channel pressure: min 10 is greater than max 5",
+		"no-such-generator",
+		"derived sensor sensor_000 has the ID of a simulated sensor",
+		`unknown sink "carrier-pigeon"`,
+		"sink syslog: the diu-frame payload format cannot carry anomaly labels",
+	}
+	report := fmt.Sprint(r.errors)
+	for _, want := range wants {
+		if !strings.Contains(report, want) {
+			t.Errorf("Expected an error containing %q, got:\n%s", want, report)
+		}
+	}
+
+	var out bytes.Buffer
+	if code := runValidate(&out, 3, 5, 1, false, false, false); code != 1 {
+		t.Errorf("Expected exit status 1, got %d", code)
+	}
+	if !strings.Contains(out.String(), "Config is invalid: ") {
+		t.Errorf("Expected an invalid report, got:\n%s", out.String())
+	}
+}
+
+func TestValidateConfigPing(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	resetBatteries(t)
+	saved := signals
+	signals = newSignalBus()
+	t.Cleanup(func() { signals = saved })
+	viper.Set("sinks", "redis")
+	viper.Set("redis.addr", "127.0.0.1:1")
+
+	r := validateConfig(1, 1, 5, false)
+	if len(r.errors) != 0 {
+		t.Fatalf("Expected no errors without ping, got %v", r.errors)
+	}
+	r = validateConfig(1, 1, 5, true)
+	if len(r.errors) == 0 || !strings.Contains(r.errors[0].String(), "127.0.0.1:1") {
+		t.Errorf("Expected the unreachable Redis reported, got %v", r.errors)
+	}
+}